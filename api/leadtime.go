@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/leadtime"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/restriction"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+// leadTimeKey builds the resolver key of a customer, goods and warehouse,
+// reading separately_fg from the goods master
+func leadTimeKey(customer, goods, warehouse string) (leadtime.Key, error) {
+	k := leadtime.Key{Customer: customer, Goods: goods, Warehouse: warehouse}
+	if goods == "" {
+		return k, nil
+	}
+	g, err := services.Store.Goods.Get(goods)
+	if err != nil {
+		return k, fmt.Errorf("goods %q: %w", goods, err)
+	}
+	k.SeparatelyFg = g.SeparatelyFg
+	return k, nil
+}
+
+// previewLeadTime handles GET /lead-time/preview. It returns the arrival
+// date for customer, goods, warehouse and delivery_dt together with the
+// rule that was applied and every other rule that matched.
+func previewLeadTime(c *gin.Context) {
+	deliveryDt, err := civil.Parse(c.Query("delivery_dt"))
+	if err != nil {
+		badRequest(c, errors.New("delivery_dt must be YYYY-MM-DD"))
+		return
+	}
+	k, err := leadTimeKey(c.Query("customer"), c.Query("goods"), c.Query("warehouse"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	arrivalDt, d := services.LeadTime.ArrivalDt(services.Calendar, k, deliveryDt.Time())
+	c.JSON(http.StatusOK, gin.H{
+		"customer":      k.Customer,
+		"goods":         k.Goods,
+		"warehouse":     k.Warehouse,
+		"separately_fg": k.SeparatelyFg,
+		"delivery_dt":   deliveryDt,
+		"arrival_dt":    civil.DateOf(arrivalDt),
+		"decision":      d,
+	})
+}
+
+// salesRequest is the body of POST /sales and PUT /sales/:sales.
+// OverrideReason lets an administrator order goods not assigned to the
+// customer.
+type salesRequest struct {
+	Class             int        `json:"class"`
+	Customer          string     `json:"customer" binding:"required"`
+	Name              string     `json:"name"`
+	Goods             string     `json:"goods" binding:"required"`
+	Qty               string     `json:"qty" binding:"required"`
+	ShipAddr          string     `json:"ship_addr"`
+	CarsTank          string     `json:"cars_tank"`
+	OutgoingWarehouse string     `json:"outgoing_warehouse"`
+	DeliveryDt        civil.Date `json:"delivery_dt"`
+	ArrivalDt         civil.Date `json:"arrival_dt"`
+	Remark            string     `json:"remark"`
+	OverrideReason    string     `json:"override_reason"`
+}
+
+// createSales handles POST /sales. arrival_dt is resolved from the lead-time
+// rules when the request leaves it empty. The sales, the reservation of its
+// quantity in the outgoing warehouse and its override are written in one
+// transaction.
+func createSales(c *gin.Context) {
+	var req salesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	if req.DeliveryDt.IsZero() {
+		badRequest(c, errors.New("delivery_dt is required"))
+		return
+	}
+	qty, err := scan.ParseQty(req.Qty)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	s := &repository.Sales{
+		Class:             req.Class,
+		Customer:          req.Customer,
+		Name:              req.Name,
+		Goods:             req.Goods,
+		Qty:               qty,
+		ShipAddr:          req.ShipAddr,
+		CarsTank:          req.CarsTank,
+		OutgoingWarehouse: req.OutgoingWarehouse,
+		DeliveryDt:        req.DeliveryDt,
+		ArrivalDt:         req.ArrivalDt,
+		Remark:            req.Remark,
+	}
+
+	var decision *leadtime.Decision
+	if s.ArrivalDt.IsZero() {
+		k, err := leadTimeKey(s.Customer, s.Goods, s.OutgoingWarehouse)
+		if err != nil {
+			badRequest(c, err)
+			return
+		}
+		arrivalDt, d := services.LeadTime.ArrivalDt(services.Calendar, k, s.DeliveryDt.Time())
+		s.ArrivalDt = civil.DateOf(arrivalDt)
+		decision = &d
+	}
+
+	by, ok := overrideBy(c, req.OverrideReason)
+	if !ok {
+		return
+	}
+	override, err := checker().Check(s, restriction.ActionCreate, by)
+	if err != nil {
+		restrictionFail(c, err)
+		return
+	}
+	var id int64
+	err = services.Store.Tx(func(tx *repository.Store) error {
+		var err error
+		if id, err = tx.Sales.Create(s); err != nil {
+			return err
+		}
+		if err := (&ledger.Ledger{Store: tx}).Reserve(s, sessionUser(c)); err != nil {
+			return err
+		}
+		return (&restriction.Checker{Store: tx}).Record(override, id)
+	})
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"sales": id, "arrival_dt": s.ArrivalDt, "lead_time": decision, "override": overrideJSON(override)})
+}
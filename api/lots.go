@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/lot"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/tank"
+)
+
+// lotRequest is the body of PUT /sales/:sales/lots. Slots with an id fill
+// the existing slots; without ids the slots replace the split.
+type lotRequest struct {
+	Slots []struct {
+		ID   int64  `json:"id"`
+		Lot  string `json:"lot"`
+		Tank string `json:"tank"`
+		Qty  string `json:"qty"`
+	} `json:"slots" binding:"required"`
+}
+
+func allocator() *lot.Allocator {
+	return &lot.Allocator{Store: services.Store}
+}
+
+func salesParam(c *gin.Context) (int64, bool) {
+	sales, err := strconv.ParseInt(c.Param("sales"), 10, 64)
+	if err != nil {
+		badRequest(c, errors.New("sales must be a number"))
+		return 0, false
+	}
+	return sales, true
+}
+
+// lotFail maps the errors of lot.Allocator to a status
+func lotFail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		fail(c, http.StatusNotFound, err)
+	case errors.Is(err, lot.ErrAssigned):
+		fail(c, http.StatusConflict, err)
+	case errors.Is(err, lot.ErrQtyMismatch), errors.Is(err, lot.ErrUnknownSlot), errors.Is(err, lot.ErrUnknownTank),
+		errors.Is(err, tank.ErrOverfill), errors.Is(err, tank.ErrGoodsNotAllowed):
+		fail(c, http.StatusUnprocessableEntity, err)
+	default:
+		fail(c, http.StatusInternalServerError, err)
+	}
+}
+
+func lotSummaryJSON(sum *lot.Summary) gin.H {
+	slots := make([]gin.H, 0, len(sum.Slots))
+	for _, s := range sum.Slots {
+		slots = append(slots, gin.H{"id": s.ID, "slot": s.Slot, "lot": s.Lot, "tank": s.Tank, "qty": s.Qty.String()})
+	}
+	byTank := make(map[string]map[string]string, len(sum.ByTank))
+	for tank, lots := range sum.ByTank {
+		byTank[tank] = make(map[string]string, len(lots))
+		for l, qty := range lots {
+			byTank[tank][l] = qty.String()
+		}
+	}
+	return gin.H{
+		"sales":     sum.Sales,
+		"goods":     sum.Goods,
+		"ordered":   sum.Ordered.String(),
+		"allocated": sum.Allocated.String(),
+		"complete":  sum.Complete,
+		"slots":     slots,
+		"by_tank":   byTank,
+	}
+}
+
+// getLots handles GET /sales/:sales/lots
+func getLots(c *gin.Context) {
+	sales, ok := salesParam(c)
+	if !ok {
+		return
+	}
+	sum, err := allocator().Summary(sales)
+	if err != nil {
+		lotFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, lotSummaryJSON(sum))
+}
+
+// makeLotSpace handles POST /sales/:sales/lots/space. ?single=1 makes one
+// slot for the whole quantity instead of one per goods unit.
+func makeLotSpace(c *gin.Context) {
+	sales, ok := salesParam(c)
+	if !ok {
+		return
+	}
+	makeSpace := allocator().MakeSpace
+	if c.Query("single") == "1" {
+		makeSpace = allocator().MakeSpaceSingle
+	}
+	sum, err := makeSpace(sales, sessionUser(c))
+	if err != nil {
+		lotFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, lotSummaryJSON(sum))
+}
+
+// putLots handles PUT /sales/:sales/lots
+func putLots(c *gin.Context) {
+	sales, ok := salesParam(c)
+	if !ok {
+		return
+	}
+	var req lotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	as := make([]lot.Assignment, 0, len(req.Slots))
+	update := len(req.Slots) > 0
+	for _, s := range req.Slots {
+		qty, err := scan.ParseQty(s.Qty)
+		if err != nil {
+			badRequest(c, err)
+			return
+		}
+		as = append(as, lot.Assignment{Slot: s.ID, Lot: s.Lot, Tank: s.Tank, Qty: qty})
+		if s.ID == 0 {
+			update = false
+		}
+	}
+
+	var sum *lot.Summary
+	var err error
+	if update {
+		sum, err = allocator().Assign(sales, as, sessionUser(c))
+	} else {
+		sum, err = allocator().Allocate(sales, as, sessionUser(c))
+	}
+	if err != nil {
+		lotFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, lotSummaryJSON(sum))
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/schedule"
+)
+
+// occurrenceRequest is the body of the skip and reschedule endpoints
+type occurrenceRequest struct {
+	DeliveryDt civil.Date `json:"delivery_dt"`
+	Qty        string     `json:"qty"`
+	Reason     string     `json:"reason"`
+}
+
+func occurrences() *schedule.Occurrences {
+	return &schedule.Occurrences{Store: services.Store, Calendar: services.Calendar}
+}
+
+// occurrenceParams reads the :repeat and :date path parameters
+func occurrenceParams(c *gin.Context) (int64, civil.Date, bool) {
+	repeat, err := strconv.ParseInt(c.Param("repeat"), 10, 64)
+	if err != nil {
+		badRequest(c, errors.New("repeat must be a number"))
+		return 0, civil.Date{}, false
+	}
+	d, err := civil.Parse(c.Param("date"))
+	if err != nil {
+		badRequest(c, errors.New("date must be YYYY-MM-DD"))
+		return 0, civil.Date{}, false
+	}
+	return repeat, d, true
+}
+
+// occurrenceFail maps the errors of schedule.Occurrences to a status
+func occurrenceFail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		fail(c, http.StatusNotFound, err)
+	case errors.Is(err, schedule.ErrConfirmed), errors.Is(err, schedule.ErrNotExcluded):
+		fail(c, http.StatusConflict, err)
+	case errors.Is(err, schedule.ErrNotOccurrence), errors.Is(err, schedule.ErrDateTaken), errors.Is(err, schedule.ErrWindow):
+		badRequest(c, err)
+	default:
+		fail(c, http.StatusInternalServerError, err)
+	}
+}
+
+func exclusionJSON(e *repository.Exclusion) gin.H {
+	h := gin.H{
+		"sales":           e.Sales,
+		"delivery_dt":     e.DeliveryDt,
+		"status":          e.Type.String(),
+		"reason":          e.Reason,
+		"new_delivery_dt": e.NewDeliveryDt,
+		"upuser":          e.Upuser,
+	}
+	if e.NewQty != 0 {
+		h["new_qty"] = e.NewQty.String()
+	}
+	return h
+}
+
+// listOccurrences handles GET /repeats/:repeat/occurrences?sdt=&edt=
+func listOccurrences(c *gin.Context) {
+	repeat, err := strconv.ParseInt(c.Param("repeat"), 10, 64)
+	if err != nil {
+		badRequest(c, errors.New("repeat must be a number"))
+		return
+	}
+	w, err := schedule.ParseWindow(c.Query("sdt"), c.Query("edt"), 0)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	list, err := occurrences().List(repeat, w)
+	if err != nil {
+		occurrenceFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"repeat": repeat, "occurrences": list})
+}
+
+// skipOccurrence handles POST /repeats/:repeat/occurrences/:date/skip
+func skipOccurrence(c *gin.Context) {
+	repeat, d, ok := occurrenceParams(c)
+	if !ok {
+		return
+	}
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	var req occurrenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	e, err := occurrences().Skip(repeat, d, req.Reason, user)
+	if err != nil {
+		occurrenceFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, exclusionJSON(e))
+}
+
+// rescheduleOccurrence handles POST /repeats/:repeat/occurrences/:date/reschedule.
+// delivery_dt and qty are the new values; either may be left empty.
+func rescheduleOccurrence(c *gin.Context) {
+	repeat, d, ok := occurrenceParams(c)
+	if !ok {
+		return
+	}
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	var req occurrenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	var qty scan.Qty
+	if req.Qty != "" {
+		var err error
+		if qty, err = scan.ParseQty(req.Qty); err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	e, err := occurrences().Reschedule(repeat, d, req.DeliveryDt, qty, req.Reason, user)
+	if err != nil {
+		occurrenceFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, exclusionJSON(e))
+}
+
+// restoreOccurrence handles POST /repeats/:repeat/occurrences/:date/restore
+func restoreOccurrence(c *gin.Context) {
+	repeat, d, ok := occurrenceParams(c)
+	if !ok {
+		return
+	}
+	if err := occurrences().Restore(repeat, d); err != nil {
+		occurrenceFail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+func TestSkipByUser(t *testing.T) {
+	store := repository.NewMemory()
+	r := withStore(t, store)
+	sales, err := store.Sales.Create(&repository.Sales{Customer: "C1", Goods: "101", Qty: scan.NewQty(1), RepeatFg: true, DeliveryDt: civil.MustParse("2026-10-19")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Repeats.Save(&repository.Repeat{Sales: sales, Period: 1, RepeatSDt: civil.MustParse("2026-10-19"), RepeatEDt: civil.MustParse("2026-12-31")}); err != nil {
+		t.Fatal(err)
+	}
+
+	skip := func(header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/repeats/1/occurrences/2026-10-26/skip", strings.NewReader(`{"reason": "holiday"}`))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	services.Sessions = adminSessions
+	if w := skip(map[string]string{"X-User": "boss"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("skip without a session: %d %s, want 401", w.Code, w.Body)
+	}
+	if w := skip(map[string]string{"Authorization": "Bearer clerk", "X-User": "boss"}); w.Code != http.StatusOK {
+		t.Fatalf("skip by clerk: %d %s, want 200", w.Code, w.Body)
+	}
+	e, err := store.Exclusions.Get(sales, civil.MustParse("2026-10-26"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Upuser != "clerk" {
+		t.Errorf("skip recorded by %q, want clerk", e.Upuser)
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/projection"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/schedule"
+)
+
+// thresholdRequest is the body of PUT /stock/thresholds
+type thresholdRequest struct {
+	Goods     string `json:"goods" binding:"required"`
+	Warehouse string `json:"warehouse" binding:"required"`
+	MinQty    string `json:"min_qty" binding:"required"`
+	TargetQty string `json:"target_qty"`
+}
+
+func thresholdJSON(t *repository.StockThreshold) gin.H {
+	return gin.H{
+		"goods":      t.Goods,
+		"warehouse":  t.Warehouse,
+		"min_qty":    t.MinQty.String(),
+		"target_qty": t.TargetQty.String(),
+		"updt":       t.Updt,
+		"upuser":     t.Upuser,
+	}
+}
+
+func projectionJSON(p *projection.Projection) gin.H {
+	days := make([]gin.H, 0, len(p.Days))
+	for _, d := range p.Days {
+		days = append(days, gin.H{"date": d.Date, "demand": d.Demand.String(), "balance": d.Balance.String()})
+	}
+	suggestions := make([]gin.H, 0, len(p.Suggestions))
+	for _, s := range p.Suggestions {
+		h := gin.H{"kind": s.Kind, "qty": s.Qty.String(), "needed_by": s.NeededBy}
+		if s.From != "" {
+			h["from"] = s.From
+		}
+		suggestions = append(suggestions, h)
+	}
+	h := gin.H{
+		"goods":       p.Goods,
+		"warehouse":   p.Warehouse,
+		"on_hand":     p.OnHand.String(),
+		"reserved":    p.Reserved.String(),
+		"in_transit":  p.InTransit.String(),
+		"scheduled":   p.Scheduled.String(),
+		"start":       p.Start().String(),
+		"min_qty":     p.MinQty.String(),
+		"target_qty":  p.TargetQty.String(),
+		"lowest":      p.Lowest.String(),
+		"lowest_dt":   p.LowestDt,
+		"low":         p.Low(),
+		"days":        days,
+		"suggestions": suggestions,
+	}
+	if !p.BelowDt.IsZero() {
+		h["below_dt"] = p.BelowDt
+	}
+	if !p.StockoutDt.IsZero() {
+		h["stockout_dt"] = p.StockoutDt
+	}
+	return h
+}
+
+// stockProjection handles GET /stock/projection?days=&goods=&warehouse=.
+// ?low=1 returns only the goods that fall below their minimum; ?today=
+// projects from another date than today.
+func stockProjection(c *gin.Context) {
+	p := &projection.Projector{Store: services.Store, Calendar: services.Calendar}
+	if s := c.Query("days"); s != "" {
+		days, err := strconv.Atoi(s)
+		if err != nil || days < 1 || days > schedule.DefaultMaxDays {
+			badRequest(c, fmt.Errorf("days must be a number from 1 to %d", schedule.DefaultMaxDays))
+			return
+		}
+		p.Days = days
+	}
+	today := civil.Today()
+	if s := c.Query("today"); s != "" {
+		var err error
+		if today, err = civil.Parse(s); err != nil {
+			badRequest(c, errors.New("today must be YYYY-MM-DD"))
+			return
+		}
+	}
+
+	rpt, err := p.Run(today, projection.Filter{Goods: c.Query("goods"), Warehouse: c.Query("warehouse")})
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	list := rpt.Projections
+	if c.Query("low") == "1" {
+		list = rpt.Low()
+	}
+	ret := make([]gin.H, 0, len(list))
+	for _, pr := range list {
+		ret = append(ret, projectionJSON(pr))
+	}
+	c.JSON(http.StatusOK, gin.H{"from": rpt.From, "to": rpt.To, "projections": ret})
+}
+
+// listThresholds handles GET /stock/thresholds?goods=&warehouse=
+func listThresholds(c *gin.Context) {
+	list, err := services.Store.Thresholds.List(c.Query("goods"), c.Query("warehouse"))
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	ret := make([]gin.H, 0, len(list))
+	for _, t := range list {
+		ret = append(ret, thresholdJSON(t))
+	}
+	c.JSON(http.StatusOK, gin.H{"thresholds": ret})
+}
+
+// saveThreshold handles PUT /stock/thresholds
+func saveThreshold(c *gin.Context) {
+	var req thresholdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	t := &repository.StockThreshold{Goods: req.Goods, Warehouse: req.Warehouse, Upuser: c.GetHeader("X-User")}
+	var err error
+	if t.MinQty, err = scan.ParseQty(req.MinQty); err != nil {
+		badRequest(c, err)
+		return
+	}
+	if req.TargetQty != "" {
+		if t.TargetQty, err = scan.ParseQty(req.TargetQty); err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	if t.MinQty < 0 || t.TargetQty < 0 {
+		badRequest(c, errors.New("min_qty and target_qty must not be negative"))
+		return
+	}
+	if t.TargetQty != 0 && t.TargetQty < t.MinQty {
+		badRequest(c, errors.New("target_qty must not be below min_qty"))
+		return
+	}
+	if err := services.Store.Thresholds.Save(t); err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, thresholdJSON(t))
+}
+
+// removeThreshold handles DELETE /stock/thresholds/:goods/:warehouse
+func removeThreshold(c *gin.Context) {
+	err := services.Store.Thresholds.Remove(c.Param("goods"), c.Param("warehouse"))
+	if errors.Is(err, repository.ErrNotFound) {
+		fail(c, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/schedule"
+)
+
+// repeatRequest is the body of the pause, resume and change endpoints
+type repeatRequest struct {
+	From      civil.Date `json:"from"`
+	To        civil.Date `json:"to"`
+	RepeatEDt civil.Date `json:"repeat_e_dt"`
+	Qty       string     `json:"qty"`
+	Reason    string     `json:"reason"`
+}
+
+func series() *schedule.Series {
+	return &schedule.Series{Store: services.Store}
+}
+
+// bindRepeat reads the :repeat path parameter and the request body
+func bindRepeat(c *gin.Context, req *repeatRequest) (int64, bool) {
+	repeat, err := strconv.ParseInt(c.Param("repeat"), 10, 64)
+	if err != nil {
+		badRequest(c, errors.New("repeat must be a number"))
+		return 0, false
+	}
+	if req == nil {
+		return repeat, true
+	}
+	if err := c.ShouldBindJSON(req); err != nil {
+		badRequest(c, err)
+		return 0, false
+	}
+	if req.From.IsZero() {
+		badRequest(c, errors.New("from is required"))
+		return 0, false
+	}
+	return repeat, true
+}
+
+// seriesFail maps the errors of schedule.Series to a status
+func seriesFail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		fail(c, http.StatusNotFound, err)
+	case errors.Is(err, schedule.ErrPaused), errors.Is(err, schedule.ErrNotPaused):
+		fail(c, http.StatusConflict, err)
+	default:
+		badRequest(c, err)
+	}
+}
+
+func versionJSON(v *repository.RepeatVersion) gin.H {
+	return gin.H{
+		"repeat":       v.Repeat,
+		"version":      v.Version,
+		"action":       v.Action,
+		"effective_dt": v.EffectiveDt,
+		"detail":       v.Detail,
+		"reason":       v.Reason,
+		"rgdt":         v.Rgdt,
+		"upuser":       v.Upuser,
+	}
+}
+
+// pauseRepeat handles POST /repeats/:repeat/pause. An empty to pauses until
+// the repeat is resumed.
+func pauseRepeat(c *gin.Context) {
+	var req repeatRequest
+	repeat, ok := bindRepeat(c, &req)
+	if !ok {
+		return
+	}
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	p, err := series().Pause(repeat, req.From, req.To, req.Reason, user)
+	if err != nil {
+		seriesFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"repeat": p.Repeat, "pause_s_dt": p.PauseSDt, "pause_e_dt": p.PauseEDt, "reason": p.Reason})
+}
+
+// resumeRepeat handles POST /repeats/:repeat/resume; from is the first day
+// delivered again
+func resumeRepeat(c *gin.Context) {
+	var req repeatRequest
+	repeat, ok := bindRepeat(c, &req)
+	if !ok {
+		return
+	}
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	if err := series().Resume(repeat, req.From, req.Reason, user); err != nil {
+		seriesFail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// changeRepeat handles POST /repeats/:repeat/change: a new repeat_e_dt or
+// qty for the occurrences on and after from
+func changeRepeat(c *gin.Context) {
+	var req repeatRequest
+	repeat, ok := bindRepeat(c, &req)
+	if !ok {
+		return
+	}
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	var qty scan.Qty
+	if req.Qty != "" {
+		var err error
+		if qty, err = scan.ParseQty(req.Qty); err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	rep, err := series().ChangeFrom(repeat, req.From, schedule.Change{RepeatEDt: req.RepeatEDt, Qty: qty}, req.Reason, user)
+	if err != nil {
+		seriesFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"repeat":        rep.Repeat,
+		"parent_repeat": rep.ParentRepeat,
+		"repeat_s_dt":   rep.RepeatSDt,
+		"repeat_e_dt":   rep.RepeatEDt,
+		"qty":           rep.DeliveryQty().String(),
+	})
+}
+
+// repeatHistory handles GET /repeats/:repeat/history
+func repeatHistory(c *gin.Context) {
+	repeat, ok := bindRepeat(c, nil)
+	if !ok {
+		return
+	}
+	versions, err := series().History(repeat)
+	if err != nil {
+		seriesFail(c, err)
+		return
+	}
+	list := make([]gin.H, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, versionJSON(v))
+	}
+	c.JSON(http.StatusOK, gin.H{"repeat": repeat, "versions": list})
+}
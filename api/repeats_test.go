@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+func TestPauseByUser(t *testing.T) {
+	store := repository.NewMemory()
+	r := withStore(t, store)
+	sales, err := store.Sales.Create(&repository.Sales{Customer: "C1", Goods: "101", Qty: scan.NewQty(1), RepeatFg: true, DeliveryDt: civil.MustParse("2026-10-19")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repeat, err := store.Repeats.Save(&repository.Repeat{Sales: sales, Period: 1, RepeatSDt: civil.MustParse("2026-10-19"), RepeatEDt: civil.MustParse("2026-12-31")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pause := func(header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/repeats/1/pause", strings.NewReader(`{"from": "2026-11-02", "to": "2026-11-06", "reason": "renovation"}`))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	services.Sessions = adminSessions
+	if w := pause(map[string]string{"X-User": "boss"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("pause without a session: %d %s, want 401", w.Code, w.Body)
+	}
+	if w := pause(map[string]string{"Authorization": "Bearer clerk", "X-User": "boss"}); w.Code != http.StatusOK {
+		t.Fatalf("pause by clerk: %d %s, want 200", w.Code, w.Body)
+	}
+	pauses, err := store.Repeats.Pauses(repeat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := store.Repeats.Versions(repeat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pauses) != 1 || pauses[0].Upuser != "clerk" {
+		t.Errorf("pauses = %+v, want one by clerk", pauses)
+	}
+	if len(versions) != 1 || versions[0].Upuser != "clerk" {
+		t.Errorf("versions = %+v, want one by clerk", versions)
+	}
+}
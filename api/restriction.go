@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/restriction"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+func checker() *restriction.Checker {
+	c := &restriction.Checker{Store: services.Store}
+	if services.Unassigned != nil {
+		c.Unassigned = *services.Unassigned
+	}
+	return c
+}
+
+// overrideBy is the override the caller asks for with reason, made by the
+// user of the authenticated session. Asking for one without a session
+// answers 401 and returns false.
+func overrideBy(c *gin.Context, reason string) (restriction.Override, bool) {
+	if strings.TrimSpace(reason) == "" {
+		return restriction.Override{}, true
+	}
+	s := session(c)
+	if s == nil {
+		fail(c, http.StatusUnauthorized, errNoSession)
+		return restriction.Override{}, false
+	}
+	return restriction.Override{Reason: reason, Admin: s.Admin, User: s.User}, true
+}
+
+// restrictionFail maps the errors of restriction.Checker to a status
+func restrictionFail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, restriction.ErrNotAssigned):
+		fail(c, http.StatusUnprocessableEntity, err)
+	case errors.Is(err, restriction.ErrNotAdmin):
+		fail(c, http.StatusForbidden, err)
+	default:
+		fail(c, http.StatusInternalServerError, err)
+	}
+}
+
+func overrideJSON(o *repository.GoodsOverride) gin.H {
+	if o == nil {
+		return nil
+	}
+	return gin.H{
+		"id":       o.ID,
+		"customer": o.Customer,
+		"goods":    o.Goods,
+		"sales":    o.Sales,
+		"action":   o.Action,
+		"reason":   o.Reason,
+		"rgdt":     o.Rgdt,
+		"upuser":   o.Upuser,
+	}
+}
+
+// updateSales handles PUT /sales/:sales. The goods assignment is checked
+// again only when customer or goods change; the reservation follows the
+// new goods, outgoing warehouse and quantity. The sales, its reservation
+// and its override are written in one transaction.
+func updateSales(c *gin.Context) {
+	sales, ok := salesParam(c)
+	if !ok {
+		return
+	}
+	var req salesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	qty, err := scan.ParseQty(req.Qty)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	s, err := services.Store.Sales.Get(sales)
+	if errors.Is(err, repository.ErrNotFound) {
+		fail(c, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	changed := s.Customer != req.Customer || s.Goods != req.Goods
+	s.Class = req.Class
+	s.Customer = req.Customer
+	s.Name = req.Name
+	s.Goods = req.Goods
+	s.Qty = qty
+	s.ShipAddr = req.ShipAddr
+	s.CarsTank = req.CarsTank
+	s.OutgoingWarehouse = req.OutgoingWarehouse
+	if !req.DeliveryDt.IsZero() {
+		s.DeliveryDt = req.DeliveryDt
+	}
+	if !req.ArrivalDt.IsZero() {
+		s.ArrivalDt = req.ArrivalDt
+	}
+	s.Remark = req.Remark
+
+	var override *repository.GoodsOverride
+	if changed {
+		by, ok := overrideBy(c, req.OverrideReason)
+		if !ok {
+			return
+		}
+		if override, err = checker().Check(s, restriction.ActionUpdate, by); err != nil {
+			restrictionFail(c, err)
+			return
+		}
+	}
+	err = services.Store.Tx(func(tx *repository.Store) error {
+		if err := tx.Sales.Update(s); err != nil {
+			return err
+		}
+		if err := (&ledger.Ledger{Store: tx}).Reserve(s, sessionUser(c)); err != nil {
+			return err
+		}
+		return (&restriction.Checker{Store: tx}).Record(override, s.Sales)
+	})
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sales": s.Sales, "arrival_dt": s.ArrivalDt, "override": overrideJSON(override)})
+}
+
+// listOverrides handles GET /customers/:customer/goods-overrides
+func listOverrides(c *gin.Context) {
+	overrides, err := services.Store.Customers.Overrides(c.Param("customer"))
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	list := make([]gin.H, 0, len(overrides))
+	for _, o := range overrides {
+		list = append(list, overrideJSON(o))
+	}
+	c.JSON(http.StatusOK, list)
+}
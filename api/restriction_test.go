@@ -0,0 +1,144 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/restriction"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+// unassignedSales orders goods 102, which customer C1 is not assigned,
+// with a reason to override
+const unassignedSales = `{"customer": "C1", "goods": "102", "qty": "1", "outgoing_warehouse": "1",
+	"delivery_dt": "2026-10-21", "arrival_dt": "2026-10-20", "override_reason": "trial order"}`
+
+// adminSessions authenticates "Bearer admin" as administrator boss and
+// "Bearer clerk" as clerk, who is not one
+func adminSessions(r *http.Request) *Session {
+	switch r.Header.Get("Authorization") {
+	case "Bearer admin":
+		return &Session{User: "boss", Admin: true}
+	case "Bearer clerk":
+		return &Session{User: "clerk"}
+	}
+	return nil
+}
+
+func withStore(t *testing.T, store *repository.Store) *gin.Engine {
+	t.Helper()
+	saved := services
+	t.Cleanup(func() { services = saved })
+
+	services.Store, services.Sessions, services.Unassigned = store, nil, nil
+	if err := store.Customers.SetGoodsCodes("C1", []string{"101"}); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := SetupRoutes(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func postSales(r *gin.Engine, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/sales", strings.NewReader(unassignedSales))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOverrideNeedsSession(t *testing.T) {
+	store := repository.NewMemory()
+	r := withStore(t, store)
+
+	forged := map[string]string{"X-Role": "administrator", "X-User": "boss"}
+	if w := postSales(r, forged); w.Code != http.StatusUnauthorized {
+		t.Errorf("override with forged headers: %d %s, want 401", w.Code, w.Body)
+	}
+
+	services.Sessions = adminSessions
+	if w := postSales(r, forged); w.Code != http.StatusUnauthorized {
+		t.Errorf("override without a session: %d %s, want 401", w.Code, w.Body)
+	}
+	if w := postSales(r, map[string]string{"Authorization": "Bearer clerk", "X-Role": "administrator"}); w.Code != http.StatusForbidden {
+		t.Errorf("override by a clerk: %d %s, want 403", w.Code, w.Body)
+	}
+	if w := postSales(r, map[string]string{"Authorization": "Bearer admin", "X-User": "someone"}); w.Code != http.StatusCreated {
+		t.Fatalf("override by an administrator: %d %s, want 201", w.Code, w.Body)
+	}
+	overrides, err := store.Customers.Overrides("C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides) != 1 || overrides[0].Upuser != "boss" || overrides[0].Sales == 0 {
+		t.Errorf("overrides = %+v, want one by boss", overrides)
+	}
+	entries, err := store.Ledger.Entries(repository.LedgerFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Upuser != "boss" {
+		t.Errorf("reservation = %+v, want one by boss", entries)
+	}
+}
+
+// TestConfigureUnassigned sets the NoGoods policy and back
+func TestConfigureUnassigned(t *testing.T) {
+	r := withStore(t, repository.NewMemory())
+	post := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/sales", strings.NewReader(`{"customer": "C2", "goods": "102", "qty": "1",
+			"outgoing_warehouse": "1", "delivery_dt": "2026-10-21", "arrival_dt": "2026-10-20"}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	noGoods, anyGoods := restriction.NoGoods, restriction.AnyGoods
+	for _, tt := range []struct {
+		name   string
+		policy *restriction.UnassignedPolicy
+		want   int
+	}{
+		{"default", nil, http.StatusCreated},
+		{"NoGoods", &noGoods, http.StatusUnprocessableEntity},
+		{"unchanged", nil, http.StatusUnprocessableEntity},
+		{"AnyGoods again", &anyGoods, http.StatusCreated},
+	} {
+		Configure(Services{Unassigned: tt.policy})
+		if got := post(); got != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestSalesAndOverrideAreAtomic fails the override: the sales and its
+// reservation must not be kept without it
+func TestSalesAndOverrideAreAtomic(t *testing.T) {
+	db := testdb.New(t)
+	r := withStore(t, repository.NewSQL(db, testdb.Dialect))
+	services.Sessions = adminSessions
+	if _, err := db.Exec("DROP TABLE yc_goods_override"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := postSales(r, map[string]string{"Authorization": "Bearer admin"}); w.Code != http.StatusInternalServerError {
+		t.Fatalf("override without its table: %d %s, want 500", w.Code, w.Body)
+	}
+	if list, _ := services.Store.Sales.List(repository.SalesFilter{}); len(list) != 0 {
+		t.Errorf("%d sales kept without their override", len(list))
+	}
+	if list, _ := services.Store.Ledger.Entries(repository.LedgerFilter{}); len(list) != 0 {
+		t.Errorf("%d ledger entries kept without their sales", len(list))
+	}
+}
@@ -1,23 +1,73 @@
 package api
 
 import (
-    "github.com/gin-gonic/gin"
+	"errors"
+
+	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine) {
-    // api_placeholder will be replaced with issue number
-    v1 := r.Group("/api/v1")
-    {
-        v1.GET("/users", getUsers)
-        v1.POST("/users", createUser)
-        // Additional routes for api_placeholder
-    }
+// ErrNoStore is returned by SetupRoutes when Configure was not given a Store
+var ErrNoStore = errors.New("api: no Store configured; call Configure before SetupRoutes")
+
+// SetupRoutes registers the handlers. It registers nothing and returns
+// ErrNoStore when Configure was not given a Store, so a misconfigured
+// server can stop at startup.
+func SetupRoutes(r *gin.Engine) error {
+	if services.Store == nil {
+		return ErrNoStore
+	}
+
+	// api_placeholder will be replaced with issue number
+	v1 := r.Group("/api/v1")
+	{
+		v1.GET("/users", getUsers)
+		v1.POST("/users", createUser)
+		v1.POST("/sales", createSales)
+		v1.GET("/sales/:sales/lots", getLots)
+		v1.POST("/sales/:sales/lots/space", makeLotSpace)
+		v1.PUT("/sales/:sales/lots", putLots)
+		v1.GET("/lead-time/preview", previewLeadTime)
+		v1.GET("/repeats/:repeat/occurrences", listOccurrences)
+		v1.POST("/repeats/:repeat/occurrences/:date/skip", skipOccurrence)
+		v1.POST("/repeats/:repeat/occurrences/:date/reschedule", rescheduleOccurrence)
+		v1.POST("/repeats/:repeat/occurrences/:date/restore", restoreOccurrence)
+		v1.POST("/repeats/:repeat/pause", pauseRepeat)
+		v1.POST("/repeats/:repeat/resume", resumeRepeat)
+		v1.POST("/repeats/:repeat/change", changeRepeat)
+		v1.GET("/repeats/:repeat/history", repeatHistory)
+		v1.GET("/stock/balances", stockBalances)
+		v1.GET("/stock/ledger", stockMovements)
+		v1.POST("/stock/receipts", receiveStock)
+		v1.POST("/stock/transfers/:stock/receive", receiveTransfer)
+		v1.POST("/stock/transfers/:stock/cancel", cancelTransfer)
+		v1.POST("/stock/adjustments", adjustStock)
+		v1.GET("/warehouses", listWarehouses)
+		v1.PUT("/warehouses/:warehouse", saveWarehouse)
+		v1.GET("/warehouse-routes", listRoutes)
+		v1.PUT("/warehouse-routes", saveRoute)
+		v1.DELETE("/warehouse-routes/:from/:to", removeRoute)
+		v1.POST("/scan/receive", scanReceive)
+		v1.POST("/scan/pick", scanPick)
+		v1.POST("/scan/load", scanLoad)
+		v1.POST("/scan/deliver", scanDeliver)
+		v1.GET("/stock/projection", stockProjection)
+		v1.GET("/stock/thresholds", listThresholds)
+		v1.PUT("/stock/thresholds", saveThreshold)
+		v1.DELETE("/stock/thresholds/:goods/:warehouse", removeThreshold)
+		v1.GET("/customers/:customer/tanks", listTanks)
+		v1.PUT("/customers/:customer/tanks/:tank", saveTank)
+		v1.POST("/customers/:customer/tanks/:tank/readings", readTank)
+		v1.PUT("/sales/:sales", updateSales)
+		v1.GET("/customers/:customer/goods-overrides", listOverrides)
+		// Additional routes for api_placeholder
+	}
+	return nil
 }
 
 func getUsers(c *gin.Context) {
-    // Implementation for api_placeholder
+	// Implementation for api_placeholder
 }
 
 func createUser(c *gin.Context) {
-    // Implementation for api_placeholder
+	// Implementation for api_placeholder
 }
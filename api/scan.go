@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/barcode"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scanning"
+	"github.com/geeknow112/srv-tools/models/transfer"
+)
+
+// scanRequest is the body of POST /scan/receive, /scan/pick, /scan/load
+// and /scan/deliver. Transfer or sales names what is being worked on.
+type scanRequest struct {
+	Barcode   string `json:"barcode" binding:"required"`
+	Transfer  string `json:"transfer"`
+	Sales     int64  `json:"sales"`
+	Warehouse string `json:"warehouse"`
+}
+
+// scanReceive handles POST /scan/receive
+func scanReceive(c *gin.Context) { scanDetail(c, scanning.Receive) }
+
+// scanPick handles POST /scan/pick
+func scanPick(c *gin.Context) { scanDetail(c, scanning.Pick) }
+
+// scanLoad handles POST /scan/load
+func scanLoad(c *gin.Context) { scanDetail(c, scanning.Load) }
+
+// scanDeliver handles POST /scan/deliver
+func scanDeliver(c *gin.Context) { scanDetail(c, scanning.Deliver) }
+
+// scanDetail scans a stock detail for action. A detail that does not fit
+// returns 422 with the mismatches for the handheld to show.
+func scanDetail(c *gin.Context, action scanning.Action) {
+	var req scanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	s := &scanning.Scanner{Store: services.Store}
+	ret, err := s.Scan(scanning.Request{
+		Action:    action,
+		Barcode:   req.Barcode,
+		Transfer:  req.Transfer,
+		Sales:     req.Sales,
+		Warehouse: req.Warehouse,
+		User:      c.GetHeader("X-User"),
+	})
+
+	var mismatch *scanning.MismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		list := make([]gin.H, 0, len(mismatch.Mismatches))
+		for _, m := range mismatch.Mismatches {
+			list = append(list, gin.H{"field": m.Field, "expected": m.Expected, "got": m.Got})
+		}
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      err.Error(),
+			"code":       "mismatch",
+			"mismatches": list,
+		})
+		return
+	case errors.Is(err, scanning.ErrUnknownBarcode), errors.Is(err, repository.ErrNotFound):
+		fail(c, http.StatusNotFound, err)
+		return
+	case errors.Is(err, scanning.ErrState), errors.Is(err, repository.ErrConflict):
+		fail(c, http.StatusConflict, err)
+		return
+	case errors.Is(err, barcode.ErrEmpty), errors.Is(err, barcode.ErrInvalid),
+		errors.Is(err, scanning.ErrNoContext), errors.Is(err, scanning.ErrBothContexts),
+		errors.Is(err, transfer.ErrNotTransfer):
+		badRequest(c, err)
+		return
+	case err != nil:
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	d := ret.Detail
+	label := gin.H{"symbology": ret.Code.Symbology, "value": ret.Code.HRI()}
+	if ret.Code.Symbology == barcode.GS1128 {
+		label["gtin"] = ret.Code.GTIN
+		label["lot"] = ret.Code.Lot
+		label["serial"] = ret.Code.Serial
+		if useBy := ret.Code.UseBy(); !useBy.IsZero() {
+			label["expiry_dt"] = useBy
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":         d.ID,
+		"stock":      d.Stock,
+		"goods":      d.Goods,
+		"warehouse":  d.Warehouse,
+		"lot":        d.Lot,
+		"expiry_dt":  d.ExpiryDt,
+		"barcode":    d.Barcode,
+		"state_from": ret.From,
+		"state":      ret.To,
+		"label":      label,
+	})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/dialect"
+	"github.com/geeknow112/srv-tools/models/leadtime"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/restriction"
+)
+
+// Services are the dependencies of the handlers. Call Configure with at
+// least a Store before SetupRoutes; Load reads everything from a database.
+type Services struct {
+	Store    *repository.Store
+	Calendar *calendar.Calendar
+	LeadTime *leadtime.Resolver
+	// Sessions returns the session a request was authenticated with, or
+	// nil when it has none. Without Sessions nobody is an administrator.
+	Sessions func(r *http.Request) *Session
+	// Unassigned is what customers with no goods assigned may order; nil
+	// is restriction.AnyGoods
+	Unassigned *restriction.UnassignedPolicy
+}
+
+// Session is the authenticated caller of a request
+type Session struct {
+	User  string
+	Admin bool
+}
+
+var services = Services{
+	Calendar: calendar.New(),
+	LeadTime: leadtime.NewResolver(nil, leadtime.DefaultDays),
+}
+
+// Configure replaces the services; nil fields keep their defaults. Store
+// has none: the server must be given its database explicitly.
+func Configure(s Services) {
+	if s.Store != nil {
+		services.Store = s.Store
+	}
+	if s.Calendar != nil {
+		services.Calendar = s.Calendar
+	}
+	if s.LeadTime != nil {
+		services.LeadTime = s.LeadTime
+	}
+	if s.Sessions != nil {
+		services.Sessions = s.Sessions
+	}
+	if s.Unassigned != nil {
+		u := *s.Unassigned
+		services.Unassigned = &u
+	}
+}
+
+// Load returns the services of a server on db: the SQL store, the
+// calendar closures of the next year and the lead-time rules of
+// yc_lead_time. Without it the lead time is always leadtime.DefaultDays.
+func Load(db *sql.DB, d dialect.Dialect) (Services, error) {
+	from := civil.Today()
+	cal, err := calendar.Load(db, from.Time(), from.AddDays(366).Time())
+	if err != nil {
+		return Services{}, err
+	}
+	lt, err := leadtime.Load(db)
+	if err != nil {
+		return Services{}, err
+	}
+	return Services{Store: repository.NewSQL(db, d), Calendar: cal, LeadTime: lt}, nil
+}
+
+// fail writes an error response in the {"error": ...} shape used by every
+// handler
+func fail(c *gin.Context, status int, err error) {
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+func badRequest(c *gin.Context, err error) {
+	fail(c, http.StatusBadRequest, err)
+}
+
+// session returns the authenticated session of the request, or nil
+func session(c *gin.Context) *Session {
+	if services.Sessions == nil {
+		return nil
+	}
+	return services.Sessions(c.Request)
+}
+
+// errNoSession answers a change that must be attributed to a user when
+// the request has no authenticated session
+var errNoSession = errors.New("authentication required")
+
+// sessionUser returns the user of the authenticated session, or "" without
+// one. Handlers record it as upuser; no header the client sends decides it.
+func sessionUser(c *gin.Context) string {
+	if s := session(c); s != nil {
+		return s.User
+	}
+	return ""
+}
+
+// requireUser is sessionUser for the changes that must be attributed to
+// someone. Without a session it answers 401 and returns false.
+func requireUser(c *gin.Context) (string, bool) {
+	s := session(c)
+	if s == nil {
+		fail(c, http.StatusUnauthorized, errNoSession)
+		return "", false
+	}
+	return s.User, true
+}
+
+// isAdmin reports whether the caller is an administrator. Only the
+// authenticated session decides; no header the client sends does.
+func isAdmin(c *gin.Context) bool {
+	s := session(c)
+	return s != nil && s.Admin
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+func TestSetupRoutesNeedsStore(t *testing.T) {
+	saved := services
+	defer func() { services = saved }()
+
+	services.Store = nil
+	if err := SetupRoutes(gin.New()); err != ErrNoStore {
+		t.Errorf("SetupRoutes without a Store: err = %v, want ErrNoStore", err)
+	}
+
+	Configure(Services{Store: repository.NewMemory()})
+	if err := SetupRoutes(gin.New()); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestLoadLeadTime checks that Load reads the yc_lead_time rules the
+// preview resolves with
+func TestLoadLeadTime(t *testing.T) {
+	saved := services
+	defer func() { services = saved }()
+
+	db := testdb.New(t, testdb.Fixture{Table: "yc_lead_time", Rows: []map[string]interface{}{
+		{"lead_time": 1, "customer": "C1", "days": 5},
+	}})
+	s, err := Load(db, testdb.Dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Configure(s)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := SetupRoutes(r); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/lead-time/preview?customer=C1&warehouse=1&delivery_dt=2026-10-30", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("preview: %d %s", w.Code, w.Body)
+	}
+	var got struct {
+		ArrivalDt string `json:"arrival_dt"`
+		Decision  struct {
+			Days int `json:"days"`
+		} `json:"decision"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Decision.Days != 5 || got.ArrivalDt != "2026-10-23" {
+		t.Errorf("preview = %s, want rule 1: 5 days, arrival 2026-10-23", w.Body)
+	}
+}
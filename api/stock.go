@@ -0,0 +1,273 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/transfer"
+)
+
+// cancelTransferRequest is the body of POST /stock/transfers/:stock/cancel
+type cancelTransferRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// adjustRequest is the body of POST /stock/adjustments
+type adjustRequest struct {
+	Goods     string `json:"goods" binding:"required"`
+	Warehouse string `json:"warehouse" binding:"required"`
+	Lot       string `json:"lot"`
+	Qty       string `json:"qty" binding:"required"`
+	Reason    string `json:"reason" binding:"required"`
+}
+
+// receiptRequest is the body of POST /stock/receipts: one detail per
+// goods unit received
+type receiptRequest struct {
+	Stock     string          `json:"stock" binding:"required"`
+	Goods     string          `json:"goods" binding:"required"`
+	Warehouse string          `json:"warehouse" binding:"required"`
+	ArrivalDt civil.Date      `json:"arrival_dt"`
+	Details   []receiptDetail `json:"details" binding:"required"`
+}
+
+type receiptDetail struct {
+	Lot      string     `json:"lot"`
+	Barcode  string     `json:"barcode"`
+	ExpiryDt civil.Date `json:"expiry_dt"`
+}
+
+func stockLedger() *ledger.Ledger {
+	return &ledger.Ledger{Store: services.Store}
+}
+
+func transfers() *transfer.Service {
+	return &transfer.Service{Store: services.Store}
+}
+
+func ledgerFilter(c *gin.Context) repository.LedgerFilter {
+	return repository.LedgerFilter{
+		Goods:     c.Query("goods"),
+		Warehouse: c.Query("warehouse"),
+		Lot:       c.Query("lot"),
+		Ref:       c.Query("ref"),
+		Kind:      repository.MovementKind(c.Query("kind")),
+	}
+}
+
+func ledgerEntryJSON(e *repository.LedgerEntry) gin.H {
+	return gin.H{
+		"id":         e.ID,
+		"kind":       e.Kind,
+		"ref":        e.Ref,
+		"goods":      e.Goods,
+		"warehouse":  e.Warehouse,
+		"lot":        e.Lot,
+		"on_hand":    e.OnHand.String(),
+		"reserved":   e.Reserved.String(),
+		"in_transit": e.InTransit.String(),
+		"cancel_of":  e.CancelOf,
+		"reason":     e.Reason,
+		"rgdt":       e.Rgdt,
+		"upuser":     e.Upuser,
+	}
+}
+
+func ledgerEntriesJSON(entries []*repository.LedgerEntry) []gin.H {
+	ret := make([]gin.H, 0, len(entries))
+	for _, e := range entries {
+		ret = append(ret, ledgerEntryJSON(e))
+	}
+	return ret
+}
+
+// stockBalances handles GET /stock/balances. It returns the stock per
+// goods and warehouse, or per lot with ?by=lot.
+func stockBalances(c *gin.Context) {
+	f := ledgerFilter(c)
+	if c.Query("by") == "lot" {
+		balances, err := services.Store.Ledger.Balances(f)
+		if err != nil {
+			fail(c, http.StatusInternalServerError, err)
+			return
+		}
+		ret := make([]gin.H, 0, len(balances))
+		for _, b := range balances {
+			ret = append(ret, gin.H{
+				"goods":      b.Goods,
+				"warehouse":  b.Warehouse,
+				"lot":        b.Lot,
+				"on_hand":    b.OnHand.String(),
+				"reserved":   b.Reserved.String(),
+				"in_transit": b.InTransit.String(),
+				"available":  b.Available().String(),
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"balances": ret})
+		return
+	}
+
+	positions, err := stockLedger().Positions(f)
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	ret := make([]gin.H, 0, len(positions))
+	for _, p := range positions {
+		ret = append(ret, gin.H{
+			"goods":      p.Goods,
+			"warehouse":  p.Warehouse,
+			"on_hand":    p.OnHand.String(),
+			"reserved":   p.Reserved.String(),
+			"in_transit": p.InTransit.String(),
+			"available":  p.Available().String(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"balances": ret})
+}
+
+// receiveStock handles POST /stock/receipts. The stock record and its
+// details are registered and posted to the ledger as a receipt in one
+// transaction.
+func receiveStock(c *gin.Context) {
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	var req receiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	if len(req.Details) == 0 {
+		badRequest(c, errors.New("details must not be empty"))
+		return
+	}
+	if req.ArrivalDt.IsZero() {
+		req.ArrivalDt = civil.Today()
+	}
+
+	header := &repository.Stock{Stock: req.Stock, Goods: req.Goods, Warehouse: req.Warehouse, ArrivalDt: req.ArrivalDt}
+	details := make([]*repository.StockDetail, len(req.Details))
+	for i, d := range req.Details {
+		details[i] = &repository.StockDetail{Lot: d.Lot, Barcode: d.Barcode, ExpiryDt: d.ExpiryDt}
+	}
+	err := services.Store.Tx(func(tx *repository.Store) error {
+		l := &ledger.Ledger{Store: tx}
+		unit, err := l.Unit(req.Goods)
+		if err != nil {
+			return err
+		}
+		header.Qty = unit * scan.Qty(len(details))
+		if err := tx.Stock.Create(header, details); err != nil {
+			return err
+		}
+		return l.Receive(header, details, user)
+	})
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	ids := make([]int64, len(details))
+	for i, d := range details {
+		ids[i] = d.ID
+	}
+	c.JSON(http.StatusCreated, gin.H{"stock": header.Stock, "qty": header.Qty.String(), "arrival_dt": header.ArrivalDt, "details": ids})
+}
+
+// stockMovements handles GET /stock/ledger
+func stockMovements(c *gin.Context) {
+	entries, err := services.Store.Ledger.Entries(ledgerFilter(c))
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": ledgerEntriesJSON(entries)})
+}
+
+// receiveTransfer handles POST /stock/transfers/:stock/receive
+func receiveTransfer(c *gin.Context) {
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	entries, err := transfers().Receive(c.Param("stock"), user)
+	if errors.Is(err, ledger.ErrNothingInTransit) {
+		fail(c, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": ledgerEntriesJSON(entries)})
+}
+
+// cancelTransfer handles POST /stock/transfers/:stock/cancel
+func cancelTransfer(c *gin.Context) {
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	var req cancelTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	tc, err := transfers().Cancel(c.Param("stock"), req.Reason, user)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		fail(c, http.StatusNotFound, err)
+		return
+	case errors.Is(err, transfer.ErrReceived):
+		fail(c, http.StatusConflict, err)
+		return
+	case errors.Is(err, transfer.ErrNoReason), errors.Is(err, transfer.ErrNotTransfer):
+		badRequest(c, err)
+		return
+	case err != nil:
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"stock":    tc.Stock,
+		"released": tc.Released,
+		"reason":   tc.Reason,
+		"rgdt":     tc.Rgdt,
+		"upuser":   tc.Upuser,
+	})
+}
+
+// adjustStock handles POST /stock/adjustments
+func adjustStock(c *gin.Context) {
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	var req adjustRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	qty, err := scan.ParseQty(req.Qty)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	if qty == 0 {
+		badRequest(c, errors.New("qty must not be zero"))
+		return
+	}
+	e, err := stockLedger().Adjust(req.Goods, req.Warehouse, req.Lot, qty, req.Reason, user)
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusCreated, ledgerEntryJSON(e))
+}
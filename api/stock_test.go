@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+)
+
+func serve(r *gin.Engine, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// TestStockByUser posts a receipt and an adjustment: both need a session
+// and are attributed to its user
+func TestStockByUser(t *testing.T) {
+	store := repository.NewMemory()
+	r := withStore(t, store)
+	services.Sessions = adminSessions
+
+	requests := []struct {
+		name, path, body string
+	}{
+		{"receipt", "/api/v1/stock/receipts", `{"stock": "S1", "goods": "101", "warehouse": "1", "arrival_dt": "2026-10-19",
+			"details": [{"lot": "L1", "barcode": "S1-1"}, {"lot": "L1", "barcode": "S1-2"}]}`},
+		{"adjustment", "/api/v1/stock/adjustments", `{"goods": "101", "warehouse": "1", "lot": "L1", "qty": "-1", "reason": "damaged bag"}`},
+	}
+	for _, tt := range requests {
+		if w := serve(r, http.MethodPost, tt.path, tt.body, map[string]string{"X-User": "boss"}); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without a session: %d %s, want 401", tt.name, w.Code, w.Body)
+		}
+		if w := serve(r, http.MethodPost, tt.path, tt.body, map[string]string{"Authorization": "Bearer clerk", "X-User": "boss"}); w.Code != http.StatusCreated {
+			t.Fatalf("%s by clerk: %d %s, want 201", tt.name, w.Code, w.Body)
+		}
+	}
+
+	entries, err := store.Ledger.Entries(repository.LedgerFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 2 {
+		t.Fatalf("%d ledger entries, want the receipt and the adjustment", len(entries))
+	}
+	for _, e := range entries {
+		if e.Upuser != "clerk" {
+			t.Errorf("%s entry %d posted by %q, want clerk", e.Kind, e.ID, e.Upuser)
+		}
+	}
+}
+
+// TestCancelTransferByUser cancels a transfer: it needs a session and the
+// cancellation is recorded under its user
+func TestCancelTransferByUser(t *testing.T) {
+	store := repository.NewMemory()
+	r := withStore(t, store)
+	services.Sessions = adminSessions
+	if err := store.Stock.Create(&repository.Stock{Stock: "T1", Goods: "101", Warehouse: "2", ArrivalDt: civil.MustParse("2026-10-20"), TransferFg: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"reason": "sent to the wrong site"}`
+	if w := serve(r, http.MethodPost, "/api/v1/stock/transfers/T1/cancel", body, map[string]string{"X-User": "boss"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("cancel without a session: %d %s, want 401", w.Code, w.Body)
+	}
+	if w := serve(r, http.MethodPost, "/api/v1/stock/transfers/T1/cancel", body, map[string]string{"Authorization": "Bearer clerk", "X-User": "boss"}); w.Code != http.StatusOK {
+		t.Fatalf("cancel by clerk: %d %s, want 200", w.Code, w.Body)
+	}
+	cancels, err := store.Stock.Cancels("T1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancels) != 1 || cancels[0].Upuser != "clerk" {
+		t.Errorf("cancellations = %+v, want one by clerk", cancels)
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/tank"
+)
+
+// tankRequest is the body of PUT /customers/:customer/tanks/:tank. Goods
+// lists what the tank may hold; empty allows any goods.
+type tankRequest struct {
+	Capacity string   `json:"capacity"`
+	DailyUse string   `json:"daily_use"`
+	Goods    []string `json:"goods"`
+}
+
+// readingRequest is the body of POST /customers/:customer/tanks/:tank/readings
+type readingRequest struct {
+	Level string     `json:"level" binding:"required"`
+	Dt    civil.Date `json:"dt"`
+}
+
+func tanks() *tank.Tanks {
+	return &tank.Tanks{Store: services.Store}
+}
+
+func tankJSON(s *tank.Status) gin.H {
+	goods := s.Goods
+	if goods == nil {
+		goods = []string{}
+	}
+	h := gin.H{
+		"tank":      s.Tank,
+		"capacity":  s.Capacity.String(),
+		"daily_use": s.DailyUse.String(),
+		"level":     s.Level.String(),
+		"level_dt":  s.LevelDt,
+		"on":        s.On,
+		"estimated": s.Estimated.String(),
+		"goods":     goods,
+	}
+	if s.Capacity > 0 {
+		h["free"] = s.Free().String()
+	}
+	return h
+}
+
+// tankFail maps the errors of tank.Tanks to a status
+func tankFail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		fail(c, http.StatusNotFound, err)
+	case errors.Is(err, tank.ErrReading):
+		fail(c, http.StatusUnprocessableEntity, err)
+	default:
+		fail(c, http.StatusInternalServerError, err)
+	}
+}
+
+// listTanks handles GET /customers/:customer/tanks; ?on= estimates the
+// levels on another day than today
+func listTanks(c *gin.Context) {
+	on := civil.Today()
+	if s := c.Query("on"); s != "" {
+		var err error
+		if on, err = civil.Parse(s); err != nil {
+			badRequest(c, errors.New("on must be YYYY-MM-DD"))
+			return
+		}
+	}
+	list, err := tanks().List(c.Param("customer"), on)
+	if err != nil {
+		tankFail(c, err)
+		return
+	}
+	ret := make([]gin.H, 0, len(list))
+	for _, s := range list {
+		ret = append(ret, tankJSON(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"tanks": ret})
+}
+
+// saveTank handles PUT /customers/:customer/tanks/:tank. The tank must be
+// registered for the customer; its level is kept.
+func saveTank(c *gin.Context) {
+	var req tankRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	customer := c.Param("customer")
+	s, err := tanks().Get(customer, c.Param("tank"), civil.Today())
+	if err != nil {
+		tankFail(c, err)
+		return
+	}
+	d := s.CustomerDetail
+	if req.Capacity != "" {
+		if d.Capacity, err = scan.ParseQty(req.Capacity); err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	if req.DailyUse != "" {
+		if d.DailyUse, err = scan.ParseQty(req.DailyUse); err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	if d.Capacity < 0 || d.DailyUse < 0 {
+		badRequest(c, errors.New("capacity and daily_use must not be negative"))
+		return
+	}
+	if err := services.Store.Customers.SaveTank(d); err != nil {
+		tankFail(c, err)
+		return
+	}
+	if req.Goods != nil {
+		if err := services.Store.Customers.SetTankGoods(customer, d.Tank, req.Goods); err != nil {
+			tankFail(c, err)
+			return
+		}
+	}
+	if s, err = tanks().Get(customer, d.Tank, civil.Today()); err != nil {
+		tankFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tankJSON(s))
+}
+
+// readTank handles POST /customers/:customer/tanks/:tank/readings. A
+// reading without dt is today's.
+func readTank(c *gin.Context) {
+	var req readingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	level, err := scan.ParseQty(req.Level)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	dt := req.Dt
+	if dt.IsZero() {
+		dt = civil.Today()
+	}
+	s, err := tanks().Reading(c.Param("customer"), c.Param("tank"), level, dt)
+	if err != nil {
+		tankFail(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, tankJSON(s))
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+)
+
+// warehouseRequest is the body of PUT /warehouses/:warehouse
+type warehouseRequest struct {
+	Name          string `json:"name" binding:"required"`
+	SourceFg      bool   `json:"source_fg"`
+	DestinationFg bool   `json:"destination_fg"`
+	BulkFg        bool   `json:"bulk_fg"`
+}
+
+// routeRequest is the body of PUT /warehouse-routes
+type routeRequest struct {
+	From     string `json:"from" binding:"required"`
+	To       string `json:"to" binding:"required"`
+	Priority int    `json:"priority"`
+	ActiveFg *bool  `json:"active_fg"`
+}
+
+func warehouseJSON(w *repository.Warehouse) gin.H {
+	return gin.H{
+		"warehouse":      w.Warehouse,
+		"name":           w.Name,
+		"source_fg":      w.SourceFg,
+		"destination_fg": w.DestinationFg,
+		"bulk_fg":        w.BulkFg,
+	}
+}
+
+func routeJSON(r *repository.WarehouseRoute) gin.H {
+	return gin.H{"from": r.From, "to": r.To, "priority": r.Priority, "active_fg": r.ActiveFg}
+}
+
+// listWarehouses handles GET /warehouses
+func listWarehouses(c *gin.Context) {
+	list, err := services.Store.Warehouses.List()
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	ret := make([]gin.H, 0, len(list))
+	for _, w := range list {
+		ret = append(ret, warehouseJSON(w))
+	}
+	c.JSON(http.StatusOK, gin.H{"warehouses": ret})
+}
+
+// saveWarehouse handles PUT /warehouses/:warehouse
+func saveWarehouse(c *gin.Context) {
+	var req warehouseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	w := &repository.Warehouse{
+		Warehouse:     c.Param("warehouse"),
+		Name:          req.Name,
+		SourceFg:      req.SourceFg,
+		DestinationFg: req.DestinationFg,
+		BulkFg:        req.BulkFg,
+	}
+	if err := services.Store.Warehouses.Save(w); err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, warehouseJSON(w))
+}
+
+// listRoutes handles GET /warehouse-routes; ?to= narrows the routes to one
+// receiving warehouse
+func listRoutes(c *gin.Context) {
+	list, err := services.Store.Warehouses.Routes(c.Query("to"))
+	if err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	ret := make([]gin.H, 0, len(list))
+	for _, r := range list {
+		ret = append(ret, routeJSON(r))
+	}
+	c.JSON(http.StatusOK, gin.H{"routes": ret})
+}
+
+// saveRoute handles PUT /warehouse-routes. A route is active unless
+// active_fg is false.
+func saveRoute(c *gin.Context) {
+	var req routeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+	if req.From == req.To {
+		badRequest(c, errors.New("from and to must differ"))
+		return
+	}
+	for _, code := range []string{req.From, req.To} {
+		if _, err := services.Store.Warehouses.Get(code); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				badRequest(c, errors.New("unknown warehouse "+code))
+				return
+			}
+			fail(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	r := &repository.WarehouseRoute{From: req.From, To: req.To, Priority: req.Priority, ActiveFg: req.ActiveFg == nil || *req.ActiveFg}
+	if err := services.Store.Warehouses.SaveRoute(r); err != nil {
+		fail(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, routeJSON(r))
+}
+
+// removeRoute handles DELETE /warehouse-routes/:from/:to
+func removeRoute(c *gin.Context) {
+	err := services.Store.Warehouses.RemoveRoute(c.Param("from"), c.Param("to"))
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		fail(c, http.StatusNotFound, err)
+	case err != nil:
+		fail(c, http.StatusInternalServerError, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
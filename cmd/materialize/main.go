@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/dialect"
+	"github.com/geeknow112/srv-tools/models/leadtime"
+	"github.com/geeknow112/srv-tools/models/materialize"
+	"github.com/geeknow112/srv-tools/models/repository"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// materialize turns the repeat occurrences of the next days into sales.
+//
+//	go run ./cmd/materialize -dsn 'user:password@tcp(localhost:3306)/dbname' -days 7 -dry-run
+//	go run ./cmd/materialize -dsn 'user:password@tcp(localhost:3306)/dbname' -every 1h
+func main() {
+	driver := flag.String("driver", "mysql", "database driver: mysql or sqlite")
+	dsn := flag.String("dsn", "", "data source name")
+	days := flag.Int("days", materialize.DefaultDays, "materialize occurrences up to N days ahead")
+	today := flag.String("today", "", "first delivery date (YYYY-MM-DD), default today in Asia/Tokyo")
+	dryRun := flag.Bool("dry-run", false, "log what would be created, write no sales")
+	every := flag.Duration("every", 0, "keep running at this interval instead of once")
+	user := flag.String("user", materialize.DefaultUser, "upuser of the created sales")
+	flag.Parse()
+
+	if err := run(*driver, *dsn, *days, *today, *dryRun, *every, *user); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(driver, dsn string, days int, today string, dryRun bool, every time.Duration, user string) error {
+	var d dialect.Dialect
+	switch driver {
+	case "mysql":
+		d = dialect.MySQL
+	case "sqlite":
+		d = dialect.SQLite
+	default:
+		return fmt.Errorf("materialize: unknown driver %q", driver)
+	}
+
+	db, err := sql.Open(d.Name(), dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	from := civil.Today()
+	if today != "" {
+		if from, err = civil.Parse(today); err != nil {
+			return fmt.Errorf("materialize: invalid -today %q", today)
+		}
+	}
+	// Closures a year ahead cover every run of a long-lived process
+	cal, err := calendar.Load(db, from.Time(), from.AddDays(366).Time())
+	if err != nil {
+		return err
+	}
+	lt, err := leadtime.Load(db)
+	if err != nil {
+		return err
+	}
+
+	job := &materialize.Job{
+		Store:    repository.NewSQL(db, d),
+		Calendar: cal,
+		LeadTime: lt,
+		Days:     days,
+		DryRun:   dryRun,
+		User:     user,
+	}
+
+	if every > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		job.Start(ctx, every)
+		<-ctx.Done()
+		return nil
+	}
+
+	rpt, err := job.Run(from)
+	if err != nil {
+		return err
+	}
+	for _, r := range rpt.Results {
+		fmt.Printf("%s\trepeat %d\tbase_sales %d\t%s\tsales %d\t%s\n", r.Status, r.Repeat, r.BaseSales, r.DeliveryDt, r.Sales, r.Message)
+	}
+	fmt.Printf("%s - %s: created %d, linked %d, planned %d, conflicts %d\n", rpt.From, rpt.To,
+		rpt.Count(materialize.Created), rpt.Count(materialize.Linked), rpt.Count(materialize.Planned), rpt.Count(materialize.Conflict))
+	return nil
+}
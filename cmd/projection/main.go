@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/dialect"
+	"github.com/geeknow112/srv-tools/models/projection"
+	"github.com/geeknow112/srv-tools/models/repository"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// projection prints the daily low-stock report: the goods whose projected
+// stock falls below its minimum in the next days, with the transfers and
+// reorders that bring it back. Run it once a day, before the morning
+// orders.
+//
+//	go run ./cmd/projection -dsn 'user:password@tcp(localhost:3306)/dbname' -days 14
+//	go run ./cmd/projection -dsn 'user:password@tcp(localhost:3306)/dbname' -all -warehouse 1
+func main() {
+	driver := flag.String("driver", "mysql", "database driver: mysql or sqlite")
+	dsn := flag.String("dsn", "", "data source name")
+	days := flag.Int("days", projection.DefaultDays, "project stock N days ahead")
+	today := flag.String("today", "", "first day (YYYY-MM-DD), default today in Asia/Tokyo")
+	goods := flag.String("goods", "", "only this goods")
+	warehouse := flag.String("warehouse", "", "only this warehouse")
+	all := flag.Bool("all", false, "list every goods, not only the low ones")
+	flag.Parse()
+
+	if err := run(*driver, *dsn, *days, *today, *goods, *warehouse, *all); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(driver, dsn string, days int, today, goods, warehouse string, all bool) error {
+	var d dialect.Dialect
+	switch driver {
+	case "mysql":
+		d = dialect.MySQL
+	case "sqlite":
+		d = dialect.SQLite
+	default:
+		return fmt.Errorf("projection: unknown driver %q", driver)
+	}
+
+	db, err := sql.Open(d.Name(), dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	from := civil.Today()
+	if today != "" {
+		if from, err = civil.Parse(today); err != nil {
+			return fmt.Errorf("projection: invalid -today %q", today)
+		}
+	}
+	cal, err := calendar.Load(db, from.Time(), from.AddDays(days).Time())
+	if err != nil {
+		return err
+	}
+
+	p := &projection.Projector{Store: repository.NewSQL(db, d), Calendar: cal, Days: days}
+	rpt, err := p.Run(from, projection.Filter{Goods: goods, Warehouse: warehouse})
+	if err != nil {
+		return err
+	}
+	list := rpt.Low()
+	if all {
+		list = rpt.Projections
+	}
+	for _, pr := range list {
+		status := "ok"
+		switch {
+		case !pr.StockoutDt.IsZero():
+			status = "stockout " + pr.StockoutDt.String()
+		case pr.Low():
+			status = "low " + pr.BelowDt.String()
+		}
+		fmt.Printf("%s\tgoods %s\twarehouse %s\tstart %s\tlowest %s on %s\tmin %s\n",
+			status, pr.Goods, pr.Warehouse, pr.Start(), pr.Lowest, pr.LowestDt, pr.MinQty)
+		for _, s := range pr.Suggestions {
+			if s.Kind == projection.Transfer {
+				fmt.Printf("\t%s %s from warehouse %s by %s\n", s.Kind, s.Qty, s.From, s.NeededBy)
+			} else {
+				fmt.Printf("\t%s %s by %s\n", s.Kind, s.Qty, s.NeededBy)
+			}
+		}
+	}
+	fmt.Printf("%s - %s: %d projected, %d low\n", rpt.From, rpt.To, len(rpt.Projections), len(rpt.Low()))
+	return nil
+}
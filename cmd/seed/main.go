@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/dialect"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/schema"
+	"github.com/geeknow112/srv-tools/models/seed"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// seed loads fixture files and/or a synthetic dataset into a development
+// database.
+//
+//	go run ./cmd/seed -dsn 'user:password@tcp(localhost:3306)/dbname' fixtures/base.yaml
+//	go run ./cmd/seed -driver sqlite -dsn dev.db -migrate -customers 200 -months 12
+func main() {
+	driver := flag.String("driver", "mysql", "database driver: mysql or sqlite")
+	dsn := flag.String("dsn", "", "data source name")
+	migrate := flag.Bool("migrate", false, "create the yc_* schema before loading")
+	customers := flag.Int("customers", 0, "generate N synthetic customers")
+	months := flag.Int("months", 12, "months of generated orders")
+	start := flag.String("start", "", "first generated month (YYYY-MM), default current month")
+	rngSeed := flag.Int64("seed", 1, "random seed for generated data")
+	dryRun := flag.Bool("dry-run", false, "validate only, write nothing")
+	flag.Parse()
+
+	if err := run(*driver, *dsn, *migrate, *customers, *months, *start, *rngSeed, *dryRun, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(driver, dsn string, migrate bool, customers, months int, start string, rngSeed int64, dryRun bool, files []string) error {
+	ds := &seed.Dataset{}
+	for _, f := range files {
+		part, err := seed.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		ds.Merge(part)
+	}
+	if customers > 0 {
+		o := seed.GenerateOptions{Customers: customers, Months: months, Seed: rngSeed}
+		if start != "" {
+			t, err := time.Parse("2006-01", start)
+			if err != nil {
+				return fmt.Errorf("seed: invalid -start %q", start)
+			}
+			o.Start = t
+		}
+		ds.Merge(seed.Generate(o))
+	}
+	if len(files) == 0 && customers == 0 {
+		return fmt.Errorf("seed: nothing to load; pass fixture files or -customers")
+	}
+
+	if dryRun && dsn == "" {
+		if err := seed.Validate(ds, nil); err != nil {
+			return err
+		}
+		fmt.Println("dataset is valid")
+		return nil
+	}
+
+	var d dialect.Dialect
+	switch driver {
+	case "mysql":
+		d = dialect.MySQL
+	case "sqlite":
+		d = dialect.SQLite
+	default:
+		return fmt.Errorf("seed: unknown driver %q", driver)
+	}
+
+	db, err := sql.Open(d.Name(), dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	if migrate {
+		applied, err := schema.Migrate(db, d)
+		if err != nil {
+			return err
+		}
+		for _, v := range applied {
+			fmt.Println("applied", v)
+		}
+	}
+
+	store := repository.NewSQL(db, d)
+	if dryRun {
+		if err := seed.Validate(ds, store); err != nil {
+			return err
+		}
+		fmt.Println("dataset is valid")
+		return nil
+	}
+
+	sum, err := seed.Load(store, ds)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("warehouses %d (routes %d), goods %d, customers %d (tanks %d), sales %d, repeats %d, stock %d (details %d)\n",
+		sum.Warehouses, sum.Routes, sum.Goods, sum.Customers, sum.Tanks, sum.Sales, sum.Repeats, sum.Stock, sum.Details)
+
+	return nil
+}
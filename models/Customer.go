@@ -3,7 +3,10 @@ package main
 import (
 	"database/sql"
 	"fmt"
-	"time"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/scan"
 )
 
 // Assuming ExtModelBase is a struct that provides some base functionality
@@ -50,85 +53,57 @@ func (c *Customer) GetValidElement(stepNum *int) map[string]interface{} {
 func (c *Customer) GetList(get map[string]interface{}, unConvert bool, db *sql.DB) (interface{}, error) {
 	curUser := getCurrentUser()
 
-	sqlQuery := "SELECT c.*, c.name as customer_name FROM yc_customer as c WHERE c.customer IS NOT NULL "
+	q := query.Select("c.*", "c.name AS customer_name").
+		From(c.getTableName() + " AS c").
+		Where("c.customer IS NOT NULL")
 
 	if !isAdmin(curUser) {
-		// sqlQuery += fmt.Sprintf("AND ap.mail = '%s'", curUser.Email)
+		// q.WhereEq("ap.mail", curUser.Email)
 	}
 
-	if action, ok := get["action"]; !ok || action == "" {
-		sqlQuery += ";"
-	} else if action == "search" {
-		if no, ok := get["s"].(map[string]interface{})["no"]; ok && no != "" {
-			sqlQuery += fmt.Sprintf("AND c.customer = '%s' ", no)
+	if action, ok := get["action"]; ok && action == "search" {
+		s, _ := get["s"].(map[string]interface{})
+		if no, ok := s["no"]; ok && no != "" {
+			q.WhereEq("c.customer", no)
 		}
-		if customerName, ok := get["s"].(map[string]interface{})["customer_name"]; ok && customerName != "" {
-			sqlQuery += fmt.Sprintf("AND c.name LIKE '%s%s' ", customerName, "%")
+		if customerName, ok := s["customer_name"]; ok && customerName != "" {
+			q.WhereLike("c.name", query.LikePrefix(fmt.Sprint(customerName)))
 		}
-		sqlQuery += ";"
 	}
 
-	rows, err := db.Query(sqlQuery)
+	sqlQuery, args, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var result map[string][]interface{}
-	tmp := make(map[string]map[int]interface{})
+	var list []struct {
+		DeliveryDt string `db:"delivery_dt"`
+		ID         int    `db:"id"`
+	}
+	if err := scan.Structs(rows, &list); err != nil {
+		return nil, err
+	}
 
-	for rows.Next() {
-		var row struct {
-			DeliveryDt string
-			ID         int
-		}
-		// Assuming the row scan is done here
-		// rows.Scan(&row)
+	result := make(map[string][]interface{})
+	tmp := make(map[string]map[int]interface{})
 
+	for _, row := range list {
 		if _, ok := tmp[row.DeliveryDt]; !ok {
 			tmp[row.DeliveryDt] = make(map[int]interface{})
 		}
 		tmp[row.DeliveryDt][row.ID] = row
 	}
 
-	// Repeat copy
-	test := map[string]interface{}{
-		"id":          1,
-		"class":       2,
-		"delivery_dt": "2022-12-21",
-		"goods":       "",
-		"goods_name":  "ミルククイーン",
-		"ship_addr":   "A棟",
-		"qty":         6,
-		"arrival_dt":  "2022-12-20",
-		"name":        "梅田畜産",
-		"repeat_fg":   1,
-		"remark":      "",
-		"field1":      "",
-		"field2":      "",
-		"field3":      "",
-		"rgdt":        "2023-01-25 06:19:00",
-		"updt":        "",
-		"upuser":      "",
-		"repeat_id":   1,
-		"period":      1,
-		"span":        5,
-		"day_of_week": "",
-		"st_dt":       "2022-12-20 00:00:00",
-		"ed_dt":       "2023-12-20 00:00:00",
-	}
-
-	days10 := []string{"2022-12-20", "2022-12-21", "2022-12-22", "2022-12-23", "2022-12-24", "2022-12-25"}
-	for _, day := range days10 {
-		t := test
-		t["delivery_dt"] = day
-		t["goods_name"] = "rep:ミルククイーン"
-		result[day] = append(result[day], t)
-
-		if dayData, ok := tmp[day]; ok {
-			for _, list := range dayData {
-				result[day] = append(result[day], list)
-			}
+	// Group rows by delivery date
+	for day, dayData := range tmp {
+		for _, list := range dayData {
+			result[day] = append(result[day], list)
 		}
 	}
 
@@ -139,84 +114,92 @@ func (c *Customer) GetList(get map[string]interface{}, unConvert bool, db *sql.D
 func (c *Customer) GetDetail(get map[string]interface{}, db *sql.DB) (interface{}, error) {
 	curUser := getCurrentUser()
 
-	sqlQuery := fmt.Sprintf("SELECT s.* FROM yc_sales as s WHERE s.id = '%s' LIMIT 1;", get["sales"])
+	q := query.Select("s.*").
+		From("yc_sales AS s").
+		WhereEq("s.id", get["sales"]).
+		Limit(1)
 
 	if !isAdmin(curUser) {
-		// sqlQuery += fmt.Sprintf("AND ap.mail = '%s'", curUser.Email)
+		// q.WhereEq("ap.mail", curUser.Email)
 	}
 
-	rows, err := db.Query(sqlQuery)
+	sqlQuery, args, err := q.Build()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var result interface{}
-	if rows.Next() {
-		// Assuming the row scan is done here
-		// rows.Scan(&result)
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return result, nil
+	return scan.Map(rows)
 }
 
 // GetDetailByCustomerCode retrieves customer details by customer code
 func (c *Customer) GetDetailByCustomerCode(customer string, db *sql.DB) (interface{}, error) {
-	sqlQuery := fmt.Sprintf("SELECT c.*, cd.*, c.customer AS customer FROM %s as c LEFT JOIN yc_customer_detail AS cd ON c.customer = cd.customer WHERE c.customer = '%s';", c.getTableName(), customer)
-
-	rows, err := db.Query(sqlQuery)
+	sqlQuery, args, err := query.Select("c.*", "cd.*", "c.customer AS customer").
+		From(c.getTableName()+" AS c").
+		LeftJoin("yc_customer_detail AS cd", "c.customer = cd.customer").
+		WhereEq("c.customer", customer).
+		Build()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var result interface{}
-	if rows.Next() {
-		// Assuming the row scan is done here
-		// rows.Scan(&result)
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return result, nil
+	return scan.Maps(rows)
 }
 
 // GetGoodsByCustomerCode retrieves goods associated with a customer code
 func (c *Customer) GetGoodsByCustomerCode(customer string, db *sql.DB) (interface{}, error) {
-	sqlQuery := fmt.Sprintf("SELECT c.*, g.* FROM %s as c LEFT JOIN yc_customer_goods AS cg ON c.customer = cg.customer LEFT JOIN yc_goods AS g ON cg.goods = g.goods WHERE c.customer = '%s';", c.getTableName(), customer)
-
-	rows, err := db.Query(sqlQuery)
+	sqlQuery, args, err := query.Select("c.*", "g.*").
+		From(c.getTableName()+" AS c").
+		LeftJoin("yc_customer_goods AS cg", "c.customer = cg.customer").
+		LeftJoin("yc_goods AS g", "cg.goods = g.goods").
+		WhereEq("c.customer", customer).
+		Build()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var result interface{}
-	if rows.Next() {
-		// Assuming the row scan is done here
-		// rows.Scan(&result)
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return result, nil
+	return scan.Maps(rows)
 }
 
 // GetLotNumberListByOrder retrieves lot numbers for a given order
 func (c *Customer) GetLotNumberListByOrder(prm map[string]interface{}, db *sql.DB) (interface{}, error) {
-	curUser := getCurrentUser()
-
-	sqlQuery := fmt.Sprintf("SELECT o.id, o.ship_addr, o.arrival_dt, o.name, g.goods, g.name as goods_name, g.qty as goods_qty, gd.lot, gd.tank FROM yc_sales as o LEFT JOIN yc_goods as g ON o.goods = g.goods LEFT JOIN yc_goods_detail as gd on o.id = gd.order WHERE o.id IS NOT NULL AND gd.id IS NOT NULL AND o.id = %d and g.goods = %d;", prm["order"], prm["goods"])
-
-	rows, err := db.Query(sqlQuery)
+	sqlQuery, args, err := query.Select("o.id", "o.ship_addr", "o.arrival_dt", "o.name", "g.goods", "g.name AS goods_name", "g.qty AS goods_qty", "gd.lot", "gd.tank").
+		From("yc_sales AS o").
+		LeftJoin("yc_goods AS g", "o.goods = g.goods").
+		LeftJoin("yc_goods_detail AS gd", "o.id = gd.order").
+		Where("o.id IS NOT NULL").
+		Where("gd.id IS NOT NULL").
+		WhereEq("o.id", prm["order"]).
+		WhereEq("g.goods", prm["goods"]).
+		Build()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var result interface{}
-	if rows.Next() {
-		// Assuming the row scan is done here
-		// rows.Scan(&result)
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return result, nil
+	return scan.Maps(rows)
 }
 
 // RegDetail registers customer details
@@ -234,7 +217,7 @@ func (c *Customer) RegDetail(get map[string]interface{}, post map[string]interfa
 	}
 
 	data["name"] = post["customer_name"]
-	data["rgdt"] = time.Now().Format("2006-01-02 15:04:05")
+	data["rgdt"] = civil.Timestamp()
 
 	// Assuming the insert operation is done here
 	// ret, err := db.Exec(insertQuery, data)
@@ -278,7 +261,7 @@ func (c *Customer) UpdDetail(get map[string]interface{}, post map[string]interfa
 		}
 	}
 
-	data["updt"] = time.Now().Format("2006-01-02 15:04:05")
+	data["updt"] = civil.Timestamp()
 
 	// Assuming the update operation is done here
 	// ret, err := db.Exec(updateQuery, data, post["customer"])
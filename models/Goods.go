@@ -3,7 +3,10 @@ package models
 import (
 	"database/sql"
 	"fmt"
-	"time"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/scan"
 )
 
 // Goods represents the goods model structure
@@ -52,37 +55,35 @@ func (g *Goods) GetValidElement(stepNum interface{}) ValidationRules {
 
 // GetList retrieves the list of goods
 func (g *Goods) GetList(params map[string]interface{}) ([]map[string]interface{}, error) {
-	query := `
-		SELECT g.*, g.name AS goods_name
-		FROM yc_goods AS g
-		WHERE g.goods IS NOT NULL
-	`
+	q := query.Select("g.*", "g.name AS goods_name").
+		From(g.name + " AS g").
+		Where("g.goods IS NOT NULL")
 
 	// Add conditions based on user role and params
 	if action, ok := params["action"].(string); ok {
 		if action == "search" {
-			if no, ok := params["s"].(map[string]interface{})["no"]; ok {
-				query += fmt.Sprintf(" AND g.goods = '%v'", no)
+			s, _ := params["s"].(map[string]interface{})
+			if no, ok := s["no"]; ok && no != "" {
+				q.WhereEq("g.goods", no)
 			}
-			if goodsName, ok := params["s"].(map[string]interface{})["goods_name"]; ok {
-				query += fmt.Sprintf(" AND g.name LIKE '%v%%'", goodsName)
+			if goodsName, ok := s["goods_name"]; ok && goodsName != "" {
+				q.WhereLike("g.name", query.LikePrefix(fmt.Sprint(goodsName)))
 			}
 		}
 	}
 
-	query += ";"
+	sqlQuery, args, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := g.db.Query(query)
+	rows, err := g.db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var result []map[string]interface{}
-	// Process rows and return results
-	// Implementation details omitted for brevity
-
-	return result, nil
+	return scan.Maps(rows)
 }
 
 // GetDetail retrieves detailed information about a specific good
@@ -99,11 +100,7 @@ func (g *Goods) GetDetail(params map[string]interface{}) (map[string]interface{}
 	}
 	defer rows.Close()
 
-	var result map[string]interface{}
-	// Process first row and return result
-	// Implementation details omitted for brevity
-
-	return result, nil
+	return scan.Map(rows)
 }
 
 // GetDetailByGoodsCode retrieves goods details by goods code
@@ -120,11 +117,7 @@ func (g *Goods) GetDetailByGoodsCode(goods interface{}) (map[string]interface{},
 	}
 	defer rows.Close()
 
-	var result map[string]interface{}
-	// Process first row and return result
-	// Implementation details omitted for brevity
-
-	return result, nil
+	return scan.Map(rows)
 }
 
 // RegDetail registers new goods details
@@ -139,7 +132,7 @@ func (g *Goods) UpdDetail(get map[string]interface{}, post map[string]interface{
 	data := make(map[string]interface{})
 	
 	// Set update fields
-	data["updt"] = time.Now().Format("2006-01-02 15:04:05")
+	data["updt"] = civil.Timestamp()
 	// Add other fields from post data
 
 	// Perform update
@@ -169,7 +162,7 @@ func (g *Goods) getPartsGoodsName() map[string]string {
 	for _, d := range goods {
 		if name, ok := d["name"]; ok {
 			separately := ""
-			if separatelyFg, ok := d["separately_fg"].(bool); ok && separatelyFg {
+			if fmt.Sprint(d["separately_fg"]) == "1" {
 				separately = " （バラ）"
 			}
 			result[fmt.Sprint(d["goods"])] = fmt.Sprintf("%v%s", name, separately)
@@ -4,18 +4,49 @@ package main
 import (
 	"database/sql"
 	"fmt"
-	"time"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/schedule"
+)
+
+// yc_repeat_exclude.type values, as scan.Maps prints them
+const (
+	EXCLUDE_CONFIRMED   = "0"
+	EXCLUDE_SKIPPED     = "1"
+	EXCLUDE_RESCHEDULED = "2"
 )
 
 // RepeatExclude represents the RepeatExclude class in PHP
 type RepeatExclude struct {
-	Name string
+	Name  string
+	db    *sql.DB
+	store *repository.Store
+	// Calendar holds the non-delivery days; nil means weekends and public
+	// holidays only
+	Calendar *calendar.Calendar
+	// MaxWindowDays limits the sdt-edt search window; zero means
+	// schedule.DefaultMaxDays
+	MaxWindowDays int
 }
 
-// NewRepeatExclude creates a new instance of RepeatExclude
-func NewRepeatExclude() *RepeatExclude {
+func (re *RepeatExclude) calendar() *calendar.Calendar {
+	if re.Calendar == nil {
+		re.Calendar = calendar.New()
+	}
+	return re.Calendar
+}
+
+// NewRepeatExclude creates a new instance of RepeatExclude. store reads
+// the repeat pauses.
+func NewRepeatExclude(db *sql.DB, store *repository.Store) *RepeatExclude {
 	return &RepeatExclude{
-		Name: "yc_repeat_exclude",
+		Name:  "yc_repeat_exclude",
+		db:    db,
+		store: store,
 	}
 }
 
@@ -61,105 +92,114 @@ func (re *RepeatExclude) GetValidElement(stepNum int) map[string]interface{} {
 
 // GetList retrieves the list of repeat information
 func (re *RepeatExclude) GetList(get map[string]interface{}) ([]map[string]interface{}, error) {
-	// Simulating global variables and functions
-	var db *sql.DB
+	db := re.db
 	curUser := getCurrentUser()
 
-	sqlQuery := `
-		SELECT scr.*, scr.sales AS sales, 
-		s.class, s.cars_tank, s.outgoing_warehouse, s.goods, s.ship_addr, s.qty, s.use_stock, s.customer, s.name, s.repeat_fg, s.delivery_dt,
-		c.name AS customer_name,
-		g.name AS goods_name
-		FROM yc_schedule_repeat AS scr
-		LEFT JOIN yc_sales AS s ON s.sales = scr.sales
-		LEFT JOIN yc_customer AS c ON s.customer = c.customer
-		LEFT JOIN yc_goods AS g ON s.goods = g.goods
-		WHERE scr.repeat IS NOT NULL
-	`
+	q := query.Select(
+		"scr.*", "scr.sales AS sales",
+		"s.class", "s.cars_tank", "s.outgoing_warehouse", "s.goods", "s.ship_addr", "s.qty", "s.use_stock", "s.customer", "s.name", "s.repeat_fg", "s.delivery_dt",
+		"c.name AS customer_name",
+		"g.name AS goods_name",
+	).
+		From("yc_schedule_repeat AS scr").
+		LeftJoin("yc_sales AS s", "s.sales = scr.sales").
+		LeftJoin("yc_customer AS c", "s.customer = c.customer").
+		LeftJoin("yc_goods AS g", "s.goods = g.goods").
+		Where("scr.repeat IS NOT NULL")
 
 	if !isAdmin(curUser) {
-		// sqlQuery += fmt.Sprintf("AND ap.mail = '%s'", curUser.Email)
+		// q.WhereEq("ap.mail", curUser.Email)
 	}
 
-	if get["action"] == nil {
-		sqlQuery += ";"
-	} else {
-		action := get["action"].(string)
+	if action, ok := get["action"].(string); ok {
 		if action == "search" {
-			// Add search conditions here
-			sqlQuery += ";"
+			s, _ := get["s"].(map[string]interface{})
+			if outgoingWarehouse, ok := s["outgoing_warehouse"]; ok && outgoingWarehouse != "" {
+				q.WhereEq("s.outgoing_warehouse", outgoingWarehouse)
+			}
 		} else {
-			// sqlQuery += fmt.Sprintf("AND ap.applicant = '%s';", prm.Post)
+			// q.WhereEq("ap.applicant", prm.Post)
 		}
 	}
 
-	rows, err := db.Query(sqlQuery)
+	sqlQuery, args, err := q.Build()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	// Process rows and generate repeat items
-	ret, err := re.makeRepeatItems(rows, get)
+	rows, err := db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	// Exclude already confirmed orders
-	rExcludes, err := db.Query("SELECT * FROM yc_repeat_exclude;")
+	// Confirmed, skipped and rescheduled occurrences
+	exQuery, exArgs, err := query.Select("*").From(re.Name).Build()
+	if err != nil {
+		return nil, err
+	}
+	rExcludes, err := db.Query(exQuery, exArgs...)
 	if err != nil {
 		return nil, err
 	}
 	defer rExcludes.Close()
 
+	excludes, err := scan.Maps(rExcludes)
+	if err != nil {
+		return nil, err
+	}
+
+	// rEx is keyed by sales and delivery date; moved lists the rescheduled
+	// occurrences by sales
 	rEx := make(map[string]map[string]interface{})
-	for rExcludes.Next() {
-		var d map[string]interface{}
-		// Scan data into d
-		if err := rExcludes.Scan(&d); err != nil {
+	moved := make(map[string][]map[string]interface{})
+	for _, d := range excludes {
+		deliveryDt, err := civil.FromValue(d["delivery_dt"])
+		if err != nil {
 			return nil, err
 		}
-		deliveryDt := d["delivery_dt"].(string)
-		sales := d["sales"].(string)
-		if rEx[deliveryDt] == nil {
-			rEx[deliveryDt] = make(map[string]interface{})
+		sales := fmt.Sprint(d["sales"])
+		if rEx[sales] == nil {
+			rEx[sales] = make(map[string]interface{})
+		}
+		rEx[sales][deliveryDt.String()] = d
+		if fmt.Sprint(d["type"]) == EXCLUDE_RESCHEDULED {
+			moved[sales] = append(moved[sales], d)
 		}
-		rEx[deliveryDt][sales] = d
 	}
 
-	for deliveryDt, list := range ret {
-		for sales := range list {
-			if rEx[deliveryDt][sales] != nil {
-				delete(ret[deliveryDt], sales)
-			}
-		}
+	pauses, err := re.store.Repeats.Pauses(0)
+	if err != nil {
+		return nil, err
 	}
 
-	return ret, nil
+	// Process rows and generate repeat items
+	return re.makeRepeatItems(rows, get, rEx, moved, schedule.PausesByRepeat(pauses))
 }
 
-// makeRepeatItems generates repeat items from the given rows
-func (re *RepeatExclude) makeRepeatItems(rows *sql.Rows, get map[string]interface{}) ([]map[string]interface{}, error) {
+// makeRepeatItems generates repeat items from the given rows. Paused
+// occurrences and those found in rEx are left out; rescheduled ones come
+// back on their new date under the same rules as schedule.Pending. A repeat whose schedule
+// is invalid fails the listing with its number.
+func (re *RepeatExclude) makeRepeatItems(rows *sql.Rows, get map[string]interface{}, rEx map[string]map[string]interface{}, moved map[string][]map[string]interface{}, pauses map[int64][]*repository.RepeatPause) ([]map[string]interface{}, error) {
 	// Generate dates for display
-	sdt, err := time.Parse("2006-01-02", get["s"].(map[string]interface{})["sdt"].(string))
+	s, _ := get["s"].(map[string]interface{})
+	sdt, _ := s["sdt"].(string)
+	edt, _ := s["edt"].(string)
+	window, err := schedule.ParseWindow(sdt, edt, re.MaxWindowDays)
 	if err != nil {
 		return nil, err
 	}
-	sdts := []string{sdt.Format("2006-01-02")}
-	for i := 0; i < OUTPUT_LIMIT; i++ {
-		sdt = sdt.AddDate(0, 0, 1)
-		sdts = append(sdts, sdt.Format("2006-01-02"))
+
+	list, err := scan.Maps(rows)
+	if err != nil {
+		return nil, err
 	}
 
 	var retRepeatItems []map[string]interface{}
-	for rows.Next() {
-		var r map[string]interface{}
-		// Scan data into r
-		if err := rows.Scan(&r); err != nil {
-			return nil, err
-		}
-
-		if r["sales"] == nil || r["repeat_s_dt"] == "0000-00-00" || r["repeat_e_dt"] == "0000-00-00" || r["period"] == nil {
+	for _, r := range list {
+		// scan.Maps reads 0000-00-00 dates as nil
+		if r["sales"] == nil || r["repeat_s_dt"] == nil || r["repeat_e_dt"] == nil || r["period"] == nil {
 			continue
 		}
 
@@ -170,41 +210,63 @@ func (re *RepeatExclude) makeRepeatItems(rows *sql.Rows, get map[string]interfac
 		r["rgdt"] = nil
 		r["updt"] = nil
 		r["upuser"] = nil
+		sales := fmt.Sprint(r["sales"])
+		repeat := schedule.ApplyRepeatRow(r)
 
-		var period string
-		switch r["period"].(int) {
-		default:
-			fallthrough
-		case 0:
-			period = "+1 day"
-		case 1:
-			period = "+1 week"
-		case 2:
-			period = "+1 month"
-		case 3:
-			period = "+1 year"
+		occurrences, err := schedule.Expand(r, window, re.calendar())
+		if err != nil {
+			return nil, fmt.Errorf("repeat %d: %w", repeat, err)
+		}
+		for _, occ := range schedule.Paused(occurrences, pauses[repeat]) {
+			deliveryDt := occ.Date.Format("2006-01-02")
+			if rEx[sales][deliveryDt] != nil {
+				continue
+			}
+			item := map[string]interface{}{
+				"delivery_dt": deliveryDt,
+				"sales":       r["sales"],
+				"data":        r,
+			}
+			if occ.Rolled() {
+				item["planned_dt"] = occ.Planned.Format("2006-01-02")
+			}
+			retRepeatItems = append(retRepeatItems, item)
 		}
 
-		rSdt, err := time.Parse("2006-01-02", r["repeat_s_dt"].(string))
+		sdt, err := civil.FromValue(r["repeat_s_dt"])
 		if err != nil {
 			return nil, err
 		}
-		deliveryDt := rSdt.Format("2006-01-02")
-
-		i := 0
-		for deliveryDt <= r["repeat_e_dt"].(string) {
-			if i != 0 {
-				rSdt = rSdt.AddDate(0, 0, 1)
+		edt, err := civil.FromValue(r["repeat_e_dt"])
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range moved[sales] {
+			newDt, err := civil.FromValue(d["new_delivery_dt"])
+			if err != nil {
+				return nil, err
+			}
+			plannedDt, err := civil.FromValue(d["delivery_dt"])
+			if err != nil {
+				return nil, err
 			}
-			deliveryDt = rSdt.Format("2006-01-02")
-			i++
-			if !contains(sdts, deliveryDt) || deliveryDt > r["repeat_e_dt"].(string) {
+			if !schedule.MovedIn(window, sdt, edt, plannedDt, newDt, pauses[repeat]) {
 				continue
 			}
+			data := r
+			if qty, _ := scan.ParseQty(fmt.Sprint(d["new_qty"])); qty != 0 {
+				data = make(map[string]interface{}, len(r))
+				for k, v := range r {
+					data[k] = v
+				}
+				data["qty"] = qty.String()
+			}
 			retRepeatItems = append(retRepeatItems, map[string]interface{}{
-				"delivery_dt": deliveryDt,
+				"delivery_dt": newDt.String(),
+				"planned_dt":  plannedDt.String(),
 				"sales":       r["sales"],
-				"data":        r,
+				"data":        data,
+				"reason":      d["reason"],
 			})
 		}
 	}
@@ -228,25 +290,15 @@ func isAdmin(user *User) bool {
 	return false
 }
 
-func contains(slice []string, item string) bool {
-	for _, v := range slice {
-		if v == item {
-			return true
-		}
-	}
-	return false
-}
-
 // User represents a user in the system
 type User struct {
 	Roles []string
 }
 
-const OUTPUT_LIMIT = 10
 
 func main() {
 	// Example usage
-	re := NewRepeatExclude()
+	re := NewRepeatExclude(nil, nil)
 	step1 := re.GetValidElement(1)
 	fmt.Println(step1)
 }
@@ -3,11 +3,28 @@ package main
 import (
 	"database/sql"
 	"fmt"
-	"time"
+	"strconv"
+
+	"github.com/geeknow112/srv-tools/models/lot"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
 )
 
 type Sales struct {
 	Name string
+	db   *sql.DB
+}
+
+// NewSales creates a new instance of Sales
+func NewSales(db *sql.DB) *Sales {
+	return &Sales{
+		Name: "yc_sales",
+		db:   db,
+	}
+}
+
+func (s *Sales) allocator() *lot.Allocator {
+	return &lot.Allocator{Store: repository.NewMySQL(s.db)}
 }
 
 func (s *Sales) GetValidElement(stepNum int) map[string]interface{} {
@@ -80,11 +97,18 @@ func (s *Sales) GetDetailByApplicantCode(applicant string) map[string]interface{
 	return row
 }
 
-func (s *Sales) GetLotNumberListBySales(get map[string]interface{}) map[string]interface{} {
-	// Placeholder for database interaction
-	var conv map[string]interface{}
-	// Simulate database query and processing
-	return conv
+// GetLotNumberListBySales returns the lot slots of get["sales"] with the
+// ordered and allocated quantities
+func (s *Sales) GetLotNumberListBySales(get map[string]interface{}) (map[string]interface{}, error) {
+	sales, err := toID(get["sales"])
+	if err != nil {
+		return nil, err
+	}
+	sum, err := s.allocator().Summary(sales)
+	if err != nil {
+		return nil, err
+	}
+	return convLotSummary(sum), nil
 }
 
 func (s *Sales) RegDetail(get map[string]interface{}, post map[string]interface{}) map[string]interface{} {
@@ -101,27 +125,123 @@ func (s *Sales) UpdDetail(get map[string]interface{}, post map[string]interface{
 	return rows
 }
 
-func (s *Sales) UpdLotDetail(get map[string]interface{}, post map[string]interface{}) bool {
-	// Placeholder for database interaction
-	// Simulate database query and processing
-	return true
+// UpdLotDetail saves the lot, tank and qty arrays posted by the lot screen.
+// When every row has an id the existing slots are updated, otherwise the
+// rows replace the slots of the sales. The quantities must add up to the
+// ordered quantity.
+func (s *Sales) UpdLotDetail(get map[string]interface{}, post map[string]interface{}) (bool, error) {
+	sales, err := toID(post["sales"])
+	if err != nil {
+		return false, err
+	}
+	ids, _ := post["id"].([]interface{})
+	lots, _ := post["lot"].([]interface{})
+	tanks, _ := post["tank"].([]interface{})
+	qtys, _ := post["qty"].([]interface{})
+
+	var as []lot.Assignment
+	update := len(lots) > 0
+	for i := range lots {
+		asg := lot.Assignment{Lot: fmt.Sprint(lots[i])}
+		if i < len(tanks) {
+			asg.Tank = fmt.Sprint(tanks[i])
+		}
+		if i < len(qtys) {
+			if asg.Qty, err = scan.ParseQty(fmt.Sprint(qtys[i])); err != nil {
+				return false, err
+			}
+		}
+		if i < len(ids) {
+			asg.Slot, _ = toID(ids[i])
+		}
+		if asg.Slot == 0 {
+			update = false
+		}
+		as = append(as, asg)
+	}
+
+	user := postString(post["upuser"])
+	if update {
+		_, err = s.allocator().Assign(sales, as, user)
+	} else {
+		_, err = s.allocator().Allocate(sales, as, user)
+	}
+	return err == nil, err
 }
 
-func (s *Sales) MakeLotSpace(get map[string]interface{}, post map[string]interface{}) bool {
-	// Placeholder for database interaction
-	// Simulate database query and processing
-	return true
+// MakeLotSpace creates one empty lot slot per goods unit for each sales in
+// post["sales"]
+func (s *Sales) MakeLotSpace(get map[string]interface{}, post map[string]interface{}) (bool, error) {
+	list, ok := post["sales"].([]interface{})
+	if !ok {
+		list = []interface{}{post["sales"]}
+	}
+	a := s.allocator()
+	for _, v := range list {
+		sales, err := toID(v)
+		if err != nil {
+			return false, err
+		}
+		if _, err := a.MakeSpace(sales, postString(post["upuser"])); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
 }
 
-func (s *Sales) MakeLotSpaceSingle(get map[string]interface{}, post map[string]interface{}) map[string]interface{} {
-	// Placeholder for database interaction
-	var updRet map[string]interface{}
-	// Simulate database query and processing
-	return updRet
+// MakeLotSpaceSingle creates a single lot slot for the whole quantity of
+// post["sales"] and returns the new slots
+func (s *Sales) MakeLotSpaceSingle(get map[string]interface{}, post map[string]interface{}) (map[string]interface{}, error) {
+	sales, err := toID(post["sales"])
+	if err != nil {
+		return nil, err
+	}
+	sum, err := s.allocator().MakeSpaceSingle(sales, postString(post["upuser"]))
+	if err != nil {
+		return nil, err
+	}
+	return convLotSummary(sum), nil
+}
+
+// convLotSummary converts a lot summary for the view
+func convLotSummary(sum *lot.Summary) map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(sum.Slots))
+	for _, slot := range sum.Slots {
+		list = append(list, map[string]interface{}{
+			"id":   slot.ID,
+			"slot": slot.Slot,
+			"lot":  slot.Lot,
+			"tank": slot.Tank,
+			"qty":  slot.Qty.String(),
+		})
+	}
+	return map[string]interface{}{
+		"sales":     sum.Sales,
+		"goods":     sum.Goods,
+		"qty":       sum.Ordered.String(),
+		"allocated": sum.Allocated.String(),
+		"complete":  sum.Complete,
+		"list":      list,
+	}
+}
+
+func postString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func toID(v interface{}) (int64, error) {
+	id, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid sales or slot id %v", v)
+	}
+	return id, nil
 }
 
 func main() {
 	// Example usage
-	sales := Sales{Name: "yc_sales"}
+	sales := NewSales(nil)
 	fmt.Println(sales.GetValidElement(1))
 }
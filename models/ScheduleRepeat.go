@@ -4,12 +4,36 @@ package main
 import (
 	"database/sql"
 	"fmt"
-	"time"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/leadtime"
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/schedule"
 )
 
 // ScheduleRepeat represents the schedule repeat structure
 type ScheduleRepeat struct {
 	Name string
+	// Calendar holds the non-delivery days; nil means weekends and public
+	// holidays only
+	Calendar *calendar.Calendar
+	// LeadTime resolves the arrival offset; nil means leadtime.DefaultDays
+	LeadTime *leadtime.Resolver
+	// MaxWindowDays limits the sdt-edt search window; zero means
+	// schedule.DefaultMaxDays
+	MaxWindowDays int
+	// Store reads the repeat pauses
+	Store *repository.Store
+}
+
+func (sr *ScheduleRepeat) calendar() *calendar.Calendar {
+	if sr.Calendar == nil {
+		sr.Calendar = calendar.New()
+	}
+	return sr.Calendar
 }
 
 // GetValidElement returns validation rules and messages based on step number
@@ -57,76 +81,78 @@ func (sr *ScheduleRepeat) GetList(get map[string]interface{}, db *sql.DB) ([]map
 	var ret []map[string]interface{}
 	// Assuming curUser and wpdb are available in the context
 	curUser := getCurrentUser()
-	sqlQuery := `
-		SELECT scr.*, scr.sales AS sales, s.class, s.cars_tank, s.outgoing_warehouse, s.goods, s.ship_addr, s.qty, s.use_stock, s.customer, s.name, s.repeat_fg, s.delivery_dt, s.field3,
-		c.name AS customer_name, g.name AS goods_name
-		FROM yc_schedule_repeat AS scr
-		LEFT JOIN yc_sales AS s ON s.sales = scr.sales
-		LEFT JOIN yc_customer AS c ON s.customer = c.customer
-		LEFT JOIN yc_goods AS g ON s.goods = g.goods
-		WHERE scr.repeat IS NOT NULL
-		AND s.status <> 9
-		AND s.repeat_fg = 1
-	`
+	q := query.Select(
+		"scr.*", "scr.sales AS sales", "s.class", "s.cars_tank", "s.outgoing_warehouse", "s.goods", "s.ship_addr", "s.qty", "s.use_stock", "s.customer", "s.name", "s.repeat_fg", "s.delivery_dt", "s.field3",
+		"c.name AS customer_name", "g.name AS goods_name", "g.separately_fg",
+	).
+		From("yc_schedule_repeat AS scr").
+		LeftJoin("yc_sales AS s", "s.sales = scr.sales").
+		LeftJoin("yc_customer AS c", "s.customer = c.customer").
+		LeftJoin("yc_goods AS g", "s.goods = g.goods").
+		Where("scr.repeat IS NOT NULL").
+		WhereNotEq("s.status", 9).
+		WhereEq("s.repeat_fg", 1)
 
 	if curUser.Role != "administrator" {
-		// sqlQuery += fmt.Sprintf("AND ap.mail = '%s'", curUser.Email)
+		// q.WhereEq("ap.mail", curUser.Email)
 	}
 
-	if action, ok := get["action"]; !ok || action == "" {
-		sqlQuery += ";"
-	} else if action == "search" {
-		if outgoingWarehouse, ok := get["s"].(map[string]interface{})["outgoing_warehouse"]; ok {
-			sqlQuery += fmt.Sprintf("AND s.outgoing_warehouse = '%s' ", outgoingWarehouse)
+	if action, ok := get["action"]; ok && action == "search" {
+		s, _ := get["s"].(map[string]interface{})
+		if outgoingWarehouse, ok := s["outgoing_warehouse"]; ok && outgoingWarehouse != "" {
+			q.WhereEq("s.outgoing_warehouse", outgoingWarehouse)
 		}
-		sqlQuery += ";"
 	}
 
-	rows, err := db.Query(sqlQuery)
+	sqlQuery, args, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	for rows.Next() {
-		var row map[string]interface{}
-		// Assuming a function to scan rows into a map
-		if err := scanRowIntoMap(rows, &row); err != nil {
-			return nil, err
-		}
-		ret = append(ret, row)
+	ret, err = scan.Maps(rows)
+	if err != nil {
+		return nil, err
 	}
 
 	// Further processing of ret as per the original PHP logic
 	return ret, nil
 }
 
-// MakeRepeatItems generates repeat items
-func (sr *ScheduleRepeat) MakeRepeatItems(repeatItems []map[string]interface{}, get map[string]interface{}) []map[string]interface{} {
-	var retRepeatList []map[string]interface{}
-	sdt, _ := time.Parse("2006-01-02", get["s"].(map[string]interface{})["sdt"].(string))
-	sdts := []string{sdt.Format("2006-01-02")}
-
-	outputLimit := OUTPUT_LIMIT
-	if edtStr, ok := get["s"].(map[string]interface{})["edt"].(string); ok {
-		edt, _ := time.Parse("2006-01-02", edtStr)
-		intervalDays := edt.Sub(sdt).Hours() / 24
-		outputLimit = int(intervalDays)
+// Pauses returns the yc_repeat_pause rows by repeat, for MakeRepeatItems
+func (sr *ScheduleRepeat) Pauses() (map[int64][]*repository.RepeatPause, error) {
+	pauses, err := sr.Store.Repeats.Pauses(0)
+	if err != nil {
+		return nil, err
 	}
+	return schedule.PausesByRepeat(pauses), nil
+}
 
-	for i := 0; i < outputLimit; i++ {
-		sdt = sdt.AddDate(0, 0, 1)
-		sdts = append(sdts, sdt.Format("2006-01-02"))
+// MakeRepeatItems generates the repeat items between the sdt and edt
+// search parameters, leaving out the paused ones. A repeat whose schedule
+// is invalid fails the listing with its number, as on the exclusion
+// screen, instead of disappearing.
+func (sr *ScheduleRepeat) MakeRepeatItems(repeatItems []map[string]interface{}, get map[string]interface{}, pauses map[int64][]*repository.RepeatPause) ([]map[string]interface{}, error) {
+	var retRepeatList []map[string]interface{}
+	s, _ := get["s"].(map[string]interface{})
+	sdt, _ := s["sdt"].(string)
+	edt, _ := s["edt"].(string)
+	window, err := schedule.ParseWindow(sdt, edt, sr.MaxWindowDays)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, r := range repeatItems {
 		if _, ok := r["sales"]; !ok {
 			continue
 		}
-		if _, ok := r["repeat_s_dt"]; !ok || r["repeat_s_dt"] == "0000-00-00" {
-			continue
-		}
-		if _, ok := r["repeat_e_dt"]; !ok || r["repeat_e_dt"] == "0000-00-00" {
+		// scan.Maps reads 0000-00-00 dates as nil
+		if r["repeat_s_dt"] == nil || r["repeat_e_dt"] == nil {
 			continue
 		}
 		if _, ok := r["period"]; !ok {
@@ -134,7 +160,7 @@ func (sr *ScheduleRepeat) MakeRepeatItems(repeatItems []map[string]interface{},
 		}
 
 		r["base_sales"] = r["sales"]
-		if r["class"] != 7 {
+		if fmt.Sprint(r["class"]) != "7" {
 			r["class"] = 0
 		}
 		r["lot_fg"] = 0
@@ -142,56 +168,54 @@ func (sr *ScheduleRepeat) MakeRepeatItems(repeatItems []map[string]interface{},
 		r["rgdt"] = nil
 		r["updt"] = nil
 		r["upuser"] = nil
+		repeat := schedule.ApplyRepeatRow(r)
 
-		var period string
-		switch r["period"] {
-		default:
-			fallthrough
-		case 0:
-			period = "+1 day"
-		case 1:
-			period = "+1 week"
-		case 2:
-			period = "+1 month"
-		case 3:
-			period = "+1 year"
-		case 9:
-			period = fmt.Sprintf("+%d day", r["span"])
+		occurrences, err := schedule.Expand(r, window, sr.calendar())
+		if err != nil {
+			return nil, fmt.Errorf("repeat %d: %w", repeat, err)
 		}
-
-		rSdt, _ := time.Parse("2006-01-02", r["repeat_s_dt"].(string))
-		deliveryDt := rSdt.Format("2006-01-02")
-
-		i := 0
-		for deliveryDt <= r["repeat_e_dt"].(string) {
-			if i != 0 {
-				rSdt = rSdt.AddDate(0, 0, 1)
-			}
-			deliveryDt = rSdt.Format("2006-01-02")
-			i++
-			if !contains(sdts, deliveryDt) {
-				continue
-			}
-			if deliveryDt > r["repeat_e_dt"].(string) {
-				continue
-			}
-			retRepeatList = append(retRepeatList, map[string]interface{}{
+		for _, occ := range schedule.Paused(occurrences, pauses[repeat]) {
+			deliveryDt := occ.Date.Format("2006-01-02")
+			item := map[string]interface{}{
 				"delivery_dt": deliveryDt,
+				"arrival_dt":  sr.SetArrivalDt(deliveryDt, repeatKey(r)),
 				"sales":       r["sales"],
 				"item":        r,
-			})
+			}
+			if occ.Rolled() {
+				item["planned_dt"] = occ.Planned.Format("2006-01-02")
+			}
+			retRepeatList = append(retRepeatList, item)
 		}
 	}
 
 	// Further processing of retRepeatList as per the original PHP logic
-	return retRepeatList
+	return retRepeatList, nil
+}
+
+// SetArrivalDt returns the arrival date: the lead time resolved for key,
+// in business days of the outgoing warehouse, before the delivery date
+func (sr *ScheduleRepeat) SetArrivalDt(deliveryDt string, key leadtime.Key) string {
+	resolver := sr.LeadTime
+	if resolver == nil {
+		resolver = leadtime.NewResolver(nil, leadtime.DefaultDays)
+	}
+	dt, err := civil.Parse(deliveryDt)
+	if err != nil {
+		return ""
+	}
+	arDt, _ := resolver.ArrivalDt(sr.calendar(), key, dt.Time())
+	return civil.DateOf(arDt).String()
 }
 
-// SetArrivalDt sets the arrival date
-func (sr *ScheduleRepeat) SetArrivalDt(deliveryDt string) string {
-	arDt, _ := time.Parse("2006-01-02", deliveryDt)
-	arDt = arDt.AddDate(0, 0, -3)
-	return arDt.Format("2006-01-02")
+// repeatKey is the lead-time key of a GetList row
+func repeatKey(r map[string]interface{}) leadtime.Key {
+	return leadtime.Key{
+		Customer:     fmt.Sprint(r["customer"]),
+		Goods:        fmt.Sprint(r["goods"]),
+		Warehouse:    fmt.Sprint(r["outgoing_warehouse"]),
+		SeparatelyFg: fmt.Sprint(r["separately_fg"]) == "1" || r["separately_fg"] == true,
+	}
 }
 
 // Helper functions
@@ -200,27 +224,12 @@ func getCurrentUser() *User {
 	return &User{Role: "user", Email: "user@example.com"}
 }
 
-func scanRowIntoMap(rows *sql.Rows, dest *map[string]interface{}) error {
-	// Dummy implementation
-	return nil
-}
-
-func contains(slice []string, item string) bool {
-	for _, v := range slice {
-		if v == item {
-			return true
-		}
-	}
-	return false
-}
-
 // User represents a user structure
 type User struct {
 	Role  string
 	Email string
 }
 
-const OUTPUT_LIMIT = 10
 
 func main() {
 	// Example usage
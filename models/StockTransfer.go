@@ -2,7 +2,14 @@ package stock
 
 import (
 	"database/sql"
-	"time"
+	"fmt"
+
+	"github.com/geeknow112/srv-tools/models/dialect"
+	"github.com/geeknow112/srv-tools/models/picking"
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/transfer"
 )
 
 // StockTransfer short description
@@ -10,6 +17,14 @@ import (
 // long description
 type StockTransfer struct {
 	Stock
+	// Dialect selects the SQL flavour; nil means MySQL
+	Dialect dialect.Dialect
+	// Strategy chooses the stock details a transfer takes; nil means
+	// picking.FIFO
+	Strategy picking.Strategy
+	// User is the upuser of the ledger entries and cancellations of a
+	// transfer
+	User string
 }
 
 // ValidationRules represents validation rules and messages
@@ -18,6 +33,9 @@ type ValidationRules struct {
 	Messages map[string]string
 }
 
+// StockDetail is a single yc_stock_detail row joined with its stock header
+type StockDetail = repository.StockDetail
+
 // GetValidElement returns validation rules for a specific step
 func (st *StockTransfer) GetValidElement(stepNum interface{}) *ValidationRules {
 	step1 := &ValidationRules{
@@ -56,84 +74,68 @@ func (st *StockTransfer) RegDetail(get interface{}, post *Post) (*StockResult, e
 		return nil, err
 	}
 
-	// Process stock reduction for Tamba SP
-	stocks := make(map[int][]*StockDetail)
+	// Reduce the stock of the warehouse each receiving warehouse is
+	// supplied from (丹波SP unless routed otherwise). Every goods is
+	// reserved under row locks so a concurrent transfer cannot take the
+	// same barcode, and posted to the ledger as in transit; rows without a
+	// quantity are skipped as before.
+	lines := make([]transfer.Line, len(rows.GoodsList))
 	for i, goods := range rows.GoodsList {
-		qty := rows.QtyList[i]
-		rwh := rows.ReceiveWarehouse[i]
-
-		if goods == "" || qty == 0 || rwh == "" || rwh == "2" {
-			continue
-		}
-
-		stockDetails, err := st.GetDetailByGoodsCode(goods, qty)
-		if err != nil {
-			return nil, err
-		}
-		stocks[i] = stockDetails
+		lines[i] = transfer.Line{Goods: goods, To: rows.ReceiveWarehouse[i], Qty: rows.QtyList[i]}
 	}
-
-	for _, stock := range stocks {
-		for _, d := range stock {
-			if err := st.UpdTransferFg(d.ID); err != nil {
-				return nil, err
-			}
+	svc := st.transfers()
+	if err := svc.SendAll(rows.Stock, lines, st.User); err != nil {
+		// Stock.RegDetail wrote the yc_stock record of the transfer on its
+		// own connection, outside the transaction of SendAll; delete it
+		// rather than leave a transfer that sends nothing
+		if derr := svc.Store.Stock.DeleteTransfer(rows.Stock); derr != nil && derr != repository.ErrNotFound {
+			return nil, fmt.Errorf("%w (deleting transfer %s: %v)", err, rows.Stock, derr)
 		}
+		return nil, err
 	}
 
 	return rows, nil
 }
 
-// GetDetailByGoodsCode retrieves stock details by goods code
-func (st *StockTransfer) GetDetailByGoodsCode(goods string, qty int) ([]*StockDetail, error) {
-	query := `
-		SELECT st.*, std.id, std.lot, std.barcode, std.transfer_fg 
-		FROM %s as st 
-		LEFT JOIN yc_stock_detail as std ON st.stock = std.stock 
-		WHERE st.goods = ? 
-		AND st.warehouse = '2'
-		AND std.transfer_fg != '1'
-		LIMIT 0, ?`
-
-	query = fmt.Sprintf(query, st.GetTableName())
-	rows, err := st.db.Query(query, goods, qty)
+func (st *StockTransfer) transfers() *transfer.Service {
+	return &transfer.Service{Store: repository.NewSQL(st.db, st.Dialect), Strategy: st.Strategy}
+}
+
+// GetDetailByGoodsCode picks qty stock details of goods in warehouse with
+// the transfer's picking strategy. The details are not locked; use
+// RegDetail to take them.
+func (st *StockTransfer) GetDetailByGoodsCode(goods, warehouse string, qty int) ([]*StockDetail, error) {
+	sqlQuery, args, err := query.Select("st.stock", "st.goods", "st.warehouse", "st.arrival_dt", "std.id", "std.lot", "std.barcode", "std.expiry_dt", "std.transfer_fg", "std.pick_strategy").
+		From(st.GetTableName()+" AS st").
+		Join("INNER", "yc_stock_detail AS std", "st.stock = std.stock").
+		WhereEq("st.goods", goods).
+		WhereEq("st.warehouse", warehouse).
+		WhereNotEq("std.transfer_fg", 1).
+		OrderBy("st.arrival_dt", false).
+		OrderBy("std.id", false).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := st.db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var details []*StockDetail
-	for rows.Next() {
-		detail := &StockDetail{}
-		if err := rows.Scan(&detail); err != nil {
-			return nil, err
-		}
-		details = append(details, detail)
+	if err := scan.Structs(rows, &details); err != nil {
+		return nil, err
 	}
 
-	return details, nil
-}
-
-// UpdTransferFg updates the transfer flag in stock details
-func (st *StockTransfer) UpdTransferFg(id int) error {
-	query := `
-		UPDATE yc_stock_detail 
-		SET transfer_fg = ?, updt = ? 
-		WHERE id = ?`
-
-	_, err := st.db.Exec(query, true, time.Now().Format("2006-01-02 15:04:05"), id)
-	return err
+	return picking.Or(st.Strategy).Pick(details, qty)
 }
 
-// CancelTransfer cancels stock transfer
-func (st *StockTransfer) CancelTransfer(stock string) error {
-	query := `
-		DELETE st FROM %s as st 
-		LEFT JOIN yc_stock_detail as std ON st.stock = std.stock 
-		WHERE st.stock = ? 
-		AND st.transfer_fg = '1'`
-
-	query = fmt.Sprintf(query, st.GetTableName())
-	_, err := st.db.Exec(query, stock)
-	return err
+// CancelTransfer cancels stock transfer. The stock details it took are
+// given back to the warehouse they came from and the cancellation is
+// recorded with the user and reason; a transfer already received cannot
+// be cancelled.
+func (st *StockTransfer) CancelTransfer(stock, reason string) (*repository.TransferCancel, error) {
+	return st.transfers().Cancel(stock, reason, st.User)
 }
@@ -0,0 +1,348 @@
+// Package barcode reads the Code-128 and GS1-128 labels on feed bags as a
+// handheld scanner sends them.
+//
+// A GS1-128 label is recognised by the "]C1" symbology identifier, by a
+// leading FNC1 (sent as the GS character) or by the human readable
+// "(01)...(10)..." form. Its element strings are split on the application
+// identifiers (AIs); variable-length elements end at a GS character or at
+// the end of the data. Anything else is a plain Code-128 value.
+package barcode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+// Symbology tells plain Code-128 from GS1-128
+type Symbology string
+
+const (
+	Code128 Symbology = "code128"
+	GS1128  Symbology = "gs1-128"
+)
+
+// GS is the group separator that stands for FNC1 inside GS1-128 data
+const GS = "\x1d"
+
+var (
+	// ErrEmpty is returned for a scan without data
+	ErrEmpty = errors.New("barcode: empty scan")
+	// ErrInvalid is wrapped when GS1-128 data cannot be split into
+	// element strings
+	ErrInvalid = errors.New("barcode: invalid GS1-128 data")
+)
+
+// AIs used on feed labels
+const (
+	AISSCC       = "00"
+	AIGTIN       = "01"
+	AIContent    = "02"
+	AIProduction = "11"
+	AIBestBefore = "15"
+	AIExpiry     = "17"
+	AIVariant    = "20"
+	AILot        = "10"
+	AISerial     = "21"
+	AICount      = "37"
+	// AINetKg is 310n: net weight in kg with n decimals
+	AINetKg = "310"
+)
+
+// ai describes the data of an application identifier: length is the fixed
+// data length, or the maximum when variable
+type ai struct {
+	length   int
+	variable bool
+}
+
+var ais = map[string]ai{
+	AISSCC:       {18, false},
+	AIGTIN:       {14, false},
+	AIContent:    {14, false},
+	AIProduction: {6, false},
+	"13":         {6, false},
+	AIBestBefore: {6, false},
+	"16":         {6, false},
+	AIExpiry:     {6, false},
+	AIVariant:    {2, false},
+	AILot:        {20, true},
+	AISerial:     {20, true},
+	"22":         {20, true},
+	"240":        {30, true},
+	"241":        {30, true},
+	"30":         {8, true},
+	AICount:      {8, true},
+	"400":        {30, true},
+}
+
+func init() {
+	for n := 0; n <= 5; n++ {
+		ais[AINetKg+strconv.Itoa(n)] = ai{6, false}
+	}
+}
+
+// Code is a parsed scan
+type Code struct {
+	// Raw is the scan as received
+	Raw       string
+	Symbology Symbology
+	// Value is the data without symbology identifier or leading FNC1
+	Value string
+	// Elements holds the GS1 element strings by AI, in scan order in AIs
+	Elements map[string]string
+	AIs      []string
+
+	GTIN       string
+	Lot        string
+	Serial     string
+	Production civil.Date
+	BestBefore civil.Date
+	Expiry     civil.Date
+	Count      int
+	NetKg      scan.Qty
+}
+
+// UseBy is the expiry date, or the best before date when the label has
+// no expiry
+func (c *Code) UseBy() civil.Date {
+	if !c.Expiry.IsZero() {
+		return c.Expiry
+	}
+	return c.BestBefore
+}
+
+// HRI returns the human readable form, "(01)04912345678904(10)L001", of a
+// GS1-128 code and the value of a Code-128 one
+func (c *Code) HRI() string {
+	if c.Symbology != GS1128 {
+		return c.Value
+	}
+	var b strings.Builder
+	for _, id := range c.AIs {
+		b.WriteString("(" + id + ")" + c.Elements[id])
+	}
+	return b.String()
+}
+
+// Keys returns the values a stock detail barcode may have been registered
+// under for this scan, most specific first and without duplicates
+func (c *Code) Keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	add := func(k string) {
+		if k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	add(c.Value)
+	if c.Symbology == GS1128 {
+		add(c.HRI())
+		add(strings.ReplaceAll(c.Value, GS, ""))
+		add(c.Serial)
+	}
+	return keys
+}
+
+// Parse reads a scan
+func Parse(raw string) (*Code, error) {
+	data := strings.TrimRight(raw, "\r\n")
+	if strings.TrimSpace(data) == "" {
+		return nil, ErrEmpty
+	}
+	c := &Code{Raw: raw, Symbology: Code128, Value: data}
+
+	switch {
+	case strings.HasPrefix(data, "]C1"):
+		data = data[3:]
+	case strings.HasPrefix(data, "]C0"):
+		c.Value = data[3:]
+		return c, nil
+	case strings.HasPrefix(data, GS):
+		data = data[1:]
+	case isHRI(data):
+		return c, c.parseHRI(data)
+	default:
+		return c, nil
+	}
+	c.Symbology, c.Value = GS1128, data
+	return c, c.parseElements(data)
+}
+
+func isHRI(s string) bool {
+	return len(s) >= 4 && s[0] == '(' && strings.IndexByte(s, ')') > 1 && isDigits(s[1:strings.IndexByte(s, ')')])
+}
+
+// parseHRI splits "(01)...(10)..." into element strings
+func (c *Code) parseHRI(s string) error {
+	c.Symbology, c.Value = GS1128, ""
+	var flat strings.Builder
+	for s != "" {
+		end := strings.IndexByte(s, ')')
+		if s[0] != '(' || end < 0 {
+			return fmt.Errorf("%w: %q", ErrInvalid, s)
+		}
+		id := s[1:end]
+		s = s[end+1:]
+		next := strings.IndexByte(s, '(')
+		if next < 0 {
+			next = len(s)
+		}
+		value := s[:next]
+		s = s[next:]
+		spec, ok := lookup(id)
+		if !ok {
+			return fmt.Errorf("%w: unknown AI %s", ErrInvalid, id)
+		}
+		if err := c.set(id, value); err != nil {
+			return err
+		}
+		flat.WriteString(id + value)
+		if spec.variable && s != "" {
+			flat.WriteString(GS)
+		}
+	}
+	c.Value = flat.String()
+	return nil
+}
+
+// parseElements splits scanner data, FNC1 sent as GS, into element strings
+func (c *Code) parseElements(s string) error {
+	for s != "" {
+		id, spec, ok := matchAI(s)
+		if !ok {
+			return fmt.Errorf("%w: unknown AI at %q", ErrInvalid, s)
+		}
+		s = s[len(id):]
+		var value string
+		if spec.variable {
+			end := strings.Index(s, GS)
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], strings.TrimPrefix(s[end:], GS)
+		} else {
+			if len(s) < spec.length {
+				return fmt.Errorf("%w: AI %s needs %d characters", ErrInvalid, id, spec.length)
+			}
+			value, s = s[:spec.length], strings.TrimPrefix(s[spec.length:], GS)
+		}
+		if err := c.set(id, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lookup(id string) (ai, bool) {
+	spec, ok := ais[id]
+	return spec, ok
+}
+
+// matchAI finds the AI at the start of s; AIs are two to four digits
+func matchAI(s string) (string, ai, bool) {
+	for n := 2; n <= 4 && n <= len(s); n++ {
+		if spec, ok := ais[s[:n]]; ok {
+			return s[:n], spec, true
+		}
+	}
+	return "", ai{}, false
+}
+
+// set stores the element string of id and decodes the ones a stock
+// detail is checked against
+func (c *Code) set(id, value string) error {
+	spec, _ := lookup(id)
+	if value == "" || len(value) > spec.length || (!spec.variable && len(value) != spec.length) {
+		return fmt.Errorf("%w: AI %s has %d characters", ErrInvalid, id, len(value))
+	}
+	if c.Elements == nil {
+		c.Elements = make(map[string]string)
+	}
+	if _, dup := c.Elements[id]; !dup {
+		c.AIs = append(c.AIs, id)
+	}
+	c.Elements[id] = value
+
+	var err error
+	switch {
+	case id == AIGTIN:
+		c.GTIN = value
+	case id == AILot:
+		c.Lot = value
+	case id == AISerial:
+		c.Serial = value
+	case id == AIProduction:
+		c.Production, err = date(id, value)
+	case id == AIBestBefore:
+		c.BestBefore, err = date(id, value)
+	case id == AIExpiry:
+		c.Expiry, err = date(id, value)
+	case id == AICount:
+		if c.Count, err = strconv.Atoi(value); err != nil {
+			err = fmt.Errorf("%w: AI %s %q is not a count", ErrInvalid, id, value)
+		}
+	case strings.HasPrefix(id, AINetKg):
+		c.NetKg, err = weight(id, value)
+	}
+	return err
+}
+
+// date reads a YYMMDD element. The century is the one that puts the date
+// within 49 years before or 50 years after today, and day 00 is the last
+// day of the month, as GS1 specifies.
+func date(id, s string) (civil.Date, error) {
+	if !isDigits(s) {
+		return civil.Date{}, fmt.Errorf("%w: AI %s %q is not a date", ErrInvalid, id, s)
+	}
+	yy, _ := strconv.Atoi(s[0:2])
+	mm, _ := strconv.Atoi(s[2:4])
+	dd, _ := strconv.Atoi(s[4:6])
+	if mm < 1 || mm > 12 {
+		return civil.Date{}, fmt.Errorf("%w: AI %s %q has no month %d", ErrInvalid, id, s, mm)
+	}
+
+	year := civil.Today().Year
+	y := year/100*100 + yy
+	switch diff := yy - year%100; {
+	case diff >= 51:
+		y -= 100
+	case diff <= -50:
+		y += 100
+	}
+	last := time.Date(y, time.Month(mm)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if dd == 0 {
+		dd = last
+	}
+	if dd > last {
+		return civil.Date{}, fmt.Errorf("%w: AI %s %q has no day %d", ErrInvalid, id, s, dd)
+	}
+	return civil.Date{Year: y, Month: time.Month(mm), Day: dd}, nil
+}
+
+// weight reads a 310n element: six digits with n of them decimals
+func weight(id, s string) (scan.Qty, error) {
+	if !isDigits(s) {
+		return 0, fmt.Errorf("%w: AI %s %q is not a weight", ErrInvalid, id, s)
+	}
+	n := int(id[3] - '0')
+	return scan.ParseQty(s[:6-n] + "." + s[6-n:])
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
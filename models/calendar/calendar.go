@@ -0,0 +1,262 @@
+package calendar
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+// AllWarehouses is the warehouse code of closures that apply everywhere
+// (company-wide blackout dates)
+const AllWarehouses = ""
+
+const dateLayout = "2006-01-02"
+
+// Policy is what repeat expansion does with an occurrence that falls on a
+// non-delivery day. It is stored in yc_schedule_repeat.roll_policy.
+type Policy int
+
+const (
+	// RollForward delivers on the next business day
+	RollForward Policy = 0
+	// RollBackward delivers on the previous business day
+	RollBackward Policy = 1
+	// Skip drops the occurrence
+	Skip Policy = 2
+	// Keep delivers on the original date regardless of the calendar
+	Keep Policy = 3
+)
+
+// ParsePolicy reads a roll_policy column value. An empty value is RollForward.
+func ParsePolicy(s string) (Policy, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return RollForward, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > int(Keep) {
+		return 0, fmt.Errorf("calendar: invalid roll policy %q", s)
+	}
+	return Policy(n), nil
+}
+
+// maxRoll bounds the search for a business day so that a misconfigured
+// calendar (every day closed) cannot loop forever
+const maxRoll = 366
+
+// Calendar decides which days a warehouse delivers on. Weekends and
+// Japanese public holidays are closed unless disabled; Close adds
+// warehouse closures and company-wide blackout dates. A Calendar is safe
+// for concurrent use.
+type Calendar struct {
+	mu       sync.RWMutex
+	weekend  map[time.Weekday]bool
+	holidays bool
+	closed   map[string]map[time.Time]string
+}
+
+// New returns a calendar closed on Saturdays, Sundays and public holidays
+func New() *Calendar {
+	return &Calendar{
+		weekend:  map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+		holidays: true,
+		closed:   make(map[string]map[time.Time]string),
+	}
+}
+
+// SetWeekend replaces the weekly closed days
+func (c *Calendar) SetWeekend(days ...time.Weekday) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.weekend = make(map[time.Weekday]bool)
+	for _, d := range days {
+		c.weekend[d] = true
+	}
+}
+
+// SetHolidays turns the public holiday closures on or off
+func (c *Calendar) SetHolidays(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.holidays = on
+}
+
+// Close marks d as closed for warehouse, or for every warehouse when
+// warehouse is AllWarehouses
+func (c *Calendar) Close(warehouse string, d time.Time, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed[warehouse] == nil {
+		c.closed[warehouse] = make(map[time.Time]string)
+	}
+	c.closed[warehouse][dateOf(d)] = reason
+}
+
+// Open removes a closure added by Close
+func (c *Calendar) Open(warehouse string, d time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.closed[warehouse], dateOf(d))
+}
+
+// Reason returns why warehouse does not deliver on d, or "" on a business day
+func (c *Calendar) Reason(warehouse string, d time.Time) string {
+	d = dateOf(d)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if reason, ok := c.closed[warehouse][d]; ok {
+		return nonEmpty(reason, "休業日")
+	}
+	if reason, ok := c.closed[AllWarehouses][d]; ok {
+		return nonEmpty(reason, "休業日")
+	}
+	if c.holidays {
+		if name, ok := Holiday(d); ok {
+			return name
+		}
+	}
+	if c.weekend[d.Weekday()] {
+		return "週休日"
+	}
+	return ""
+}
+
+// IsBusinessDay reports whether warehouse delivers on d
+func (c *Calendar) IsBusinessDay(warehouse string, d time.Time) bool {
+	return c.Reason(warehouse, d) == ""
+}
+
+// Next returns the first business day on or after d
+func (c *Calendar) Next(warehouse string, d time.Time) (time.Time, bool) {
+	return c.step(warehouse, dateOf(d), 1)
+}
+
+// Prev returns the last business day on or before d
+func (c *Calendar) Prev(warehouse string, d time.Time) (time.Time, bool) {
+	return c.step(warehouse, dateOf(d), -1)
+}
+
+func (c *Calendar) step(warehouse string, d time.Time, dir int) (time.Time, bool) {
+	for i := 0; i < maxRoll; i++ {
+		if c.IsBusinessDay(warehouse, d) {
+			return d, true
+		}
+		d = d.AddDate(0, 0, dir)
+	}
+	return time.Time{}, false
+}
+
+// Roll applies policy to an occurrence on d. ok is false when the
+// occurrence is dropped.
+func (c *Calendar) Roll(warehouse string, d time.Time, policy Policy) (time.Time, bool) {
+	d = dateOf(d)
+	switch policy {
+	case Keep:
+		return d, true
+	case Skip:
+		return d, c.IsBusinessDay(warehouse, d)
+	case RollBackward:
+		return c.Prev(warehouse, d)
+	}
+	return c.Next(warehouse, d)
+}
+
+// AddBusinessDays moves n business days from d; a negative n moves back.
+// d itself does not need to be a business day.
+func (c *Calendar) AddBusinessDays(warehouse string, d time.Time, n int) time.Time {
+	d = dateOf(d)
+	dir := 1
+	if n < 0 {
+		dir, n = -1, -n
+	}
+	for i := 0; n > 0 && i < maxRoll*(n+1); i++ {
+		d = d.AddDate(0, 0, dir)
+		if c.IsBusinessDay(warehouse, d) {
+			n--
+		}
+	}
+	return d
+}
+
+// Occurrence is a scheduled delivery after the roll policy was applied.
+// Planned is the date the recurrence rule produced.
+type Occurrence struct {
+	Date    time.Time
+	Planned time.Time
+}
+
+// Rolled reports whether the occurrence was moved off its planned date
+func (o Occurrence) Rolled() bool {
+	return !o.Date.Equal(o.Planned)
+}
+
+// Apply rolls every date of one series and returns the result sorted by
+// date. Two occurrences rolled onto the same day are delivered once.
+func (c *Calendar) Apply(warehouse string, dates []time.Time, policy Policy) []Occurrence {
+	seen := make(map[time.Time]bool)
+	var ret []Occurrence
+	for _, planned := range dates {
+		d, ok := c.Roll(warehouse, planned, policy)
+		if !ok || seen[d] {
+			continue
+		}
+		seen[d] = true
+		ret = append(ret, Occurrence{Date: d, Planned: dateOf(planned)})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Date.Before(ret[j].Date) })
+	return ret
+}
+
+// Load returns a calendar with the closures recorded in yc_calendar_closure
+// between from and to (inclusive)
+func Load(db *sql.DB, from, to time.Time) (*Calendar, error) {
+	q, args, err := query.Select("warehouse", "closed_dt", "reason").
+		From("yc_calendar_closure").
+		Where("closed_dt BETWEEN ? AND ?", from.Format(dateLayout), to.Format(dateLayout)).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []struct {
+		Warehouse string    `db:"warehouse"`
+		ClosedDt  time.Time `db:"closed_dt"`
+		Reason    string    `db:"reason"`
+	}
+	if err := scan.Structs(rows, &list); err != nil {
+		return nil, err
+	}
+
+	c := New()
+	for _, r := range list {
+		c.Close(r.Warehouse, r.ClosedDt, r.Reason)
+	}
+	return c, nil
+}
+
+func nonEmpty(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func dateOf(t time.Time) time.Time {
+	return date(t.Date())
+}
@@ -0,0 +1,171 @@
+package calendar_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+)
+
+func d(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// holidays lists the public holidays of year as "date name", in date order
+func holidays(year int) []string {
+	var ret []string
+	for day, name := range calendar.Holidays(year) {
+		ret = append(ret, day.Format("2006-01-02")+" "+name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// TestHolidays checks whole years against the holidays published by the
+// Cabinet Office
+func TestHolidays(t *testing.T) {
+	tests := []struct {
+		year int
+		want []string
+	}{
+		{2025, []string{
+			"2025-01-01 元日",
+			"2025-01-13 成人の日",
+			"2025-02-11 建国記念の日",
+			"2025-02-23 天皇誕生日",
+			"2025-02-24 振替休日",
+			"2025-03-20 春分の日",
+			"2025-04-29 昭和の日",
+			"2025-05-03 憲法記念日",
+			"2025-05-04 みどりの日",
+			"2025-05-05 こどもの日",
+			"2025-05-06 振替休日",
+			"2025-07-21 海の日",
+			"2025-08-11 山の日",
+			"2025-09-15 敬老の日",
+			"2025-09-23 秋分の日",
+			"2025-10-13 スポーツの日",
+			"2025-11-03 文化の日",
+			"2025-11-23 勤労感謝の日",
+			"2025-11-24 振替休日",
+		}},
+		{2026, []string{
+			"2026-01-01 元日",
+			"2026-01-12 成人の日",
+			"2026-02-11 建国記念の日",
+			"2026-02-23 天皇誕生日",
+			"2026-03-20 春分の日",
+			"2026-04-29 昭和の日",
+			"2026-05-03 憲法記念日",
+			"2026-05-04 みどりの日",
+			"2026-05-05 こどもの日",
+			"2026-05-06 振替休日",
+			"2026-07-20 海の日",
+			"2026-08-11 山の日",
+			"2026-09-21 敬老の日",
+			"2026-09-22 国民の休日",
+			"2026-09-23 秋分の日",
+			"2026-10-12 スポーツの日",
+			"2026-11-03 文化の日",
+			"2026-11-23 勤労感謝の日",
+		}},
+	}
+	for _, tt := range tests {
+		if got := holidays(tt.year); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%d:\n%q\nwant\n%q", tt.year, got, tt.want)
+		}
+	}
+}
+
+// TestSpecialHolidays checks the one-off holidays of the 2019 accession
+// and the 2020 Olympics, and the days around them
+func TestSpecialHolidays(t *testing.T) {
+	tests := []struct {
+		day  string
+		want string
+	}{
+		{"2019-04-30", "国民の休日"},
+		{"2019-05-01", "天皇の即位の日"},
+		{"2019-05-02", "国民の休日"},
+		{"2019-05-06", "振替休日"},
+		{"2019-10-14", "体育の日"},
+		{"2019-10-22", "即位礼正殿の儀の行われる日"},
+		{"2019-12-23", ""},
+		{"2020-07-20", ""},
+		{"2020-07-23", "海の日"},
+		{"2020-07-24", "スポーツの日"},
+		{"2020-08-10", "山の日"},
+		{"2020-08-11", ""},
+		{"2020-10-12", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := calendar.Holiday(d(tt.day)); got != tt.want {
+			t.Errorf("Holiday(%s) = %q, want %q", tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestRoll(t *testing.T) {
+	c := calendar.New()
+	// Year-end blackout for every warehouse, and one more day for warehouse 2
+	for day := d("2026-12-29"); !day.After(d("2027-01-03")); day = day.AddDate(0, 0, 1) {
+		c.Close(calendar.AllWarehouses, day, "年末年始")
+	}
+	c.Close("2", d("2026-12-28"), "棚卸")
+
+	tests := []struct {
+		name      string
+		warehouse string
+		day       string
+		policy    calendar.Policy
+		want      string
+		ok        bool
+	}{
+		{"business day", "1", "2026-01-30", calendar.RollForward, "2026-01-30", true},
+		{"month end forward", "1", "2026-01-31", calendar.RollForward, "2026-02-02", true},
+		{"month end backward", "1", "2026-01-31", calendar.RollBackward, "2026-01-30", true},
+		{"month end skip", "1", "2026-01-31", calendar.Skip, "2026-01-31", false},
+		{"month end keep", "1", "2026-01-31", calendar.Keep, "2026-01-31", true},
+		{"month start backward", "1", "2026-03-01", calendar.RollBackward, "2026-02-27", true},
+		{"golden week forward", "1", "2026-05-02", calendar.RollForward, "2026-05-07", true},
+		{"golden week backward", "1", "2026-05-06", calendar.RollBackward, "2026-05-01", true},
+		{"year end forward", "1", "2026-12-31", calendar.RollForward, "2027-01-04", true},
+		{"year end backward", "1", "2026-12-31", calendar.RollBackward, "2026-12-28", true},
+		{"year end backward, warehouse closure", "2", "2026-12-31", calendar.RollBackward, "2026-12-25", true},
+		{"new year backward", "1", "2027-01-02", calendar.RollBackward, "2026-12-28", true},
+		{"new year keep", "1", "2027-01-01", calendar.Keep, "2027-01-01", true},
+	}
+	for _, tt := range tests {
+		got, ok := c.Roll(tt.warehouse, d(tt.day), tt.policy)
+		if ok != tt.ok || (ok && got.Format("2006-01-02") != tt.want) {
+			t.Errorf("%s: Roll = %s %v, want %s %v", tt.name, got.Format("2006-01-02"), ok, tt.want, tt.ok)
+		}
+	}
+
+	if got := c.AddBusinessDays("1", d("2026-12-25"), 2); got != d("2027-01-04") {
+		t.Errorf("two business days after 2026-12-25 = %s, want 2027-01-04", got.Format("2006-01-02"))
+	}
+	if got := c.AddBusinessDays("1", d("2027-01-04"), -1); got != d("2026-12-28") {
+		t.Errorf("one business day before 2027-01-04 = %s, want 2026-12-28", got.Format("2006-01-02"))
+	}
+}
+
+// TestApply rolls a weekly series over a holiday week: the two dates that
+// roll onto the same day are delivered once
+func TestApply(t *testing.T) {
+	c := calendar.New()
+	dates := []time.Time{d("2026-04-30"), d("2026-05-03"), d("2026-05-07")}
+	var got []string
+	for _, o := range c.Apply("1", dates, calendar.RollForward) {
+		got = append(got, fmt.Sprintf("%s<%s", o.Date.Format("2006-01-02"), o.Planned.Format("2006-01-02")))
+	}
+	if want := "[2026-04-30<2026-04-30 2026-05-07<2026-05-03]"; fmt.Sprint(got) != want {
+		t.Errorf("Apply = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package calendar
+
+import (
+	"sync"
+	"time"
+)
+
+// Japanese public holidays under the 国民の祝日に関する法律, including the
+// substitute (振替休日) and citizens' (国民の休日) holidays. Years before
+// 2000 use the current rules and may differ from the historical calendar.
+
+var (
+	holidayMu    sync.Mutex
+	holidayCache = make(map[int]map[time.Time]string)
+)
+
+// Holiday returns the name of the public holiday on d, if any
+func Holiday(d time.Time) (string, bool) {
+	d = dateOf(d)
+	name, ok := holidaysOf(d.Year())[d]
+	return name, ok
+}
+
+// Holidays returns the public holidays of year, keyed by date
+func Holidays(year int) map[time.Time]string {
+	ret := make(map[time.Time]string)
+	for d, name := range holidaysOf(year) {
+		ret[d] = name
+	}
+	return ret
+}
+
+func holidaysOf(year int) map[time.Time]string {
+	holidayMu.Lock()
+	defer holidayMu.Unlock()
+	if h, ok := holidayCache[year]; ok {
+		return h
+	}
+	h := computeHolidays(year)
+	holidayCache[year] = h
+	return h
+}
+
+func computeHolidays(y int) map[time.Time]string {
+	h := make(map[time.Time]string)
+	set := func(m time.Month, d int, name string) {
+		h[date(y, m, d)] = name
+	}
+
+	set(time.January, 1, "元日")
+	h[nthMonday(y, time.January, 2)] = "成人の日"
+	set(time.February, 11, "建国記念の日")
+	switch {
+	case y >= 2020:
+		set(time.February, 23, "天皇誕生日")
+	case y <= 2018:
+		set(time.December, 23, "天皇誕生日")
+	}
+	set(time.March, vernalEquinox(y), "春分の日")
+	set(time.April, 29, "昭和の日")
+	set(time.May, 3, "憲法記念日")
+	set(time.May, 4, "みどりの日")
+	set(time.May, 5, "こどもの日")
+
+	// The 2020 and 2021 Olympic years moved three holidays by special law
+	switch y {
+	case 2020:
+		set(time.July, 23, "海の日")
+		set(time.July, 24, "スポーツの日")
+		set(time.August, 10, "山の日")
+	case 2021:
+		set(time.July, 22, "海の日")
+		set(time.July, 23, "スポーツの日")
+		set(time.August, 8, "山の日")
+	default:
+		h[nthMonday(y, time.July, 3)] = "海の日"
+		if y >= 2016 {
+			set(time.August, 11, "山の日")
+		}
+		name := "スポーツの日"
+		if y < 2020 {
+			name = "体育の日"
+		}
+		h[nthMonday(y, time.October, 2)] = name
+	}
+
+	h[nthMonday(y, time.September, 3)] = "敬老の日"
+	set(time.September, autumnalEquinox(y), "秋分の日")
+	set(time.November, 3, "文化の日")
+	set(time.November, 23, "勤労感謝の日")
+
+	if y == 2019 {
+		set(time.May, 1, "天皇の即位の日")
+		set(time.October, 22, "即位礼正殿の儀の行われる日")
+	}
+
+	// 国民の休日: a weekday between two holidays
+	var between []time.Time
+	for d := range h {
+		mid := d.AddDate(0, 0, 1)
+		if _, ok := h[d.AddDate(0, 0, 2)]; !ok {
+			continue
+		}
+		if _, ok := h[mid]; !ok && mid.Weekday() != time.Sunday {
+			between = append(between, mid)
+		}
+	}
+	for _, d := range between {
+		h[d] = "国民の休日"
+	}
+
+	// 振替休日: a holiday on Sunday moves to the next day that is not one
+	var subs []time.Time
+	for d := range h {
+		if d.Weekday() != time.Sunday {
+			continue
+		}
+		s := d.AddDate(0, 0, 1)
+		for {
+			if _, ok := h[s]; !ok {
+				break
+			}
+			s = s.AddDate(0, 0, 1)
+		}
+		subs = append(subs, s)
+	}
+	for _, s := range subs {
+		h[s] = "振替休日"
+	}
+
+	return h
+}
+
+// vernalEquinox and autumnalEquinox use the approximation published by the
+// National Astronomical Observatory, valid from 1980 to 2099
+func vernalEquinox(y int) int {
+	return int(20.8431+0.242194*float64(y-1980)) - (y-1980)/4
+}
+
+func autumnalEquinox(y int) int {
+	return int(23.2488+0.242194*float64(y-1980)) - (y-1980)/4
+}
+
+func nthMonday(y int, m time.Month, n int) time.Time {
+	first := date(y, m, 1)
+	offset := (int(time.Monday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+7*(n-1))
+}
@@ -0,0 +1,208 @@
+package civil
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Layout is the text form of a Date, as stored in DATE columns
+const Layout = "2006-01-02"
+
+// Date is a calendar date without a time of day or location. Delivery,
+// arrival and repeat dates are Dates: they name a day in the business
+// timezone and never shift when converted between zones.
+//
+// The zero Date is NULL in the database and null in JSON.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf returns the date of t in t's location
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{Year: y, Month: m, Day: d}
+}
+
+// Parse reads a YYYY-MM-DD date. A DATETIME value ("2006-01-02 15:04:05")
+// is accepted and its time of day dropped.
+func Parse(s string) (Date, error) {
+	if len(s) > len(Layout) && s[len(Layout)] == ' ' {
+		s = s[:len(Layout)]
+	}
+	t, err := time.Parse(Layout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("civil: invalid date %q", s)
+	}
+	return DateOf(t), nil
+}
+
+// FromValue converts a column value read by scan.Maps (string, []byte,
+// time.Time or nil) to a Date
+func FromValue(v interface{}) (Date, error) {
+	var d Date
+	err := d.Scan(v)
+	return d, err
+}
+
+// MustParse is Parse for constants; it panics on an invalid date
+func MustParse(s string) Date {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// String returns the date as YYYY-MM-DD, or "" for the zero Date
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// IsZero reports whether d is the zero Date
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// Time returns midnight of d in UTC. Date arithmetic in the recurrence and
+// calendar packages works on these values, which have no DST transitions.
+func (d Date) Time() time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, time.UTC)
+}
+
+// In returns midnight of d in loc
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// AddDays returns d plus n days
+func (d Date) AddDays(n int) Date {
+	return DateOf(d.Time().AddDate(0, 0, n))
+}
+
+// DaysSince returns the number of days from o to d
+func (d Date) DaysSince(o Date) int {
+	return int(d.Time().Sub(o.Time()).Hours() / 24)
+}
+
+// Weekday returns the day of the week of d
+func (d Date) Weekday() time.Weekday {
+	return d.Time().Weekday()
+}
+
+// Compare returns -1, 0 or +1 as d is before, equal to or after o
+func (d Date) Compare(o Date) int {
+	switch {
+	case d.Year != o.Year:
+		return sign(d.Year - o.Year)
+	case d.Month != o.Month:
+		return sign(int(d.Month - o.Month))
+	}
+	return sign(d.Day - o.Day)
+}
+
+// Before reports whether d is before o
+func (d Date) Before(o Date) bool { return d.Compare(o) < 0 }
+
+// After reports whether d is after o
+func (d Date) After(o Date) bool { return d.Compare(o) > 0 }
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// Scan implements sql.Scanner. NULL and MySQL zero dates (0000-00-00)
+// become the zero Date. A time.Time from a driver with parseTime is read in
+// its own location, so a DATE column is never shifted by the session zone.
+func (d *Date) Scan(v interface{}) error {
+	switch t := v.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		if t.IsZero() {
+			*d = Date{}
+			return nil
+		}
+		*d = DateOf(t)
+		return nil
+	case []byte:
+		return d.scanString(string(t))
+	case string:
+		return d.scanString(t)
+	}
+	return fmt.Errorf("civil: cannot scan %T into Date", v)
+}
+
+func (d *Date) scanString(s string) error {
+	if s == "" || s == "0000-00-00" || s == "0000-00-00 00:00:00" {
+		*d = Date{}
+		return nil
+	}
+	p, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = p
+	return nil
+}
+
+// Value implements driver.Valuer; the zero Date is NULL
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler; "" is the zero Date
+func (d *Date) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*d = Date{}
+		return nil
+	}
+	p, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*d = p
+	return nil
+}
+
+// MarshalJSON writes the date as a string, or null for the zero Date
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts a YYYY-MM-DD string, "" or null
+func (d *Date) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*d = Date{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("civil: date must be a string: %w", err)
+	}
+	return d.UnmarshalText([]byte(s))
+}
@@ -0,0 +1,62 @@
+package civil
+
+import (
+	"sync"
+	"time"
+)
+
+// TimestampLayout is the text form of rgdt/updt DATETIME values
+const TimestampLayout = "2006-01-02 15:04:05"
+
+// BusinessZone is the timezone the business runs in, matching the PHP
+// side's date_default_timezone_set('Asia/Tokyo')
+const BusinessZone = "Asia/Tokyo"
+
+var (
+	locMu    sync.RWMutex
+	location = loadBusinessLocation()
+	nowFunc  = time.Now
+)
+
+// loadBusinessLocation falls back to a fixed +09:00 zone when the system
+// has no tzdata; Japan has no daylight saving time, so the two agree.
+func loadBusinessLocation() *time.Location {
+	if loc, err := time.LoadLocation(BusinessZone); err == nil {
+		return loc
+	}
+	return time.FixedZone("JST", 9*60*60)
+}
+
+// Location returns the business timezone
+func Location() *time.Location {
+	locMu.RLock()
+	defer locMu.RUnlock()
+	return location
+}
+
+// SetLocation replaces the business timezone, for deployments outside
+// Japan. A nil loc restores Asia/Tokyo.
+func SetLocation(loc *time.Location) {
+	locMu.Lock()
+	defer locMu.Unlock()
+	if loc == nil {
+		loc = loadBusinessLocation()
+	}
+	location = loc
+}
+
+// Now returns the current time in the business timezone
+func Now() time.Time {
+	return nowFunc().In(Location())
+}
+
+// Today returns the current date in the business timezone. Just after
+// midnight in Tokyo it is already the next day, whatever the server zone.
+func Today() Date {
+	return DateOf(Now())
+}
+
+// Timestamp returns Now formatted for rgdt/updt columns
+func Timestamp() string {
+	return Now().Format(TimestampLayout)
+}
@@ -0,0 +1,129 @@
+package dialect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect hides the SQL differences between MySQL (production) and SQLite
+// (local tests). Statements that both engines accept as-is, such as
+// "LIMIT ? OFFSET ?", are written directly without going through it.
+type Dialect interface {
+	// Name returns the database/sql driver name
+	Name() string
+	// Quote quotes an identifier such as the reserved column "repeat"
+	Quote(ident string) string
+	// AutoIncrement is the column definition of a surrogate primary key
+	AutoIncrement() string
+	// TableOptions is appended to CREATE TABLE
+	TableOptions() string
+	// Upsert returns an INSERT that updates the update columns when a row
+	// with the same keys exists
+	Upsert(table string, cols, keys, update []string) string
+	// DeleteJoin deletes rows of table (aliased as alias) matched through
+	// join and where. key is the primary key column used by engines that
+	// cannot delete through a join.
+	DeleteJoin(table, alias, key, join, where string) string
+	// ForUpdate is appended to a SELECT that locks the rows it reads
+	ForUpdate() string
+	// CreateIndex creates index name on table over cols unless it exists,
+	// so a migration that stopped halfway can run again
+	CreateIndex(name, table, cols string) string
+	// IndexExists reports whether err is the error of creating an index
+	// that already exists
+	IndexExists(err error) bool
+}
+
+// MySQL is the production dialect
+var MySQL Dialect = mysql{}
+
+// SQLite is the dialect of the embedded test database
+var SQLite Dialect = sqlite{}
+
+// Or returns d, or MySQL when d is nil
+func Or(d Dialect) Dialect {
+	if d == nil {
+		return MySQL
+	}
+	return d
+}
+
+type mysql struct{}
+
+func (mysql) Name() string { return "mysql" }
+
+func (mysql) Quote(ident string) string { return "`" + strings.ReplaceAll(ident, "`", "``") + "`" }
+
+func (mysql) AutoIncrement() string { return "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY" }
+
+func (mysql) TableOptions() string { return " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4" }
+
+func (d mysql) Upsert(table string, cols, keys, update []string) string {
+	sets := make([]string, len(update))
+	for i, c := range update {
+		sets[i] = fmt.Sprintf("%s = VALUES(%s)", d.Quote(c), d.Quote(c))
+	}
+	return Insert(d, table, cols) + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (mysql) DeleteJoin(table, alias, key, join, where string) string {
+	return fmt.Sprintf("DELETE %s FROM %s AS %s %s WHERE %s", alias, table, alias, join, where)
+}
+
+func (mysql) ForUpdate() string { return " FOR UPDATE" }
+
+// CreateIndex has no IF NOT EXISTS: MySQL does not support it for
+// indexes. schema.Migrate skips the statement when IndexExists.
+func (mysql) CreateIndex(name, table, cols string) string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, cols)
+}
+
+// IndexExists matches error 1061, "Duplicate key name"
+func (mysql) IndexExists(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Duplicate key name")
+}
+
+type sqlite struct{}
+
+func (sqlite) Name() string { return "sqlite" }
+
+func (sqlite) Quote(ident string) string { return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"` }
+
+func (sqlite) AutoIncrement() string { return "INTEGER PRIMARY KEY AUTOINCREMENT" }
+
+func (sqlite) TableOptions() string { return "" }
+
+func (d sqlite) Upsert(table string, cols, keys, update []string) string {
+	quoted := make([]string, len(keys))
+	for i, k := range keys {
+		quoted[i] = d.Quote(k)
+	}
+	sets := make([]string, len(update))
+	for i, c := range update {
+		sets[i] = fmt.Sprintf("%s = excluded.%s", d.Quote(c), d.Quote(c))
+	}
+	return fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", Insert(d, table, cols), strings.Join(quoted, ", "), strings.Join(sets, ", "))
+}
+
+func (sqlite) DeleteJoin(table, alias, key, join, where string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT %s.%s FROM %s AS %s %s WHERE %s)", table, key, alias, key, table, alias, join, where)
+}
+
+// ForUpdate is empty: SQLite locks the whole database for writes
+func (sqlite) ForUpdate() string { return "" }
+
+func (sqlite) CreateIndex(name, table, cols string) string {
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", name, table, cols)
+}
+
+func (sqlite) IndexExists(err error) bool { return false }
+
+// Insert returns a plain INSERT with one placeholder per column
+func Insert(d Dialect, table string, cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = d.Quote(c)
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(quoted, ", "), marks)
+}
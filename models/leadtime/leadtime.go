@@ -0,0 +1,200 @@
+package leadtime
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+// DefaultDays is the lead time used when no rule matches; it is the
+// offset SetArrivalDt used to hard-code
+const DefaultDays = 3
+
+// Packing narrows a rule to bulk or bagged goods (yc_goods.separately_fg)
+type Packing int
+
+const (
+	AnyPacking Packing = 0
+	// Bulk is バラ, separately_fg = 1
+	Bulk Packing = 1
+	// Bagged is 袋物, separately_fg = 0
+	Bagged Packing = 2
+)
+
+func (p Packing) String() string {
+	switch p {
+	case Bulk:
+		return "バラ"
+	case Bagged:
+		return "袋"
+	}
+	return "すべて"
+}
+
+// Rule is a yc_lead_time row. Empty codes and AnyPacking match everything.
+// Days are business days of the outgoing warehouse between arrival and
+// delivery.
+type Rule struct {
+	LeadTime  int64   `db:"lead_time" json:"lead_time"`
+	Customer  string  `db:"customer" json:"customer"`
+	Goods     string  `db:"goods" json:"goods"`
+	Warehouse string  `db:"warehouse" json:"warehouse"`
+	Packing   Packing `db:"packing" json:"packing"`
+	Days      int     `db:"days" json:"days"`
+	Remark    string  `db:"remark" json:"remark"`
+}
+
+// Key describes the sales a lead time is resolved for
+type Key struct {
+	Customer     string
+	Goods        string
+	Warehouse    string
+	SeparatelyFg bool
+}
+
+func (k Key) packing() Packing {
+	if k.SeparatelyFg {
+		return Bulk
+	}
+	return Bagged
+}
+
+// Matches reports whether the rule applies to k
+func (r Rule) Matches(k Key) bool {
+	return (r.Customer == "" || r.Customer == k.Customer) &&
+		(r.Goods == "" || r.Goods == k.Goods) &&
+		(r.Warehouse == "" || r.Warehouse == k.Warehouse) &&
+		(r.Packing == AnyPacking || r.Packing == k.packing())
+}
+
+// Specificity orders matching rules: customer beats goods, goods beats
+// packing, packing beats warehouse
+func (r Rule) Specificity() int {
+	n := 0
+	if r.Customer != "" {
+		n += 8
+	}
+	if r.Goods != "" {
+		n += 4
+	}
+	if r.Packing != AnyPacking {
+		n += 2
+	}
+	if r.Warehouse != "" {
+		n++
+	}
+	return n
+}
+
+// Describe lists the conditions of the rule, for explanations
+func (r Rule) Describe() string {
+	var conds []string
+	if r.Customer != "" {
+		conds = append(conds, "customer="+r.Customer)
+	}
+	if r.Goods != "" {
+		conds = append(conds, "goods="+r.Goods)
+	}
+	if r.Packing != AnyPacking {
+		conds = append(conds, "packing="+r.Packing.String())
+	}
+	if r.Warehouse != "" {
+		conds = append(conds, "warehouse="+r.Warehouse)
+	}
+	if len(conds) == 0 {
+		return "all sales"
+	}
+	return strings.Join(conds, ", ")
+}
+
+// Decision is the outcome of Resolve. Rule is nil when DefaultDays was
+// used; Candidates are every matching rule, most specific first.
+type Decision struct {
+	Days       int    `json:"days"`
+	Rule       *Rule  `json:"rule"`
+	Candidates []Rule `json:"candidates"`
+	Reason     string `json:"reason"`
+}
+
+// Resolver picks the lead time of a sales from a set of rules
+type Resolver struct {
+	rules       []Rule
+	defaultDays int
+}
+
+// NewResolver returns a resolver over rules. defaultDays applies when no
+// rule matches; zero or less means DefaultDays.
+func NewResolver(rules []Rule, defaultDays int) *Resolver {
+	if defaultDays <= 0 {
+		defaultDays = DefaultDays
+	}
+	rs := append([]Rule{}, rules...)
+	sort.SliceStable(rs, func(i, j int) bool {
+		if si, sj := rs[i].Specificity(), rs[j].Specificity(); si != sj {
+			return si > sj
+		}
+		return rs[i].LeadTime < rs[j].LeadTime
+	})
+	return &Resolver{rules: rs, defaultDays: defaultDays}
+}
+
+// Load returns a resolver over the rules in yc_lead_time
+func Load(db *sql.DB) (*Resolver, error) {
+	q, args, err := query.Select("*").From("yc_lead_time").OrderBy("lead_time", false).Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	if err := scan.Structs(rows, &rules); err != nil {
+		return nil, err
+	}
+	return NewResolver(rules, DefaultDays), nil
+}
+
+// Rules returns the rules in the order they are tried
+func (r *Resolver) Rules() []Rule {
+	return append([]Rule{}, r.rules...)
+}
+
+// Resolve returns the lead time for k. The most specific matching rule
+// wins; among equally specific rules the oldest one does.
+func (r *Resolver) Resolve(k Key) Decision {
+	var d Decision
+	for _, rule := range r.rules {
+		if rule.Matches(k) {
+			d.Candidates = append(d.Candidates, rule)
+		}
+	}
+	if len(d.Candidates) == 0 {
+		d.Days = r.defaultDays
+		d.Reason = fmt.Sprintf("no rule matched; default %d business days", r.defaultDays)
+		return d
+	}
+	best := d.Candidates[0]
+	d.Rule = &best
+	d.Days = best.Days
+	d.Reason = fmt.Sprintf("rule %d (%s): %d business days", best.LeadTime, best.Describe(), best.Days)
+	return d
+}
+
+// ArrivalDt returns the arrival date for a delivery on deliveryDt: the
+// resolved number of business days of k.Warehouse earlier
+func (r *Resolver) ArrivalDt(cal *calendar.Calendar, k Key, deliveryDt time.Time) (time.Time, Decision) {
+	d := r.Resolve(k)
+	if cal == nil {
+		cal = calendar.New()
+	}
+	return cal.AddBusinessDays(k.Warehouse, deliveryDt, -d.Days), d
+}
@@ -0,0 +1,434 @@
+// Package ledger posts stock movements to yc_stock_ledger and reads the
+// balances it keeps per goods, warehouse and lot.
+//
+// Every balance has three quantities: on hand in the warehouse, reserved
+// for sales out of what is on hand, and in transit towards the warehouse.
+// A transfer takes its details off the hand of the sending warehouse and
+// puts them in transit to the receiving one until ReceiveTransfer; Cancel
+// reverses whatever a reference posted. Entries are never changed.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+var (
+	// ErrNothingInTransit is returned when a transfer has nothing left to
+	// receive
+	ErrNothingInTransit = errors.New("ledger: nothing in transit for the transfer")
+	// ErrNothingToCancel is returned when a reference has no movement left
+	// to reverse
+	ErrNothingToCancel = errors.New("ledger: no movement to cancel")
+)
+
+// Ledger posts stock movements
+type Ledger struct {
+	Store *repository.Store
+}
+
+// Position is the stock of goods in a warehouse, summed over its lots
+type Position struct {
+	Goods     string
+	Warehouse string
+	OnHand    scan.Qty
+	Reserved  scan.Qty
+	InTransit scan.Qty
+}
+
+// Available is the stock on hand that is not reserved
+func (p Position) Available() scan.Qty {
+	return p.OnHand - p.Reserved
+}
+
+// SalesRef is the reference of the movements of a sales
+func SalesRef(sales int64) string {
+	return fmt.Sprintf("sales:%d", sales)
+}
+
+// Unit is the quantity of one stock detail: the unit of the goods, or 1
+// when the goods has none
+func (l *Ledger) Unit(goods string) (scan.Qty, error) {
+	g, err := l.Store.Goods.Get(goods)
+	switch {
+	case err == repository.ErrNotFound:
+		return scan.NewQty(1), nil
+	case err != nil:
+		return 0, err
+	case g.Qty <= 0:
+		return scan.NewQty(1), nil
+	}
+	return g.Qty, nil
+}
+
+// Receive posts the receipt of the details of stock s, one goods unit per
+// detail
+func (l *Ledger) Receive(s *repository.Stock, details []*repository.StockDetail, user string) error {
+	unit, err := l.Unit(s.Goods)
+	if err != nil {
+		return err
+	}
+	var entries []*repository.LedgerEntry
+	for _, lot := range byLot(details) {
+		entries = append(entries, &repository.LedgerEntry{
+			Kind:      repository.Receipt,
+			Ref:       s.Stock,
+			Goods:     s.Goods,
+			Warehouse: s.Warehouse,
+			Lot:       lot.lot,
+			OnHand:    unit * scan.Qty(lot.n),
+			Upuser:    user,
+		})
+	}
+	return l.Store.Ledger.Post(entries)
+}
+
+// Transfer posts the transfer ref of details from their warehouse to
+// warehouse to: off hand where they are, in transit where they go
+func (l *Ledger) Transfer(ref, to string, details []*repository.StockDetail, user string) error {
+	var entries []*repository.LedgerEntry
+	units := make(map[string]scan.Qty)
+	for _, lot := range byLot(details) {
+		unit, ok := units[lot.goods]
+		if !ok {
+			var err error
+			if unit, err = l.Unit(lot.goods); err != nil {
+				return err
+			}
+			units[lot.goods] = unit
+		}
+		qty := unit * scan.Qty(lot.n)
+		entries = append(entries,
+			&repository.LedgerEntry{Kind: repository.TransferOut, Ref: ref, Goods: lot.goods, Warehouse: lot.warehouse, Lot: lot.lot, OnHand: -qty, Upuser: user},
+			&repository.LedgerEntry{Kind: repository.Transit, Ref: ref, Goods: lot.goods, Warehouse: to, Lot: lot.lot, InTransit: qty, Upuser: user},
+		)
+	}
+	return l.Store.Ledger.Post(entries)
+}
+
+// ReceiveTransfer moves what transfer ref still has in transit onto the
+// hand of the receiving warehouse
+func (l *Ledger) ReceiveTransfer(ref, user string) ([]*repository.LedgerEntry, error) {
+	pending, err := l.InTransit(ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNothingInTransit, ref)
+	}
+	for _, e := range pending {
+		e.Kind = repository.TransferIn
+		e.OnHand, e.InTransit = e.InTransit, -e.InTransit
+		e.Upuser = user
+	}
+	if err := l.Store.Ledger.Post(pending); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// ReceiveDetails moves details of transfer ref out of transit onto the
+// hand of the receiving warehouse to, as far as they are still in
+// transit: details booked by ReceiveTransfer already post nothing. It
+// returns the entries posted.
+func (l *Ledger) ReceiveDetails(ref, to string, details []*repository.StockDetail, user string) ([]*repository.LedgerEntry, error) {
+	pending, err := l.InTransit(ref)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*repository.LedgerEntry
+	for _, lot := range byLot(details) {
+		unit, err := l.Unit(lot.goods)
+		if err != nil {
+			return nil, err
+		}
+		qty := unit * scan.Qty(lot.n)
+		for _, p := range pending {
+			if p.Goods != lot.goods || p.Warehouse != to || p.Lot != lot.lot {
+				continue
+			}
+			if qty > p.InTransit {
+				qty = p.InTransit
+			}
+			entries = append(entries, &repository.LedgerEntry{Kind: repository.TransferIn, Ref: ref, Goods: lot.goods, Warehouse: to, Lot: lot.lot, OnHand: qty, InTransit: -qty, Upuser: user})
+			break
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if err := l.Store.Ledger.Post(entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// InTransit returns what transfer ref still has in transit, one entry per
+// goods, warehouse and lot with the quantity in InTransit
+func (l *Ledger) InTransit(ref string) ([]*repository.LedgerEntry, error) {
+	entries, err := l.Store.Ledger.Entries(repository.LedgerFilter{Ref: ref})
+	if err != nil {
+		return nil, err
+	}
+	type key struct{ goods, warehouse, lot string }
+	sums := make(map[key]*repository.LedgerEntry)
+	var keys []key
+	for _, e := range entries {
+		k := key{e.Goods, e.Warehouse, e.Lot}
+		if sums[k] == nil {
+			sums[k] = &repository.LedgerEntry{Ref: ref, Goods: e.Goods, Warehouse: e.Warehouse, Lot: e.Lot}
+			keys = append(keys, k)
+		}
+		sums[k].InTransit += e.InTransit
+	}
+	var ret []*repository.LedgerEntry
+	for _, k := range keys {
+		if sums[k].InTransit > 0 {
+			ret = append(ret, sums[k])
+		}
+	}
+	return ret, nil
+}
+
+// Received reports whether transfer ref has been received at its
+// destination, in part or in full, and the receipt is not cancelled
+func (l *Ledger) Received(ref string) (bool, error) {
+	entries, err := l.Store.Ledger.Entries(repository.LedgerFilter{Ref: ref})
+	if err != nil {
+		return false, err
+	}
+	reversed := reversedIDs(entries)
+	for _, e := range entries {
+		if e.Kind == repository.TransferIn && !reversed[e.ID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Reserve brings the reservation of sales s in line with its goods,
+// outgoing warehouse and quantity, less what has shipped of it: what is
+// reserved elsewhere is released and the difference is reserved. A sales
+// without an outgoing warehouse, or cancelled (status 9), reserves
+// nothing. Reserve posts nothing when the reservation is in line, so it
+// is called after every save of a sales.
+func (l *Ledger) Reserve(s *repository.Sales, user string) error {
+	ref := SalesRef(s.Sales)
+	entries, err := l.Store.Ledger.Entries(repository.LedgerFilter{Ref: ref})
+	if err != nil {
+		return err
+	}
+	type key struct{ goods, warehouse string }
+	want := key{s.Goods, s.OutgoingWarehouse}
+	reserved := make(map[key]scan.Qty)
+	keys := []key{want}
+	var shipped scan.Qty
+	for _, e := range entries {
+		k := key{e.Goods, e.Warehouse}
+		if _, ok := reserved[k]; !ok && k != want {
+			keys = append(keys, k)
+		}
+		reserved[k] += e.Reserved
+		if k == want {
+			shipped -= e.OnHand
+		}
+	}
+
+	target := s.Qty - shipped
+	if s.OutgoingWarehouse == "" || s.Status == 9 || target < 0 {
+		target = 0
+	}
+	var post []*repository.LedgerEntry
+	for _, k := range keys {
+		goal := scan.Qty(0)
+		if k == want {
+			goal = target
+		}
+		if delta := goal - reserved[k]; delta != 0 {
+			post = append(post, &repository.LedgerEntry{Kind: repository.Sale, Ref: ref, Goods: k.goods, Warehouse: k.warehouse, Reserved: delta, Upuser: user})
+		}
+	}
+	if len(post) == 0 {
+		return nil
+	}
+	return l.Store.Ledger.Post(post)
+}
+
+// Ship posts the delivery of details for sales s: off hand in the lots
+// they come from, and out of the reservation of s as far as it goes
+func (l *Ledger) Ship(s *repository.Sales, details []*repository.StockDetail, user string) error {
+	ref := SalesRef(s.Sales)
+	posted, err := l.Store.Ledger.Entries(repository.LedgerFilter{Ref: ref})
+	if err != nil {
+		return err
+	}
+	var reserved scan.Qty
+	for _, e := range posted {
+		if e.Goods == s.Goods && e.Warehouse == s.OutgoingWarehouse {
+			reserved += e.Reserved
+		}
+	}
+
+	var entries []*repository.LedgerEntry
+	var shipped scan.Qty
+	for _, lot := range byLot(details) {
+		unit, err := l.Unit(lot.goods)
+		if err != nil {
+			return err
+		}
+		qty := unit * scan.Qty(lot.n)
+		entries = append(entries, &repository.LedgerEntry{Kind: repository.Sale, Ref: ref, Goods: lot.goods, Warehouse: lot.warehouse, Lot: lot.lot, OnHand: -qty, Upuser: user})
+		if lot.goods == s.Goods && lot.warehouse == s.OutgoingWarehouse {
+			shipped += qty
+		}
+	}
+	release := shipped
+	if reserved < release {
+		release = reserved
+	}
+	if release > 0 {
+		entries = append(entries, &repository.LedgerEntry{Kind: repository.Sale, Ref: ref, Goods: s.Goods, Warehouse: s.OutgoingWarehouse, Reserved: -release, Upuser: user})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return l.Store.Ledger.Post(entries)
+}
+
+// Adjust posts a correction of delta to the stock on hand, such as after a
+// count
+func (l *Ledger) Adjust(goods, warehouse, lot string, delta scan.Qty, reason, user string) (*repository.LedgerEntry, error) {
+	e := &repository.LedgerEntry{
+		Kind:      repository.Adjustment,
+		Goods:     goods,
+		Warehouse: warehouse,
+		Lot:       lot,
+		OnHand:    delta,
+		Reason:    reason,
+		Upuser:    user,
+	}
+	if err := l.Store.Ledger.Post([]*repository.LedgerEntry{e}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Cancel reverses every movement of ref that is not reversed yet. It is
+// safe to repeat.
+func (l *Ledger) Cancel(ref, reason, user string) ([]*repository.LedgerEntry, error) {
+	entries, err := l.Store.Ledger.Entries(repository.LedgerFilter{Ref: ref})
+	if err != nil {
+		return nil, err
+	}
+	reversed := reversedIDs(entries)
+	var cancels []*repository.LedgerEntry
+	for _, e := range entries {
+		if e.Kind == repository.Cancel || reversed[e.ID] {
+			continue
+		}
+		cancels = append(cancels, &repository.LedgerEntry{
+			Kind:      repository.Cancel,
+			Ref:       ref,
+			Goods:     e.Goods,
+			Warehouse: e.Warehouse,
+			Lot:       e.Lot,
+			OnHand:    -e.OnHand,
+			Reserved:  -e.Reserved,
+			InTransit: -e.InTransit,
+			CancelOf:  e.ID,
+			Reason:    reason,
+			Upuser:    user,
+		})
+	}
+	if len(cancels) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNothingToCancel, ref)
+	}
+	if err := l.Store.Ledger.Post(cancels); err != nil {
+		return nil, err
+	}
+	return cancels, nil
+}
+
+// Position returns the stock of goods in warehouse over all lots
+func (l *Ledger) Position(goods, warehouse string) (Position, error) {
+	p := Position{Goods: goods, Warehouse: warehouse}
+	balances, err := l.Store.Ledger.Balances(repository.LedgerFilter{Goods: goods, Warehouse: warehouse})
+	if err != nil {
+		return p, err
+	}
+	for _, b := range balances {
+		p.OnHand += b.OnHand
+		p.Reserved += b.Reserved
+		p.InTransit += b.InTransit
+	}
+	return p, nil
+}
+
+// Positions returns the stock per goods and warehouse of the balances
+// matching f
+func (l *Ledger) Positions(f repository.LedgerFilter) ([]Position, error) {
+	balances, err := l.Store.Ledger.Balances(f)
+	if err != nil {
+		return nil, err
+	}
+	type key struct{ goods, warehouse string }
+	sums := make(map[key]*Position)
+	for _, b := range balances {
+		k := key{b.Goods, b.Warehouse}
+		if sums[k] == nil {
+			sums[k] = &Position{Goods: b.Goods, Warehouse: b.Warehouse}
+		}
+		sums[k].OnHand += b.OnHand
+		sums[k].Reserved += b.Reserved
+		sums[k].InTransit += b.InTransit
+	}
+	ret := make([]Position, 0, len(sums))
+	for _, p := range sums {
+		ret = append(ret, *p)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Goods != ret[j].Goods {
+			return ret[i].Goods < ret[j].Goods
+		}
+		return ret[i].Warehouse < ret[j].Warehouse
+	})
+	return ret, nil
+}
+
+// reversedIDs returns the ids of the entries a Cancel entry reverses
+func reversedIDs(entries []*repository.LedgerEntry) map[int64]bool {
+	ret := make(map[int64]bool)
+	for _, e := range entries {
+		if e.Kind == repository.Cancel {
+			ret[e.CancelOf] = true
+		}
+	}
+	return ret
+}
+
+type lotCount struct {
+	goods, warehouse, lot string
+	n                     int
+}
+
+// byLot counts details per goods, warehouse and lot, in order of first
+// appearance
+func byLot(details []*repository.StockDetail) []*lotCount {
+	var ret []*lotCount
+	index := make(map[[3]string]*lotCount)
+	for _, d := range details {
+		k := [3]string{d.Goods, d.Warehouse, d.Lot}
+		c, ok := index[k]
+		if !ok {
+			c = &lotCount{goods: d.Goods, warehouse: d.Warehouse, lot: d.Lot}
+			index[k] = c
+			ret = append(ret, c)
+		}
+		c.n++
+	}
+	return ret
+}
@@ -0,0 +1,98 @@
+package ledger_test
+
+import (
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func reserved(t *testing.T, l *ledger.Ledger, warehouse string) scan.Qty {
+	t.Helper()
+	p, err := l.Position("101", warehouse)
+	must(t, err)
+	return p.Reserved
+}
+
+func TestReserve(t *testing.T) {
+	st := repository.NewMemory()
+	l := &ledger.Ledger{Store: st}
+	s := &repository.Sales{Customer: "C1", Goods: "101", Qty: scan.NewQty(5), OutgoingWarehouse: "2", DeliveryDt: civil.MustParse("2026-10-21")}
+	_, err := st.Sales.Create(s)
+	must(t, err)
+
+	steps := []struct {
+		name   string
+		change func()
+		want2  scan.Qty
+		want3  scan.Qty
+	}{
+		{"created", func() {}, scan.NewQty(5), 0},
+		{"saved unchanged", func() {}, scan.NewQty(5), 0},
+		{"less qty", func() { s.Qty = scan.NewQty(3) }, scan.NewQty(3), 0},
+		{"other warehouse", func() { s.OutgoingWarehouse = "3" }, 0, scan.NewQty(3)},
+		{"no warehouse", func() { s.OutgoingWarehouse = "" }, 0, 0},
+		{"warehouse again", func() { s.OutgoingWarehouse = "2" }, scan.NewQty(3), 0},
+		{"cancelled", func() { s.Status = 9 }, 0, 0},
+	}
+	var posted int
+	for _, step := range steps {
+		step.change()
+		must(t, l.Reserve(s, "test"))
+		if got := reserved(t, l, "2"); got != step.want2 {
+			t.Errorf("%s: reserved in 2 = %s, want %s", step.name, got, step.want2)
+		}
+		if got := reserved(t, l, "3"); got != step.want3 {
+			t.Errorf("%s: reserved in 3 = %s, want %s", step.name, got, step.want3)
+		}
+		entries, err := st.Ledger.Entries(repository.LedgerFilter{Ref: ledger.SalesRef(s.Sales)})
+		must(t, err)
+		if step.name == "saved unchanged" && len(entries) != posted {
+			t.Errorf("saving an unchanged sales posted %d entries", len(entries)-posted)
+		}
+		posted = len(entries)
+	}
+}
+
+func TestTransferKinds(t *testing.T) {
+	st := repository.NewMemory()
+	l := &ledger.Ledger{Store: st}
+	details := []*repository.StockDetail{{Goods: "101", Warehouse: "1", Lot: "L1"}, {Goods: "101", Warehouse: "1", Lot: "L1"}}
+	must(t, l.Transfer("T1", "2", details, "test"))
+
+	entries, err := st.Ledger.Entries(repository.LedgerFilter{Ref: "T1"})
+	must(t, err)
+	if len(entries) != 2 {
+		t.Fatalf("Transfer posted %d entries, want 2", len(entries))
+	}
+	out, transit := entries[0], entries[1]
+	if out.Kind != repository.TransferOut || out.Warehouse != "1" || out.OnHand != -scan.NewQty(2) {
+		t.Errorf("sending side = %+v", out)
+	}
+	if transit.Kind != repository.Transit || transit.Warehouse != "2" || transit.InTransit != scan.NewQty(2) {
+		t.Errorf("receiving side = %+v", transit)
+	}
+
+	if received, _ := l.Received("T1"); received {
+		t.Error("a transfer in transit counts as received")
+	}
+	_, err = l.ReceiveTransfer("T1", "test")
+	must(t, err)
+	if received, _ := l.Received("T1"); !received {
+		t.Error("ReceiveTransfer did not receive the transfer")
+	}
+	p, err := l.Position("101", "2")
+	must(t, err)
+	if p.OnHand != scan.NewQty(2) || p.InTransit != 0 {
+		t.Errorf("position in 2 = %+v", p)
+	}
+}
@@ -0,0 +1,324 @@
+// Package lot splits the quantity of a sales into lot slots and records
+// which lot went into which tank.
+//
+// A slot is a yc_goods_detail row. MakeSpace creates one empty slot per
+// unit of the goods (yc_goods.qty, e.g. one 1t bag), MakeSpaceSingle one
+// slot for the whole quantity. Operators then assign a lot number and a
+// tank to every slot with Assign, or split the delivery their own way with
+// Allocate. Slots that would overfill a tank or put the goods into a tank
+// not allowed to hold it are refused, as package tank checks. The
+// allocation is complete when every slot has a lot and the slots add up
+// to the ordered quantity, at which point the sales is flagged lot_fg.
+package lot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/tank"
+)
+
+var (
+	// ErrQtyMismatch is wrapped when the slots do not add up to the
+	// ordered quantity
+	ErrQtyMismatch = errors.New("lot: allocated quantity does not match the ordered quantity")
+	// ErrAssigned is returned when MakeSpace would discard lot numbers
+	// already entered
+	ErrAssigned = errors.New("lot: lots are already assigned to this sales")
+	// ErrUnknownSlot is returned for a slot that is not one of the sales
+	ErrUnknownSlot = errors.New("lot: slot does not belong to the sales")
+	// ErrUnknownTank is returned for a tank the customer does not have
+	ErrUnknownTank = errors.New("lot: tank is not registered for the customer")
+)
+
+// Assignment sets the lot, tank and quantity of one slot. For Assign, Slot
+// is the id of an existing slot and a zero Qty keeps its quantity; Allocate
+// ignores Slot.
+type Assignment struct {
+	Slot int64
+	Lot  string
+	Tank string
+	Qty  scan.Qty
+}
+
+// Summary is the allocation state of a sales
+type Summary struct {
+	Sales     int64
+	Goods     string
+	Ordered   scan.Qty
+	Allocated scan.Qty
+	Slots     []*repository.LotSlot
+	// ByTank is the allocated quantity per tank, then per lot
+	ByTank map[string]map[string]scan.Qty
+	// Complete is true when every slot has a lot and Allocated equals
+	// Ordered
+	Complete bool
+}
+
+// Allocator creates and fills the lot slots of sales
+type Allocator struct {
+	Store *repository.Store
+}
+
+// Split divides total into slots of unit, the last one holding the
+// remainder. A zero unit gives a single slot.
+func Split(total, unit scan.Qty) []scan.Qty {
+	if total <= 0 {
+		return nil
+	}
+	if unit <= 0 || unit >= total {
+		return []scan.Qty{total}
+	}
+	var ret []scan.Qty
+	for left := total; left > 0; left -= unit {
+		if left < unit {
+			ret = append(ret, left)
+			break
+		}
+		ret = append(ret, unit)
+	}
+	return ret
+}
+
+// MakeSpace replaces the slots of sales with one empty slot per unit of
+// the goods. It refuses when a lot number has been entered; Reset first.
+func (a *Allocator) MakeSpace(sales int64, user string) (*Summary, error) {
+	return a.makeSpace(sales, user, true)
+}
+
+// MakeSpaceSingle replaces the slots of sales with one slot for the whole
+// quantity, for bulk deliveries from a single lot
+func (a *Allocator) MakeSpaceSingle(sales int64, user string) (*Summary, error) {
+	return a.makeSpace(sales, user, false)
+}
+
+func (a *Allocator) makeSpace(sales int64, user string, perUnit bool) (*Summary, error) {
+	s, err := a.Store.Sales.Get(sales)
+	if err != nil {
+		return nil, err
+	}
+	old, err := a.Store.Lots.Slots(sales)
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range old {
+		if slot.Lot != "" {
+			return nil, ErrAssigned
+		}
+	}
+
+	var unit scan.Qty
+	if perUnit {
+		g, err := a.Store.Goods.Get(s.Goods)
+		if err != nil {
+			return nil, fmt.Errorf("goods %q: %w", s.Goods, err)
+		}
+		unit = g.Qty
+	}
+	tank, err := a.defaultTank(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots []*repository.LotSlot
+	for _, qty := range Split(s.Qty, unit) {
+		slots = append(slots, &repository.LotSlot{Goods: s.Goods, Tank: tank, Qty: qty, Upuser: user})
+	}
+	if err := a.checkTanks(s, slots); err != nil {
+		return nil, err
+	}
+	if err := a.Store.Lots.ReplaceSlots(sales, slots); err != nil {
+		return nil, err
+	}
+	return a.update(s, slots)
+}
+
+// Reset removes every slot of sales, assigned or not
+func (a *Allocator) Reset(sales int64, user string) (*Summary, error) {
+	s, err := a.Store.Sales.Get(sales)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Store.Lots.ReplaceSlots(sales, nil); err != nil {
+		return nil, err
+	}
+	return a.update(s, nil)
+}
+
+// Assign applies as to the slots of sales. Slots not in as keep their
+// values. The whole change is refused when a tank is not one of the
+// customer's, or when the slots would no longer add up to the ordered
+// quantity.
+func (a *Allocator) Assign(sales int64, as []Assignment, user string) (*Summary, error) {
+	s, err := a.Store.Sales.Get(sales)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := a.Store.Lots.Slots(sales)
+	if err != nil {
+		return nil, err
+	}
+	tanks, err := a.tanks(s.Customer)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*repository.LotSlot, len(slots))
+	for _, slot := range slots {
+		byID[slot.ID] = slot
+	}
+	var changed []*repository.LotSlot
+	for _, asg := range as {
+		slot, ok := byID[asg.Slot]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownSlot, asg.Slot)
+		}
+		tank := strings.TrimSpace(asg.Tank)
+		if tank != "" && len(tanks) > 0 && !tanks[tank] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTank, tank)
+		}
+		slot.Lot = strings.TrimSpace(asg.Lot)
+		slot.Tank = tank
+		if asg.Qty != 0 {
+			slot.Qty = asg.Qty
+		}
+		slot.Upuser = user
+		changed = append(changed, slot)
+	}
+
+	var total scan.Qty
+	for _, slot := range slots {
+		total += slot.Qty
+	}
+	if total != s.Qty {
+		return nil, fmt.Errorf("%w: %s allocated, %s ordered", ErrQtyMismatch, total, s.Qty)
+	}
+	if err := a.checkTanks(s, slots); err != nil {
+		return nil, err
+	}
+	if err := a.Store.Lots.UpdateSlots(changed); err != nil {
+		return nil, err
+	}
+	return a.update(s, slots)
+}
+
+// Allocate replaces the slots of sales with as, one slot per assignment.
+// It is how a delivery is split differently from MakeSpace, e.g. 6t as 4t
+// of one lot into tank 1 and 2t of another into tank 2.
+func (a *Allocator) Allocate(sales int64, as []Assignment, user string) (*Summary, error) {
+	s, err := a.Store.Sales.Get(sales)
+	if err != nil {
+		return nil, err
+	}
+	tanks, err := a.tanks(s.Customer)
+	if err != nil {
+		return nil, err
+	}
+
+	var total scan.Qty
+	slots := make([]*repository.LotSlot, 0, len(as))
+	for _, asg := range as {
+		tank := strings.TrimSpace(asg.Tank)
+		if tank != "" && len(tanks) > 0 && !tanks[tank] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTank, tank)
+		}
+		if asg.Qty <= 0 {
+			return nil, fmt.Errorf("%w: slot of lot %q has no quantity", ErrQtyMismatch, asg.Lot)
+		}
+		total += asg.Qty
+		slots = append(slots, &repository.LotSlot{Goods: s.Goods, Lot: strings.TrimSpace(asg.Lot), Tank: tank, Qty: asg.Qty, Upuser: user})
+	}
+	if total != s.Qty {
+		return nil, fmt.Errorf("%w: %s allocated, %s ordered", ErrQtyMismatch, total, s.Qty)
+	}
+	if err := a.checkTanks(s, slots); err != nil {
+		return nil, err
+	}
+	if err := a.Store.Lots.ReplaceSlots(sales, slots); err != nil {
+		return nil, err
+	}
+	return a.update(s, slots)
+}
+
+// Summary returns the allocation state of sales
+func (a *Allocator) Summary(sales int64) (*Summary, error) {
+	s, err := a.Store.Sales.Get(sales)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := a.Store.Lots.Slots(sales)
+	if err != nil {
+		return nil, err
+	}
+	return summarize(s, slots), nil
+}
+
+// update keeps lot_fg of s in step with its slots
+func (a *Allocator) update(s *repository.Sales, slots []*repository.LotSlot) (*Summary, error) {
+	sum := summarize(s, slots)
+	if s.LotFg != sum.Complete {
+		s.LotFg = sum.Complete
+		if err := a.Store.Sales.Update(s); err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+// checkTanks refuses slots that would overfill a tank of the customer or
+// put the goods into a tank not allowed to hold it
+func (a *Allocator) checkTanks(s *repository.Sales, slots []*repository.LotSlot) error {
+	return (&tank.Tanks{Store: a.Store}).Check(s, slots)
+}
+
+// defaultTank is the customer's tank when there is only one
+func (a *Allocator) defaultTank(s *repository.Sales) (string, error) {
+	details, err := a.Store.Customers.Details(s.Customer)
+	if err != nil {
+		return "", err
+	}
+	if len(details) == 1 {
+		return details[0].Tank, nil
+	}
+	return "", nil
+}
+
+// tanks returns the customer's tanks; an empty set allows any tank
+func (a *Allocator) tanks(customer string) (map[string]bool, error) {
+	details, err := a.Store.Customers.Details(customer)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]bool, len(details))
+	for _, d := range details {
+		ret[d.Tank] = true
+	}
+	return ret, nil
+}
+
+func summarize(s *repository.Sales, slots []*repository.LotSlot) *Summary {
+	sum := &Summary{
+		Sales:   s.Sales,
+		Goods:   s.Goods,
+		Ordered: s.Qty,
+		Slots:   slots,
+		ByTank:  make(map[string]map[string]scan.Qty),
+	}
+	complete := len(slots) > 0
+	for _, slot := range slots {
+		sum.Allocated += slot.Qty
+		if slot.Lot == "" {
+			complete = false
+			continue
+		}
+		if sum.ByTank[slot.Tank] == nil {
+			sum.ByTank[slot.Tank] = make(map[string]scan.Qty)
+		}
+		sum.ByTank[slot.Tank][slot.Lot] += slot.Qty
+	}
+	sum.Complete = complete && sum.Allocated == sum.Ordered
+	return sum
+}
@@ -0,0 +1,224 @@
+package lot_test
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/lot"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func q(s string) scan.Qty {
+	qty, err := scan.ParseQty(s)
+	if err != nil {
+		panic(err)
+	}
+	return qty
+}
+
+// forEachStore runs f against the in-memory store and a SQLite database
+func forEachStore(t *testing.T, f func(t *testing.T, st *repository.Store)) {
+	t.Helper()
+	t.Run("memory", func(t *testing.T) {
+		f(t, repository.NewMemory())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		f(t, repository.NewSQL(testdb.New(t), testdb.Dialect))
+	})
+}
+
+// order creates a 6t sales of goods 101, which comes in 1t bags, for a
+// customer with the given tanks
+func order(t *testing.T, st *repository.Store, tanks ...string) *repository.Sales {
+	t.Helper()
+	must(t, st.Goods.Save(&repository.Goods{Goods: "101", Qty: q("1")}))
+	var details []*repository.CustomerDetail
+	for _, name := range tanks {
+		details = append(details, &repository.CustomerDetail{Tank: name})
+	}
+	must(t, st.Customers.SaveDetails("C1", details))
+	s := &repository.Sales{Customer: "C1", Goods: "101", Qty: q("6"), OutgoingWarehouse: "1", DeliveryDt: civil.MustParse("2026-10-21")}
+	_, err := st.Sales.Create(s)
+	must(t, err)
+	return s
+}
+
+// byTank lists the allocation of sum as "tank/lot=qty", sorted
+func byTank(sum *lot.Summary) string {
+	var ret []string
+	for tank, lots := range sum.ByTank {
+		for l, qty := range lots {
+			ret = append(ret, fmt.Sprintf("%s/%s=%s", tank, l, qty))
+		}
+	}
+	sort.Strings(ret)
+	return fmt.Sprint(ret)
+}
+
+func slotQtys(slots []*repository.LotSlot) string {
+	var ret []string
+	for _, s := range slots {
+		ret = append(ret, fmt.Sprintf("%s:%s", s.Tank, s.Qty))
+	}
+	return fmt.Sprint(ret)
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		total, unit string
+		want        string
+	}{
+		{"6", "1", "[1.000 1.000 1.000 1.000 1.000 1.000]"},
+		{"6.5", "2", "[2.000 2.000 2.000 0.500]"},
+		{"2", "2", "[2.000]"},
+		{"6", "10", "[6.000]"},
+		{"6", "0", "[6.000]"},
+		{"0", "1", "[]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(lot.Split(q(tt.total), q(tt.unit))); got != tt.want {
+			t.Errorf("Split(%s, %s) = %s, want %s", tt.total, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestMakeSpace(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		a := &lot.Allocator{Store: st}
+		s := order(t, st, "T1")
+
+		sum, err := a.MakeSpace(s.Sales, "test")
+		must(t, err)
+		if got := slotQtys(sum.Slots); got != "[T1:1.000 T1:1.000 T1:1.000 T1:1.000 T1:1.000 T1:1.000]" {
+			t.Errorf("MakeSpace slots = %s, want six 1t slots in the only tank", got)
+		}
+		if sum.Complete || sum.Allocated != q("6") {
+			t.Errorf("MakeSpace summary = %+v, want 6t allocated, incomplete", sum)
+		}
+
+		sum, err = a.MakeSpaceSingle(s.Sales, "test")
+		must(t, err)
+		if got := slotQtys(sum.Slots); got != "[T1:6.000]" {
+			t.Errorf("MakeSpaceSingle slots = %s, want one 6t slot", got)
+		}
+	})
+}
+
+// TestAssign splits 6t over two tanks on the slots of MakeSpace: four bags
+// of lot L1 into tank 1, two of lot L2 into tank 2
+func TestAssign(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		a := &lot.Allocator{Store: st}
+		s := order(t, st, "T1", "T2")
+		sum, err := a.MakeSpace(s.Sales, "test")
+		must(t, err)
+		if got := slotQtys(sum.Slots); got != "[:1.000 :1.000 :1.000 :1.000 :1.000 :1.000]" {
+			t.Fatalf("MakeSpace slots = %s, want six 1t slots in no tank", got)
+		}
+
+		var as []lot.Assignment
+		for i, slot := range sum.Slots {
+			asg := lot.Assignment{Slot: slot.ID, Lot: "L1", Tank: "T1"}
+			if i >= 4 {
+				asg.Lot, asg.Tank = "L2", "T2"
+			}
+			as = append(as, asg)
+		}
+		sum, err = a.Assign(s.Sales, as, "test")
+		must(t, err)
+		if !sum.Complete || byTank(sum) != "[T1/L1=4.000 T2/L2=2.000]" {
+			t.Errorf("Assign = %s, complete %v", byTank(sum), sum.Complete)
+		}
+		if got, _ := st.Sales.Get(s.Sales); !got.LotFg {
+			t.Error("a complete allocation did not set lot_fg")
+		}
+		// Saving the same assignment again changes no row
+		_, err = a.Assign(s.Sales, as, "test")
+		must(t, err)
+
+		bad := []struct {
+			name string
+			as   []lot.Assignment
+			want error
+		}{
+			{"more than ordered", []lot.Assignment{{Slot: as[0].Slot, Lot: "L1", Tank: "T1", Qty: q("2")}}, lot.ErrQtyMismatch},
+			{"unknown tank", []lot.Assignment{{Slot: as[0].Slot, Lot: "L1", Tank: "T9"}}, lot.ErrUnknownTank},
+			{"unknown slot", []lot.Assignment{{Slot: 999, Lot: "L1", Tank: "T1"}}, lot.ErrUnknownSlot},
+		}
+		for _, tt := range bad {
+			if _, err := a.Assign(s.Sales, tt.as, "test"); !errors.Is(err, tt.want) {
+				t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+			}
+		}
+		sum, err = a.Summary(s.Sales)
+		must(t, err)
+		if !sum.Complete || byTank(sum) != "[T1/L1=4.000 T2/L2=2.000]" {
+			t.Errorf("refused assignments changed the slots: %s", byTank(sum))
+		}
+
+		if _, err := a.MakeSpace(s.Sales, "test"); err != lot.ErrAssigned {
+			t.Errorf("MakeSpace over assigned lots: err = %v, want ErrAssigned", err)
+		}
+		_, err = a.Reset(s.Sales, "test")
+		must(t, err)
+		if got, _ := st.Sales.Get(s.Sales); got.LotFg {
+			t.Error("Reset kept lot_fg")
+		}
+	})
+}
+
+// TestAllocate records the 6t delivery across two tanks of the request:
+// 4t of lot L1 into tank 1 and 2t of lot L2 into tank 2. Allocations that
+// do not add up to the 6t ordered are refused.
+func TestAllocate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		a := &lot.Allocator{Store: st}
+		s := order(t, st, "T1", "T2")
+
+		tests := []struct {
+			name string
+			as   []lot.Assignment
+			want error
+		}{
+			{"short", []lot.Assignment{{Lot: "L1", Tank: "T1", Qty: q("4")}, {Lot: "L2", Tank: "T2", Qty: q("1.5")}}, lot.ErrQtyMismatch},
+			{"over", []lot.Assignment{{Lot: "L1", Tank: "T1", Qty: q("4")}, {Lot: "L2", Tank: "T2", Qty: q("2.5")}}, lot.ErrQtyMismatch},
+			{"empty slot", []lot.Assignment{{Lot: "L1", Tank: "T1", Qty: q("6")}, {Lot: "L2", Tank: "T2"}}, lot.ErrQtyMismatch},
+			{"unknown tank", []lot.Assignment{{Lot: "L1", Tank: "T1", Qty: q("4")}, {Lot: "L2", Tank: "T3", Qty: q("2")}}, lot.ErrUnknownTank},
+			{"nothing", nil, lot.ErrQtyMismatch},
+		}
+		for _, tt := range tests {
+			if _, err := a.Allocate(s.Sales, tt.as, "test"); !errors.Is(err, tt.want) {
+				t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+			}
+		}
+		if slots, _ := st.Lots.Slots(s.Sales); len(slots) != 0 {
+			t.Errorf("refused allocations left %d slots", len(slots))
+		}
+
+		sum, err := a.Allocate(s.Sales, []lot.Assignment{{Lot: "L1", Tank: "T1", Qty: q("4")}, {Lot: "L2", Tank: "T2", Qty: q("2")}}, "test")
+		must(t, err)
+		if !sum.Complete || sum.Allocated != q("6") || byTank(sum) != "[T1/L1=4.000 T2/L2=2.000]" {
+			t.Errorf("Allocate = %s, %s allocated, complete %v", byTank(sum), sum.Allocated, sum.Complete)
+		}
+		slots, err := st.Lots.Slots(s.Sales)
+		must(t, err)
+		if got := slotQtys(slots); got != "[T1:4.000 T2:2.000]" {
+			t.Errorf("stored slots = %s", got)
+		}
+		if got, _ := st.Sales.Get(s.Sales); !got.LotFg {
+			t.Error("a complete allocation did not set lot_fg")
+		}
+	})
+}
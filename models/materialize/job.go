@@ -0,0 +1,357 @@
+// Package materialize turns projected repeat occurrences into real
+// yc_sales rows a few days before delivery, as RegistOrderProcessForRepeat
+// does for one occurrence on the schedule screen.
+//
+// The job is idempotent per (base_sales, delivery_dt): a materialized
+// occurrence is confirmed in yc_repeat_exclude and its sales carries
+// base_sales, so a rerun, or a run after a crash between the two writes,
+// never creates a second sales. Every run is recorded in
+// yc_materialize_log, including dry runs.
+package materialize
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/leadtime"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/restriction"
+	"github.com/geeknow112/srv-tools/models/schedule"
+)
+
+// DefaultDays is how far ahead occurrences are materialized when Job.Days
+// is zero
+const DefaultDays = 7
+
+// DefaultUser is the upuser of the sales the job creates
+const DefaultUser = "materialize"
+
+// yc_materialize_log.status values
+const (
+	// Created occurrences were materialized as a new sales
+	Created = "created"
+	// Linked occurrences already had a sales from an interrupted run; only
+	// the exclusion was written
+	Linked = "linked"
+	// Planned occurrences would be created; dry runs only
+	Planned = "planned"
+	// Conflict occurrences were left projected; the next run retries them
+	Conflict = "conflict"
+)
+
+// Job materializes the repeat occurrences from today to Days days ahead
+type Job struct {
+	Store *repository.Store
+	// Calendar holds the non-delivery days; nil means weekends and public
+	// holidays only
+	Calendar *calendar.Calendar
+	// LeadTime resolves arrival_dt; nil means leadtime.DefaultDays
+	LeadTime *leadtime.Resolver
+	// Unassigned is what customers with no goods assigned may order
+	Unassigned restriction.UnassignedPolicy
+	Days       int
+	// DryRun logs what would be created without writing sales
+	DryRun bool
+	User   string
+
+	mu sync.Mutex
+}
+
+// Result is what the job did with one occurrence
+type Result struct {
+	Repeat     int64      `json:"repeat"`
+	BaseSales  int64      `json:"base_sales"`
+	DeliveryDt civil.Date `json:"delivery_dt"`
+	Sales      int64      `json:"sales,omitempty"`
+	Status     string     `json:"status"`
+	Message    string     `json:"message,omitempty"`
+}
+
+// Report is the outcome of one run
+type Report struct {
+	RunAt   string     `json:"run_at"`
+	DryRun  bool       `json:"dry_run"`
+	From    civil.Date `json:"from"`
+	To      civil.Date `json:"to"`
+	Results []Result   `json:"results"`
+}
+
+// Count returns the number of results with status
+func (r *Report) Count(status string) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Conflicts returns the results that were not materialized
+func (r *Report) Conflicts() []Result {
+	var ret []Result
+	for _, res := range r.Results {
+		if res.Status == Conflict {
+			ret = append(ret, res)
+		}
+	}
+	return ret
+}
+
+// Run materializes the occurrences from today to today plus Days. Runs do
+// not overlap; a second call waits for the first.
+func (j *Job) Run(today civil.Date) (*Report, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	days := j.Days
+	if days <= 0 {
+		days = DefaultDays
+	}
+	rpt := &Report{RunAt: civil.Timestamp(), DryRun: j.DryRun, From: today, To: today.AddDays(days)}
+
+	candidates, err := schedule.Pending(j.Store, rpt.From, rpt.To, j.Calendar)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		res, err := j.materialize(c)
+		if err != nil {
+			return rpt, err
+		}
+		if err := j.Store.Log.Add(&repository.MaterializeLog{
+			RunAt:      rpt.RunAt,
+			DryRun:     j.DryRun,
+			BaseSales:  res.BaseSales,
+			Repeat:     res.Repeat,
+			DeliveryDt: res.DeliveryDt,
+			Sales:      res.Sales,
+			Status:     res.Status,
+			Message:    res.Message,
+		}); err != nil {
+			return rpt, err
+		}
+		rpt.Results = append(rpt.Results, res)
+	}
+	return rpt, nil
+}
+
+// Start runs the job now and then every interval until ctx is done. Errors
+// and conflicts are written to the standard logger.
+func (j *Job) Start(ctx context.Context, every time.Duration) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			rpt, err := j.Run(civil.Today())
+			if err != nil {
+				log.Printf("materialize: %v", err)
+			}
+			if rpt != nil {
+				for _, c := range rpt.Conflicts() {
+					log.Printf("materialize: repeat %d on %s: %s", c.Repeat, c.DeliveryDt, c.Message)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// materialize creates the sales of c, or reports why it cannot
+func (j *Job) materialize(c schedule.PendingOccurrence) (Result, error) {
+	res := Result{Repeat: c.Repeat.Repeat, BaseSales: c.Repeat.Sales, DeliveryDt: c.DeliveryDt}
+
+	// A sales created by a run that stopped before writing the exclusion.
+	// A cancelled one does not count: the occurrence is created again.
+	done, err := j.Store.Sales.List(repository.SalesFilter{BaseSales: c.Repeat.Sales, DeliveryFrom: c.DeliveryDt, DeliveryTo: c.DeliveryDt})
+	if err != nil {
+		return res, err
+	}
+	for _, s := range done {
+		if s.Status == 9 {
+			continue
+		}
+		res.Sales = s.Sales
+		res.Status = Linked
+		if j.DryRun {
+			res.Status = Planned
+			res.Message = fmt.Sprintf("sales %d exists; the exclusion would be written", res.Sales)
+			return res, nil
+		}
+		return res, j.confirm(c, res.Sales)
+	}
+
+	base, err := j.Store.Sales.Get(c.Repeat.Sales)
+	if err == repository.ErrNotFound {
+		res.Status, res.Message = Conflict, fmt.Sprintf("base sales %d not found", c.Repeat.Sales)
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	msg, err := j.conflict(base, c)
+	if err != nil {
+		return res, err
+	}
+	if msg != "" {
+		res.Status, res.Message = Conflict, msg
+		return res, nil
+	}
+	override, msg, err := j.restricted(base)
+	if err != nil {
+		return res, err
+	}
+	if msg != "" {
+		res.Status, res.Message = Conflict, msg
+		return res, nil
+	}
+
+	s := &repository.Sales{
+		Class:             base.Class,
+		Customer:          base.Customer,
+		Name:              base.Name,
+		Goods:             base.Goods,
+		Qty:               c.Qty,
+		ShipAddr:          base.ShipAddr,
+		CarsTank:          base.CarsTank,
+		OutgoingWarehouse: base.OutgoingWarehouse,
+		UseStock:          base.UseStock,
+		DeliveryDt:        c.DeliveryDt,
+		BaseSales:         base.Sales,
+		Remark:            base.Remark,
+		Upuser:            j.user(),
+	}
+	// Only class 7 survives the copy, as on the schedule screen
+	if s.Class != 7 {
+		s.Class = 0
+	}
+	if s.ArrivalDt, err = j.arrivalDt(s); err != nil {
+		return res, err
+	}
+
+	if j.DryRun {
+		res.Status = Planned
+		res.Message = fmt.Sprintf("qty %s, arrival_dt %s", s.Qty, s.ArrivalDt)
+		return res, nil
+	}
+	var id int64
+	err = j.Store.Tx(func(tx *repository.Store) error {
+		var err error
+		if id, err = tx.Sales.Create(s); err != nil {
+			return err
+		}
+		if err := (&ledger.Ledger{Store: tx}).Reserve(s, j.user()); err != nil {
+			return err
+		}
+		return (&restriction.Checker{Store: tx}).Record(override, id)
+	})
+	if err != nil {
+		return res, err
+	}
+	res.Sales, res.Status = id, Created
+	return res, j.confirm(c, res.Sales)
+}
+
+// restricted checks the goods of base against the customer's assignment.
+// Goods no longer assigned are materialized only when base itself was
+// ordered under an override; the override to record for the new sales is
+// returned. Otherwise it returns why the occurrence cannot be materialized.
+func (j *Job) restricted(base *repository.Sales) (*repository.GoodsOverride, string, error) {
+	rc := &restriction.Checker{Store: j.Store, Unassigned: j.Unassigned}
+	ok, err := rc.Allowed(base.Customer, base.Goods)
+	if err != nil || ok {
+		return nil, "", err
+	}
+	inherited, err := rc.Inherited(base)
+	if err != nil {
+		return nil, "", err
+	}
+	if inherited == nil {
+		return nil, fmt.Sprintf("goods %s is not assigned to customer %s", base.Goods, base.Customer), nil
+	}
+	return &repository.GoodsOverride{
+		Customer: base.Customer,
+		Goods:    base.Goods,
+		Action:   restriction.ActionMaterialize,
+		Reason:   fmt.Sprintf("repeat of sales %d: %s", base.Sales, inherited.Reason),
+		Upuser:   j.user(),
+	}, "", nil
+}
+
+// conflict returns why c cannot be materialized, or ""
+func (j *Job) conflict(base *repository.Sales, c schedule.PendingOccurrence) (string, error) {
+	same, err := j.Store.Sales.List(repository.SalesFilter{Customer: base.Customer, Goods: base.Goods, DeliveryFrom: c.DeliveryDt, DeliveryTo: c.DeliveryDt})
+	if err != nil {
+		return "", err
+	}
+	for _, s := range same {
+		if s.Sales != base.Sales && s.Status != 9 {
+			return fmt.Sprintf("sales %d already delivers %s to %s on %s", s.Sales, base.Goods, base.Customer, c.DeliveryDt), nil
+		}
+	}
+
+	stock, err := j.Store.Stock.Available(base.Goods, base.OutgoingWarehouse, 1)
+	if err != nil {
+		return "", err
+	}
+	if len(stock) == 0 {
+		return fmt.Sprintf("no stock of %s in warehouse %q for customer %s", base.Goods, base.OutgoingWarehouse, base.Customer), nil
+	}
+	return "", nil
+}
+
+// confirm writes the exclusion that hides the materialized occurrence from
+// the projection
+func (j *Job) confirm(c schedule.PendingOccurrence, sales int64) error {
+	if c.Exclusion != nil {
+		e := *c.Exclusion
+		e.Type = repository.Confirmed
+		e.Upuser = j.user()
+		return j.Store.Exclusions.Save(&e)
+	}
+	return j.Store.Exclusions.Add(&repository.Exclusion{
+		Sales:      c.Repeat.Sales,
+		DeliveryDt: c.DeliveryDt,
+		Type:       repository.Confirmed,
+		Reason:     fmt.Sprintf("materialized as sales %d", sales),
+		Upuser:     j.user(),
+	})
+}
+
+func (j *Job) arrivalDt(s *repository.Sales) (civil.Date, error) {
+	k := leadtime.Key{Customer: s.Customer, Goods: s.Goods, Warehouse: s.OutgoingWarehouse}
+	g, err := j.Store.Goods.Get(s.Goods)
+	switch {
+	case err == nil:
+		k.SeparatelyFg = g.SeparatelyFg
+	case err != repository.ErrNotFound:
+		return civil.Date{}, err
+	}
+	resolver := j.LeadTime
+	if resolver == nil {
+		resolver = leadtime.NewResolver(nil, leadtime.DefaultDays)
+	}
+	cal := j.Calendar
+	if cal == nil {
+		cal = calendar.New()
+	}
+	arrivalDt, _ := resolver.ArrivalDt(cal, k, s.DeliveryDt.Time())
+	return civil.DateOf(arrivalDt), nil
+}
+
+func (j *Job) user() string {
+	if j.User == "" {
+		return DefaultUser
+	}
+	return j.User
+}
@@ -0,0 +1,188 @@
+package materialize_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/materialize"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+var d = civil.MustParse
+
+// today runs the job over 2026-10-20 to 2026-10-27, which holds the
+// Monday 2026-10-26 occurrence of the weekly repeats
+var today = d("2026-10-20")
+
+// weekly adds a base sales of goods delivered to C1 from warehouse 1 every
+// Monday from 2026-10-19, and returns the base sales
+func weekly(t *testing.T, st *repository.Store, goods string) int64 {
+	t.Helper()
+	base := &repository.Sales{Customer: "C1", Goods: goods, Qty: scan.NewQty(2), OutgoingWarehouse: "1", RepeatFg: true, DeliveryDt: d("2026-10-19")}
+	_, err := st.Sales.Create(base)
+	must(t, err)
+	_, err = st.Repeats.Save(&repository.Repeat{Sales: base.Sales, Period: 1, RepeatSDt: d("2026-10-19"), RepeatEDt: d("2026-12-31")})
+	must(t, err)
+	return base.Sales
+}
+
+// setup returns a store with a weekly repeat of goods 101, which is in
+// stock, and its base sales
+func setup(t *testing.T) (*repository.Store, int64) {
+	t.Helper()
+	st := repository.NewMemory()
+	base := weekly(t, st, "101")
+	details := []*repository.StockDetail{{Lot: "L1"}, {Lot: "L1"}, {Lot: "L1"}}
+	must(t, st.Stock.Create(&repository.Stock{Stock: "S1", Goods: "101", Warehouse: "1", ArrivalDt: d("2026-10-01")}, details))
+	return st, base
+}
+
+// results lists the results of rpt as "base_sales delivery_dt status sales"
+func results(rpt *materialize.Report) string {
+	var ret []string
+	for _, r := range rpt.Results {
+		ret = append(ret, fmt.Sprintf("%d %s %s %d", r.BaseSales, r.DeliveryDt, r.Status, r.Sales))
+	}
+	return fmt.Sprint(ret)
+}
+
+// materialized returns the sales materialized from base
+func materialized(t *testing.T, st *repository.Store, base int64) []*repository.Sales {
+	t.Helper()
+	list, err := st.Sales.List(repository.SalesFilter{BaseSales: base})
+	must(t, err)
+	return list
+}
+
+func TestRunTwice(t *testing.T) {
+	st, base := setup(t)
+	job := &materialize.Job{Store: st}
+
+	rpt, err := job.Run(today)
+	must(t, err)
+	created := materialized(t, st, base)
+	if len(created) != 1 {
+		t.Fatalf("first run created %d sales, want 1", len(created))
+	}
+	s := created[0]
+	if want := fmt.Sprint([]string{fmt.Sprintf("%d 2026-10-26 created %d", base, s.Sales)}); results(rpt) != want {
+		t.Errorf("first run = %s, want %s", results(rpt), want)
+	}
+	if s.DeliveryDt != d("2026-10-26") || s.ArrivalDt != d("2026-10-21") || s.Qty != scan.NewQty(2) || s.Upuser != materialize.DefaultUser {
+		t.Errorf("created sales = %+v", s)
+	}
+	e, err := st.Exclusions.Get(base, d("2026-10-26"))
+	must(t, err)
+	if e.Type != repository.Confirmed {
+		t.Errorf("exclusion = %+v, want confirmed", e)
+	}
+
+	rpt, err = job.Run(today)
+	must(t, err)
+	if len(rpt.Results) != 0 {
+		t.Errorf("second run = %s, want nothing", results(rpt))
+	}
+	if n := len(materialized(t, st, base)); n != 1 {
+		t.Errorf("%d sales after the second run, want 1", n)
+	}
+	p, err := (&ledger.Ledger{Store: st}).Position("101", "1")
+	must(t, err)
+	if p.Reserved != scan.NewQty(2) {
+		t.Errorf("reserved %s after two runs, want 2", p.Reserved)
+	}
+}
+
+// TestLinked resumes after a run that created the sales but stopped before
+// writing its exclusion. A cancelled sales left on the day is not linked.
+func TestLinked(t *testing.T) {
+	for _, cancelled := range []bool{false, true} {
+		st, base := setup(t)
+		left := &repository.Sales{Customer: "C1", Goods: "101", Qty: scan.NewQty(2), OutgoingWarehouse: "1", DeliveryDt: d("2026-10-26"), BaseSales: base}
+		if cancelled {
+			left.Status = 9
+		}
+		_, err := st.Sales.Create(left)
+		must(t, err)
+
+		rpt, err := (&materialize.Job{Store: st}).Run(today)
+		must(t, err)
+		list := materialized(t, st, base)
+		if cancelled {
+			if len(rpt.Results) != 1 || rpt.Results[0].Status != materialize.Created || rpt.Results[0].Sales == left.Sales || len(list) != 2 {
+				t.Errorf("with a cancelled sales: %s, %d sales", results(rpt), len(list))
+			}
+			continue
+		}
+		if want := fmt.Sprint([]string{fmt.Sprintf("%d 2026-10-26 linked %d", base, left.Sales)}); results(rpt) != want {
+			t.Errorf("run = %s, want %s", results(rpt), want)
+		}
+		if len(list) != 1 {
+			t.Errorf("%d sales, want the one left by the interrupted run", len(list))
+		}
+		if ok, _ := st.Exclusions.Exists(base, d("2026-10-26")); !ok {
+			t.Error("the linked occurrence has no exclusion")
+		}
+	}
+}
+
+// TestDryRunLog checks the yc_materialize_log rows of a dry run and of the
+// real runs after it. Goods 102 has no stock, so its repeat conflicts on
+// every run.
+func TestDryRunLog(t *testing.T) {
+	st, base := setup(t)
+	other := weekly(t, st, "102")
+
+	logged := func() []string {
+		t.Helper()
+		list, err := st.Log.List(0)
+		must(t, err)
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		var ret []string
+		for _, e := range list {
+			ret = append(ret, fmt.Sprintf("%v %d %s %s", e.DryRun, e.BaseSales, e.DeliveryDt, e.Status))
+		}
+		return ret
+	}
+
+	rpt, err := (&materialize.Job{Store: st, DryRun: true}).Run(today)
+	must(t, err)
+	if rpt.Count(materialize.Planned) != 1 || rpt.Count(materialize.Conflict) != 1 {
+		t.Errorf("dry run = %s", results(rpt))
+	}
+	if c := rpt.Conflicts(); len(c) != 1 || c[0].BaseSales != other || c[0].Message == "" {
+		t.Errorf("dry run conflicts = %+v", c)
+	}
+	if n := len(materialized(t, st, base)); n != 0 {
+		t.Errorf("dry run created %d sales", n)
+	}
+	if ok, _ := st.Exclusions.Exists(base, d("2026-10-26")); ok {
+		t.Error("dry run wrote an exclusion")
+	}
+
+	job := &materialize.Job{Store: st}
+	for i := 0; i < 2; i++ {
+		_, err := job.Run(today)
+		must(t, err)
+	}
+	want := []string{
+		fmt.Sprintf("true %d 2026-10-26 planned", base),
+		fmt.Sprintf("true %d 2026-10-26 conflict", other),
+		fmt.Sprintf("false %d 2026-10-26 created", base),
+		fmt.Sprintf("false %d 2026-10-26 conflict", other),
+		fmt.Sprintf("false %d 2026-10-26 conflict", other),
+	}
+	if got := logged(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("log =\n%q\nwant\n%q", got, want)
+	}
+}
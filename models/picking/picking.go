@@ -0,0 +1,210 @@
+// Package picking chooses which stock details leave a warehouse when goods
+// are transferred. A Strategy orders and filters the available details;
+// FIFO (oldest arrival first) is the default, FEFO takes the earliest
+// expiry first and Lots takes only the named lots.
+//
+// Strategies are registered by name so a transfer can store the one it
+// used in yc_stock_detail.pick_strategy and Parse can rebuild it. Transfer
+// reserves the picked details under row locks and retries when another
+// transfer got there first.
+package picking
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+)
+
+// ErrShort is wrapped when fewer details are available than requested
+var ErrShort = errors.New("picking: not enough stock")
+
+// Strategy picks n of the available details of one goods and warehouse
+type Strategy interface {
+	// Name is stored with the transfer; Parse(Name()) returns an
+	// equivalent Strategy
+	Name() string
+	Pick(available []*repository.StockDetail, n int) ([]*repository.StockDetail, error)
+}
+
+var (
+	// FIFO takes the oldest arrival first
+	FIFO Strategy = ordered{name: "fifo", less: byArrival}
+	// FEFO takes the earliest expiry first; details without an expiry
+	// date go last, oldest arrival first
+	FEFO Strategy = ordered{name: "fefo", less: byExpiry}
+)
+
+// Or returns s, or FIFO when s is nil
+func Or(s Strategy) Strategy {
+	if s == nil {
+		return FIFO
+	}
+	return s
+}
+
+// Lots takes only details of the given lots, oldest arrival first
+func Lots(lots ...string) Strategy {
+	set := make(map[string]bool, len(lots))
+	var names []string
+	for _, l := range lots {
+		if l = strings.TrimSpace(l); l != "" && !set[l] {
+			set[l] = true
+			names = append(names, l)
+		}
+	}
+	return lotStrategy{lots: set, name: "lot:" + strings.Join(names, ",")}
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func(arg string) (Strategy, error){
+		"fifo": func(string) (Strategy, error) { return FIFO, nil },
+		"fefo": func(string) (Strategy, error) { return FEFO, nil },
+		"lot": func(arg string) (Strategy, error) {
+			if strings.TrimSpace(arg) == "" {
+				return nil, errors.New("picking: lot strategy needs lot numbers")
+			}
+			return Lots(strings.Split(arg, ",")...), nil
+		},
+	}
+)
+
+// Register adds a strategy under name. Parse passes it what follows
+// "name:" in the strategy string.
+func Register(name string, f func(arg string) (Strategy, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = f
+}
+
+// Parse returns the strategy named s, such as "fifo", "fefo" or
+// "lot:L001,L002". An empty s is FIFO.
+func Parse(s string) (Strategy, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return FIFO, nil
+	}
+	name, arg := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, arg = s[:i], s[i+1:]
+	}
+	registryMu.RLock()
+	f, ok := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("picking: unknown strategy %q", s)
+	}
+	return f(arg)
+}
+
+type ordered struct {
+	name string
+	less func(a, b *repository.StockDetail) bool
+}
+
+func (o ordered) Name() string { return o.name }
+
+func (o ordered) Pick(available []*repository.StockDetail, n int) ([]*repository.StockDetail, error) {
+	return take(sorted(available, o.less), n)
+}
+
+type lotStrategy struct {
+	lots map[string]bool
+	name string
+}
+
+func (l lotStrategy) Name() string { return l.name }
+
+func (l lotStrategy) Pick(available []*repository.StockDetail, n int) ([]*repository.StockDetail, error) {
+	var match []*repository.StockDetail
+	for _, d := range available {
+		if l.lots[d.Lot] {
+			match = append(match, d)
+		}
+	}
+	return take(sorted(match, byArrival), n)
+}
+
+// sorted returns a sorted copy of list; the caller's order is kept for
+// equal details
+func sorted(list []*repository.StockDetail, less func(a, b *repository.StockDetail) bool) []*repository.StockDetail {
+	cp := append([]*repository.StockDetail(nil), list...)
+	sort.SliceStable(cp, func(i, j int) bool { return less(cp[i], cp[j]) })
+	return cp
+}
+
+func take(list []*repository.StockDetail, n int) ([]*repository.StockDetail, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("picking: cannot take %d details", n)
+	}
+	if len(list) < n {
+		return nil, fmt.Errorf("%w: %d requested, %d available", ErrShort, n, len(list))
+	}
+	return list[:n], nil
+}
+
+func byArrival(a, b *repository.StockDetail) bool {
+	if c := compareDates(a.ArrivalDt, b.ArrivalDt); c != 0 {
+		return c < 0
+	}
+	return a.ID < b.ID
+}
+
+func byExpiry(a, b *repository.StockDetail) bool {
+	if c := compareDates(a.ExpiryDt, b.ExpiryDt); c != 0 {
+		return c < 0
+	}
+	return byArrival(a, b)
+}
+
+// compareDates orders dates with the zero (unknown) date last
+func compareDates(a, b civil.Date) int {
+	switch {
+	case a.IsZero() && b.IsZero():
+		return 0
+	case a.IsZero():
+		return 1
+	case b.IsZero():
+		return -1
+	}
+	return a.Compare(b)
+}
+
+// MaxAttempts is how often Transfer tries a reservation that lost a race
+// with another transfer before it gives up
+const MaxAttempts = 5
+
+// ErrBusy is wrapped when every attempt of a transfer conflicted with
+// another one
+var ErrBusy = errors.New("picking: stock is being transferred by someone else")
+
+// Transfer picks n details of goods in warehouse with s, or FIFO when s is
+// nil, and flags them as taken by transfer ref with the name of the
+// strategy. The details are locked while they are picked; a reservation
+// that still conflicts is retried up to MaxAttempts times.
+func Transfer(stock repository.StockRepository, ref, goods, warehouse string, n int, s Strategy) ([]*repository.StockDetail, error) {
+	s = Or(s)
+	pick := func(available []*repository.StockDetail) ([]*repository.StockDetail, error) {
+		picked, err := s.Pick(available, n)
+		if err != nil {
+			return nil, fmt.Errorf("%s in warehouse %q: %w", goods, warehouse, err)
+		}
+		return picked, nil
+	}
+	for attempt := 1; ; attempt++ {
+		picked, err := stock.Reserve(goods, warehouse, ref, s.Name(), pick)
+		if !errors.Is(err, repository.ErrConflict) {
+			return picked, err
+		}
+		if attempt == MaxAttempts {
+			return nil, fmt.Errorf("%w: %s in warehouse %q after %d attempts", ErrBusy, goods, warehouse, attempt)
+		}
+		time.Sleep(time.Duration(attempt) * 10 * time.Millisecond)
+	}
+}
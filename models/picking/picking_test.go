@@ -0,0 +1,124 @@
+package picking_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/picking"
+	"github.com/geeknow112/srv-tools/models/repository"
+)
+
+// feeds receives one detail per lot of goods 101 into warehouse 2. The
+// arrival and expiry orders differ, and lot C has no expiry date.
+func feeds(t *testing.T) *repository.Store {
+	t.Helper()
+	st := repository.NewMemory()
+	for _, f := range []struct{ stock, arrival, lot, expiry string }{
+		{"S3", "2026-10-01", "C", ""},
+		{"S1", "2026-09-01", "A", "2027-03-01"},
+		{"S4", "2026-10-10", "D", "2027-01-01"},
+		{"S2", "2026-09-15", "B", "2026-12-01"},
+	} {
+		detail := &repository.StockDetail{Lot: f.lot, Barcode: f.stock + "-1"}
+		if f.expiry != "" {
+			detail.ExpiryDt = civil.MustParse(f.expiry)
+		}
+		header := &repository.Stock{Stock: f.stock, Goods: "101", Warehouse: "2", ArrivalDt: civil.MustParse(f.arrival)}
+		if err := st.Stock.Create(header, []*repository.StockDetail{detail}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st
+}
+
+func lots(list []*repository.StockDetail) string {
+	s := ""
+	for _, d := range list {
+		s += d.Lot
+	}
+	return s
+}
+
+func TestTransfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy picking.Strategy
+		n        int
+		want     string
+		left     string
+		err      error
+	}{
+		{"nil is FIFO", nil, 2, "AB", "CD", nil},
+		{"FIFO takes the older feed first", picking.FIFO, 3, "ABC", "D", nil},
+		{"FEFO takes the earlier expiry first", picking.FEFO, 2, "BD", "AC", nil},
+		{"FEFO takes unknown expiry last", picking.FEFO, 4, "BDAC", "", nil},
+		{"lots, oldest arrival first", picking.Lots("D", "A"), 2, "AD", "BC", nil},
+		{"nothing", picking.FIFO, 0, "", "ABCD", nil},
+		{"short", picking.FIFO, 5, "", "ABCD", picking.ErrShort},
+		{"short of a lot", picking.Lots("A"), 2, "", "ABCD", picking.ErrShort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := feeds(t)
+			picked, err := picking.Transfer(st.Stock, "T1", "101", "2", tt.n, tt.strategy)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if got := lots(picked); got != tt.want {
+				t.Errorf("picked lots %q, want %q", got, tt.want)
+			}
+			left, err := st.Stock.Available("101", "2", -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lots(left); got != tt.left {
+				t.Errorf("left lots %q, want %q", got, tt.left)
+			}
+
+			taken, err := st.Stock.Transferred("T1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := picking.FIFO.Name()
+			if tt.strategy != nil {
+				name = tt.strategy.Name()
+			}
+			for _, d := range taken {
+				if d.PickStrategy != name {
+					t.Errorf("lot %s pick_strategy %q, want %q", d.Lot, d.PickStrategy, name)
+				}
+			}
+			if len(taken) != len(tt.want) {
+				t.Errorf("%d details taken by T1, want %d", len(taken), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPickNegative(t *testing.T) {
+	for _, s := range []picking.Strategy{picking.FIFO, picking.FEFO, picking.Lots("A")} {
+		if picked, err := s.Pick(nil, -1); err == nil {
+			t.Errorf("%s: Pick(-1) = %v, want an error", s.Name(), picked)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"", "fifo", "FEFO", "lot:L1,L2"} {
+		got, err := picking.Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", s, err)
+			continue
+		}
+		again, err := picking.Parse(got.Name())
+		if err != nil || again.Name() != got.Name() {
+			t.Errorf("Parse(%q).Name() = %q does not parse back: %v", s, got.Name(), err)
+		}
+	}
+	for _, s := range []string{"lifo", "lot:"} {
+		if _, err := picking.Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+// Package projection projects the stock of goods in each warehouse over
+// the next days and suggests how to keep it above its minimum.
+//
+// A projection starts from the ledger: what is on hand and in transit into
+// the warehouse, less what is reserved. Each day then takes off the
+// deliveries from the warehouse: the confirmed sales, with what the ledger
+// still holds reserved for them or their quantity when they were never
+// posted, and the repeat occurrences not materialized yet. A reservation
+// delivered within the projection is taken off on its delivery day
+// instead of at the start. A goods whose projected stock falls below the minimum in
+// yc_stock_threshold (zero when none is set) is low.
+//
+// A low warehouse that transfers feed its stock gets a transfer suggestion
+// from its source, as far as the source can spare it above its own
+// minimum; the rest, and whatever a source itself runs short of, is a
+// reorder suggestion. Suggested quantities are whole goods units.
+package projection
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/schedule"
+	"github.com/geeknow112/srv-tools/models/transfer"
+)
+
+// DefaultDays is how far ahead stock is projected when Projector.Days is
+// zero
+const DefaultDays = 14
+
+// SuggestionKind tells a transfer from a reorder
+type SuggestionKind string
+
+const (
+	// Transfer suggestions move stock from the source warehouse
+	Transfer SuggestionKind = "transfer"
+	// Reorder suggestions buy stock into the warehouse
+	Reorder SuggestionKind = "reorder"
+)
+
+// Filter narrows a projection. Zero values are ignored.
+type Filter struct {
+	Goods     string
+	Warehouse string
+}
+
+// Day is the projected stock at the end of a day with deliveries
+type Day struct {
+	Date    civil.Date
+	Demand  scan.Qty
+	Balance scan.Qty
+}
+
+// Suggestion is a quantity to transfer or reorder into the warehouse of a
+// projection before NeededBy
+type Suggestion struct {
+	Kind     SuggestionKind
+	From     string
+	Qty      scan.Qty
+	NeededBy civil.Date
+}
+
+// Projection is the projected stock of goods in a warehouse
+type Projection struct {
+	Goods     string
+	Warehouse string
+	OnHand    scan.Qty
+	Reserved  scan.Qty
+	InTransit scan.Qty
+	// Scheduled is the part of Reserved that the Days deliver
+	Scheduled scan.Qty
+	MinQty    scan.Qty
+	TargetQty scan.Qty
+	// Days lists the days with deliveries, in order
+	Days     []Day
+	Lowest   scan.Qty
+	LowestDt civil.Date
+	// BelowDt is the first day the stock is below MinQty and StockoutDt
+	// the first day it is below zero; zero when it never is
+	BelowDt     civil.Date
+	StockoutDt  civil.Date
+	Suggestions []Suggestion
+}
+
+// Start is the stock the projection starts from
+func (p *Projection) Start() scan.Qty {
+	return p.OnHand - p.Reserved + p.Scheduled + p.InTransit
+}
+
+// Low reports whether the stock falls below its minimum
+func (p *Projection) Low() bool {
+	return !p.BelowDt.IsZero()
+}
+
+// Report is the projection of every goods and warehouse from From to To
+type Report struct {
+	From        civil.Date
+	To          civil.Date
+	Projections []*Projection
+}
+
+// Low returns the projections that fall below their minimum
+func (r *Report) Low() []*Projection {
+	var ret []*Projection
+	for _, p := range r.Projections {
+		if p.Low() {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// Projector projects stock
+type Projector struct {
+	Store *repository.Store
+	// Calendar holds the non-delivery days; nil means weekends and public
+	// holidays only
+	Calendar *calendar.Calendar
+	Days     int
+}
+
+type key struct{ goods, warehouse string }
+
+// Run projects the stock matching f from today to today plus Days, lowest
+// first by the day it falls below its minimum
+func (p *Projector) Run(today civil.Date, f Filter) (*Report, error) {
+	days := p.Days
+	if days <= 0 {
+		days = DefaultDays
+	}
+	rpt := &Report{From: today, To: today.AddDays(days)}
+
+	// Sources are projected whatever the warehouse filter, as transfers
+	// from them depend on their own stock
+	all, err := p.project(rpt.From, rpt.To, f.Goods)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.suggest(all); err != nil {
+		return nil, err
+	}
+
+	for _, pr := range all {
+		if f.Warehouse == "" || pr.Warehouse == f.Warehouse {
+			rpt.Projections = append(rpt.Projections, pr)
+		}
+	}
+	sort.SliceStable(rpt.Projections, func(i, j int) bool {
+		a, b := rpt.Projections[i], rpt.Projections[j]
+		if a.Low() != b.Low() {
+			return a.Low()
+		}
+		if c := a.BelowDt.Compare(b.BelowDt); c != 0 {
+			return c < 0
+		}
+		if a.Goods != b.Goods {
+			return a.Goods < b.Goods
+		}
+		return a.Warehouse < b.Warehouse
+	})
+	return rpt, nil
+}
+
+// project projects every warehouse of goods, or of every goods when goods
+// is empty, by goods then warehouse
+func (p *Projector) project(from, to civil.Date, goods string) (map[key]*Projection, error) {
+	ret := make(map[key]*Projection)
+	get := func(goods, warehouse string) *Projection {
+		k := key{goods, warehouse}
+		if ret[k] == nil {
+			ret[k] = &Projection{Goods: goods, Warehouse: warehouse}
+		}
+		return ret[k]
+	}
+
+	positions, err := (&ledger.Ledger{Store: p.Store}).Positions(repository.LedgerFilter{Goods: goods})
+	if err != nil {
+		return nil, err
+	}
+	for _, pos := range positions {
+		pr := get(pos.Goods, pos.Warehouse)
+		pr.OnHand, pr.Reserved, pr.InTransit = pos.OnHand, pos.Reserved, pos.InTransit
+	}
+	thresholds, err := p.Store.Thresholds.List(goods, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range thresholds {
+		pr := get(t.Goods, t.Warehouse)
+		pr.MinQty, pr.TargetQty = t.MinQty, t.TargetQty
+	}
+
+	demand, scheduled, err := p.demand(from, to, goods)
+	if err != nil {
+		return nil, err
+	}
+	for k, qty := range scheduled {
+		get(k.goods, k.warehouse).Scheduled = qty
+	}
+	for k, byDay := range demand {
+		pr := get(k.goods, k.warehouse)
+		for d, qty := range byDay {
+			pr.Days = append(pr.Days, Day{Date: d, Demand: qty})
+		}
+	}
+
+	for _, pr := range ret {
+		sort.Slice(pr.Days, func(i, j int) bool { return pr.Days[i].Date.Before(pr.Days[j].Date) })
+		balance := pr.Start()
+		pr.Lowest, pr.LowestDt = balance, from
+		check := func(d civil.Date) {
+			if balance < pr.Lowest {
+				pr.Lowest, pr.LowestDt = balance, d
+			}
+			if balance < pr.MinQty && pr.BelowDt.IsZero() {
+				pr.BelowDt = d
+			}
+			if balance < 0 && pr.StockoutDt.IsZero() {
+				pr.StockoutDt = d
+			}
+		}
+		check(from)
+		for i := range pr.Days {
+			balance -= pr.Days[i].Demand
+			pr.Days[i].Balance = balance
+			check(pr.Days[i].Date)
+		}
+	}
+	return ret, nil
+}
+
+// demand sums the deliveries from from to to per goods, warehouse and day,
+// and the reservations among them per goods and warehouse
+func (p *Projector) demand(from, to civil.Date, goods string) (map[key]map[civil.Date]scan.Qty, map[key]scan.Qty, error) {
+	ret := make(map[key]map[civil.Date]scan.Qty)
+	add := func(goods, warehouse string, d civil.Date, qty scan.Qty) {
+		k := key{goods, warehouse}
+		if ret[k] == nil {
+			ret[k] = make(map[civil.Date]scan.Qty)
+		}
+		ret[k][d] += qty
+	}
+
+	// A sales the ledger has posted delivers what is still reserved for it
+	type salesKey struct{ ref, goods, warehouse string }
+	posted := make(map[string]bool)
+	reserved := make(map[salesKey]scan.Qty)
+	entries, err := p.Store.Ledger.Entries(repository.LedgerFilter{Goods: goods})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if e.Kind == repository.Sale {
+			posted[e.Ref] = true
+		}
+		reserved[salesKey{e.Ref, e.Goods, e.Warehouse}] += e.Reserved
+	}
+	scheduled := make(map[key]scan.Qty)
+
+	sales, err := p.Store.Sales.List(repository.SalesFilter{Goods: goods, DeliveryFrom: from, DeliveryTo: to})
+	if err != nil {
+		return nil, nil, err
+	}
+	type delivery struct {
+		customer, goods string
+		d               civil.Date
+	}
+	booked := make(map[delivery]bool)
+	for _, s := range sales {
+		if s.Status == 9 {
+			continue
+		}
+		booked[delivery{s.Customer, s.Goods, s.DeliveryDt}] = true
+		if s.OutgoingWarehouse == "" {
+			continue
+		}
+		ref := ledger.SalesRef(s.Sales)
+		if !posted[ref] {
+			add(s.Goods, s.OutgoingWarehouse, s.DeliveryDt, s.Qty)
+			continue
+		}
+		if qty := reserved[salesKey{ref, s.Goods, s.OutgoingWarehouse}]; qty > 0 {
+			add(s.Goods, s.OutgoingWarehouse, s.DeliveryDt, qty)
+			scheduled[key{s.Goods, s.OutgoingWarehouse}] += qty
+		}
+	}
+
+	pending, err := schedule.Pending(p.Store, from, to, p.Calendar)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, occ := range pending {
+		rep := occ.Repeat
+		if goods != "" && rep.Goods != goods {
+			continue
+		}
+		// The materialize job would not create it either
+		if rep.OutgoingWarehouse == "" || booked[delivery{rep.Customer, rep.Goods, occ.DeliveryDt}] {
+			continue
+		}
+		add(rep.Goods, rep.OutgoingWarehouse, occ.DeliveryDt, occ.Qty)
+	}
+	return ret, scheduled, nil
+}
+
+// suggest adds the transfers and reorders that bring every low projection
+// back to its target. Transfers are planned first, earliest shortage
+// first, so a source reorders for what it sends as well as for itself.
+func (p *Projector) suggest(all map[key]*Projection) error {
+	l := &ledger.Ledger{Store: p.Store}
+	svc := &transfer.Service{Store: p.Store}
+	units := make(map[string]scan.Qty)
+	unit := func(goods string) (scan.Qty, error) {
+		if u, ok := units[goods]; ok {
+			return u, nil
+		}
+		u, err := l.Unit(goods)
+		units[goods] = u
+		return u, err
+	}
+
+	var list []*Projection
+	for _, pr := range all {
+		list = append(list, pr)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if c := list[i].BelowDt.Compare(list[j].BelowDt); c != 0 {
+			return c < 0
+		}
+		if list[i].Goods != list[j].Goods {
+			return list[i].Goods < list[j].Goods
+		}
+		return list[i].Warehouse < list[j].Warehouse
+	})
+
+	sent := make(map[key]scan.Qty)
+	var sources []*Projection
+	for _, pr := range list {
+		from, err := svc.Source(pr.Warehouse)
+		switch {
+		case errors.Is(err, transfer.ErrNoRoute), errors.Is(err, transfer.ErrUnknownWarehouse):
+			from = ""
+		case err != nil:
+			return err
+		}
+		if from == "" {
+			sources = append(sources, pr)
+			continue
+		}
+		if !pr.Low() {
+			continue
+		}
+		u, err := unit(pr.Goods)
+		if err != nil {
+			return err
+		}
+		short := roundUp(target(pr)-pr.Lowest, u)
+
+		src := all[key{pr.Goods, from}]
+		var spare scan.Qty
+		if src != nil {
+			spare = roundDown(src.Lowest-src.MinQty-sent[key{pr.Goods, from}], u)
+		}
+		if spare > 0 {
+			qty := spare
+			if short < qty {
+				qty = short
+			}
+			pr.Suggestions = append(pr.Suggestions, Suggestion{Kind: Transfer, From: from, Qty: qty, NeededBy: pr.BelowDt})
+			sent[key{pr.Goods, from}] += qty
+			short -= qty
+		}
+		if short > 0 {
+			pr.Suggestions = append(pr.Suggestions, Suggestion{Kind: Reorder, Qty: short, NeededBy: pr.BelowDt})
+		}
+	}
+
+	for _, pr := range sources {
+		out := sent[key{pr.Goods, pr.Warehouse}]
+		lowest := pr.Lowest - out
+		if lowest >= pr.MinQty {
+			continue
+		}
+		u, err := unit(pr.Goods)
+		if err != nil {
+			return err
+		}
+		neededBy := pr.BelowDt
+		if neededBy.IsZero() {
+			// Low only because of what it sends
+			neededBy = pr.LowestDt
+		}
+		pr.Suggestions = append(pr.Suggestions, Suggestion{Kind: Reorder, Qty: roundUp(target(pr)-lowest, u), NeededBy: neededBy})
+	}
+	return nil
+}
+
+// target is the stock a suggestion brings a projection back to: TargetQty,
+// or MinQty when the target is lower
+func target(pr *Projection) scan.Qty {
+	if pr.TargetQty > pr.MinQty {
+		return pr.TargetQty
+	}
+	return pr.MinQty
+}
+
+func roundUp(q, unit scan.Qty) scan.Qty {
+	if unit <= 0 || q <= 0 {
+		return q
+	}
+	return (q + unit - 1) / unit * unit
+}
+
+func roundDown(q, unit scan.Qty) scan.Qty {
+	if unit <= 0 || q <= 0 {
+		return q
+	}
+	return q / unit * unit
+}
@@ -0,0 +1,90 @@
+package projection_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/projection"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+var today = civil.MustParse("2026-10-19")
+
+// days lists the days of p as "date:demand/balance"
+func days(p *projection.Projection) string {
+	var ret []string
+	for _, d := range p.Days {
+		ret = append(ret, fmt.Sprintf("%s:%s/%s", d.Date, d.Demand, d.Balance))
+	}
+	return fmt.Sprint(ret)
+}
+
+// TestSalesDemand projects five goods units against a reserved sales in
+// the window, a sales that was never posted and a reserved sales beyond
+// the window
+func TestSalesDemand(t *testing.T) {
+	st := repository.NewMemory()
+	l := &ledger.Ledger{Store: st}
+	header := &repository.Stock{Stock: "S1", Goods: "101", Warehouse: "1", ArrivalDt: today}
+	var details []*repository.StockDetail
+	for i := 0; i < 5; i++ {
+		details = append(details, &repository.StockDetail{Lot: "L1"})
+	}
+	must(t, st.Stock.Create(header, details))
+	must(t, l.Receive(header, details, "test"))
+
+	order := func(qty int64, in int, reserve bool) *repository.Sales {
+		s := &repository.Sales{Customer: "C1", Goods: "101", Qty: scan.NewQty(qty), OutgoingWarehouse: "1", DeliveryDt: today.AddDays(in)}
+		_, err := st.Sales.Create(s)
+		must(t, err)
+		if reserve {
+			must(t, l.Reserve(s, "test"))
+		}
+		return s
+	}
+	reserved := order(2, 3, true)
+	order(1, 5, false)
+	order(4, 20, true)
+
+	run := func() *projection.Projection {
+		t.Helper()
+		rpt, err := (&projection.Projector{Store: st}).Run(today, projection.Filter{Goods: "101"})
+		must(t, err)
+		if len(rpt.Projections) != 1 {
+			t.Fatalf("%d projections, want 1", len(rpt.Projections))
+		}
+		return rpt.Projections[0]
+	}
+
+	p := run()
+	// 5 on hand less the 4 reserved beyond the window
+	if p.Reserved != scan.NewQty(6) || p.Scheduled != scan.NewQty(2) || p.Start() != scan.NewQty(1) {
+		t.Errorf("reserved %s, scheduled %s, start %s; want 6, 2 and 1", p.Reserved, p.Scheduled, p.Start())
+	}
+	if want := "[2026-10-22:2.000/-1.000 2026-10-24:1.000/-2.000]"; days(p) != want {
+		t.Errorf("days = %s, want %s", days(p), want)
+	}
+	if p.StockoutDt != today.AddDays(3) {
+		t.Errorf("stockout on %s, want %s", p.StockoutDt, today.AddDays(3))
+	}
+
+	// One unit of the reserved sales has been delivered
+	must(t, l.Ship(reserved, details[:1], "test"))
+	p = run()
+	if p.OnHand != scan.NewQty(4) || p.Start() != scan.NewQty(0) {
+		t.Errorf("after a delivery: on hand %s, start %s; want 4 and 0", p.OnHand, p.Start())
+	}
+	if want := "[2026-10-22:1.000/-1.000 2026-10-24:1.000/-2.000]"; days(p) != want {
+		t.Errorf("after a delivery: days = %s, want %s", days(p), want)
+	}
+}
@@ -0,0 +1,166 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// identPattern matches the column and table references the builder accepts
+// for ORDER BY, e.g. "s.delivery_dt" or "goods".
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ErrPlaceholderCount is returned when a condition's placeholders do not
+// match the number of bound values.
+var ErrPlaceholderCount = errors.New("query: placeholder count does not match args")
+
+// Builder assembles a SELECT statement. Values are never written into the
+// SQL text; they are always returned as args bound to "?" placeholders.
+type Builder struct {
+	columns []string
+	from    string
+	joins   []string
+	conds   []string
+	args    []interface{}
+	orders  []string
+	limit   int
+	offset  int
+	err     error
+}
+
+// Select starts a new statement selecting the given columns.
+func Select(columns ...string) *Builder {
+	if len(columns) == 0 {
+		columns = []string{"*"}
+	}
+	return &Builder{columns: columns, limit: -1}
+}
+
+// From sets the table expression, e.g. "yc_goods AS g".
+func (b *Builder) From(table string) *Builder {
+	b.from = table
+	return b
+}
+
+// Join adds a join clause. kind is "LEFT", "INNER", etc.
+func (b *Builder) Join(kind, table, on string) *Builder {
+	b.joins = append(b.joins, fmt.Sprintf("%s JOIN %s ON %s", strings.ToUpper(kind), table, on))
+	return b
+}
+
+// LeftJoin adds a LEFT JOIN clause.
+func (b *Builder) LeftJoin(table, on string) *Builder {
+	return b.Join("LEFT", table, on)
+}
+
+// Where adds a condition joined with AND. Every value must be passed in
+// args and referenced with "?" in cond.
+func (b *Builder) Where(cond string, args ...interface{}) *Builder {
+	if strings.Count(cond, "?") != len(args) {
+		b.fail(fmt.Errorf("%w: %q", ErrPlaceholderCount, cond))
+		return b
+	}
+	b.conds = append(b.conds, cond)
+	b.args = append(b.args, args...)
+	return b
+}
+
+// WhereEq adds "column = ?".
+func (b *Builder) WhereEq(column string, value interface{}) *Builder {
+	return b.Where(column+" = ?", value)
+}
+
+// WhereNotEq adds "column <> ?".
+func (b *Builder) WhereNotEq(column string, value interface{}) *Builder {
+	return b.Where(column+" <> ?", value)
+}
+
+// WhereIn adds "column IN (?, ?, ...)". An empty list matches nothing.
+func (b *Builder) WhereIn(column string, values ...interface{}) *Builder {
+	if len(values) == 0 {
+		return b.Where("1 = 0")
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	return b.Where(fmt.Sprintf("%s IN (%s)", column, marks), values...)
+}
+
+// WhereLike adds "column LIKE ?" with a pattern built by the caller,
+// normally through LikePrefix or LikeContains.
+func (b *Builder) WhereLike(column, pattern string) *Builder {
+	return b.Where(column+" LIKE ? ESCAPE '"+likeEscape+"'", pattern)
+}
+
+// OrderBy appends an ORDER BY term. column must be a plain identifier.
+func (b *Builder) OrderBy(column string, desc bool) *Builder {
+	if !identPattern.MatchString(column) {
+		b.fail(fmt.Errorf("query: invalid order column %q", column))
+		return b
+	}
+	if desc {
+		column += " DESC"
+	}
+	b.orders = append(b.orders, column)
+	return b
+}
+
+// Limit caps the number of rows returned.
+func (b *Builder) Limit(n int) *Builder {
+	b.limit = n
+	return b
+}
+
+// Offset skips the first n rows. It only takes effect with Limit.
+func (b *Builder) Offset(n int) *Builder {
+	b.offset = n
+	return b
+}
+
+// Build returns the SQL text and the values bound to its placeholders.
+func (b *Builder) Build() (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if b.from == "" {
+		return "", nil, errors.New("query: missing FROM")
+	}
+	if b.limit < -1 || b.offset < 0 {
+		return "", nil, errors.New("query: negative limit or offset")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	sb.WriteString(strings.Join(b.columns, ", "))
+	sb.WriteString(" FROM ")
+	sb.WriteString(b.from)
+	for _, j := range b.joins {
+		sb.WriteString(" ")
+		sb.WriteString(j)
+	}
+	if len(b.conds) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(b.conds, " AND "))
+	}
+	if len(b.orders) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(b.orders, ", "))
+	}
+
+	args := append([]interface{}{}, b.args...)
+	if b.limit >= 0 {
+		sb.WriteString(" LIMIT ?")
+		args = append(args, b.limit)
+		if b.offset > 0 {
+			sb.WriteString(" OFFSET ?")
+			args = append(args, b.offset)
+		}
+	}
+
+	return sb.String(), args, nil
+}
+
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
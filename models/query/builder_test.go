@@ -0,0 +1,159 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hostile are values a search form may send. None of them may reach the
+// SQL text.
+var hostile = []string{
+	"'; DROP TABLE yc_sales; --",
+	"\" OR \"1\"=\"1",
+	"' OR '1'='1",
+	"1; DELETE FROM yc_goods",
+	"?",
+	"%_!",
+	"\\'",
+	"x' UNION SELECT password FROM users --",
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *Builder
+		sql  string
+		args []interface{}
+	}{
+		{
+			name: "all columns",
+			b:    Select().From("yc_goods"),
+			sql:  "SELECT * FROM yc_goods",
+		},
+		{
+			name: "conditions, order and paging",
+			b: Select("s.sales", "g.name").From("yc_sales AS s").
+				LeftJoin("yc_goods AS g", "s.goods = g.goods").
+				WhereEq("s.customer", "C1").
+				WhereNotEq("s.status", 9).
+				WhereIn("s.goods", "101", "102").
+				OrderBy("s.delivery_dt", true).
+				OrderBy("sales", false).
+				Limit(10).Offset(20),
+			sql:  "SELECT s.sales, g.name FROM yc_sales AS s LEFT JOIN yc_goods AS g ON s.goods = g.goods WHERE s.customer = ? AND s.status <> ? AND s.goods IN (?, ?) ORDER BY s.delivery_dt DESC, sales LIMIT ? OFFSET ?",
+			args: []interface{}{"C1", 9, "101", "102", 10, 20},
+		},
+		{
+			name: "empty IN matches nothing",
+			b:    Select().From("yc_goods").WhereIn("goods"),
+			sql:  "SELECT * FROM yc_goods WHERE 1 = 0",
+		},
+		{
+			name: "offset without limit",
+			b:    Select().From("yc_goods").Offset(5),
+			sql:  "SELECT * FROM yc_goods",
+		},
+		{
+			name: "limit 0",
+			b:    Select().From("yc_goods").Limit(0),
+			sql:  "SELECT * FROM yc_goods LIMIT ?",
+			args: []interface{}{0},
+		},
+		{
+			name: "like",
+			b:    Select().From("yc_goods").WhereLike("name", LikeContains("50%")),
+			sql:  "SELECT * FROM yc_goods WHERE name LIKE ? ESCAPE '!'",
+			args: []interface{}{"%50!%%"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := tt.b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.sql {
+				t.Errorf("sql\n got %s\nwant %s", sql, tt.sql)
+			}
+			if len(args) != 0 || len(tt.args) != 0 {
+				if !reflect.DeepEqual(args, tt.args) {
+					t.Errorf("args = %v, want %v", args, tt.args)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildHostileValues(t *testing.T) {
+	for _, v := range hostile {
+		t.Run(v, func(t *testing.T) {
+			sql, args, err := Select().From("yc_sales").
+				WhereEq("customer", v).
+				WhereIn("goods", v, v).
+				WhereLike("name", LikePrefix(v)).
+				Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "SELECT * FROM yc_sales WHERE customer = ? AND goods IN (?, ?) AND name LIKE ? ESCAPE '!'"
+			if sql != want {
+				t.Errorf("sql\n got %s\nwant %s", sql, want)
+			}
+			if got := strings.Count(sql, "?"); got != len(args) {
+				t.Errorf("%d placeholders for %d args", got, len(args))
+			}
+			if args[0] != v || args[1] != v || args[2] != v {
+				t.Errorf("args = %q, want %q bound unchanged", args[:3], v)
+			}
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *Builder
+		is   error
+	}{
+		{"missing from", Select(), nil},
+		{"too few args", Select().From("t").Where("a = ? AND b = ?", 1), ErrPlaceholderCount},
+		{"too many args", Select().From("t").Where("a = 1", 1), ErrPlaceholderCount},
+		{"value in condition", Select().From("t").Where("a = '?'"), ErrPlaceholderCount},
+		{"negative limit", Select().From("t").Limit(-2), nil},
+		{"negative offset", Select().From("t").Limit(1).Offset(-1), nil},
+		{"first error wins", Select().From("t").Where("a = ?").OrderBy("x;", false), ErrPlaceholderCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := tt.b.Build()
+			if err == nil {
+				t.Fatalf("Build() = %q, %v; want an error", sql, args)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("err = %v, want %v", err, tt.is)
+			}
+			if sql != "" || args != nil {
+				t.Errorf("Build() returned %q, %v with the error", sql, args)
+			}
+		})
+	}
+}
+
+func TestOrderByRejectsExpressions(t *testing.T) {
+	for _, col := range append([]string{
+		"",
+		"delivery_dt DESC",
+		"1",
+		"a.b.c",
+		"name; DROP TABLE yc_goods",
+		"(SELECT 1)",
+		"goods--",
+		"`goods`",
+	}, hostile...) {
+		if _, _, err := Select().From("yc_goods").OrderBy(col, false).Build(); err == nil {
+			t.Errorf("OrderBy(%q) accepted", col)
+		}
+	}
+}
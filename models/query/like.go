@@ -0,0 +1,25 @@
+package query
+
+import "strings"
+
+// likeEscape is the LIKE escape character. It is declared explicitly with
+// ESCAPE because MySQL and SQLite disagree on the default.
+const likeEscape = "!"
+
+// likeEscaper escapes the LIKE wildcards and the escape character itself.
+var likeEscaper = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+
+// EscapeLike escapes s so it matches literally inside a LIKE pattern.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// LikePrefix returns a pattern matching values that start with s.
+func LikePrefix(s string) string {
+	return EscapeLike(s) + "%"
+}
+
+// LikeContains returns a pattern matching values that contain s.
+func LikeContains(s string) string {
+	return "%" + EscapeLike(s) + "%"
+}
@@ -0,0 +1,106 @@
+package query_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"50%", "50!%"},
+		{"a_b", "a!_b"},
+		{"!", "!!"},
+		{"!%", "!!!%"},
+		{"%_!%_!", "!%!_!!!%!_!!"},
+		{"it's", "it's"},
+		{`"quoted"`, `"quoted"`},
+		{`back\slash`, `back\slash`},
+		{"'; DROP TABLE yc_goods; --", "'; DROP TABLE yc!_goods; --"},
+		{"飼料_A%", "飼料!_A!%"},
+	}
+	for _, tt := range tests {
+		if got := query.EscapeLike(tt.in); got != tt.want {
+			t.Errorf("EscapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := query.LikePrefix("a%"); got != "a!%%" {
+		t.Errorf("LikePrefix = %q", got)
+	}
+	if got := query.LikeContains("_"); got != "%!_%" {
+		t.Errorf("LikeContains = %q", got)
+	}
+}
+
+// TestLikeMatchesLiterally runs the patterns against SQLite, which needs
+// the explicit ESCAPE clause just as MySQL does
+func TestLikeMatchesLiterally(t *testing.T) {
+	names := []string{
+		"50% protein",
+		"500 protein",
+		"a_b",
+		"axb",
+		"x!y",
+		"x!!y",
+		"it's",
+		"its",
+		`back\slash`,
+		"'; DROP TABLE yc_goods; --",
+	}
+	rows := make([]map[string]interface{}, len(names))
+	for i, n := range names {
+		rows[i] = map[string]interface{}{"goods": string(rune('A' + i)), "name": n}
+	}
+	db := testdb.New(t, testdb.Fixture{Table: "yc_goods", Rows: rows})
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{query.LikePrefix("50%"), []string{"50% protein"}},
+		{query.LikeContains("%"), []string{"50% protein"}},
+		{query.LikeContains("_"), []string{"'; DROP TABLE yc_goods; --", "a_b"}},
+		{query.LikePrefix("a_"), []string{"a_b"}},
+		{query.LikeContains("!"), []string{"x!!y", "x!y"}},
+		{query.LikeContains("!!"), []string{"x!!y"}},
+		{query.LikeContains("'"), []string{"'; DROP TABLE yc_goods; --", "it's"}},
+		{query.LikeContains(`\`), []string{`back\slash`}},
+		{query.LikePrefix("'; DROP"), []string{"'; DROP TABLE yc_goods; --"}},
+		{query.LikeContains("' OR '1'='1"), nil},
+	}
+	for _, tt := range tests {
+		sql, args, err := query.Select("name").From("yc_goods").WhereLike("name", tt.pattern).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err := db.Query(sql, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		var got []string
+		for rs.Next() {
+			var n string
+			if err := rs.Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, n)
+		}
+		rs.Close()
+		sort.Strings(got)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("LIKE %q matched %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM yc_goods").Scan(&n); err != nil || n != len(names) {
+		t.Errorf("yc_goods has %d rows (%v) after the searches, want %d", n, err, len(names))
+	}
+}
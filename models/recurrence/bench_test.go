@@ -0,0 +1,55 @@
+package recurrence_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/recurrence"
+)
+
+// benchRules is the mix of a large schedule screen: weekly, daily, custom
+// and monthly repeats that started years before the window
+func benchRules(b *testing.B, n int, started time.Time) []*recurrence.RRule {
+	specs := []struct{ period, span, days string }{
+		{"1", "", "1,4"},
+		{"1", "", ""},
+		{"0", "", ""},
+		{"9", "10", ""},
+		{"2", "", ""},
+	}
+	rules := make([]*recurrence.RRule, n)
+	for i := range rules {
+		sp := specs[i%len(specs)]
+		start := started.AddDate(0, 0, i%28).Format("2006-01-02")
+		r, err := recurrence.ForRepeat(sp.period, sp.span, sp.days, "", start, "2099-12-31")
+		if err != nil {
+			b.Fatal(err)
+		}
+		rules[i] = r
+	}
+	return rules
+}
+
+// BenchmarkOccurrences expands 10k rules over a one-year window. The cost
+// does not depend on how long ago the series started.
+//
+//	go test -run '^$' -bench Occurrences -benchmem -count 5 ./models/recurrence
+func BenchmarkOccurrences(b *testing.B) {
+	from, to := date("2026-10-01"), date("2027-09-30")
+	for _, started := range []string{"2025-10-01", "2016-10-01"} {
+		b.Run(fmt.Sprint("started=", started), func(b *testing.B) {
+			rules := benchRules(b, 10000, date(started))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := 0
+				for _, r := range rules {
+					n += len(r.Occurrences(from, to))
+				}
+				if n == 0 {
+					b.Fatal("no occurrences")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// legacyDays maps the spellings found in yc_schedule_repeat.day_of_week:
+// PHP date('w') numbers, Japanese day names and RRULE codes
+var legacyDays = map[string]time.Weekday{
+	"0": time.Sunday, "1": time.Monday, "2": time.Tuesday, "3": time.Wednesday,
+	"4": time.Thursday, "5": time.Friday, "6": time.Saturday,
+	"日": time.Sunday, "月": time.Monday, "火": time.Tuesday, "水": time.Wednesday,
+	"木": time.Thursday, "金": time.Friday, "土": time.Saturday,
+}
+
+// ParseDayOfWeek parses a comma separated day_of_week value such as
+// "1,4", "月,木" or "MO,TH"
+func ParseDayOfWeek(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, v := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '、' }) {
+		v = strings.TrimSuffix(v, "曜日")
+		v = strings.TrimSuffix(v, "曜")
+		if d, ok := legacyDays[v]; ok {
+			days = append(days, d)
+			continue
+		}
+		if d, ok := dayCodes[strings.ToUpper(v)]; ok {
+			days = append(days, d)
+			continue
+		}
+		return nil, fmt.Errorf("recurrence: invalid day_of_week %q", v)
+	}
+	return days, nil
+}
+
+// FromLegacy converts the period, span and day_of_week columns to the
+// equivalent RRule
+func FromLegacy(period Period, span int, dayOfWeek string, start, end time.Time) (*RRule, error) {
+	r := &RRule{Interval: 1, Start: dateOf(start), End: dateOf(end)}
+	switch period {
+	case Daily:
+		r.Freq = FreqDaily
+	case Weekly:
+		r.Freq = FreqWeekly
+	case Monthly:
+		r.Freq = FreqMonthly
+	case Yearly:
+		r.Freq = FreqYearly
+	case Custom:
+		if span <= 0 {
+			return nil, fmt.Errorf("recurrence: custom period needs a positive span, got %d", span)
+		}
+		r.Freq = FreqDaily
+		r.Interval = span
+	default:
+		return nil, fmt.Errorf("recurrence: unknown period %d", int(period))
+	}
+
+	days, err := ParseDayOfWeek(dayOfWeek)
+	if err != nil {
+		return nil, err
+	}
+	if len(days) > 0 && (period == Daily || period == Weekly) {
+		for _, d := range days {
+			r.ByDay = append(r.ByDay, WeekdayNum{Day: d})
+		}
+	}
+
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ForRepeat returns the schedule of a yc_schedule_repeat row. The rrule
+// column wins when set; otherwise period, span and day_of_week are
+// converted.
+func ForRepeat(period, span, dayOfWeek, rrule, repeatSDt, repeatEDt string) (*RRule, error) {
+	start, err := time.Parse(dateLayout, repeatSDt)
+	if err != nil {
+		return nil, fmt.Errorf("recurrence: invalid repeat_s_dt %q", repeatSDt)
+	}
+	end, err := time.Parse(dateLayout, repeatEDt)
+	if err != nil {
+		return nil, fmt.Errorf("recurrence: invalid repeat_e_dt %q", repeatEDt)
+	}
+
+	if strings.TrimSpace(rrule) != "" {
+		return ParseRRule(rrule, start, end)
+	}
+
+	p, err := strconv.Atoi(strings.TrimSpace(period))
+	if err != nil {
+		return nil, fmt.Errorf("recurrence: invalid period %q", period)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(span))
+	return FromLegacy(Period(p), n, dayOfWeek, start, end)
+}
@@ -0,0 +1,112 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Period is the yc_schedule_repeat.period value
+type Period int
+
+const (
+	Daily   Period = 0
+	Weekly  Period = 1
+	Monthly Period = 2
+	Yearly  Period = 3
+	// Custom repeats every Span days
+	Custom Period = 9
+)
+
+const dateLayout = "2006-01-02"
+
+// String returns the PHP strtotime offset the period used to be written as
+func (p Period) String() string {
+	switch p {
+	case Daily:
+		return "+1 day"
+	case Weekly:
+		return "+1 week"
+	case Monthly:
+		return "+1 month"
+	case Yearly:
+		return "+1 year"
+	case Custom:
+		return "+N day"
+	}
+	return fmt.Sprintf("period(%d)", int(p))
+}
+
+// Rule generates the delivery dates of one repeat series. Start is the
+// first occurrence and its day of month is the anchor for monthly and
+// yearly repeats, clamped to the last day of shorter months: a series
+// starting Jan 31 continues Feb 28 (or 29), Mar 31, ... End is the last
+// allowed date (inclusive).
+type Rule struct {
+	Period Period
+	Span   int
+	Start  time.Time
+	End    time.Time
+}
+
+// NewRule validates and returns a Rule. Dates are truncated to midnight UTC.
+func NewRule(period Period, span int, start, end time.Time) (Rule, error) {
+	r := Rule{Period: period, Span: span, Start: dateOf(start), End: dateOf(end)}
+	switch period {
+	case Daily, Weekly, Monthly, Yearly:
+	case Custom:
+		if span <= 0 {
+			return Rule{}, fmt.Errorf("recurrence: custom period needs a positive span, got %d", span)
+		}
+	default:
+		return Rule{}, fmt.Errorf("recurrence: unknown period %d", int(period))
+	}
+	if r.End.Before(r.Start) {
+		return Rule{}, errors.New("recurrence: end is before start")
+	}
+	return r, nil
+}
+
+// Parse builds a Rule from the yc_schedule_repeat columns
+func Parse(period, span int, repeatSDt, repeatEDt string) (Rule, error) {
+	start, err := time.Parse(dateLayout, repeatSDt)
+	if err != nil {
+		return Rule{}, fmt.Errorf("recurrence: invalid repeat_s_dt %q", repeatSDt)
+	}
+	end, err := time.Parse(dateLayout, repeatEDt)
+	if err != nil {
+		return Rule{}, fmt.Errorf("recurrence: invalid repeat_e_dt %q", repeatEDt)
+	}
+	return NewRule(Period(period), span, start, end)
+}
+
+// RRule returns the equivalent RRule
+func (r Rule) RRule() (*RRule, error) {
+	return FromLegacy(r.Period, r.Span, "", r.Start, r.End)
+}
+
+// Occurrences returns the occurrences between from and to (inclusive) that
+// fall within the series. An invalid rule has no occurrences.
+func (r Rule) Occurrences(from, to time.Time) []time.Time {
+	rr, err := r.RRule()
+	if err != nil {
+		return nil
+	}
+	return rr.Occurrences(from, to)
+}
+
+// Contains reports whether d is an occurrence of the series
+func (r Rule) Contains(d time.Time) bool {
+	d = dateOf(d)
+	occ := r.Occurrences(d, d)
+	return len(occ) == 1
+}
+
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func dateOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,194 @@
+package recurrence_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/recurrence"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func format(list []time.Time) string {
+	s := make([]string, len(list))
+	for i, t := range list {
+		s[i] = t.Format("2006-01-02")
+	}
+	return strings.Join(s, " ")
+}
+
+func TestOccurrences(t *testing.T) {
+	tests := []struct {
+		name       string
+		period     recurrence.Period
+		span       int
+		start, end string
+		from, to   string
+		want       string
+	}{
+		{"daily", recurrence.Daily, 0, "2026-10-19", "2026-10-23", "2026-10-01", "2026-10-31",
+			"2026-10-19 2026-10-20 2026-10-21 2026-10-22 2026-10-23"},
+		{"daily across a month and a year", recurrence.Daily, 0, "2026-12-30", "2027-01-02", "2026-12-01", "2027-01-31",
+			"2026-12-30 2026-12-31 2027-01-01 2027-01-02"},
+		{"daily over Feb 29", recurrence.Daily, 0, "2028-02-27", "2028-03-01", "2028-02-01", "2028-03-31",
+			"2028-02-27 2028-02-28 2028-02-29 2028-03-01"},
+		{"weekly keeps the start weekday", recurrence.Weekly, 0, "2026-10-21", "2026-11-30", "2026-10-01", "2026-11-30",
+			"2026-10-21 2026-10-28 2026-11-04 2026-11-11 2026-11-18 2026-11-25"},
+		{"weekly window cuts both ends", recurrence.Weekly, 0, "2026-10-21", "2026-12-31", "2026-10-29", "2026-11-11",
+			"2026-11-04 2026-11-11"},
+		{"custom span", recurrence.Custom, 10, "2026-10-01", "2026-11-30", "2026-10-01", "2026-11-30",
+			"2026-10-01 2026-10-11 2026-10-21 2026-10-31 2026-11-10 2026-11-20 2026-11-30"},
+		{"custom span from the middle", recurrence.Custom, 14, "2026-01-05", "2026-12-31", "2026-10-01", "2026-10-31",
+			"2026-10-12 2026-10-26"},
+		{"monthly", recurrence.Monthly, 0, "2026-10-15", "2027-02-15", "2026-10-01", "2027-12-31",
+			"2026-10-15 2026-11-15 2026-12-15 2027-01-15 2027-02-15"},
+		{"monthly from the 31st clamps", recurrence.Monthly, 0, "2026-01-31", "2026-12-31", "2026-01-01", "2026-12-31",
+			"2026-01-31 2026-02-28 2026-03-31 2026-04-30 2026-05-31 2026-06-30 2026-07-31 2026-08-31 2026-09-30 2026-10-31 2026-11-30 2026-12-31"},
+		{"monthly from the 31st in a leap year", recurrence.Monthly, 0, "2028-01-31", "2028-04-30", "2028-01-01", "2028-04-30",
+			"2028-01-31 2028-02-29 2028-03-31 2028-04-30"},
+		{"monthly from the 30th", recurrence.Monthly, 0, "2027-01-30", "2027-03-31", "2027-01-01", "2027-03-31",
+			"2027-01-30 2027-02-28 2027-03-30"},
+		{"monthly from the 29th, leap and common Februaries", recurrence.Monthly, 0, "2027-12-29", "2028-03-31", "2027-12-01", "2028-03-31",
+			"2027-12-29 2028-01-29 2028-02-29 2028-03-29"},
+		{"monthly window in a short month", recurrence.Monthly, 0, "2026-01-31", "2026-12-31", "2026-02-01", "2026-02-28",
+			"2026-02-28"},
+		{"yearly", recurrence.Yearly, 0, "2026-10-19", "2029-10-19", "2026-01-01", "2030-12-31",
+			"2026-10-19 2027-10-19 2028-10-19 2029-10-19"},
+		{"yearly from Feb 29", recurrence.Yearly, 0, "2024-02-29", "2032-12-31", "2024-01-01", "2032-12-31",
+			"2024-02-29 2025-02-28 2026-02-28 2027-02-28 2028-02-29 2029-02-28 2030-02-28 2031-02-28 2032-02-29"},
+		{"yearly Feb 29 through a century", recurrence.Yearly, 0, "2096-02-29", "2104-12-31", "2099-01-01", "2104-12-31",
+			"2099-02-28 2100-02-28 2101-02-28 2102-02-28 2103-02-28 2104-02-29"},
+		{"end is inclusive", recurrence.Weekly, 0, "2026-10-19", "2026-11-02", "2026-10-01", "2026-12-31",
+			"2026-10-19 2026-10-26 2026-11-02"},
+		{"start and end the same day", recurrence.Monthly, 0, "2026-10-19", "2026-10-19", "2026-01-01", "2026-12-31",
+			"2026-10-19"},
+		{"window before the series", recurrence.Daily, 0, "2026-10-19", "2026-10-31", "2026-09-01", "2026-10-18", ""},
+		{"window after the series", recurrence.Daily, 0, "2026-10-19", "2026-10-31", "2026-11-01", "2026-11-30", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := recurrence.NewRule(tt.period, tt.span, date(tt.start), date(tt.end))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := format(r.Occurrences(date(tt.from), date(tt.to))); got != tt.want {
+				t.Errorf("Occurrences =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestOccurrencesWindowed checks that expanding month by month gives the
+// same dates as expanding the whole series at once
+func TestOccurrencesWindowed(t *testing.T) {
+	for _, p := range []recurrence.Period{recurrence.Daily, recurrence.Weekly, recurrence.Monthly, recurrence.Yearly, recurrence.Custom} {
+		for _, start := range []string{"2024-01-31", "2024-02-29", "2025-12-31", "2026-10-19"} {
+			r, err := recurrence.NewRule(p, 9, date(start), date("2029-03-31"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			all := r.Occurrences(date("2024-01-01"), date("2029-12-31"))
+			var windowed []time.Time
+			for m := date("2024-01-01"); m.Year() < 2030; m = m.AddDate(0, 1, 0) {
+				windowed = append(windowed, r.Occurrences(m, m.AddDate(0, 1, -1))...)
+			}
+			if format(windowed) != format(all) {
+				t.Errorf("%v from %s: month by month\n%s\nwhole series\n%s", p, start, format(windowed), format(all))
+			}
+			for _, d := range all {
+				if !r.Contains(d) {
+					t.Errorf("%v from %s: Contains(%s) = false", p, start, d.Format("2006-01-02"))
+				}
+				if next := d.AddDate(0, 0, 1); r.Contains(next) != (format(r.Occurrences(next, next)) != "") {
+					t.Errorf("%v from %s: Contains(%s) disagrees with Occurrences", p, start, next.Format("2006-01-02"))
+				}
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		period, span int
+		start, end   string
+		wantErr      string
+	}{
+		{"weekly", 1, 0, "2026-10-19", "2027-10-19", ""},
+		{"custom", 9, 5, "2026-10-19", "2027-10-19", ""},
+		{"custom without span", 9, 0, "2026-10-19", "2027-10-19", "positive span"},
+		{"unknown period", 4, 0, "2026-10-19", "2027-10-19", "unknown period"},
+		{"end before start", 0, 0, "2026-10-19", "2026-10-18", "end is before start"},
+		{"bad start", 0, 0, "2026/10/19", "2027-10-19", "invalid repeat_s_dt"},
+		{"bad end", 0, 0, "2026-10-19", "", "invalid repeat_e_dt"},
+		{"no Feb 30", 0, 0, "2026-02-30", "2027-10-19", "invalid repeat_s_dt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := recurrence.Parse(tt.period, tt.span, tt.start, tt.end)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("err = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestMonthEnd sets the clamping of legacy monthly repeats against the
+// RFC 5545 BYMONTHDAY, which skips the months without the day
+func TestMonthEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		rrule string
+		start string
+		want  string
+	}{
+		{"legacy monthly clamps", "", "2027-12-31",
+			"2027-12-31 2028-01-31 2028-02-29 2028-03-31 2028-04-30 2028-05-31 2028-06-30"},
+		{"no BYMONTHDAY clamps too", "FREQ=MONTHLY", "2027-12-31",
+			"2027-12-31 2028-01-31 2028-02-29 2028-03-31 2028-04-30 2028-05-31 2028-06-30"},
+		{"BYMONTHDAY=31 skips short months", "FREQ=MONTHLY;BYMONTHDAY=31", "2027-12-01",
+			"2027-12-31 2028-01-31 2028-03-31 2028-05-31"},
+		{"BYMONTHDAY=30", "FREQ=MONTHLY;BYMONTHDAY=30", "2027-12-01",
+			"2027-12-30 2028-01-30 2028-03-30 2028-04-30 2028-05-30 2028-06-30"},
+		{"BYMONTHDAY=29 in a leap year", "FREQ=MONTHLY;BYMONTHDAY=29", "2028-01-01",
+			"2028-01-29 2028-02-29 2028-03-29 2028-04-29 2028-05-29 2028-06-29"},
+		{"BYMONTHDAY=29 in a common year", "FREQ=MONTHLY;BYMONTHDAY=29", "2027-01-01",
+			"2027-01-29 2027-03-29 2027-04-29 2027-05-29 2027-06-29 2027-07-29 2027-08-29 2027-09-29 2027-10-29 2027-11-29 2027-12-29 " +
+				"2028-01-29 2028-02-29 2028-03-29 2028-04-29 2028-05-29 2028-06-29"},
+		{"BYMONTHDAY=-1 is the last day", "FREQ=MONTHLY;BYMONTHDAY=-1", "2027-12-01",
+			"2027-12-31 2028-01-31 2028-02-29 2028-03-31 2028-04-30 2028-05-31 2028-06-30"},
+		{"BYMONTHDAY=-3", "FREQ=MONTHLY;BYMONTHDAY=-3", "2028-01-01",
+			"2028-01-29 2028-02-27 2028-03-29 2028-04-28 2028-05-29 2028-06-28"},
+		{"BYMONTHDAY=1,-1", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=1,-1", "2028-01-01",
+			"2028-01-01 2028-01-31 2028-03-01 2028-03-31 2028-05-01 2028-05-31"},
+		{"last Friday", "FREQ=MONTHLY;BYDAY=-1FR", "2028-01-01",
+			"2028-01-28 2028-02-25 2028-03-31 2028-04-28 2028-05-26 2028-06-30"},
+		{"fifth Tuesday skips months with four", "FREQ=MONTHLY;BYDAY=5TU", "2028-01-01",
+			"2028-02-29 2028-05-30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period := "2"
+			if tt.rrule != "" {
+				period = ""
+			}
+			r, err := recurrence.ForRepeat(period, "", "", tt.rrule, tt.start, "2028-06-30")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := format(r.Occurrences(date("2027-01-01"), date("2028-12-31"))); got != tt.want {
+				t.Errorf("Occurrences =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+)
+
+// Freq is the RRULE FREQ part
+type Freq string
+
+const (
+	FreqDaily   Freq = "DAILY"
+	FreqWeekly  Freq = "WEEKLY"
+	FreqMonthly Freq = "MONTHLY"
+	FreqYearly  Freq = "YEARLY"
+)
+
+// WeekdayNum is one BYDAY entry such as "TU", "2TU" (second Tuesday) or
+// "-1FR" (last Friday). N is 0 when no ordinal is given.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+var dayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func (w WeekdayNum) String() string {
+	code := strings.ToUpper(w.Day.String()[:2])
+	if w.N == 0 {
+		return code
+	}
+	return strconv.Itoa(w.N) + code
+}
+
+// RRule is the RFC 5545 subset stored in yc_schedule_repeat.rrule:
+// FREQ, INTERVAL, BYDAY, BYMONTHDAY, UNTIL and COUNT. Start (DTSTART) is
+// repeat_s_dt and End is repeat_e_dt, which bounds the series in addition
+// to UNTIL.
+//
+// As in RFC 5545, a YEARLY rule with BYDAY or BYMONTHDAY expands over the
+// whole year: BYMONTHDAY=15 is the 15th of every month and an ordinal
+// BYDAY counts within the year (20MO is the 20th Monday). There is no
+// BYMONTH to narrow it down. UNTIL is a date in the business timezone; a
+// UTC date-time (ending in Z) is converted to it first.
+//
+// One deliberate difference from RFC 5545: a MONTHLY or YEARLY rule without
+// BYDAY or BYMONTHDAY clamps to the end of shorter months (Jan 31 gives
+// Feb 28) instead of skipping them, matching legacy monthly repeats.
+type RRule struct {
+	Freq       Freq
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	Until      time.Time
+	Count      int
+
+	Start time.Time
+	End   time.Time
+}
+
+// ParseRRule parses an RRULE value, with or without the "RRULE:" prefix
+func ParseRRule(s string, start, end time.Time) (*RRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &RRule{Interval: 1, Start: dateOf(start), End: dateOf(end)}
+
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("recurrence: malformed rrule part %q", part)
+		}
+		key, val := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		switch key {
+		case "FREQ":
+			switch Freq(val) {
+			case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+				r.Freq = Freq(val)
+			default:
+				return nil, fmt.Errorf("recurrence: unsupported FREQ %q", val)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("recurrence: invalid INTERVAL %q", val)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("recurrence: invalid COUNT %q", val)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(val)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, v := range strings.Split(val, ",") {
+				w, err := parseWeekdayNum(v)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, w)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("recurrence: invalid BYMONTHDAY %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		default:
+			return nil, fmt.Errorf("recurrence: unsupported rrule part %q", key)
+		}
+	}
+
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RRule) validate() error {
+	if r.Freq == "" {
+		return errors.New("recurrence: rrule has no FREQ")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return errors.New("recurrence: COUNT and UNTIL are mutually exclusive")
+	}
+	for _, w := range r.ByDay {
+		if w.N != 0 && r.Freq != FreqMonthly && r.Freq != FreqYearly {
+			return fmt.Errorf("recurrence: ordinal BYDAY %s needs FREQ=MONTHLY or YEARLY", w)
+		}
+		if r.Freq == FreqMonthly && (w.N < -5 || w.N > 5) {
+			return fmt.Errorf("recurrence: BYDAY ordinal %s is out of range for FREQ=MONTHLY", w)
+		}
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq == FreqWeekly {
+		return errors.New("recurrence: BYMONTHDAY is not allowed with FREQ=WEEKLY")
+	}
+	if r.End.Before(r.Start) {
+		return errors.New("recurrence: end is before start")
+	}
+	return nil
+}
+
+// parseUntil returns the business date of UNTIL. A date or a floating
+// date-time is taken as it is; a UTC date-time is converted first, so
+// 20261019T150000Z is Oct 20 in Japan.
+func parseUntil(v string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", v); err == nil {
+		return dateOf(t.In(civil.Location())), nil
+	}
+	for _, layout := range []string{"20060102", "20060102T150405"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return dateOf(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("recurrence: invalid UNTIL %q", v)
+}
+
+func parseWeekdayNum(v string) (WeekdayNum, error) {
+	v = strings.TrimSpace(v)
+	if len(v) < 2 {
+		return WeekdayNum{}, fmt.Errorf("recurrence: invalid BYDAY %q", v)
+	}
+	day, ok := dayCodes[v[len(v)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("recurrence: invalid BYDAY %q", v)
+	}
+	w := WeekdayNum{Day: day}
+	if ord := v[:len(v)-2]; ord != "" {
+		n, err := strconv.Atoi(ord)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("recurrence: invalid BYDAY ordinal %q", v)
+		}
+		w.N = n
+	}
+	return w, nil
+}
+
+// String formats the rule without the "RRULE:" prefix, as stored
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, w := range r.ByDay {
+			days[i] = w.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences returns the occurrences between from and to (inclusive).
+// Without COUNT the expansion starts at the period containing from, so its
+// cost depends on the window and not on how long the series has run. COUNT
+// is counted from Start, so with it earlier periods are still generated.
+func (r *RRule) Occurrences(from, to time.Time) []time.Time {
+	from, to = dateOf(from), dateOf(to)
+	limit := r.End
+	if !r.Until.IsZero() && r.Until.Before(limit) {
+		limit = r.Until
+	}
+	if r.Count == 0 && limit.After(to) {
+		limit = to
+	}
+
+	first := 0
+	if r.Count == 0 {
+		first = r.periodIndex(from)
+	}
+
+	var ret, buf []time.Time
+	offsets := r.weekOffsets()
+	count := 0
+	for k := first; ; k++ {
+		periodStart := r.periodStart(k)
+		if periodStart.After(limit) {
+			break
+		}
+		buf = r.candidates(periodStart, offsets, buf[:0])
+		for _, d := range buf {
+			if d.Before(r.Start) || d.After(limit) {
+				continue
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return ret
+			}
+			if !d.Before(from) && !d.After(to) {
+				ret = append(ret, d)
+			}
+		}
+	}
+	return ret
+}
+
+// periodIndex returns the index k of the period that contains d, or 0
+// when d is before Start
+func (r *RRule) periodIndex(d time.Time) int {
+	if !d.After(r.Start) {
+		return 0
+	}
+	var n int
+	switch r.Freq {
+	case FreqWeekly:
+		n = int(d.Sub(r.periodStart(0)).Hours()/24) / 7
+	case FreqMonthly:
+		n = (d.Year()-r.Start.Year())*12 + int(d.Month()-r.Start.Month())
+	case FreqYearly:
+		n = d.Year() - r.Start.Year()
+	default:
+		n = int(d.Sub(r.Start).Hours() / 24)
+	}
+	return n / r.Interval
+}
+
+// periodStart is the first day of the k-th period: the start date for
+// DAILY, the Monday of the week for WEEKLY, the first of the month for
+// MONTHLY and, for YEARLY, January 1st or, without BYDAY and BYMONTHDAY,
+// the first of the start month
+func (r *RRule) periodStart(k int) time.Time {
+	n := k * r.Interval
+	y, m, _ := r.Start.Date()
+	switch r.Freq {
+	case FreqWeekly:
+		return addDays(r.Start, 7*n-mondayOffset(r.Start.Weekday()))
+	case FreqMonthly:
+		return time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	case FreqYearly:
+		if len(r.ByDay) > 0 || len(r.ByMonthDay) > 0 {
+			return time.Date(y+n, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}
+		return time.Date(y+n, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return addDays(r.Start, n)
+}
+
+// candidates appends to buf the sorted dates of one period that match the
+// BY* parts. offsets is weekOffsets, computed once per expansion.
+func (r *RRule) candidates(periodStart time.Time, offsets []int, buf []time.Time) []time.Time {
+	switch r.Freq {
+	case FreqDaily:
+		if r.matchDay(periodStart) {
+			buf = append(buf, periodStart)
+		}
+		return buf
+
+	case FreqWeekly:
+		if len(r.ByDay) == 0 {
+			return append(buf, addDays(periodStart, mondayOffset(r.Start.Weekday())))
+		}
+		for _, off := range offsets {
+			buf = append(buf, addDays(periodStart, off))
+		}
+		return buf
+	}
+
+	// MONTHLY expands within one month and YEARLY, with BYDAY or
+	// BYMONTHDAY, within one year. Days are matched as integers and only
+	// the matches become times.
+	y, m, _ := periodStart.Date()
+	last := daysIn(y, m)
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		day := r.Start.Day()
+		if day > last {
+			day = last
+		}
+		return append(buf, time.Date(y, m, day, 0, 0, 0, 0, time.UTC))
+	}
+	first := periodStart.Weekday()
+	if r.Freq == FreqMonthly {
+		for day := 1; day <= last; day++ {
+			wd := time.Weekday((int(first) + day - 1) % 7)
+			if r.matchMonthDay(day, last) && r.matchWeekdayInPeriod(day, last, wd) {
+				buf = append(buf, addDays(periodStart, day-1))
+			}
+		}
+		return buf
+	}
+	yearLast := time.Date(y, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+	yday := 0
+	for month := time.January; month <= time.December; month++ {
+		monthLast := daysIn(y, month)
+		for day := 1; day <= monthLast; day++ {
+			yday++
+			wd := time.Weekday((int(first) + yday - 1) % 7)
+			if r.matchMonthDay(day, monthLast) && r.matchWeekdayInPeriod(yday, yearLast, wd) {
+				buf = append(buf, addDays(periodStart, yday-1))
+			}
+		}
+	}
+	return buf
+}
+
+// weekOffsets returns the sorted distinct offsets from Monday of the BYDAY
+// days
+func (r *RRule) weekOffsets() []int {
+	var seen [7]bool
+	for _, w := range r.ByDay {
+		seen[mondayOffset(w.Day)] = true
+	}
+	var ret []int
+	for i, ok := range seen {
+		if ok {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// addDays is AddDate(0, 0, n) for dates at midnight UTC, which have no
+// daylight saving transitions
+func addDays(t time.Time, n int) time.Time {
+	return t.Add(time.Duration(n) * 24 * time.Hour)
+}
+
+func mondayOffset(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+// matchDay applies BYDAY and BYMONTHDAY as filters, for DAILY rules
+func (r *RRule) matchDay(d time.Time) bool {
+	return (len(r.ByDay) == 0 || r.matchWeekday(d.Weekday())) &&
+		(len(r.ByMonthDay) == 0 || r.matchMonthDay(d.Day(), daysIn(d.Year(), d.Month())))
+}
+
+func (r *RRule) matchWeekday(wd time.Weekday) bool {
+	for _, w := range r.ByDay {
+		if w.Day == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMonthDay applies BYMONTHDAY to day of a month with last days
+func (r *RRule) matchMonthDay(day, last int) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	for _, n := range r.ByMonthDay {
+		if n == day || (n < 0 && last+n+1 == day) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWeekdayInPeriod applies BYDAY to day of a month or year with last
+// days, counting ordinals within it
+func (r *RRule) matchWeekdayInPeriod(day, last int, wd time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	nth := (day-1)/7 + 1
+	nthLast := -((last-day)/7 + 1)
+	for _, w := range r.ByDay {
+		if w.Day != wd {
+			continue
+		}
+		if w.N == 0 || w.N == nth || w.N == nthLast {
+			return true
+		}
+	}
+	return false
+}
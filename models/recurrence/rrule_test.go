@@ -0,0 +1,105 @@
+package recurrence_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/recurrence"
+)
+
+func TestRRuleOccurrences(t *testing.T) {
+	tests := []struct {
+		name       string
+		rrule      string
+		start, end string
+		from, to   string
+		want       string
+	}{
+		{"yearly BYMONTHDAY is every month", "FREQ=YEARLY;BYMONTHDAY=15", "2026-10-01", "2027-03-31", "2026-01-01", "2027-12-31",
+			"2026-10-15 2026-11-15 2026-12-15 2027-01-15 2027-02-15 2027-03-15"},
+		{"yearly BYMONTHDAY=-1", "FREQ=YEARLY;BYMONTHDAY=-1", "2027-11-01", "2028-03-31", "2027-01-01", "2028-12-31",
+			"2027-11-30 2027-12-31 2028-01-31 2028-02-29 2028-03-31"},
+		{"yearly ordinal BYDAY counts in the year", "FREQ=YEARLY;BYDAY=20MO", "2026-01-01", "2027-12-31", "2026-01-01", "2027-12-31",
+			"2026-05-18 2027-05-17"},
+		{"yearly last Friday of the year", "FREQ=YEARLY;BYDAY=-1FR", "2026-01-01", "2027-12-31", "2026-01-01", "2027-12-31",
+			"2026-12-25 2027-12-31"},
+		{"yearly BYDAY is every such weekday", "FREQ=YEARLY;BYDAY=MO", "2026-12-01", "2027-01-31", "2026-01-01", "2027-12-31",
+			"2026-12-07 2026-12-14 2026-12-21 2026-12-28 2027-01-04 2027-01-11 2027-01-18 2027-01-25"},
+		{"yearly BY* before the start month of a later year", "FREQ=YEARLY;INTERVAL=2;BYMONTHDAY=1", "2026-11-01", "2028-02-29", "2026-01-01", "2028-12-31",
+			"2026-11-01 2026-12-01 2028-01-01 2028-02-01"},
+		{"yearly without BY* keeps the start day", "FREQ=YEARLY", "2024-02-29", "2028-12-31", "2024-01-01", "2028-12-31",
+			"2024-02-29 2025-02-28 2026-02-28 2027-02-28 2028-02-29"},
+		{"weekly BYDAY", "FREQ=WEEKLY;BYDAY=MO,TH", "2026-10-19", "2026-11-01", "2026-10-01", "2026-11-30",
+			"2026-10-19 2026-10-22 2026-10-26 2026-10-29"},
+		{"every other week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=WE", "2026-10-19", "2026-11-30", "2026-10-01", "2026-11-30",
+			"2026-10-21 2026-11-04 2026-11-18"},
+		{"daily BYDAY filters", "FREQ=DAILY;BYDAY=SA,SU", "2026-10-19", "2026-11-01", "2026-10-01", "2026-11-30",
+			"2026-10-24 2026-10-25 2026-10-31 2026-11-01"},
+		{"COUNT counts from the start", "FREQ=WEEKLY;COUNT=3", "2026-10-19", "2027-10-19", "2026-10-27", "2027-10-19",
+			"2026-11-02"},
+		{"UNTIL date", "FREQ=DAILY;UNTIL=20261021", "2026-10-19", "2026-12-31", "2026-10-01", "2026-12-31",
+			"2026-10-19 2026-10-20 2026-10-21"},
+		{"UNTIL in UTC is a Tokyo date", "FREQ=DAILY;UNTIL=20261020T150000Z", "2026-10-19", "2026-12-31", "2026-10-01", "2026-12-31",
+			"2026-10-19 2026-10-20 2026-10-21"},
+		{"UNTIL in UTC before 9:00 in Tokyo", "FREQ=DAILY;UNTIL=20261020T145959Z", "2026-10-19", "2026-12-31", "2026-10-01", "2026-12-31",
+			"2026-10-19 2026-10-20"},
+		{"floating UNTIL is taken as it is", "FREQ=DAILY;UNTIL=20261020T235959", "2026-10-19", "2026-12-31", "2026-10-01", "2026-12-31",
+			"2026-10-19 2026-10-20"},
+		{"end wins over a later UNTIL", "FREQ=DAILY;UNTIL=20261231", "2026-10-19", "2026-10-20", "2026-10-01", "2026-12-31",
+			"2026-10-19 2026-10-20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := recurrence.ParseRRule(tt.rrule, date(tt.start), date(tt.end))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := format(r.Occurrences(date(tt.from), date(tt.to))); got != tt.want {
+				t.Errorf("Occurrences =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		rrule   string
+		want    string
+		wantErr string
+	}{
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", ""},
+		{"freq=monthly;byday=-1fr", "FREQ=MONTHLY;BYDAY=-1FR", ""},
+		{"FREQ=YEARLY;BYDAY=53SU", "FREQ=YEARLY;BYDAY=53SU", ""},
+		{"FREQ=DAILY;UNTIL=20261020T150000Z", "FREQ=DAILY;UNTIL=20261021", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=4", "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=4", ""},
+		{"INTERVAL=2", "", "no FREQ"},
+		{"FREQ=HOURLY", "", "unsupported FREQ"},
+		{"FREQ=DAILY;BYMONTH=1", "", "unsupported rrule part"},
+		{"FREQ=DAILY;INTERVAL=0", "", "invalid INTERVAL"},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20261231", "", "mutually exclusive"},
+		{"FREQ=WEEKLY;BYDAY=2MO", "", "needs FREQ=MONTHLY or YEARLY"},
+		{"FREQ=MONTHLY;BYDAY=6MO", "", "out of range"},
+		{"FREQ=YEARLY;BYDAY=54MO", "", "invalid BYDAY ordinal"},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", "", "not allowed with FREQ=WEEKLY"},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", "", "invalid BYMONTHDAY"},
+		{"FREQ=DAILY;UNTIL=2026-12-31", "", "invalid UNTIL"},
+		{"FREQ=DAILY;BYDAY=XX", "", "invalid BYDAY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rrule, func(t *testing.T) {
+			r, err := recurrence.ParseRRule(tt.rrule, date("2026-10-19"), date("2027-10-19"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("String = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
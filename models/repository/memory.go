@@ -0,0 +1,1364 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+)
+
+// memoryDB is the shared state behind the in-memory repositories. One
+// mutex guards every table so cross-table reads stay consistent.
+type memoryDB struct {
+	mu sync.RWMutex
+	memoryTables
+
+	// inTx is set on the copy a Store.Tx works on
+	inTx bool
+}
+
+// memoryTables holds every table of a memoryDB
+type memoryTables struct {
+	sales           map[int64]*Sales
+	goods           map[string]*Goods
+	customers       map[string]*Customer
+	customerDetails map[string][]*CustomerDetail
+	customerGoods   map[string][]string
+	tankGoods       map[[2]string][]string
+	overrides       []*GoodsOverride
+	repeats         map[int64]*Repeat
+	pauses          map[int64][]*RepeatPause
+	versions        map[int64][]*RepeatVersion
+	exclusions      map[exclusionKey]*Exclusion
+	stock           map[int64]*StockDetail
+	stockHeaders    map[string]*Stock
+	cancels         []*TransferCancel
+	scans           []*StockScan
+	warehouses      map[string]*Warehouse
+	routes          map[[2]string]*WarehouseRoute
+	thresholds      map[[2]string]*StockThreshold
+	log             []*MaterializeLog
+	ledger          []*LedgerEntry
+	balances        map[balanceKey]*StockBalance
+	lots            map[int64][]*LotSlot
+
+	nextSales  int64
+	nextRepeat int64
+	nextStock  int64
+	nextLot    int64
+}
+
+type balanceKey struct {
+	goods, warehouse, lot string
+}
+
+type exclusionKey struct {
+	sales      int64
+	deliveryDt civil.Date
+}
+
+// NewMemory returns a thread-safe Store held entirely in memory, for unit
+// tests and local experiments without MySQL
+func NewMemory() *Store {
+	m := &memoryDB{memoryTables: memoryTables{
+		sales:           make(map[int64]*Sales),
+		goods:           make(map[string]*Goods),
+		customers:       make(map[string]*Customer),
+		customerDetails: make(map[string][]*CustomerDetail),
+		customerGoods:   make(map[string][]string),
+		tankGoods:       make(map[[2]string][]string),
+		repeats:         make(map[int64]*Repeat),
+		pauses:          make(map[int64][]*RepeatPause),
+		versions:        make(map[int64][]*RepeatVersion),
+		exclusions:      make(map[exclusionKey]*Exclusion),
+		stock:           make(map[int64]*StockDetail),
+		stockHeaders:    make(map[string]*Stock),
+		lots:            make(map[int64][]*LotSlot),
+		balances:        make(map[balanceKey]*StockBalance),
+		warehouses:      make(map[string]*Warehouse),
+		routes:          make(map[[2]string]*WarehouseRoute),
+		thresholds:      make(map[[2]string]*StockThreshold),
+	}}
+	return m.store()
+}
+
+func (m *memoryDB) store() *Store {
+	return &Store{
+		Sales:      &memorySales{m},
+		Goods:      &memoryGoods{m},
+		Customers:  &memoryCustomers{m},
+		Repeats:    &memoryRepeats{m},
+		Exclusions: &memoryExclusions{m},
+		Stock:      &MemoryStock{m},
+		Lots:       &memoryLots{m},
+		Log:        &memoryLog{m},
+		Ledger:     &memoryLedger{m},
+		Warehouses: &memoryWarehouses{m},
+		Thresholds: &memoryThresholds{m},
+		tx:         m.tx,
+	}
+}
+
+// tx runs fn on a copy of the tables and keeps the copy when fn succeeds.
+// The tables stay locked meanwhile, so other callers wait for the end of
+// the transaction as they would for locked rows.
+func (m *memoryDB) tx(fn func(tx *Store) error) error {
+	if m.inTx {
+		return fn(m.store())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	work := &memoryDB{memoryTables: m.clone(), inTx: true}
+	if err := fn(work.store()); err != nil {
+		return err
+	}
+	m.memoryTables = work.memoryTables
+	return nil
+}
+
+// clone copies every table down to the records, which the repositories
+// never share with their callers
+func (t *memoryTables) clone() memoryTables {
+	c := *t
+	c.sales = make(map[int64]*Sales, len(t.sales))
+	for k, v := range t.sales {
+		cp := *v
+		c.sales[k] = &cp
+	}
+	c.goods = make(map[string]*Goods, len(t.goods))
+	for k, v := range t.goods {
+		cp := *v
+		c.goods[k] = &cp
+	}
+	c.customers = make(map[string]*Customer, len(t.customers))
+	for k, v := range t.customers {
+		cp := *v
+		c.customers[k] = &cp
+	}
+	c.customerDetails = make(map[string][]*CustomerDetail, len(t.customerDetails))
+	for k, list := range t.customerDetails {
+		for _, v := range list {
+			cp := *v
+			c.customerDetails[k] = append(c.customerDetails[k], &cp)
+		}
+	}
+	c.customerGoods = make(map[string][]string, len(t.customerGoods))
+	for k, v := range t.customerGoods {
+		c.customerGoods[k] = append([]string(nil), v...)
+	}
+	c.tankGoods = make(map[[2]string][]string, len(t.tankGoods))
+	for k, v := range t.tankGoods {
+		c.tankGoods[k] = append([]string(nil), v...)
+	}
+	c.overrides = nil
+	for _, v := range t.overrides {
+		cp := *v
+		c.overrides = append(c.overrides, &cp)
+	}
+	c.repeats = make(map[int64]*Repeat, len(t.repeats))
+	for k, v := range t.repeats {
+		cp := *v
+		c.repeats[k] = &cp
+	}
+	c.pauses = make(map[int64][]*RepeatPause, len(t.pauses))
+	for k, list := range t.pauses {
+		for _, v := range list {
+			cp := *v
+			c.pauses[k] = append(c.pauses[k], &cp)
+		}
+	}
+	c.versions = make(map[int64][]*RepeatVersion, len(t.versions))
+	for k, list := range t.versions {
+		for _, v := range list {
+			cp := *v
+			c.versions[k] = append(c.versions[k], &cp)
+		}
+	}
+	c.exclusions = make(map[exclusionKey]*Exclusion, len(t.exclusions))
+	for k, v := range t.exclusions {
+		cp := *v
+		c.exclusions[k] = &cp
+	}
+	c.stock = make(map[int64]*StockDetail, len(t.stock))
+	for k, v := range t.stock {
+		cp := *v
+		c.stock[k] = &cp
+	}
+	c.stockHeaders = make(map[string]*Stock, len(t.stockHeaders))
+	for k, v := range t.stockHeaders {
+		cp := *v
+		c.stockHeaders[k] = &cp
+	}
+	c.cancels = nil
+	for _, v := range t.cancels {
+		cp := *v
+		c.cancels = append(c.cancels, &cp)
+	}
+	c.scans = nil
+	for _, v := range t.scans {
+		cp := *v
+		c.scans = append(c.scans, &cp)
+	}
+	c.warehouses = make(map[string]*Warehouse, len(t.warehouses))
+	for k, v := range t.warehouses {
+		cp := *v
+		c.warehouses[k] = &cp
+	}
+	c.routes = make(map[[2]string]*WarehouseRoute, len(t.routes))
+	for k, v := range t.routes {
+		cp := *v
+		c.routes[k] = &cp
+	}
+	c.thresholds = make(map[[2]string]*StockThreshold, len(t.thresholds))
+	for k, v := range t.thresholds {
+		cp := *v
+		c.thresholds[k] = &cp
+	}
+	c.log = nil
+	for _, v := range t.log {
+		cp := *v
+		c.log = append(c.log, &cp)
+	}
+	c.ledger = nil
+	for _, v := range t.ledger {
+		cp := *v
+		c.ledger = append(c.ledger, &cp)
+	}
+	c.balances = make(map[balanceKey]*StockBalance, len(t.balances))
+	for k, v := range t.balances {
+		cp := *v
+		c.balances[k] = &cp
+	}
+	c.lots = make(map[int64][]*LotSlot, len(t.lots))
+	for k, list := range t.lots {
+		for _, v := range list {
+			cp := *v
+			c.lots[k] = append(c.lots[k], &cp)
+		}
+	}
+	return c
+}
+
+type memorySales struct {
+	m *memoryDB
+}
+
+func (r *memorySales) Get(sales int64) (*Sales, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	s, ok := r.m.sales[sales]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (r *memorySales) List(f SalesFilter) ([]*Sales, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*Sales
+	for _, s := range r.m.sales {
+		if f.Customer != "" && s.Customer != f.Customer {
+			continue
+		}
+		if f.Goods != "" && s.Goods != f.Goods {
+			continue
+		}
+		if f.OutgoingWarehouse != "" && s.OutgoingWarehouse != f.OutgoingWarehouse {
+			continue
+		}
+		if !f.DeliveryFrom.IsZero() && s.DeliveryDt.Before(f.DeliveryFrom) {
+			continue
+		}
+		if !f.DeliveryTo.IsZero() && s.DeliveryDt.After(f.DeliveryTo) {
+			continue
+		}
+		if f.RepeatOnly && !s.RepeatFg {
+			continue
+		}
+		if f.BaseSales != 0 && s.BaseSales != f.BaseSales {
+			continue
+		}
+		cp := *s
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if c := list[i].DeliveryDt.Compare(list[j].DeliveryDt); c != 0 {
+			return c < 0
+		}
+		return list[i].Sales < list[j].Sales
+	})
+	return list, nil
+}
+
+func (r *memorySales) Create(s *Sales) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	r.m.nextSales++
+	s.Sales = r.m.nextSales
+	s.Rgdt = now()
+	cp := *s
+	r.m.sales[s.Sales] = &cp
+	return s.Sales, nil
+}
+
+func (r *memorySales) Update(s *Sales) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.sales[s.Sales]; !ok {
+		return ErrNotFound
+	}
+	s.Updt = now()
+	cp := *s
+	r.m.sales[s.Sales] = &cp
+	return nil
+}
+
+type memoryGoods struct {
+	m *memoryDB
+}
+
+func (r *memoryGoods) Get(goods string) (*Goods, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	g, ok := r.m.goods[goods]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *g
+	return &cp, nil
+}
+
+func (r *memoryGoods) List(f GoodsFilter) ([]*Goods, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*Goods
+	for _, g := range r.m.goods {
+		if f.Goods != "" && g.Goods != f.Goods {
+			continue
+		}
+		if f.NamePrefix != "" && !strings.HasPrefix(g.Name, f.NamePrefix) {
+			continue
+		}
+		cp := *g
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Goods < list[j].Goods })
+	return list, nil
+}
+
+func (r *memoryGoods) Save(g *Goods) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	g.Updt = now()
+	if old, ok := r.m.goods[g.Goods]; ok {
+		g.Rgdt = old.Rgdt
+	} else {
+		g.Rgdt = g.Updt
+	}
+	cp := *g
+	r.m.goods[g.Goods] = &cp
+	return nil
+}
+
+type memoryCustomers struct {
+	m *memoryDB
+}
+
+func (r *memoryCustomers) Get(customer string) (*Customer, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	c, ok := r.m.customers[customer]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (r *memoryCustomers) List(f CustomerFilter) ([]*Customer, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*Customer
+	for _, c := range r.m.customers {
+		if f.Customer != "" && c.Customer != f.Customer {
+			continue
+		}
+		if f.NamePrefix != "" && !strings.HasPrefix(c.Name, f.NamePrefix) {
+			continue
+		}
+		cp := *c
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Customer < list[j].Customer })
+	return list, nil
+}
+
+func (r *memoryCustomers) Save(c *Customer) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	c.Updt = now()
+	if old, ok := r.m.customers[c.Customer]; ok {
+		c.Rgdt = old.Rgdt
+	} else {
+		c.Rgdt = c.Updt
+	}
+	cp := *c
+	r.m.customers[c.Customer] = &cp
+	return nil
+}
+
+func (r *memoryCustomers) Details(customer string) ([]*CustomerDetail, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*CustomerDetail
+	for _, d := range r.m.customerDetails[customer] {
+		cp := *d
+		list = append(list, &cp)
+	}
+	return list, nil
+}
+
+func (r *memoryCustomers) SaveDetails(customer string, details []*CustomerDetail) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	updt := now()
+	list := make([]*CustomerDetail, 0, len(details))
+	for i, d := range details {
+		cp := *d
+		cp.Customer, cp.Detail, cp.Updt = customer, i+1, updt
+		list = append(list, &cp)
+	}
+	r.m.customerDetails[customer] = list
+	return nil
+}
+
+func (r *memoryCustomers) SaveTank(d *CustomerDetail) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, old := range r.m.customerDetails[d.Customer] {
+		if old.Tank == d.Tank {
+			d.Detail, d.Updt = old.Detail, now()
+			old.Capacity, old.DailyUse, old.Level, old.LevelDt, old.Updt = d.Capacity, d.DailyUse, d.Level, d.LevelDt, d.Updt
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryCustomers) TankGoods(customer string) (map[string][]string, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	ret := make(map[string][]string)
+	for k, goods := range r.m.tankGoods {
+		if k[0] == customer && len(goods) > 0 {
+			ret[k[1]] = append([]string{}, goods...)
+			sort.Strings(ret[k[1]])
+		}
+	}
+	return ret, nil
+}
+
+func (r *memoryCustomers) SetTankGoods(customer, tank string, goods []string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	r.m.tankGoods[[2]string{customer, tank}] = append([]string{}, goods...)
+	return nil
+}
+
+func (r *memoryCustomers) AddOverride(o *GoodsOverride) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	o.Rgdt = now()
+	o.ID = int64(len(r.m.overrides) + 1)
+	cp := *o
+	r.m.overrides = append(r.m.overrides, &cp)
+	return nil
+}
+
+func (r *memoryCustomers) Overrides(customer string) ([]*GoodsOverride, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*GoodsOverride
+	for _, o := range r.m.overrides {
+		if o.Customer == customer {
+			cp := *o
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+func (r *memoryCustomers) GoodsCodes(customer string) ([]string, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	codes := append([]string{}, r.m.customerGoods[customer]...)
+	sort.Strings(codes)
+	return codes, nil
+}
+
+func (r *memoryCustomers) SetGoodsCodes(customer string, goods []string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	r.m.customerGoods[customer] = append([]string{}, goods...)
+	return nil
+}
+
+type memoryRepeats struct {
+	m *memoryDB
+}
+
+// join fills the yc_sales, yc_customer and yc_goods columns the MySQL
+// implementation reads through LEFT JOINs. Callers hold the lock.
+func (r *memoryRepeats) join(rep *Repeat) *Repeat {
+	cp := *rep
+	if s, ok := r.m.sales[rep.Sales]; ok {
+		cp.Class = s.Class
+		cp.Customer = s.Customer
+		cp.Goods = s.Goods
+		cp.Qty = s.Qty
+		cp.ShipAddr = s.ShipAddr
+		cp.OutgoingWarehouse = s.OutgoingWarehouse
+		cp.Status = s.Status
+		cp.RepeatFg = s.RepeatFg
+		if c, ok := r.m.customers[s.Customer]; ok {
+			cp.CustomerName = c.Name
+		}
+		if g, ok := r.m.goods[s.Goods]; ok {
+			cp.GoodsName = g.Name
+		}
+	}
+	return &cp
+}
+
+func (r *memoryRepeats) Get(repeat int64) (*Repeat, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	rep, ok := r.m.repeats[repeat]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.join(rep), nil
+}
+
+func (r *memoryRepeats) List(f RepeatFilter) ([]*Repeat, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*Repeat
+	for _, rep := range r.m.repeats {
+		j := r.join(rep)
+		if j.Status == 9 || !j.RepeatFg {
+			continue
+		}
+		if f.OutgoingWarehouse != "" && j.OutgoingWarehouse != f.OutgoingWarehouse {
+			continue
+		}
+		if f.Customer != "" && j.Customer != f.Customer {
+			continue
+		}
+		list = append(list, j)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Repeat < list[j].Repeat })
+	return list, nil
+}
+
+func (r *memoryRepeats) Save(rep *Repeat) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if rep.Repeat == 0 {
+		r.m.nextRepeat++
+		rep.Repeat = r.m.nextRepeat
+	}
+	cp := *rep
+	r.m.repeats[rep.Repeat] = &cp
+	return rep.Repeat, nil
+}
+
+func (r *memoryRepeats) Pauses(repeat int64) ([]*RepeatPause, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*RepeatPause
+	for id, pauses := range r.m.pauses {
+		if repeat != 0 && id != repeat {
+			continue
+		}
+		for _, p := range pauses {
+			cp := *p
+			list = append(list, &cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Repeat != list[j].Repeat {
+			return list[i].Repeat < list[j].Repeat
+		}
+		return list[i].PauseSDt.Before(list[j].PauseSDt)
+	})
+	return list, nil
+}
+
+func (r *memoryRepeats) SavePause(p *RepeatPause) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if p.Rgdt == "" {
+		p.Rgdt = now()
+	}
+	cp := *p
+	pauses := r.m.pauses[p.Repeat]
+	for i, old := range pauses {
+		if old.PauseSDt == p.PauseSDt {
+			cp.Rgdt = old.Rgdt
+			pauses[i] = &cp
+			return nil
+		}
+	}
+	r.m.pauses[p.Repeat] = append(pauses, &cp)
+	return nil
+}
+
+func (r *memoryRepeats) RemovePause(repeat int64, pauseSDt civil.Date) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	pauses := r.m.pauses[repeat]
+	for i, p := range pauses {
+		if p.PauseSDt == pauseSDt {
+			r.m.pauses[repeat] = append(pauses[:i:i], pauses[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRepeats) Versions(repeat int64) ([]*RepeatVersion, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*RepeatVersion
+	for _, v := range r.m.versions[repeat] {
+		cp := *v
+		list = append(list, &cp)
+	}
+	return list, nil
+}
+
+func (r *memoryRepeats) AddVersion(v *RepeatVersion) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	v.Version = len(r.m.versions[v.Repeat]) + 1
+	v.Rgdt = now()
+	cp := *v
+	r.m.versions[v.Repeat] = append(r.m.versions[v.Repeat], &cp)
+	return nil
+}
+
+type memoryExclusions struct {
+	m *memoryDB
+}
+
+func (r *memoryExclusions) List(from, to civil.Date) ([]*Exclusion, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*Exclusion
+	for _, e := range r.m.exclusions {
+		if !inRange(e.DeliveryDt, from, to) && (e.NewDeliveryDt.IsZero() || !inRange(e.NewDeliveryDt, from, to)) {
+			continue
+		}
+		cp := *e
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if c := list[i].DeliveryDt.Compare(list[j].DeliveryDt); c != 0 {
+			return c < 0
+		}
+		return list[i].Sales < list[j].Sales
+	})
+	return list, nil
+}
+
+// inRange reports whether d is between from and to; a zero bound is open
+func inRange(d, from, to civil.Date) bool {
+	return (from.IsZero() || !d.Before(from)) && (to.IsZero() || !d.After(to))
+}
+
+func (r *memoryExclusions) Get(sales int64, deliveryDt civil.Date) (*Exclusion, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	e, ok := r.m.exclusions[exclusionKey{sales, deliveryDt}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *e
+	return &cp, nil
+}
+
+func (r *memoryExclusions) Exists(sales int64, deliveryDt civil.Date) (bool, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	_, ok := r.m.exclusions[exclusionKey{sales, deliveryDt}]
+	return ok, nil
+}
+
+func (r *memoryExclusions) Add(e *Exclusion) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	e.Rgdt = now()
+	cp := *e
+	r.m.exclusions[exclusionKey{e.Sales, e.DeliveryDt}] = &cp
+	return nil
+}
+
+func (r *memoryExclusions) Save(e *Exclusion) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	e.Updt = now()
+	key := exclusionKey{e.Sales, e.DeliveryDt}
+	if old, ok := r.m.exclusions[key]; ok {
+		e.Rgdt = old.Rgdt
+	} else if e.Rgdt == "" {
+		e.Rgdt = e.Updt
+	}
+	cp := *e
+	r.m.exclusions[key] = &cp
+	return nil
+}
+
+func (r *memoryExclusions) Remove(sales int64, deliveryDt civil.Date) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	key := exclusionKey{sales, deliveryDt}
+	if _, ok := r.m.exclusions[key]; !ok {
+		return ErrNotFound
+	}
+	delete(r.m.exclusions, key)
+	return nil
+}
+
+// MemoryStock is the in-memory StockRepository. It is exported so tests
+// can seed stock details with Put.
+type MemoryStock struct {
+	m *memoryDB
+}
+
+// Put adds or replaces a stock detail
+func (r *MemoryStock) Put(d *StockDetail) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	cp := *d
+	r.m.stock[d.ID] = &cp
+	if d.ID > r.m.nextStock {
+		r.m.nextStock = d.ID
+	}
+}
+
+func (r *MemoryStock) Create(s *Stock, details []*StockDetail) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	header := *s
+	r.m.stockHeaders[s.Stock] = &header
+
+	for _, d := range details {
+		r.m.nextStock++
+		d.ID = r.m.nextStock
+		d.Stock, d.Goods, d.Warehouse, d.ArrivalDt = s.Stock, s.Goods, s.Warehouse, s.ArrivalDt
+		cp := *d
+		r.m.stock[d.ID] = &cp
+	}
+	return nil
+}
+
+func (r *MemoryStock) Available(goods, warehouse string, limit int) ([]*StockDetail, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	return r.available(goods, warehouse, limit), nil
+}
+
+// available lists the details not yet transferred; the caller holds the
+// lock
+func (r *MemoryStock) available(goods, warehouse string, limit int) []*StockDetail {
+	var list []*StockDetail
+	for _, d := range r.m.stock {
+		if d.Goods != goods || d.Warehouse != warehouse || d.TransferFg {
+			continue
+		}
+		cp := *d
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if c := list[i].ArrivalDt.Compare(list[j].ArrivalDt); c != 0 {
+			return c < 0
+		}
+		return list[i].ID < list[j].ID
+	})
+	if limit >= 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+func (r *MemoryStock) GetDetail(id int64) (*StockDetail, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	d, ok := r.m.stock[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *d
+	return &cp, nil
+}
+
+func (r *MemoryStock) SetTransferFg(id int64, fg bool) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	d, ok := r.m.stock[id]
+	if !ok {
+		return ErrNotFound
+	}
+	d.TransferFg = fg
+	return nil
+}
+
+func (r *MemoryStock) MarkTransferred(ids []int64, ref, strategy string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	return r.markTransferred(ids, ref, strategy)
+}
+
+func (r *MemoryStock) Reserve(goods, warehouse, ref, strategy string, pick func([]*StockDetail) ([]*StockDetail, error)) ([]*StockDetail, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	picked, err := pick(r.available(goods, warehouse, -1))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(picked))
+	for i, d := range picked {
+		ids[i] = d.ID
+	}
+	if err := r.markTransferred(ids, ref, strategy); err != nil {
+		return nil, err
+	}
+	for _, d := range picked {
+		d.TransferFg, d.PickStrategy, d.TransferRef = true, strategy, ref
+	}
+	return picked, nil
+}
+
+func (r *MemoryStock) GetStock(stock string) (*Stock, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	s, ok := r.m.stockHeaders[stock]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (r *MemoryStock) Transferred(ref string) ([]*StockDetail, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*StockDetail
+	for _, d := range r.m.stock {
+		if d.TransferFg && d.TransferRef == ref {
+			cp := *d
+			list = append(list, &cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// LockTransferred is Transferred: Store.Tx locks the tables already
+func (r *MemoryStock) LockTransferred(ref string) ([]*StockDetail, error) {
+	return r.Transferred(ref)
+}
+
+func (r *MemoryStock) Release(ref string) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	n := 0
+	for _, d := range r.m.stock {
+		if d.TransferFg && d.TransferRef == ref {
+			d.TransferFg, d.TransferRef, d.PickStrategy = false, "", ""
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryStock) DeleteTransfer(stock string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	s, ok := r.m.stockHeaders[stock]
+	if !ok || !s.TransferFg {
+		return ErrNotFound
+	}
+	delete(r.m.stockHeaders, stock)
+	for id, d := range r.m.stock {
+		if d.Stock == stock {
+			delete(r.m.stock, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryStock) AddCancel(c *TransferCancel) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	c.Rgdt = now()
+	c.ID = int64(len(r.m.cancels) + 1)
+	cp := *c
+	r.m.cancels = append(r.m.cancels, &cp)
+	return nil
+}
+
+func (r *MemoryStock) Cancels(stock string) ([]*TransferCancel, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*TransferCancel
+	for _, c := range r.m.cancels {
+		if c.Stock == stock {
+			cp := *c
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+func (r *MemoryStock) ByBarcode(barcodes ...string) (*StockDetail, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	for _, b := range barcodes {
+		if b == "" {
+			continue
+		}
+		var found *StockDetail
+		for _, d := range r.m.stock {
+			if d.Barcode == b && (found == nil || d.ID > found.ID) {
+				found = d
+			}
+		}
+		if found != nil {
+			cp := *found
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryStock) SetScanState(id int64, from, to ScanState) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	d, ok := r.m.stock[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if d.ScanState != from {
+		return ErrConflict
+	}
+	d.ScanState = to
+	return nil
+}
+
+func (r *MemoryStock) AddScan(s *StockScan) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	s.Rgdt = now()
+	s.ID = int64(len(r.m.scans) + 1)
+	cp := *s
+	r.m.scans = append(r.m.scans, &cp)
+	return nil
+}
+
+func (r *MemoryStock) Scans(detail int64) ([]*StockScan, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*StockScan
+	for _, s := range r.m.scans {
+		if s.Detail == detail {
+			cp := *s
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+// markTransferred flags ids; the caller holds the write lock
+func (r *MemoryStock) markTransferred(ids []int64, ref, strategy string) error {
+	for _, id := range ids {
+		d, ok := r.m.stock[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if d.TransferFg {
+			return ErrConflict
+		}
+	}
+	for _, id := range ids {
+		r.m.stock[id].TransferFg = true
+		r.m.stock[id].PickStrategy = strategy
+		r.m.stock[id].TransferRef = ref
+	}
+	return nil
+}
+
+type memoryLots struct {
+	m *memoryDB
+}
+
+func (r *memoryLots) Slots(sales int64) ([]*LotSlot, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*LotSlot
+	for _, s := range r.m.lots[sales] {
+		cp := *s
+		list = append(list, &cp)
+	}
+	return list, nil
+}
+
+func (r *memoryLots) ReplaceSlots(sales int64, slots []*LotSlot) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	list := make([]*LotSlot, 0, len(slots))
+	for i, s := range slots {
+		r.m.nextLot++
+		s.ID, s.Order, s.Slot, s.Rgdt = r.m.nextLot, sales, i+1, now()
+		cp := *s
+		list = append(list, &cp)
+	}
+	r.m.lots[sales] = list
+	return nil
+}
+
+func (r *memoryLots) UpdateSlots(slots []*LotSlot) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	// Check every slot first so a missing one changes nothing, like the
+	// rolled back transaction of the SQL implementation
+	found := make([]*LotSlot, len(slots))
+	for i, s := range slots {
+		for _, old := range r.m.lots[s.Order] {
+			if old.ID == s.ID {
+				found[i] = old
+			}
+		}
+		if found[i] == nil {
+			return ErrNotFound
+		}
+	}
+	for i, s := range slots {
+		s.Updt = now()
+		found[i].Lot, found[i].Tank, found[i].Qty = s.Lot, s.Tank, s.Qty
+		found[i].Updt, found[i].Upuser = s.Updt, s.Upuser
+	}
+	return nil
+}
+
+type memoryLog struct {
+	m *memoryDB
+}
+
+func (r *memoryLog) Add(e *MaterializeLog) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if e.RunAt == "" {
+		e.RunAt = now()
+	}
+	e.ID = int64(len(r.m.log) + 1)
+	cp := *e
+	r.m.log = append(r.m.log, &cp)
+	return nil
+}
+
+func (r *memoryLog) List(limit int) ([]*MaterializeLog, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*MaterializeLog
+	for i := len(r.m.log) - 1; i >= 0 && (limit <= 0 || len(list) < limit); i-- {
+		cp := *r.m.log[i]
+		list = append(list, &cp)
+	}
+	return list, nil
+}
+
+type memoryLedger struct {
+	m *memoryDB
+}
+
+func (r *memoryLedger) Post(entries []*LedgerEntry) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	rgdt := now()
+	for _, e := range entries {
+		e.Rgdt = rgdt
+		e.ID = int64(len(r.m.ledger) + 1)
+		cp := *e
+		r.m.ledger = append(r.m.ledger, &cp)
+
+		k := balanceKey{e.Goods, e.Warehouse, e.Lot}
+		b, ok := r.m.balances[k]
+		if !ok {
+			b = &StockBalance{Goods: e.Goods, Warehouse: e.Warehouse, Lot: e.Lot}
+			r.m.balances[k] = b
+		}
+		b.OnHand += e.OnHand
+		b.Reserved += e.Reserved
+		b.InTransit += e.InTransit
+		b.Updt = rgdt
+	}
+	return nil
+}
+
+func (r *memoryLedger) Entries(f LedgerFilter) ([]*LedgerEntry, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*LedgerEntry
+	for _, e := range r.m.ledger {
+		if !ledgerMatch(f, e.Goods, e.Warehouse, e.Lot) || (f.Ref != "" && e.Ref != f.Ref) || (f.Kind != "" && e.Kind != f.Kind) {
+			continue
+		}
+		cp := *e
+		list = append(list, &cp)
+	}
+	return list, nil
+}
+
+func (r *memoryLedger) Balances(f LedgerFilter) ([]*StockBalance, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*StockBalance
+	for _, b := range r.m.balances {
+		if !ledgerMatch(f, b.Goods, b.Warehouse, b.Lot) {
+			continue
+		}
+		cp := *b
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Goods != b.Goods {
+			return a.Goods < b.Goods
+		}
+		if a.Warehouse != b.Warehouse {
+			return a.Warehouse < b.Warehouse
+		}
+		return a.Lot < b.Lot
+	})
+	return list, nil
+}
+
+func ledgerMatch(f LedgerFilter, goods, warehouse, lot string) bool {
+	return (f.Goods == "" || goods == f.Goods) &&
+		(f.Warehouse == "" || warehouse == f.Warehouse) &&
+		(f.Lot == "" || lot == f.Lot)
+}
+
+type memoryWarehouses struct {
+	m *memoryDB
+}
+
+func (r *memoryWarehouses) Get(warehouse string) (*Warehouse, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	w, ok := r.m.warehouses[warehouse]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *w
+	return &cp, nil
+}
+
+func (r *memoryWarehouses) List() ([]*Warehouse, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*Warehouse
+	for _, w := range r.m.warehouses {
+		cp := *w
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Warehouse < list[j].Warehouse })
+	return list, nil
+}
+
+func (r *memoryWarehouses) Save(w *Warehouse) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	w.Updt = now()
+	if old, ok := r.m.warehouses[w.Warehouse]; ok {
+		w.Rgdt = old.Rgdt
+	} else {
+		w.Rgdt = w.Updt
+	}
+	cp := *w
+	r.m.warehouses[w.Warehouse] = &cp
+	return nil
+}
+
+func (r *memoryWarehouses) Routes(to string) ([]*WarehouseRoute, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*WarehouseRoute
+	for _, wr := range r.m.routes {
+		if to != "" && wr.To != to {
+			continue
+		}
+		cp := *wr
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.From < b.From
+	})
+	return list, nil
+}
+
+func (r *memoryWarehouses) SaveRoute(wr *WarehouseRoute) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	k := [2]string{wr.From, wr.To}
+	wr.Updt = now()
+	if old, ok := r.m.routes[k]; ok {
+		wr.Rgdt = old.Rgdt
+	} else {
+		wr.Rgdt = wr.Updt
+	}
+	cp := *wr
+	r.m.routes[k] = &cp
+	return nil
+}
+
+func (r *memoryWarehouses) RemoveRoute(from, to string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	k := [2]string{from, to}
+	if _, ok := r.m.routes[k]; !ok {
+		return ErrNotFound
+	}
+	delete(r.m.routes, k)
+	return nil
+}
+
+type memoryThresholds struct {
+	m *memoryDB
+}
+
+func (r *memoryThresholds) List(goods, warehouse string) ([]*StockThreshold, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	var list []*StockThreshold
+	for _, t := range r.m.thresholds {
+		if (goods != "" && t.Goods != goods) || (warehouse != "" && t.Warehouse != warehouse) {
+			continue
+		}
+		cp := *t
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Goods != list[j].Goods {
+			return list[i].Goods < list[j].Goods
+		}
+		return list[i].Warehouse < list[j].Warehouse
+	})
+	return list, nil
+}
+
+func (r *memoryThresholds) Save(t *StockThreshold) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	k := [2]string{t.Goods, t.Warehouse}
+	t.Updt = now()
+	if old, ok := r.m.thresholds[k]; ok {
+		t.Rgdt = old.Rgdt
+	} else {
+		t.Rgdt = t.Updt
+	}
+	cp := *t
+	r.m.thresholds[k] = &cp
+	return nil
+}
+
+func (r *memoryThresholds) Remove(goods, warehouse string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	k := [2]string{goods, warehouse}
+	if _, ok := r.m.thresholds[k]; !ok {
+		return ErrNotFound
+	}
+	delete(r.m.thresholds, k)
+	return nil
+}
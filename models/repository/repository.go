@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+)
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("repository: not found")
+
+// ErrConflict is returned when a record was changed by someone else
+// between reading and writing it
+var ErrConflict = errors.New("repository: conflicting update")
+
+// SalesFilter narrows a sales listing. Zero values are ignored.
+type SalesFilter struct {
+	Customer          string
+	Goods             string
+	OutgoingWarehouse string
+	DeliveryFrom      civil.Date
+	DeliveryTo        civil.Date
+	RepeatOnly        bool
+	BaseSales         int64
+}
+
+// SalesRepository reads and writes yc_sales
+type SalesRepository interface {
+	Get(sales int64) (*Sales, error)
+	List(f SalesFilter) ([]*Sales, error)
+	Create(s *Sales) (int64, error)
+	Update(s *Sales) error
+}
+
+// GoodsFilter narrows a goods listing. Zero values are ignored.
+type GoodsFilter struct {
+	Goods      string
+	NamePrefix string
+}
+
+// GoodsRepository reads and writes yc_goods
+type GoodsRepository interface {
+	Get(goods string) (*Goods, error)
+	List(f GoodsFilter) ([]*Goods, error)
+	Save(g *Goods) error
+}
+
+// CustomerFilter narrows a customer listing. Zero values are ignored.
+type CustomerFilter struct {
+	Customer   string
+	NamePrefix string
+}
+
+// CustomerRepository reads and writes yc_customer and its detail tables.
+// SaveDetails replaces the tanks of a customer, numbering them from 1;
+// SaveTank updates the capacity, daily use and level of one tank, found by
+// name. TankGoods returns the goods each tank may hold by tank name; a
+// tank without goods may hold any. AddOverride and Overrides keep
+// yc_goods_override; Overrides lists those of a customer, oldest first.
+type CustomerRepository interface {
+	Get(customer string) (*Customer, error)
+	List(f CustomerFilter) ([]*Customer, error)
+	Save(c *Customer) error
+	Details(customer string) ([]*CustomerDetail, error)
+	SaveDetails(customer string, details []*CustomerDetail) error
+	SaveTank(d *CustomerDetail) error
+	TankGoods(customer string) (map[string][]string, error)
+	SetTankGoods(customer, tank string, goods []string) error
+	GoodsCodes(customer string) ([]string, error)
+	SetGoodsCodes(customer string, goods []string) error
+	AddOverride(o *GoodsOverride) error
+	Overrides(customer string) ([]*GoodsOverride, error)
+}
+
+// RepeatFilter narrows a repeat listing. Zero values are ignored.
+type RepeatFilter struct {
+	OutgoingWarehouse string
+	Customer          string
+}
+
+// RepeatRepository reads and writes yc_schedule_repeat with its pauses
+// and version history. List only returns repeats whose sales is active
+// (status <> 9, repeat_fg = 1). Pauses(0) returns the pauses of every
+// repeat; AddVersion numbers the version itself.
+type RepeatRepository interface {
+	Get(repeat int64) (*Repeat, error)
+	List(f RepeatFilter) ([]*Repeat, error)
+	Save(r *Repeat) (int64, error)
+	Pauses(repeat int64) ([]*RepeatPause, error)
+	SavePause(p *RepeatPause) error
+	RemovePause(repeat int64, pauseSDt civil.Date) error
+	Versions(repeat int64) ([]*RepeatVersion, error)
+	AddVersion(v *RepeatVersion) error
+}
+
+// ExclusionRepository reads and writes yc_repeat_exclude. List returns
+// the exclusions whose delivery_dt or new_delivery_dt is in the range.
+type ExclusionRepository interface {
+	List(from, to civil.Date) ([]*Exclusion, error)
+	Get(sales int64, deliveryDt civil.Date) (*Exclusion, error)
+	Exists(sales int64, deliveryDt civil.Date) (bool, error)
+	Add(e *Exclusion) error
+	Save(e *Exclusion) error
+	Remove(sales int64, deliveryDt civil.Date) error
+}
+
+// StockRepository reads and writes yc_stock and yc_stock_detail.
+// Available returns the details not yet transferred, oldest arrival first;
+// a negative limit returns them all. MarkTransferred returns ErrConflict
+// when a detail is already transferred.
+//
+// Reserve locks the available details of goods in warehouse, lets pick
+// choose among them and marks the chosen ones transferred by transfer ref,
+// in a single transaction, so two transfers never take the same detail.
+// Transferred lists the details a transfer took and Release gives them
+// back. LockTransferred lists them too and, inside Store.Tx, locks them
+// until the transaction ends, so a cancellation and a receipt of the same
+// transfer wait for each other. DeleteTransfer removes the stock record of a transfer and its
+// details; AddCancel and Cancels keep yc_transfer_cancel.
+//
+// ByBarcode returns the detail registered under the first of barcodes that
+// matches one. SetScanState moves a detail from scan state from to to and
+// returns ErrConflict when it is no longer in from; AddScan and Scans keep
+// yc_stock_scan.
+type StockRepository interface {
+	Create(s *Stock, details []*StockDetail) error
+	GetStock(stock string) (*Stock, error)
+	Available(goods, warehouse string, limit int) ([]*StockDetail, error)
+	GetDetail(id int64) (*StockDetail, error)
+	SetTransferFg(id int64, fg bool) error
+	MarkTransferred(ids []int64, ref, strategy string) error
+	Reserve(goods, warehouse, ref, strategy string, pick func(available []*StockDetail) ([]*StockDetail, error)) ([]*StockDetail, error)
+	Transferred(ref string) ([]*StockDetail, error)
+	LockTransferred(ref string) ([]*StockDetail, error)
+	Release(ref string) (int, error)
+	DeleteTransfer(stock string) error
+	AddCancel(c *TransferCancel) error
+	Cancels(stock string) ([]*TransferCancel, error)
+	ByBarcode(barcodes ...string) (*StockDetail, error)
+	SetScanState(id int64, from, to ScanState) error
+	AddScan(s *StockScan) error
+	Scans(detail int64) ([]*StockScan, error)
+}
+
+// LotRepository reads and writes the lot slots of a sales in
+// yc_goods_detail. Slots are ordered by slot number; ReplaceSlots numbers
+// them from 1 and UpdateSlots changes lot, tank and qty of existing ones.
+type LotRepository interface {
+	Slots(sales int64) ([]*LotSlot, error)
+	ReplaceSlots(sales int64, slots []*LotSlot) error
+	UpdateSlots(slots []*LotSlot) error
+}
+
+// MaterializeLogRepository appends to and reads yc_materialize_log. List
+// returns the newest limit entries, newest first.
+type MaterializeLogRepository interface {
+	Add(e *MaterializeLog) error
+	List(limit int) ([]*MaterializeLog, error)
+}
+
+// LedgerFilter narrows a ledger or balance listing. Zero values are
+// ignored; Balances ignores Ref and Kind.
+type LedgerFilter struct {
+	Goods     string
+	Warehouse string
+	Lot       string
+	Ref       string
+	Kind      MovementKind
+}
+
+// LedgerRepository appends to yc_stock_ledger and keeps yc_stock_balance
+// in step in the same transaction. Entries are never changed; a Cancel
+// entry reverses one. Entries lists oldest first, Balances by goods,
+// warehouse and lot.
+type LedgerRepository interface {
+	Post(entries []*LedgerEntry) error
+	Entries(f LedgerFilter) ([]*LedgerEntry, error)
+	Balances(f LedgerFilter) ([]*StockBalance, error)
+}
+
+// WarehouseRepository reads and writes yc_warehouse and
+// yc_warehouse_route. Routes lists the routes into to, or every route when
+// to is empty, by destination then priority.
+type WarehouseRepository interface {
+	Get(warehouse string) (*Warehouse, error)
+	List() ([]*Warehouse, error)
+	Save(w *Warehouse) error
+	Routes(to string) ([]*WarehouseRoute, error)
+	SaveRoute(r *WarehouseRoute) error
+	RemoveRoute(from, to string) error
+}
+
+// ThresholdRepository reads and writes yc_stock_threshold. List returns
+// the thresholds of goods in warehouse, ignoring an empty goods or
+// warehouse, by goods then warehouse.
+type ThresholdRepository interface {
+	List(goods, warehouse string) ([]*StockThreshold, error)
+	Save(t *StockThreshold) error
+	Remove(goods, warehouse string) error
+}
+
+// Store bundles the repositories backed by the same database
+type Store struct {
+	Sales      SalesRepository
+	Goods      GoodsRepository
+	Customers  CustomerRepository
+	Repeats    RepeatRepository
+	Exclusions ExclusionRepository
+	Stock      StockRepository
+	Lots       LotRepository
+	Log        MaterializeLogRepository
+	Ledger     LedgerRepository
+	Warehouses WarehouseRepository
+	Thresholds ThresholdRepository
+
+	tx func(fn func(tx *Store) error) error
+}
+
+// Tx runs fn with a Store whose repositories share one transaction: what
+// fn wrote is kept when it returns nil and undone when it returns an
+// error. fn must only use the Store it is given, and must return the
+// error of any call that failed. A Tx inside fn joins the running one; a
+// Store built without NewSQL or NewMemory runs fn without a transaction.
+func (s *Store) Tx(fn func(tx *Store) error) error {
+	if s.tx == nil {
+		return fn(s)
+	}
+	return s.tx(fn)
+}
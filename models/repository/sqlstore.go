@@ -0,0 +1,1310 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/dialect"
+	"github.com/geeknow112/srv-tools/models/query"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+// NewMySQL returns a Store backed by a MySQL database
+func NewMySQL(db *sql.DB) *Store {
+	return NewSQL(db, dialect.MySQL)
+}
+
+// NewSQL returns a Store backed by db, writing SQL for dialect d
+func NewSQL(db *sql.DB, d dialect.Dialect) *Store {
+	return newSQL(&conn{db: db}, dialect.Or(d))
+}
+
+func newSQL(c *conn, d dialect.Dialect) *Store {
+	s := &Store{
+		Sales:      &sqlSales{db: c, d: d},
+		Goods:      &sqlGoods{db: c, d: d},
+		Customers:  &sqlCustomers{db: c, d: d},
+		Repeats:    &sqlRepeats{db: c, d: d},
+		Exclusions: &sqlExclusions{db: c, d: d},
+		Stock:      &sqlStock{db: c, d: d},
+		Lots:       &sqlLots{db: c, d: d},
+		Log:        &sqlLog{db: c, d: d},
+		Ledger:     &sqlLedger{db: c, d: d},
+		Warehouses: &sqlWarehouses{db: c, d: d},
+		Thresholds: &sqlThresholds{db: c, d: d},
+	}
+	s.tx = func(fn func(tx *Store) error) error {
+		if c.tx != nil {
+			return fn(s)
+		}
+		tx, err := c.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(newSQL(&conn{db: c.db, tx: tx}, d)); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	return s
+}
+
+// conn is what the SQL repositories run statements on: the database, or
+// the transaction of Store.Tx when tx is set
+type conn struct {
+	db *sql.DB
+	tx *sql.Tx
+	// savepoints numbers the savepoints of the methods run inside tx
+	savepoints int
+}
+
+func (c *conn) Exec(stmt string, args ...interface{}) (sql.Result, error) {
+	if c.tx != nil {
+		return c.tx.Exec(stmt, args...)
+	}
+	return c.db.Exec(stmt, args...)
+}
+
+func (c *conn) Query(stmt string, args ...interface{}) (*sql.Rows, error) {
+	if c.tx != nil {
+		return c.tx.Query(stmt, args...)
+	}
+	return c.db.Query(stmt, args...)
+}
+
+func (c *conn) QueryRow(stmt string, args ...interface{}) *sql.Row {
+	if c.tx != nil {
+		return c.tx.QueryRow(stmt, args...)
+	}
+	return c.db.QueryRow(stmt, args...)
+}
+
+// Begin starts the transaction of a repository method. Inside Store.Tx it
+// sets a savepoint in the running transaction instead, so a method that
+// fails halfway undoes its own writes and leaves the rest to Tx.
+func (c *conn) Begin() (*txn, error) {
+	if c.tx != nil {
+		c.savepoints++
+		name := fmt.Sprintf("sp%d", c.savepoints)
+		if _, err := c.tx.Exec("SAVEPOINT " + name); err != nil {
+			return nil, err
+		}
+		return &txn{Tx: c.tx, savepoint: name}, nil
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx}, nil
+}
+
+// txn is a transaction started by conn.Begin, or a savepoint when
+// savepoint is set
+type txn struct {
+	*sql.Tx
+	savepoint string
+	done      bool
+}
+
+func (t *txn) Commit() error {
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+	t.done = true
+	_, err := t.Exec("RELEASE SAVEPOINT " + t.savepoint)
+	return err
+}
+
+func (t *txn) Rollback() error {
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return nil
+	}
+	t.done = true
+	if _, err := t.Exec("ROLLBACK TO SAVEPOINT " + t.savepoint); err != nil {
+		return err
+	}
+	_, err := t.Exec("RELEASE SAVEPOINT " + t.savepoint)
+	return err
+}
+
+// querier runs a SELECT on a conn or a txn
+type querier interface {
+	Query(stmt string, args ...interface{}) (*sql.Rows, error)
+}
+
+// now is the rgdt/updt value, in the business timezone
+func now() string {
+	return civil.Timestamp()
+}
+
+// selectAll runs q and scans every row into dest
+func selectAll(db querier, q *query.Builder, dest interface{}) error {
+	sqlQuery, args, err := q.Build()
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scan.Structs(rows, dest)
+}
+
+// selectOne runs q and scans the first row into dest
+func selectOne(db querier, q *query.Builder, dest interface{}) error {
+	sqlQuery, args, err := q.Limit(1).Build()
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := scan.Struct(rows, dest); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+type sqlSales struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlSales) Get(sales int64) (*Sales, error) {
+	s := &Sales{}
+	err := selectOne(r.db, query.Select("s.*").From("yc_sales AS s").WhereEq("s.sales", sales), s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *sqlSales) List(f SalesFilter) ([]*Sales, error) {
+	q := query.Select("s.*").From("yc_sales AS s").Where("s.sales IS NOT NULL")
+	if f.Customer != "" {
+		q.WhereEq("s.customer", f.Customer)
+	}
+	if f.Goods != "" {
+		q.WhereEq("s.goods", f.Goods)
+	}
+	if f.OutgoingWarehouse != "" {
+		q.WhereEq("s.outgoing_warehouse", f.OutgoingWarehouse)
+	}
+	if !f.DeliveryFrom.IsZero() {
+		q.Where("s.delivery_dt >= ?", f.DeliveryFrom)
+	}
+	if !f.DeliveryTo.IsZero() {
+		q.Where("s.delivery_dt <= ?", f.DeliveryTo)
+	}
+	if f.RepeatOnly {
+		q.WhereEq("s.repeat_fg", 1)
+	}
+	if f.BaseSales != 0 {
+		q.WhereEq("s.base_sales", f.BaseSales)
+	}
+	q.OrderBy("s.delivery_dt", false).OrderBy("s.sales", false)
+
+	var list []*Sales
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlSales) Create(s *Sales) (int64, error) {
+	s.Rgdt = now()
+	ret, err := r.db.Exec(`
+		INSERT INTO yc_sales
+		(class, customer, name, goods, qty, ship_addr, cars_tank, outgoing_warehouse, use_stock, delivery_dt, arrival_dt, repeat_fg, base_sales, lot_fg, status, remark, rgdt, upuser)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.Class, s.Customer, s.Name, s.Goods, s.Qty, s.ShipAddr, s.CarsTank, s.OutgoingWarehouse, s.UseStock, s.DeliveryDt, s.ArrivalDt, s.RepeatFg, nullID(s.BaseSales), s.LotFg, s.Status, s.Remark, s.Rgdt, s.Upuser)
+	if err != nil {
+		return 0, err
+	}
+	id, err := ret.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	s.Sales = id
+	return id, nil
+}
+
+func (r *sqlSales) Update(s *Sales) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockRow(tx, r.d, "yc_sales", "sales", s.Sales); err != nil {
+		return err
+	}
+	s.Updt = now()
+	_, err = tx.Exec(`
+		UPDATE yc_sales SET
+		class = ?, customer = ?, name = ?, goods = ?, qty = ?, ship_addr = ?, cars_tank = ?, outgoing_warehouse = ?, use_stock = ?,
+		delivery_dt = ?, arrival_dt = ?, repeat_fg = ?, base_sales = ?, lot_fg = ?, status = ?, remark = ?, updt = ?, upuser = ?
+		WHERE sales = ?`,
+		s.Class, s.Customer, s.Name, s.Goods, s.Qty, s.ShipAddr, s.CarsTank, s.OutgoingWarehouse, s.UseStock,
+		s.DeliveryDt, s.ArrivalDt, s.RepeatFg, nullID(s.BaseSales), s.LotFg, s.Status, s.Remark, s.Updt, s.Upuser, s.Sales)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqlGoods struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlGoods) Get(goods string) (*Goods, error) {
+	g := &Goods{}
+	if err := selectOne(r.db, query.Select("g.*").From("yc_goods AS g").WhereEq("g.goods", goods), g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (r *sqlGoods) List(f GoodsFilter) ([]*Goods, error) {
+	q := query.Select("g.*").From("yc_goods AS g").Where("g.goods IS NOT NULL")
+	if f.Goods != "" {
+		q.WhereEq("g.goods", f.Goods)
+	}
+	if f.NamePrefix != "" {
+		q.WhereLike("g.name", query.LikePrefix(f.NamePrefix))
+	}
+	q.OrderBy("g.goods", false)
+
+	var list []*Goods
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlGoods) Save(g *Goods) error {
+	g.Updt = now()
+	stmt := r.d.Upsert("yc_goods",
+		[]string{"goods", "name", "qty", "separately_fg", "rgdt", "updt"},
+		[]string{"goods"},
+		[]string{"name", "qty", "separately_fg", "updt"})
+	_, err := r.db.Exec(stmt, g.Goods, g.Name, g.Qty, g.SeparatelyFg, g.Updt, g.Updt)
+	return err
+}
+
+type sqlCustomers struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlCustomers) Get(customer string) (*Customer, error) {
+	c := &Customer{}
+	if err := selectOne(r.db, query.Select("c.*").From("yc_customer AS c").WhereEq("c.customer", customer), c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *sqlCustomers) List(f CustomerFilter) ([]*Customer, error) {
+	q := query.Select("c.*").From("yc_customer AS c").Where("c.customer IS NOT NULL")
+	if f.Customer != "" {
+		q.WhereEq("c.customer", f.Customer)
+	}
+	if f.NamePrefix != "" {
+		q.WhereLike("c.name", query.LikePrefix(f.NamePrefix))
+	}
+	q.OrderBy("c.customer", false)
+
+	var list []*Customer
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlCustomers) Save(c *Customer) error {
+	c.Updt = now()
+	stmt := r.d.Upsert("yc_customer",
+		[]string{"customer", "name", "pref", "rgdt", "updt"},
+		[]string{"customer"},
+		[]string{"name", "pref", "updt"})
+	_, err := r.db.Exec(stmt, c.Customer, c.Name, c.Pref, c.Updt, c.Updt)
+	return err
+}
+
+func (r *sqlCustomers) Details(customer string) ([]*CustomerDetail, error) {
+	q := query.Select("cd.*").From("yc_customer_detail AS cd").WhereEq("cd.customer", customer).OrderBy("cd.detail", false)
+
+	var list []*CustomerDetail
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlCustomers) SaveDetails(customer string, details []*CustomerDetail) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM yc_customer_detail WHERE customer = ?", customer); err != nil {
+		return err
+	}
+	updt := now()
+	for i, d := range details {
+		if _, err := tx.Exec("INSERT INTO yc_customer_detail (customer, detail, tank, capacity, daily_use, level, level_dt, updt) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			customer, i+1, d.Tank, d.Capacity, d.DailyUse, d.Level, d.LevelDt, updt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlCustomers) SaveTank(d *CustomerDetail) error {
+	var found []*CustomerDetail
+	q := query.Select("cd.*").From("yc_customer_detail AS cd").WhereEq("cd.customer", d.Customer).WhereEq("cd.tank", d.Tank)
+	if err := selectAll(r.db, q, &found); err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return ErrNotFound
+	}
+	d.Detail, d.Updt = found[0].Detail, now()
+	_, err := r.db.Exec("UPDATE yc_customer_detail SET capacity = ?, daily_use = ?, level = ?, level_dt = ?, updt = ? WHERE customer = ? AND tank = ?",
+		d.Capacity, d.DailyUse, d.Level, d.LevelDt, d.Updt, d.Customer, d.Tank)
+	return err
+}
+
+func (r *sqlCustomers) TankGoods(customer string) (map[string][]string, error) {
+	q := query.Select("tg.tank", "tg.goods").From("yc_customer_tank_goods AS tg").WhereEq("tg.customer", customer).OrderBy("tg.tank", false).OrderBy("tg.goods", false)
+
+	var list []struct {
+		Tank  string `db:"tank"`
+		Goods string `db:"goods"`
+	}
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	ret := make(map[string][]string)
+	for _, tg := range list {
+		ret[tg.Tank] = append(ret[tg.Tank], tg.Goods)
+	}
+	return ret, nil
+}
+
+func (r *sqlCustomers) SetTankGoods(customer, tank string, goods []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM yc_customer_tank_goods WHERE customer = ? AND tank = ?", customer, tank); err != nil {
+		return err
+	}
+	for _, g := range goods {
+		if _, err := tx.Exec("INSERT INTO yc_customer_tank_goods (customer, tank, goods) VALUES (?, ?, ?)", customer, tank, g); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlCustomers) AddOverride(o *GoodsOverride) error {
+	o.Rgdt = now()
+	ret, err := r.db.Exec(dialect.Insert(r.d, "yc_goods_override", []string{"customer", "goods", "sales", "action", "reason", "rgdt", "upuser"}),
+		o.Customer, o.Goods, nullID(o.Sales), o.Action, o.Reason, o.Rgdt, o.Upuser)
+	if err != nil {
+		return err
+	}
+	o.ID, err = ret.LastInsertId()
+	return err
+}
+
+func (r *sqlCustomers) Overrides(customer string) ([]*GoodsOverride, error) {
+	q := query.Select("ov.*").From("yc_goods_override AS ov").WhereEq("ov.customer", customer).OrderBy("ov.id", false)
+
+	var list []*GoodsOverride
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlCustomers) GoodsCodes(customer string) ([]string, error) {
+	q := query.Select("cg.goods").From("yc_customer_goods AS cg").WhereEq("cg.customer", customer).OrderBy("cg.goods", false)
+
+	var list []struct {
+		Goods string `db:"goods"`
+	}
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, len(list))
+	for _, d := range list {
+		codes = append(codes, d.Goods)
+	}
+	return codes, nil
+}
+
+func (r *sqlCustomers) SetGoodsCodes(customer string, goods []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM yc_customer_goods WHERE customer = ?", customer); err != nil {
+		return err
+	}
+	for _, g := range goods {
+		if _, err := tx.Exec("INSERT INTO yc_customer_goods (customer, goods) VALUES (?, ?)", customer, g); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type sqlRepeats struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlRepeats) selectRepeats() *query.Builder {
+	return query.Select(
+		"scr.*", "scr.sales AS sales", "s.class", "s.outgoing_warehouse", "s.goods", "s.ship_addr", "s.qty", "s.customer", "s.status", "s.repeat_fg",
+		"c.name AS customer_name", "g.name AS goods_name",
+	).
+		From("yc_schedule_repeat AS scr").
+		LeftJoin("yc_sales AS s", "s.sales = scr.sales").
+		LeftJoin("yc_customer AS c", "s.customer = c.customer").
+		LeftJoin("yc_goods AS g", "s.goods = g.goods")
+}
+
+func (r *sqlRepeats) Get(repeat int64) (*Repeat, error) {
+	rep := &Repeat{}
+	if err := selectOne(r.db, r.selectRepeats().WhereEq("scr.repeat", repeat), rep); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func (r *sqlRepeats) List(f RepeatFilter) ([]*Repeat, error) {
+	q := r.selectRepeats().
+		Where("scr.repeat IS NOT NULL").
+		WhereNotEq("s.status", 9).
+		WhereEq("s.repeat_fg", 1)
+	if f.OutgoingWarehouse != "" {
+		q.WhereEq("s.outgoing_warehouse", f.OutgoingWarehouse)
+	}
+	if f.Customer != "" {
+		q.WhereEq("s.customer", f.Customer)
+	}
+	q.OrderBy("scr.repeat", false)
+
+	var list []*Repeat
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlRepeats) Save(rep *Repeat) (int64, error) {
+	if rep.Repeat == 0 {
+		ret, err := r.db.Exec(`
+			INSERT INTO yc_schedule_repeat (sales, period, span, day_of_week, rrule, roll_policy, repeat_s_dt, repeat_e_dt, parent_repeat, repeat_qty, rgdt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			rep.Sales, rep.Period, rep.Span, rep.DayOfWeek, rep.RRule, rep.RollPolicy, rep.RepeatSDt, rep.RepeatEDt, nullID(rep.ParentRepeat), rep.RepeatQty, now())
+		if err != nil {
+			return 0, err
+		}
+		id, err := ret.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		rep.Repeat = id
+		return id, nil
+	}
+
+	_, err := r.db.Exec(`
+		UPDATE yc_schedule_repeat SET sales = ?, period = ?, span = ?, day_of_week = ?, rrule = ?, roll_policy = ?, repeat_s_dt = ?, repeat_e_dt = ?, parent_repeat = ?, repeat_qty = ?, updt = ?
+		WHERE `+r.d.Quote("repeat")+` = ?`,
+		rep.Sales, rep.Period, rep.Span, rep.DayOfWeek, rep.RRule, rep.RollPolicy, rep.RepeatSDt, rep.RepeatEDt, nullID(rep.ParentRepeat), rep.RepeatQty, now(), rep.Repeat)
+	if err != nil {
+		return 0, err
+	}
+	return rep.Repeat, nil
+}
+
+func (r *sqlRepeats) Pauses(repeat int64) ([]*RepeatPause, error) {
+	q := query.Select("rp.*").From("yc_repeat_pause AS rp")
+	if repeat != 0 {
+		q.WhereEq("rp.repeat", repeat)
+	}
+	q.OrderBy("rp.repeat", false).OrderBy("rp.pause_s_dt", false)
+
+	var list []*RepeatPause
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+var pauseCols = []string{"repeat", "pause_s_dt", "pause_e_dt", "reason", "rgdt", "upuser"}
+
+func (r *sqlRepeats) SavePause(p *RepeatPause) error {
+	if p.Rgdt == "" {
+		p.Rgdt = now()
+	}
+	stmt := r.d.Upsert("yc_repeat_pause", pauseCols,
+		[]string{"repeat", "pause_s_dt"},
+		[]string{"pause_e_dt", "reason", "upuser"})
+	_, err := r.db.Exec(stmt, p.Repeat, p.PauseSDt, p.PauseEDt, p.Reason, p.Rgdt, p.Upuser)
+	return err
+}
+
+func (r *sqlRepeats) RemovePause(repeat int64, pauseSDt civil.Date) error {
+	ret, err := r.db.Exec("DELETE FROM yc_repeat_pause WHERE "+r.d.Quote("repeat")+" = ? AND pause_s_dt = ?", repeat, pauseSDt)
+	if err != nil {
+		return err
+	}
+	return expectRow(ret)
+}
+
+func (r *sqlRepeats) Versions(repeat int64) ([]*RepeatVersion, error) {
+	q := query.Select("rv.*").From("yc_repeat_version AS rv").
+		WhereEq("rv.repeat", repeat).
+		OrderBy("rv.version", false)
+
+	var list []*RepeatVersion
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlRepeats) AddVersion(v *RepeatVersion) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	repeat := r.d.Quote("repeat")
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) + 1 FROM yc_repeat_version WHERE "+repeat+" = ?"+r.d.ForUpdate(), v.Repeat).Scan(&v.Version); err != nil {
+		return err
+	}
+	v.Rgdt = now()
+	_, err = tx.Exec(dialect.Insert(r.d, "yc_repeat_version", []string{"repeat", "version", "action", "effective_dt", "detail", "reason", "rgdt", "upuser"}),
+		v.Repeat, v.Version, v.Action, v.EffectiveDt, v.Detail, v.Reason, v.Rgdt, v.Upuser)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// nullID writes a zero reference as NULL
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+type sqlExclusions struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlExclusions) List(from, to civil.Date) ([]*Exclusion, error) {
+	q := query.Select("re.*").From("yc_repeat_exclude AS re")
+	switch {
+	case !from.IsZero() && !to.IsZero():
+		q.Where("(re.delivery_dt BETWEEN ? AND ? OR re.new_delivery_dt BETWEEN ? AND ?)", from, to, from, to)
+	case !from.IsZero():
+		q.Where("(re.delivery_dt >= ? OR re.new_delivery_dt >= ?)", from, from)
+	case !to.IsZero():
+		q.Where("(re.delivery_dt <= ? OR re.new_delivery_dt <= ?)", to, to)
+	}
+	q.OrderBy("re.delivery_dt", false).OrderBy("re.sales", false)
+
+	var list []*Exclusion
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlExclusions) Get(sales int64, deliveryDt civil.Date) (*Exclusion, error) {
+	e := &Exclusion{}
+	if err := selectOne(r.db, query.Select("re.*").From("yc_repeat_exclude AS re").WhereEq("re.sales", sales).WhereEq("re.delivery_dt", deliveryDt), e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *sqlExclusions) Exists(sales int64, deliveryDt civil.Date) (bool, error) {
+	_, err := r.Get(sales, deliveryDt)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+var exclusionCols = []string{"sales", "delivery_dt", "type", "reason", "new_delivery_dt", "new_qty", "rgdt", "updt", "upuser"}
+
+func (r *sqlExclusions) Add(e *Exclusion) error {
+	e.Rgdt = now()
+	_, err := r.db.Exec(dialect.Insert(r.d, "yc_repeat_exclude", exclusionCols),
+		e.Sales, e.DeliveryDt, e.Type, e.Reason, e.NewDeliveryDt, e.NewQty, e.Rgdt, e.Updt, e.Upuser)
+	return err
+}
+
+// Save inserts e or replaces the override of an existing exclusion
+func (r *sqlExclusions) Save(e *Exclusion) error {
+	e.Updt = now()
+	if e.Rgdt == "" {
+		e.Rgdt = e.Updt
+	}
+	stmt := r.d.Upsert("yc_repeat_exclude", exclusionCols,
+		[]string{"sales", "delivery_dt"},
+		[]string{"type", "reason", "new_delivery_dt", "new_qty", "updt", "upuser"})
+	_, err := r.db.Exec(stmt, e.Sales, e.DeliveryDt, e.Type, e.Reason, e.NewDeliveryDt, e.NewQty, e.Rgdt, e.Updt, e.Upuser)
+	return err
+}
+
+func (r *sqlExclusions) Remove(sales int64, deliveryDt civil.Date) error {
+	ret, err := r.db.Exec("DELETE FROM yc_repeat_exclude WHERE sales = ? AND delivery_dt = ?", sales, deliveryDt)
+	if err != nil {
+		return err
+	}
+	return expectRow(ret)
+}
+
+type sqlStock struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlStock) selectDetails() *query.Builder {
+	return query.Select("st.stock", "st.goods", "st.warehouse", "st.arrival_dt", "std.id", "std.lot", "std.barcode", "std.expiry_dt", "std.transfer_fg", "std.pick_strategy", "std.transfer_ref", "std.scan_state").
+		From("yc_stock AS st").
+		Join("INNER", "yc_stock_detail AS std", "st.stock = std.stock")
+}
+
+func (r *sqlStock) Create(s *Stock, details []*StockDetail) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rgdt := now()
+	if _, err := tx.Exec("INSERT INTO yc_stock (stock, goods, warehouse, qty, arrival_dt, transfer_fg, rgdt) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		s.Stock, s.Goods, s.Warehouse, s.Qty, s.ArrivalDt, s.TransferFg, rgdt); err != nil {
+		return err
+	}
+	for _, d := range details {
+		ret, err := tx.Exec("INSERT INTO yc_stock_detail (stock, lot, barcode, expiry_dt, transfer_fg, rgdt) VALUES (?, ?, ?, ?, ?, ?)",
+			s.Stock, d.Lot, d.Barcode, d.ExpiryDt, d.TransferFg, rgdt)
+		if err != nil {
+			return err
+		}
+		if d.ID, err = ret.LastInsertId(); err != nil {
+			return err
+		}
+		d.Stock, d.Goods, d.Warehouse, d.ArrivalDt = s.Stock, s.Goods, s.Warehouse, s.ArrivalDt
+	}
+	return tx.Commit()
+}
+
+func (r *sqlStock) available(goods, warehouse string) *query.Builder {
+	return r.selectDetails().
+		WhereEq("st.goods", goods).
+		WhereEq("st.warehouse", warehouse).
+		WhereNotEq("std.transfer_fg", 1).
+		OrderBy("st.arrival_dt", false).
+		OrderBy("std.id", false)
+}
+
+func (r *sqlStock) Available(goods, warehouse string, limit int) ([]*StockDetail, error) {
+	q := r.available(goods, warehouse)
+	if limit >= 0 {
+		q.Limit(limit)
+	}
+
+	var list []*StockDetail
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlStock) GetDetail(id int64) (*StockDetail, error) {
+	d := &StockDetail{}
+	if err := selectOne(r.db, r.selectDetails().WhereEq("std.id", id), d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *sqlStock) SetTransferFg(id int64, fg bool) error {
+	_, err := r.db.Exec("UPDATE yc_stock_detail SET transfer_fg = ?, updt = ? WHERE id = ?", fg, now(), id)
+	return err
+}
+
+func (r *sqlStock) MarkTransferred(ids []int64, ref, strategy string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := markTransferred(tx, ids, ref, strategy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlStock) Reserve(goods, warehouse, ref, strategy string, pick func([]*StockDetail) ([]*StockDetail, error)) ([]*StockDetail, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sqlQuery, args, err := r.available(goods, warehouse).Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(sqlQuery+r.d.ForUpdate(), args...)
+	if err != nil {
+		return nil, err
+	}
+	var list []*StockDetail
+	err = scan.Structs(rows, &list)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	picked, err := pick(list)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(picked))
+	for i, d := range picked {
+		ids[i] = d.ID
+	}
+	if err := markTransferred(tx, ids, ref, strategy); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	for _, d := range picked {
+		d.TransferFg, d.PickStrategy, d.TransferRef = true, strategy, ref
+	}
+	return picked, nil
+}
+
+func (r *sqlStock) GetStock(stock string) (*Stock, error) {
+	s := &Stock{}
+	if err := selectOne(r.db, query.Select("st.stock", "st.goods", "st.warehouse", "st.qty", "st.arrival_dt", "st.transfer_fg").From("yc_stock AS st").WhereEq("st.stock", stock), s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *sqlStock) Transferred(ref string) ([]*StockDetail, error) {
+	q := r.selectDetails().
+		WhereEq("std.transfer_ref", ref).
+		WhereEq("std.transfer_fg", 1).
+		OrderBy("std.id", false)
+
+	var list []*StockDetail
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlStock) LockTransferred(ref string) ([]*StockDetail, error) {
+	sqlQuery, args, err := r.selectDetails().
+		WhereEq("std.transfer_ref", ref).
+		WhereEq("std.transfer_fg", 1).
+		OrderBy("std.id", false).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(sqlQuery+r.d.ForUpdate(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*StockDetail
+	if err := scan.Structs(rows, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlStock) Release(ref string) (int, error) {
+	ret, err := r.db.Exec("UPDATE yc_stock_detail SET transfer_fg = 0, transfer_ref = NULL, pick_strategy = '', updt = ? WHERE transfer_ref = ? AND transfer_fg = 1", now(), ref)
+	if err != nil {
+		return 0, err
+	}
+	n, err := ret.RowsAffected()
+	return int(n), err
+}
+
+func (r *sqlStock) DeleteTransfer(stock string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ret, err := tx.Exec("DELETE FROM yc_stock WHERE stock = ? AND transfer_fg = 1", stock)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(ret); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM yc_stock_detail WHERE stock = ?", stock); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlStock) AddCancel(c *TransferCancel) error {
+	c.Rgdt = now()
+	ret, err := r.db.Exec(dialect.Insert(r.d, "yc_transfer_cancel", []string{"stock", "released", "reason", "rgdt", "upuser"}),
+		c.Stock, c.Released, c.Reason, c.Rgdt, c.Upuser)
+	if err != nil {
+		return err
+	}
+	c.ID, err = ret.LastInsertId()
+	return err
+}
+
+func (r *sqlStock) Cancels(stock string) ([]*TransferCancel, error) {
+	q := query.Select("tc.*").From("yc_transfer_cancel AS tc").WhereEq("tc.stock", stock).OrderBy("tc.id", false)
+
+	var list []*TransferCancel
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlStock) ByBarcode(barcodes ...string) (*StockDetail, error) {
+	for _, b := range barcodes {
+		if b == "" {
+			continue
+		}
+		d := &StockDetail{}
+		err := selectOne(r.db, r.selectDetails().WhereEq("std.barcode", b).OrderBy("std.id", true), d)
+		if err == nil {
+			return d, nil
+		}
+		if err != ErrNotFound {
+			return nil, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *sqlStock) SetScanState(id int64, from, to ScanState) error {
+	ret, err := r.db.Exec("UPDATE yc_stock_detail SET scan_state = ?, updt = ? WHERE id = ? AND scan_state = ?", to, now(), id, from)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(ret); err != ErrNotFound {
+		return err
+	}
+	if _, err := r.GetDetail(id); err != nil {
+		return err
+	}
+	return ErrConflict
+}
+
+func (r *sqlStock) AddScan(s *StockScan) error {
+	s.Rgdt = now()
+	ret, err := r.db.Exec(dialect.Insert(r.d, "yc_stock_scan", []string{"detail", "barcode", "action", "ref", "state_from", "state_to", "result", "message", "rgdt", "upuser"}),
+		nullID(s.Detail), s.Barcode, s.Action, s.Ref, s.StateFrom, s.StateTo, s.Result, s.Message, s.Rgdt, s.Upuser)
+	if err != nil {
+		return err
+	}
+	s.ID, err = ret.LastInsertId()
+	return err
+}
+
+func (r *sqlStock) Scans(detail int64) ([]*StockScan, error) {
+	q := query.Select("ss.*").From("yc_stock_scan AS ss").WhereEq("ss.detail", detail).OrderBy("ss.id", false)
+
+	var list []*StockScan
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// markTransferred flags ids as transferred. The transfer_fg condition
+// catches a detail taken by another transfer where the dialect cannot
+// lock rows.
+func markTransferred(tx *txn, ids []int64, ref, strategy string) error {
+	updt := now()
+	for _, id := range ids {
+		ret, err := tx.Exec("UPDATE yc_stock_detail SET transfer_fg = 1, transfer_ref = ?, pick_strategy = ?, updt = ? WHERE id = ? AND transfer_fg <> 1", ref, strategy, updt, id)
+		if err != nil {
+			return err
+		}
+		if err := expectRow(ret); err != ErrNotFound {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM yc_stock_detail WHERE id = ?", id).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+type sqlLots struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlLots) Slots(sales int64) ([]*LotSlot, error) {
+	q := query.Select("gd.*").From("yc_goods_detail AS gd").
+		WhereEq("gd."+r.d.Quote("order"), sales).
+		OrderBy("gd.slot", false).OrderBy("gd.id", false)
+
+	var list []*LotSlot
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlLots) ReplaceSlots(sales int64, slots []*LotSlot) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM yc_goods_detail WHERE "+r.d.Quote("order")+" = ?", sales); err != nil {
+		return err
+	}
+	stmt := dialect.Insert(r.d, "yc_goods_detail", []string{"order", "slot", "goods", "lot", "tank", "qty", "rgdt", "upuser"})
+	for i, s := range slots {
+		s.Order, s.Slot, s.Rgdt = sales, i+1, now()
+		ret, err := tx.Exec(stmt, s.Order, s.Slot, s.Goods, s.Lot, s.Tank, s.Qty, s.Rgdt, s.Upuser)
+		if err != nil {
+			return err
+		}
+		if s.ID, err = ret.LastInsertId(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlLots) UpdateSlots(slots []*LotSlot) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, s := range slots {
+		if err := lockRow(tx, r.d, "yc_goods_detail", "id", s.ID); err != nil {
+			return err
+		}
+		s.Updt = now()
+		if _, err := tx.Exec("UPDATE yc_goods_detail SET lot = ?, tank = ?, qty = ?, updt = ?, upuser = ? WHERE id = ?",
+			s.Lot, s.Tank, s.Qty, s.Updt, s.Upuser, s.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type sqlLog struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlLog) Add(e *MaterializeLog) error {
+	if e.RunAt == "" {
+		e.RunAt = now()
+	}
+	ret, err := r.db.Exec(dialect.Insert(r.d, "yc_materialize_log", []string{"run_at", "dry_run", "base_sales", "repeat", "delivery_dt", "sales", "status", "message"}),
+		e.RunAt, e.DryRun, e.BaseSales, e.Repeat, e.DeliveryDt, nullID(e.Sales), e.Status, e.Message)
+	if err != nil {
+		return err
+	}
+	e.ID, err = ret.LastInsertId()
+	return err
+}
+
+func (r *sqlLog) List(limit int) ([]*MaterializeLog, error) {
+	q := query.Select("ml.*").From("yc_materialize_log AS ml").OrderBy("ml.id", true)
+	if limit > 0 {
+		q.Limit(limit)
+	}
+
+	var list []*MaterializeLog
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+type sqlLedger struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+var ledgerCols = []string{"kind", "ref", "goods", "warehouse", "lot", "on_hand", "reserved", "in_transit", "cancel_of", "reason", "rgdt", "upuser"}
+
+func (r *sqlLedger) Post(entries []*LedgerEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rgdt := now()
+	insert := dialect.Insert(r.d, "yc_stock_ledger", ledgerCols)
+	for _, e := range entries {
+		e.Rgdt = rgdt
+		ret, err := tx.Exec(insert, e.Kind, e.Ref, e.Goods, e.Warehouse, e.Lot, e.OnHand, e.Reserved, e.InTransit, nullID(e.CancelOf), e.Reason, e.Rgdt, e.Upuser)
+		if err != nil {
+			return err
+		}
+		if e.ID, err = ret.LastInsertId(); err != nil {
+			return err
+		}
+		if e.OnHand == 0 && e.Reserved == 0 && e.InTransit == 0 {
+			continue
+		}
+
+		ret, err = tx.Exec("UPDATE yc_stock_balance SET on_hand = on_hand + ?, reserved = reserved + ?, in_transit = in_transit + ?, updt = ? WHERE goods = ? AND warehouse = ? AND lot = ?",
+			e.OnHand, e.Reserved, e.InTransit, rgdt, e.Goods, e.Warehouse, e.Lot)
+		if err != nil {
+			return err
+		}
+		if err := expectRow(ret); err != ErrNotFound {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO yc_stock_balance (goods, warehouse, lot, on_hand, reserved, in_transit, updt) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			e.Goods, e.Warehouse, e.Lot, e.OnHand, e.Reserved, e.InTransit, rgdt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlLedger) Entries(f LedgerFilter) ([]*LedgerEntry, error) {
+	q := query.Select("sl.*").From("yc_stock_ledger AS sl")
+	ledgerWhere(q, "sl", f)
+	if f.Ref != "" {
+		q.WhereEq("sl.ref", f.Ref)
+	}
+	if f.Kind != "" {
+		q.WhereEq("sl.kind", string(f.Kind))
+	}
+	q.OrderBy("sl.id", false)
+
+	var list []*LedgerEntry
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlLedger) Balances(f LedgerFilter) ([]*StockBalance, error) {
+	q := query.Select("sb.*").From("yc_stock_balance AS sb")
+	ledgerWhere(q, "sb", f)
+	q.OrderBy("sb.goods", false).OrderBy("sb.warehouse", false).OrderBy("sb.lot", false)
+
+	var list []*StockBalance
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ledgerWhere narrows q to the goods, warehouse and lot of f
+func ledgerWhere(q *query.Builder, alias string, f LedgerFilter) {
+	if f.Goods != "" {
+		q.WhereEq(alias+".goods", f.Goods)
+	}
+	if f.Warehouse != "" {
+		q.WhereEq(alias+".warehouse", f.Warehouse)
+	}
+	if f.Lot != "" {
+		q.WhereEq(alias+".lot", f.Lot)
+	}
+}
+
+type sqlWarehouses struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlWarehouses) Get(warehouse string) (*Warehouse, error) {
+	w := &Warehouse{}
+	if err := selectOne(r.db, query.Select("w.*").From("yc_warehouse AS w").WhereEq("w.warehouse", warehouse), w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (r *sqlWarehouses) List() ([]*Warehouse, error) {
+	var list []*Warehouse
+	if err := selectAll(r.db, query.Select("w.*").From("yc_warehouse AS w").OrderBy("w.warehouse", false), &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlWarehouses) Save(w *Warehouse) error {
+	w.Updt = now()
+	stmt := r.d.Upsert("yc_warehouse",
+		[]string{"warehouse", "name", "source_fg", "destination_fg", "bulk_fg", "rgdt", "updt"},
+		[]string{"warehouse"},
+		[]string{"name", "source_fg", "destination_fg", "bulk_fg", "updt"})
+	_, err := r.db.Exec(stmt, w.Warehouse, w.Name, w.SourceFg, w.DestinationFg, w.BulkFg, w.Updt, w.Updt)
+	return err
+}
+
+func (r *sqlWarehouses) Routes(to string) ([]*WarehouseRoute, error) {
+	q := query.Select("wr.*").From("yc_warehouse_route AS wr")
+	if to != "" {
+		q.WhereEq("wr.to_warehouse", to)
+	}
+	q.OrderBy("wr.to_warehouse", false).OrderBy("wr.priority", false).OrderBy("wr.from_warehouse", false)
+
+	var list []*WarehouseRoute
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlWarehouses) SaveRoute(wr *WarehouseRoute) error {
+	wr.Updt = now()
+	stmt := r.d.Upsert("yc_warehouse_route",
+		[]string{"from_warehouse", "to_warehouse", "priority", "active_fg", "rgdt", "updt"},
+		[]string{"from_warehouse", "to_warehouse"},
+		[]string{"priority", "active_fg", "updt"})
+	_, err := r.db.Exec(stmt, wr.From, wr.To, wr.Priority, wr.ActiveFg, wr.Updt, wr.Updt)
+	return err
+}
+
+func (r *sqlWarehouses) RemoveRoute(from, to string) error {
+	ret, err := r.db.Exec("DELETE FROM yc_warehouse_route WHERE from_warehouse = ? AND to_warehouse = ?", from, to)
+	if err != nil {
+		return err
+	}
+	return expectRow(ret)
+}
+
+type sqlThresholds struct {
+	db *conn
+	d  dialect.Dialect
+}
+
+func (r *sqlThresholds) List(goods, warehouse string) ([]*StockThreshold, error) {
+	q := query.Select("th.*").From("yc_stock_threshold AS th")
+	if goods != "" {
+		q.WhereEq("th.goods", goods)
+	}
+	if warehouse != "" {
+		q.WhereEq("th.warehouse", warehouse)
+	}
+	q.OrderBy("th.goods", false).OrderBy("th.warehouse", false)
+
+	var list []*StockThreshold
+	if err := selectAll(r.db, q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *sqlThresholds) Save(t *StockThreshold) error {
+	t.Updt = now()
+	stmt := r.d.Upsert("yc_stock_threshold",
+		[]string{"goods", "warehouse", "min_qty", "target_qty", "rgdt", "updt", "upuser"},
+		[]string{"goods", "warehouse"},
+		[]string{"min_qty", "target_qty", "updt", "upuser"})
+	_, err := r.db.Exec(stmt, t.Goods, t.Warehouse, t.MinQty, t.TargetQty, t.Updt, t.Updt, t.Upuser)
+	return err
+}
+
+func (r *sqlThresholds) Remove(goods, warehouse string) error {
+	ret, err := r.db.Exec("DELETE FROM yc_stock_threshold WHERE goods = ? AND warehouse = ?", goods, warehouse)
+	if err != nil {
+		return err
+	}
+	return expectRow(ret)
+}
+
+// lockRow locks the row of table whose key column is id, or returns
+// ErrNotFound. Updates check the row this way rather than by the rows
+// they affect: MySQL counts a row saved with its own values as unchanged.
+func lockRow(tx *txn, d dialect.Dialect, table, key string, id interface{}) error {
+	var found int
+	err := tx.QueryRow("SELECT 1 FROM "+table+" WHERE "+key+" = ?"+d.ForUpdate(), id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// expectRow turns a delete that touched nothing into ErrNotFound. An
+// update may only use it when its WHERE clause excludes the new values.
+func expectRow(ret sql.Result) error {
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repository_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+type row = map[string]interface{}
+
+// TestRepeatListJoins checks the joins behind the repeat schedule screen:
+// yc_schedule_repeat with its yc_sales, and the names from yc_customer and
+// yc_goods, which may be missing
+func TestRepeatListJoins(t *testing.T) {
+	db := testdb.New(t,
+		testdb.Fixture{Table: "yc_customer", Rows: []row{
+			{"customer": "C1", "name": "梅田畜産"},
+		}},
+		testdb.Fixture{Table: "yc_goods", Rows: []row{
+			{"goods": "101", "name": "ミルククイーン", "qty": "1.000"},
+		}},
+		testdb.Fixture{Table: "yc_sales", Rows: []row{
+			{"sales": 1, "customer": "C1", "goods": "101", "qty": "6.500", "outgoing_warehouse": "2", "repeat_fg": 1},
+			{"sales": 2, "customer": "C9", "goods": "999", "qty": "1", "outgoing_warehouse": "2", "repeat_fg": 1},
+			{"sales": 3, "customer": "C1", "goods": "101", "outgoing_warehouse": "2", "repeat_fg": 1, "status": 9},
+			{"sales": 4, "customer": "C1", "goods": "101", "outgoing_warehouse": "3", "repeat_fg": 0},
+			{"sales": 5, "customer": "C1", "goods": "101", "outgoing_warehouse": "3", "repeat_fg": 1},
+		}},
+		testdb.Fixture{Table: "yc_schedule_repeat", Rows: []row{
+			{"repeat": 10, "sales": 1, "period": 1, "repeat_s_dt": "2026-10-01"},
+			{"repeat": 11, "sales": 2, "period": 2, "repeat_s_dt": "2026-10-01"},
+			{"repeat": 12, "sales": 3, "period": 1, "repeat_s_dt": "2026-10-01"},
+			{"repeat": 13, "sales": 4, "period": 1, "repeat_s_dt": "2026-10-01"},
+			{"repeat": 14, "sales": 5, "period": 1, "repeat_s_dt": "2026-10-01", "parent_repeat": 10},
+			{"repeat": 15, "sales": 99, "period": 1, "repeat_s_dt": "2026-10-01"},
+		}},
+	)
+	st := repository.NewSQL(db, testdb.Dialect)
+
+	list, err := st.Repeats.List(repository.RepeatFilter{})
+	must(t, err)
+	var got []string
+	for _, r := range list {
+		got = append(got, fmt.Sprintf("%d:%d %s/%s %s/%s %s %s", r.Repeat, r.Sales, r.Customer, r.CustomerName, r.Goods, r.GoodsName, r.Qty, r.OutgoingWarehouse))
+	}
+	want := []string{
+		"10:1 C1/梅田畜産 101/ミルククイーン 6.500 2",
+		"11:2 C9/ 999/ 1.000 2",
+		"14:5 C1/梅田畜産 101/ミルククイーン 0.000 3",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("List =\n%q\nwant\n%q", got, want)
+	}
+	if list[2].ParentRepeat != 10 || list[2].RepeatSDt != d("2026-10-01") {
+		t.Errorf("repeat 14 = %+v", list[2])
+	}
+
+	list, err = st.Repeats.List(repository.RepeatFilter{OutgoingWarehouse: "2", Customer: "C1"})
+	must(t, err)
+	if len(list) != 1 || list[0].Repeat != 10 {
+		t.Errorf("List by warehouse and customer = %+v", list)
+	}
+
+	orphan, err := st.Repeats.Get(15)
+	must(t, err)
+	if orphan.Sales != 99 || orphan.Customer != "" {
+		t.Errorf("Get of a repeat without its sales = %+v", orphan)
+	}
+}
+
+// TestStockDetailJoin checks the yc_stock / yc_stock_detail join the
+// transfer screen picks from: header fields on every detail, transferred
+// details and other goods or warehouses left out, header arrival first
+func TestStockDetailJoin(t *testing.T) {
+	db := testdb.New(t,
+		testdb.Fixture{Table: "yc_stock", Rows: []row{
+			{"stock": "S-NEW", "goods": "101", "warehouse": "2", "arrival_dt": "2026-10-10"},
+			{"stock": "S-OLD", "goods": "101", "warehouse": "2", "arrival_dt": "2026-10-01"},
+			{"stock": "S-TAMBA", "goods": "101", "warehouse": "3", "arrival_dt": "2026-09-01"},
+			{"stock": "S-OTHER", "goods": "102", "warehouse": "2", "arrival_dt": "2026-09-01"},
+		}},
+		testdb.Fixture{Table: "yc_stock_detail", Rows: []row{
+			{"id": 1, "stock": "S-NEW", "lot": "L2", "barcode": "B1", "transfer_fg": 0},
+			{"id": 2, "stock": "S-NEW", "lot": "L2", "barcode": "B2", "transfer_fg": 1, "transfer_ref": "T1", "pick_strategy": "fifo"},
+			{"id": 3, "stock": "S-OLD", "lot": "L1", "barcode": "B3", "transfer_fg": 0, "expiry_dt": "2027-01-31"},
+			{"id": 4, "stock": "S-OLD", "lot": "L1", "barcode": "B4", "transfer_fg": 0},
+			{"id": 5, "stock": "S-TAMBA", "lot": "L0", "barcode": "B5", "transfer_fg": 0},
+			{"id": 6, "stock": "S-OTHER", "lot": "L9", "barcode": "B6", "transfer_fg": 0},
+		}},
+	)
+	st := repository.NewSQL(db, testdb.Dialect)
+
+	avail, err := st.Stock.Available("101", "2", -1)
+	must(t, err)
+	var got []string
+	for _, d := range avail {
+		got = append(got, fmt.Sprintf("%d %s %s/%s %s %s %s", d.ID, d.Stock, d.Goods, d.Warehouse, d.ArrivalDt, d.Lot, d.ExpiryDt))
+	}
+	want := []string{
+		"3 S-OLD 101/2 2026-10-01 L1 2027-01-31",
+		"4 S-OLD 101/2 2026-10-01 L1 ",
+		"1 S-NEW 101/2 2026-10-10 L2 ",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Available =\n%q\nwant\n%q", got, want)
+	}
+
+	taken, err := st.Stock.Transferred("T1")
+	must(t, err)
+	if len(taken) != 1 || taken[0].ID != 2 || taken[0].Warehouse != "2" || taken[0].PickStrategy != "fifo" {
+		t.Errorf("Transferred = %+v", taken)
+	}
+}
@@ -0,0 +1,478 @@
+package repository_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+// forEachStore runs f against the in-memory store and against the SQL
+// store on a fresh SQLite database, so the memory store that logic is
+// unit-tested on keeps behaving like the real one
+func forEachStore(t *testing.T, f func(t *testing.T, st *repository.Store)) {
+	t.Helper()
+	t.Run("memory", func(t *testing.T) {
+		f(t, repository.NewMemory())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		f(t, repository.NewSQL(testdb.New(t), testdb.Dialect))
+	})
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+var d = civil.MustParse
+
+func TestSales(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		var ids []int64
+		for _, s := range []*repository.Sales{
+			{Customer: "C1", Goods: "101", Qty: scan.NewQty(5), DeliveryDt: d("2026-10-21")},
+			{Customer: "C1", Goods: "102", Qty: scan.NewQty(3), DeliveryDt: d("2026-10-20")},
+			{Customer: "C2", Goods: "101", Qty: scan.NewQty(1), DeliveryDt: d("2026-10-21"), RepeatFg: true},
+			{Customer: "C2", Goods: "101", Qty: scan.NewQty(1), DeliveryDt: d("2026-10-28"), BaseSales: 3},
+		} {
+			id, err := st.Sales.Create(s)
+			must(t, err)
+			if id == 0 || id != s.Sales {
+				t.Fatalf("Create returned %d and set Sales to %d", id, s.Sales)
+			}
+			ids = append(ids, id)
+		}
+
+		got, err := st.Sales.Get(ids[0])
+		must(t, err)
+		if got.Customer != "C1" || got.Qty != scan.NewQty(5) || got.DeliveryDt != d("2026-10-21") || got.Rgdt == "" {
+			t.Errorf("Get = %+v", got)
+		}
+		got.Customer = "changed"
+		if again, _ := st.Sales.Get(ids[0]); again.Customer != "C1" {
+			t.Error("changing a returned sales changed the store")
+		}
+		if _, err := st.Sales.Get(999); err != repository.ErrNotFound {
+			t.Errorf("Get(999) err = %v, want ErrNotFound", err)
+		}
+
+		tests := []struct {
+			name string
+			f    repository.SalesFilter
+			want []int64
+		}{
+			{"all, by delivery then sales", repository.SalesFilter{}, []int64{ids[1], ids[0], ids[2], ids[3]}},
+			{"customer", repository.SalesFilter{Customer: "C1"}, []int64{ids[1], ids[0]}},
+			{"goods", repository.SalesFilter{Goods: "101"}, []int64{ids[0], ids[2], ids[3]}},
+			{"delivery range", repository.SalesFilter{DeliveryFrom: d("2026-10-21"), DeliveryTo: d("2026-10-21")}, []int64{ids[0], ids[2]}},
+			{"repeat only", repository.SalesFilter{RepeatOnly: true}, []int64{ids[2]}},
+			{"base sales", repository.SalesFilter{BaseSales: 3}, []int64{ids[3]}},
+			{"nothing", repository.SalesFilter{Customer: "C9"}, nil},
+		}
+		for _, tt := range tests {
+			list, err := st.Sales.List(tt.f)
+			must(t, err)
+			if got := salesIDs(list); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("%s: List = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+
+		s, _ := st.Sales.Get(ids[1])
+		s.Status, s.Qty = 9, scan.NewQty(4)
+		must(t, st.Sales.Update(s))
+		if got, _ := st.Sales.Get(ids[1]); got.Status != 9 || got.Qty != scan.NewQty(4) || got.Updt == "" {
+			t.Errorf("after Update = %+v", got)
+		}
+		// Saving the same values again in the same second changes no row
+		must(t, st.Sales.Update(s))
+		must(t, st.Sales.Update(s))
+		if err := st.Sales.Update(&repository.Sales{Sales: 999}); err != repository.ErrNotFound {
+			t.Errorf("Update(999) err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func salesIDs(list []*repository.Sales) []int64 {
+	var ids []int64
+	for _, s := range list {
+		ids = append(ids, s.Sales)
+	}
+	return ids
+}
+
+func TestGoodsAndCustomers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		must(t, st.Goods.Save(&repository.Goods{Goods: "102", Name: "子豚用", Qty: scan.NewQty(1)}))
+		must(t, st.Goods.Save(&repository.Goods{Goods: "101", Name: "肥育用", Qty: scan.NewQty(2)}))
+		g, err := st.Goods.Get("101")
+		must(t, err)
+		rgdt := g.Rgdt
+		g.Name = "肥育用A"
+		must(t, st.Goods.Save(g))
+		if g, _ := st.Goods.Get("101"); g.Name != "肥育用A" || g.Rgdt != rgdt {
+			t.Errorf("after Save = %+v, want the name changed and rgdt %q kept", g, rgdt)
+		}
+		list, err := st.Goods.List(repository.GoodsFilter{NamePrefix: "肥育"})
+		must(t, err)
+		if len(list) != 1 || list[0].Goods != "101" {
+			t.Errorf("List by name prefix = %v", list)
+		}
+		if _, err := st.Goods.Get("999"); err != repository.ErrNotFound {
+			t.Errorf("Get(999) err = %v, want ErrNotFound", err)
+		}
+
+		must(t, st.Customers.Save(&repository.Customer{Customer: "C1", Name: "梅田畜産"}))
+		must(t, st.Customers.SaveDetails("C1", []*repository.CustomerDetail{{Tank: "A棟"}, {Tank: "B棟"}}))
+		details, err := st.Customers.Details("C1")
+		must(t, err)
+		if len(details) != 2 || details[0].Detail != 1 || details[1].Tank != "B棟" {
+			t.Errorf("Details = %+v", details)
+		}
+		must(t, st.Customers.SaveTank(&repository.CustomerDetail{Customer: "C1", Tank: "B棟", Capacity: scan.NewQty(10)}))
+		if err := st.Customers.SaveTank(&repository.CustomerDetail{Customer: "C1", Tank: "C棟"}); err != repository.ErrNotFound {
+			t.Errorf("SaveTank of an unknown tank err = %v, want ErrNotFound", err)
+		}
+
+		must(t, st.Customers.SetGoodsCodes("C1", []string{"102", "101"}))
+		codes, err := st.Customers.GoodsCodes("C1")
+		must(t, err)
+		if fmt.Sprint(codes) != "[101 102]" {
+			t.Errorf("GoodsCodes = %v", codes)
+		}
+		must(t, st.Customers.SetGoodsCodes("C1", []string{"102"}))
+		if codes, _ := st.Customers.GoodsCodes("C1"); fmt.Sprint(codes) != "[102]" {
+			t.Errorf("GoodsCodes after replacing = %v", codes)
+		}
+	})
+}
+
+func TestRepeatsJoinSales(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		must(t, st.Customers.Save(&repository.Customer{Customer: "C1", Name: "梅田畜産"}))
+		must(t, st.Goods.Save(&repository.Goods{Goods: "101", Name: "ミルククイーン"}))
+		active, _ := st.Sales.Create(&repository.Sales{Customer: "C1", Goods: "101", Qty: scan.NewQty(6), OutgoingWarehouse: "2", RepeatFg: true})
+		cancelled, _ := st.Sales.Create(&repository.Sales{Customer: "C1", Goods: "101", RepeatFg: true, Status: 9})
+		plain, _ := st.Sales.Create(&repository.Sales{Customer: "C1", Goods: "101"})
+
+		var reps []int64
+		for _, sales := range []int64{active, cancelled, plain} {
+			id, err := st.Repeats.Save(&repository.Repeat{Sales: sales, Period: 1, RepeatSDt: d("2026-10-01")})
+			must(t, err)
+			reps = append(reps, id)
+		}
+
+		list, err := st.Repeats.List(repository.RepeatFilter{})
+		must(t, err)
+		if len(list) != 1 {
+			t.Fatalf("List = %d repeats, want only the one of the active repeat sales", len(list))
+		}
+		r := list[0]
+		if r.Repeat != reps[0] || r.CustomerName != "梅田畜産" || r.GoodsName != "ミルククイーン" || r.Qty != scan.NewQty(6) || r.OutgoingWarehouse != "2" {
+			t.Errorf("List[0] = %+v", r)
+		}
+		if list, _ := st.Repeats.List(repository.RepeatFilter{OutgoingWarehouse: "3"}); len(list) != 0 {
+			t.Errorf("List by another warehouse = %d repeats", len(list))
+		}
+
+		got, err := st.Repeats.Get(reps[1])
+		must(t, err)
+		if got.Status != 9 || got.CustomerName != "梅田畜産" {
+			t.Errorf("Get of the cancelled repeat = %+v", got)
+		}
+		if _, err := st.Repeats.Get(999); err != repository.ErrNotFound {
+			t.Errorf("Get(999) err = %v, want ErrNotFound", err)
+		}
+
+		must(t, st.Repeats.SavePause(&repository.RepeatPause{Repeat: reps[0], PauseSDt: d("2026-11-01"), Reason: "a"}))
+		must(t, st.Repeats.SavePause(&repository.RepeatPause{Repeat: reps[0], PauseSDt: d("2026-11-01"), PauseEDt: d("2026-11-10"), Reason: "b"}))
+		pauses, err := st.Repeats.Pauses(reps[0])
+		must(t, err)
+		if len(pauses) != 1 || pauses[0].Reason != "b" || !pauses[0].Contains(d("2026-11-10")) || pauses[0].Contains(d("2026-11-11")) {
+			t.Errorf("Pauses = %+v", pauses)
+		}
+		must(t, st.Repeats.RemovePause(reps[0], d("2026-11-01")))
+		if err := st.Repeats.RemovePause(reps[0], d("2026-11-01")); err != repository.ErrNotFound {
+			t.Errorf("second RemovePause err = %v, want ErrNotFound", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			must(t, st.Repeats.AddVersion(&repository.RepeatVersion{Repeat: reps[0], Action: "change"}))
+		}
+		versions, err := st.Repeats.Versions(reps[0])
+		must(t, err)
+		if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 {
+			t.Errorf("Versions = %+v", versions)
+		}
+	})
+}
+
+func TestExclusions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		must(t, st.Exclusions.Add(&repository.Exclusion{Sales: 1, DeliveryDt: d("2026-10-05"), Type: repository.Skipped}))
+		must(t, st.Exclusions.Add(&repository.Exclusion{Sales: 1, DeliveryDt: d("2026-09-28"), Type: repository.Rescheduled, NewDeliveryDt: d("2026-10-02")}))
+		must(t, st.Exclusions.Add(&repository.Exclusion{Sales: 2, DeliveryDt: d("2026-11-01"), Type: repository.Confirmed}))
+
+		list, err := st.Exclusions.List(d("2026-10-01"), d("2026-10-31"))
+		must(t, err)
+		if len(list) != 2 || list[0].DeliveryDt != d("2026-09-28") || list[1].DeliveryDt != d("2026-10-05") {
+			t.Errorf("List = %+v, want the skip and the reschedule moved into October", list)
+		}
+		if ok, _ := st.Exclusions.Exists(2, d("2026-11-01")); !ok {
+			t.Error("Exists = false")
+		}
+
+		e, err := st.Exclusions.Get(1, d("2026-10-05"))
+		must(t, err)
+		e.Type, e.NewDeliveryDt, e.NewQty = repository.Rescheduled, d("2026-10-06"), scan.NewQty(2)
+		must(t, st.Exclusions.Save(e))
+		if e, _ := st.Exclusions.Get(1, d("2026-10-05")); e.Type != repository.Rescheduled || e.NewQty != scan.NewQty(2) || e.Rgdt == "" {
+			t.Errorf("after Save = %+v", e)
+		}
+
+		must(t, st.Exclusions.Remove(2, d("2026-11-01")))
+		if err := st.Exclusions.Remove(2, d("2026-11-01")); err != repository.ErrNotFound {
+			t.Errorf("second Remove err = %v, want ErrNotFound", err)
+		}
+		if _, err := st.Exclusions.Get(2, d("2026-11-01")); err != repository.ErrNotFound {
+			t.Errorf("Get after Remove err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// receive creates stock of goods in warehouse with one detail per lot
+func receive(t *testing.T, st *repository.Store, stock, goods, warehouse, arrival string, lots ...string) []*repository.StockDetail {
+	t.Helper()
+	var details []*repository.StockDetail
+	for i, l := range lots {
+		details = append(details, &repository.StockDetail{Lot: l, Barcode: fmt.Sprintf("%s-%d", stock, i+1)})
+	}
+	must(t, st.Stock.Create(&repository.Stock{Stock: stock, Goods: goods, Warehouse: warehouse, ArrivalDt: d(arrival)}, details))
+	return details
+}
+
+func detailIDs(list []*repository.StockDetail) []int64 {
+	var ids []int64
+	for _, d := range list {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func TestStock(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		newer := receive(t, st, "S2", "101", "2", "2026-10-10", "L2", "L2")
+		older := receive(t, st, "S1", "101", "2", "2026-10-01", "L1")
+		receive(t, st, "S3", "101", "3", "2026-09-01", "L0")
+
+		avail, err := st.Stock.Available("101", "2", -1)
+		must(t, err)
+		want := []int64{older[0].ID, newer[0].ID, newer[1].ID}
+		if fmt.Sprint(detailIDs(avail)) != fmt.Sprint(want) {
+			t.Errorf("Available = %v, want oldest arrival first %v", detailIDs(avail), want)
+		}
+		if avail, _ := st.Stock.Available("101", "2", 1); len(avail) != 1 {
+			t.Errorf("Available with limit 1 = %d details", len(avail))
+		}
+
+		picked, err := st.Stock.Reserve("101", "2", "T1", "fifo", func(list []*repository.StockDetail) ([]*repository.StockDetail, error) {
+			return list[:2], nil
+		})
+		must(t, err)
+		if fmt.Sprint(detailIDs(picked)) != fmt.Sprint(want[:2]) || !picked[0].TransferFg || picked[0].TransferRef != "T1" {
+			t.Errorf("Reserve = %+v", picked)
+		}
+		if err := st.Stock.MarkTransferred([]int64{newer[0].ID}, "T2", "fifo"); err != repository.ErrConflict {
+			t.Errorf("MarkTransferred of a taken detail err = %v, want ErrConflict", err)
+		}
+		if d, _ := st.Stock.GetDetail(newer[1].ID); d.TransferFg {
+			t.Error("a failed MarkTransferred flagged the free detail")
+		}
+
+		short := errors.New("short")
+		if _, err := st.Stock.Reserve("101", "2", "T3", "fifo", func([]*repository.StockDetail) ([]*repository.StockDetail, error) {
+			return nil, short
+		}); err != short {
+			t.Errorf("Reserve err = %v, want the pick error", err)
+		}
+
+		taken, err := st.Stock.Transferred("T1")
+		must(t, err)
+		if len(taken) != 2 || taken[0].PickStrategy != "fifo" {
+			t.Errorf("Transferred = %+v", taken)
+		}
+		n, err := st.Stock.Release("T1")
+		must(t, err)
+		if n != 2 {
+			t.Errorf("Release = %d, want 2", n)
+		}
+		if d, _ := st.Stock.GetDetail(older[0].ID); d.TransferFg || d.TransferRef != "" || d.PickStrategy != "" {
+			t.Errorf("released detail = %+v", d)
+		}
+
+		found, err := st.Stock.ByBarcode("nope", "S1-1")
+		must(t, err)
+		if found.ID != older[0].ID {
+			t.Errorf("ByBarcode = %d, want %d", found.ID, older[0].ID)
+		}
+		must(t, st.Stock.SetScanState(found.ID, "", repository.ScanReceived))
+		if err := st.Stock.SetScanState(found.ID, "", repository.ScanReceived); err != repository.ErrConflict {
+			t.Errorf("SetScanState from a stale state err = %v, want ErrConflict", err)
+		}
+	})
+}
+
+func TestLedger(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		must(t, st.Ledger.Post([]*repository.LedgerEntry{
+			{Kind: repository.Receipt, Ref: "S1", Goods: "101", Warehouse: "2", Lot: "L1", OnHand: scan.NewQty(3)},
+			{Kind: repository.Receipt, Ref: "S1", Goods: "101", Warehouse: "2", Lot: "L2", OnHand: scan.NewQty(1)},
+		}))
+		must(t, st.Ledger.Post([]*repository.LedgerEntry{
+			{Kind: repository.Sale, Ref: "sales:1", Goods: "101", Warehouse: "2", Reserved: scan.NewQty(2)},
+			{Kind: repository.Adjustment, Goods: "101", Warehouse: "2", Lot: "L1", OnHand: -scan.NewQty(1)},
+		}))
+
+		entries, err := st.Ledger.Entries(repository.LedgerFilter{Ref: "S1"})
+		must(t, err)
+		if len(entries) != 2 || entries[0].ID == 0 || entries[0].ID >= entries[1].ID {
+			t.Errorf("Entries = %+v", entries)
+		}
+		balances, err := st.Ledger.Balances(repository.LedgerFilter{Goods: "101"})
+		must(t, err)
+		var got []string
+		for _, b := range balances {
+			got = append(got, fmt.Sprintf("%s:%s/%s/%s", b.Lot, b.OnHand, b.Reserved, b.InTransit))
+		}
+		if want := "[:0.000/2.000/0.000 L1:2.000/0.000/0.000 L2:1.000/0.000/0.000]"; fmt.Sprint(got) != want {
+			t.Errorf("Balances = %v, want %s", got, want)
+		}
+	})
+}
+
+func TestTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		failed := errors.New("failed")
+		err := st.Tx(func(tx *repository.Store) error {
+			must(t, tx.Goods.Save(&repository.Goods{Goods: "101", Name: "lost"}))
+			receive(t, tx, "S1", "101", "2", "2026-10-01", "L1")
+			must(t, tx.Ledger.Post([]*repository.LedgerEntry{{Kind: repository.Receipt, Ref: "S1", Goods: "101", Warehouse: "2", Lot: "L1", OnHand: scan.NewQty(1)}}))
+			return tx.Tx(func(inner *repository.Store) error {
+				if _, err := inner.Sales.Create(&repository.Sales{Customer: "C1", DeliveryDt: d("2026-10-20")}); err != nil {
+					return err
+				}
+				return failed
+			})
+		})
+		if err != failed {
+			t.Fatalf("Tx err = %v, want %v", err, failed)
+		}
+		if _, err := st.Goods.Get("101"); err != repository.ErrNotFound {
+			t.Errorf("goods after rollback: err = %v", err)
+		}
+		if list, _ := st.Stock.Available("101", "2", -1); len(list) != 0 {
+			t.Errorf("stock after rollback = %+v", list)
+		}
+		if list, _ := st.Sales.List(repository.SalesFilter{}); len(list) != 0 {
+			t.Errorf("sales after rollback = %+v", list)
+		}
+		if list, _ := st.Ledger.Balances(repository.LedgerFilter{}); len(list) != 0 {
+			t.Errorf("balances after rollback = %+v", list)
+		}
+
+		var id int64
+		must(t, st.Tx(func(tx *repository.Store) error {
+			must(t, tx.Goods.Save(&repository.Goods{Goods: "101", Name: "kept"}))
+			receive(t, tx, "S1", "101", "2", "2026-10-01", "L1")
+			var err error
+			id, err = tx.Sales.Create(&repository.Sales{Customer: "C1", DeliveryDt: d("2026-10-20")})
+			return err
+		}))
+		if g, err := st.Goods.Get("101"); err != nil || g.Name != "kept" {
+			t.Errorf("goods after commit = %+v, %v", g, err)
+		}
+		if list, _ := st.Stock.Available("101", "2", -1); len(list) != 1 {
+			t.Errorf("stock after commit = %+v", list)
+		}
+		if _, err := st.Sales.Get(id); err != nil {
+			t.Errorf("sales %d after commit: %v", id, err)
+		}
+	})
+}
+
+// TestTxFailedMethod checks that a repository method failing inside Tx
+// undoes its own writes even when fn carries on
+func TestTxFailedMethod(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		details := receive(t, st, "S1", "101", "2", "2026-10-01", "L1", "L1")
+		free, taken := details[0].ID, details[1].ID
+		must(t, st.Stock.MarkTransferred([]int64{taken}, "T1", "fifo"))
+
+		must(t, st.Tx(func(tx *repository.Store) error {
+			if err := tx.Stock.MarkTransferred([]int64{free, taken}, "T2", "fifo"); err != repository.ErrConflict {
+				t.Errorf("MarkTransferred err = %v, want ErrConflict", err)
+			}
+			return nil
+		}))
+		if d, _ := st.Stock.GetDetail(free); d.TransferFg || d.TransferRef != "" {
+			t.Errorf("the failed MarkTransferred kept %+v", d)
+		}
+	})
+}
+
+// TestMemoryConcurrent is meant for -race: the memory store is shared by
+// the goroutines of the API and the jobs
+func TestMemoryConcurrent(t *testing.T) {
+	st := repository.NewMemory()
+	receive(t, st, "S1", "101", "2", "2026-10-01", "L1", "L1", "L1", "L1", "L1", "L1", "L1", "L1")
+
+	var wg sync.WaitGroup
+	taken := make(chan int64, 8)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := st.Sales.Create(&repository.Sales{Customer: "C1", DeliveryDt: d("2026-10-20")}); err != nil {
+				t.Error(err)
+			}
+			if _, err := st.Sales.List(repository.SalesFilter{Customer: "C1"}); err != nil {
+				t.Error(err)
+			}
+			picked, err := st.Stock.Reserve("101", "2", fmt.Sprint("T", i), "fifo", func(list []*repository.StockDetail) ([]*repository.StockDetail, error) {
+				if len(list) == 0 {
+					return nil, nil
+				}
+				return list[:1], nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			for _, d := range picked {
+				taken <- d.ID
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(taken)
+
+	seen := make(map[int64]bool)
+	for id := range taken {
+		if seen[id] {
+			t.Errorf("detail %d taken twice", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != 8 {
+		t.Errorf("%d details taken, want all 8", len(seen))
+	}
+	if list, _ := st.Sales.List(repository.SalesFilter{}); len(list) != 16 {
+		t.Errorf("%d sales, want 16", len(list))
+	}
+}
@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+// Sales is a yc_sales row
+type Sales struct {
+	Sales             int64      `db:"sales"`
+	Class             int        `db:"class"`
+	Customer          string     `db:"customer"`
+	Name              string     `db:"name"`
+	Goods             string     `db:"goods"`
+	Qty               scan.Qty   `db:"qty"`
+	ShipAddr          string     `db:"ship_addr"`
+	CarsTank          string     `db:"cars_tank"`
+	OutgoingWarehouse string     `db:"outgoing_warehouse"`
+	UseStock          int        `db:"use_stock"`
+	DeliveryDt        civil.Date `db:"delivery_dt"`
+	ArrivalDt         civil.Date `db:"arrival_dt"`
+	RepeatFg          bool       `db:"repeat_fg"`
+	BaseSales         int64      `db:"base_sales"`
+	LotFg             bool       `db:"lot_fg"`
+	Status            int        `db:"status"`
+	Remark            string     `db:"remark"`
+	Rgdt              string     `db:"rgdt"`
+	Updt              string     `db:"updt"`
+	Upuser            string     `db:"upuser"`
+}
+
+// Goods is a yc_goods row
+type Goods struct {
+	Goods        string   `db:"goods"`
+	Name         string   `db:"name"`
+	Qty          scan.Qty `db:"qty"`
+	SeparatelyFg bool     `db:"separately_fg"`
+	Rgdt         string   `db:"rgdt"`
+	Updt         string   `db:"updt"`
+}
+
+// Customer is a yc_customer row
+type Customer struct {
+	Customer string `db:"customer"`
+	Name     string `db:"name"`
+	Pref     string `db:"pref"`
+	Rgdt     string `db:"rgdt"`
+	Updt     string `db:"updt"`
+}
+
+// CustomerDetail is a yc_customer_detail row (one per tank). Level is the
+// level read on LevelDt and DailyUse what the customer uses per day; a
+// zero Capacity is unknown.
+type CustomerDetail struct {
+	Customer string     `db:"customer"`
+	Detail   int        `db:"detail"`
+	Tank     string     `db:"tank"`
+	Capacity scan.Qty   `db:"capacity"`
+	DailyUse scan.Qty   `db:"daily_use"`
+	Level    scan.Qty   `db:"level"`
+	LevelDt  civil.Date `db:"level_dt"`
+	Updt     string     `db:"updt"`
+}
+
+// GoodsOverride is a yc_goods_override row: an administrator let sales
+// order goods not assigned to the customer, for Reason. Action is how the
+// sales came to be: created, updated or materialized from a repeat.
+type GoodsOverride struct {
+	ID       int64  `db:"id"`
+	Customer string `db:"customer"`
+	Goods    string `db:"goods"`
+	Sales    int64  `db:"sales"`
+	Action   string `db:"action"`
+	Reason   string `db:"reason"`
+	Rgdt     string `db:"rgdt"`
+	Upuser   string `db:"upuser"`
+}
+
+// LotSlot is a yc_goods_detail row: the part of a sales delivered from one
+// lot into one tank. Order is the sales.
+type LotSlot struct {
+	ID     int64    `db:"id"`
+	Order  int64    `db:"order"`
+	Slot   int      `db:"slot"`
+	Goods  string   `db:"goods"`
+	Lot    string   `db:"lot"`
+	Tank   string   `db:"tank"`
+	Qty    scan.Qty `db:"qty"`
+	Rgdt   string   `db:"rgdt"`
+	Updt   string   `db:"updt"`
+	Upuser string   `db:"upuser"`
+}
+
+// Repeat is a yc_schedule_repeat row joined with the sales it repeats
+type Repeat struct {
+	Repeat            int64      `db:"repeat"`
+	Sales             int64      `db:"sales"`
+	Period            int        `db:"period"`
+	Span              int        `db:"span"`
+	DayOfWeek         string     `db:"day_of_week"`
+	RRule             string     `db:"rrule"`
+	RollPolicy        int        `db:"roll_policy"`
+	RepeatSDt         civil.Date `db:"repeat_s_dt"`
+	RepeatEDt         civil.Date `db:"repeat_e_dt"`
+	ParentRepeat      int64      `db:"parent_repeat"`
+	RepeatQty         scan.Qty   `db:"repeat_qty"`
+	Class             int        `db:"class"`
+	Customer          string     `db:"customer"`
+	CustomerName      string     `db:"customer_name"`
+	Goods             string     `db:"goods"`
+	GoodsName         string     `db:"goods_name"`
+	Qty               scan.Qty   `db:"qty"`
+	ShipAddr          string     `db:"ship_addr"`
+	OutgoingWarehouse string     `db:"outgoing_warehouse"`
+	Status            int        `db:"status"`
+	RepeatFg          bool       `db:"repeat_fg"`
+}
+
+// DeliveryQty is the quantity of each occurrence: RepeatQty when a "this
+// and following" change set one, else the quantity of the repeated sales
+func (r *Repeat) DeliveryQty() scan.Qty {
+	if r.RepeatQty != 0 {
+		return r.RepeatQty
+	}
+	return r.Qty
+}
+
+// RepeatPause is a yc_repeat_pause row: no deliveries from PauseSDt to
+// PauseEDt. A zero PauseEDt means paused until resumed.
+type RepeatPause struct {
+	Repeat   int64      `db:"repeat"`
+	PauseSDt civil.Date `db:"pause_s_dt"`
+	PauseEDt civil.Date `db:"pause_e_dt"`
+	Reason   string     `db:"reason"`
+	Rgdt     string     `db:"rgdt"`
+	Upuser   string     `db:"upuser"`
+}
+
+// Contains reports whether d is in the pause
+func (p *RepeatPause) Contains(d civil.Date) bool {
+	return inRange(d, p.PauseSDt, p.PauseEDt)
+}
+
+// RepeatVersion is a yc_repeat_version row: one change to a repeat
+type RepeatVersion struct {
+	Repeat      int64      `db:"repeat"`
+	Version     int        `db:"version"`
+	Action      string     `db:"action"`
+	EffectiveDt civil.Date `db:"effective_dt"`
+	Detail      string     `db:"detail"`
+	Reason      string     `db:"reason"`
+	Rgdt        string     `db:"rgdt"`
+	Upuser      string     `db:"upuser"`
+}
+
+// ExclusionType is yc_repeat_exclude.type
+type ExclusionType int
+
+const (
+	// Confirmed occurrences were registered as sales of their own
+	Confirmed ExclusionType = 0
+	// Skipped occurrences are cancelled
+	Skipped ExclusionType = 1
+	// Rescheduled occurrences are delivered on NewDeliveryDt, with NewQty
+	// when it is not zero
+	Rescheduled ExclusionType = 2
+)
+
+func (t ExclusionType) String() string {
+	switch t {
+	case Confirmed:
+		return "confirmed"
+	case Skipped:
+		return "skipped"
+	case Rescheduled:
+		return "rescheduled"
+	}
+	return "unknown"
+}
+
+// Exclusion is a yc_repeat_exclude row: an occurrence of a repeat, keyed
+// by the repeated sales and its planned delivery date, that must not be
+// shown as a projected delivery as is
+type Exclusion struct {
+	Sales         int64         `db:"sales"`
+	DeliveryDt    civil.Date    `db:"delivery_dt"`
+	Type          ExclusionType `db:"type"`
+	Reason        string        `db:"reason"`
+	NewDeliveryDt civil.Date    `db:"new_delivery_dt"`
+	NewQty        scan.Qty      `db:"new_qty"`
+	Rgdt          string        `db:"rgdt"`
+	Updt          string        `db:"updt"`
+	Upuser        string        `db:"upuser"`
+}
+
+// MaterializeLog is a yc_materialize_log row: what one run of the
+// materialization job did, or would have done, with one occurrence
+type MaterializeLog struct {
+	ID         int64      `db:"id"`
+	RunAt      string     `db:"run_at"`
+	DryRun     bool       `db:"dry_run"`
+	BaseSales  int64      `db:"base_sales"`
+	Repeat     int64      `db:"repeat"`
+	DeliveryDt civil.Date `db:"delivery_dt"`
+	Sales      int64      `db:"sales"`
+	Status     string     `db:"status"`
+	Message    string     `db:"message"`
+}
+
+// Stock is a yc_stock row: one receipt of goods into a warehouse
+type Stock struct {
+	Stock      string     `db:"stock"`
+	Goods      string     `db:"goods"`
+	Warehouse  string     `db:"warehouse"`
+	Qty        scan.Qty   `db:"qty"`
+	ArrivalDt  civil.Date `db:"arrival_dt"`
+	TransferFg bool       `db:"transfer_fg"`
+}
+
+// StockDetail is a yc_stock_detail row joined with its yc_stock header
+type StockDetail struct {
+	ID         int64      `db:"id"`
+	Stock      string     `db:"stock"`
+	Goods      string     `db:"goods"`
+	Warehouse  string     `db:"warehouse"`
+	ArrivalDt  civil.Date `db:"arrival_dt"`
+	Lot        string     `db:"lot"`
+	Barcode    string     `db:"barcode"`
+	ExpiryDt   civil.Date `db:"expiry_dt"`
+	TransferFg bool       `db:"transfer_fg"`
+	// PickStrategy names the picking strategy that took the detail for a
+	// transfer
+	PickStrategy string `db:"pick_strategy"`
+	// TransferRef is the stock number of the transfer that took the detail
+	TransferRef string `db:"transfer_ref"`
+	// ScanState is the last scan the detail passed: one of the ScanState
+	// constants, or "" before its first scan
+	ScanState ScanState `db:"scan_state"`
+}
+
+// ScanState is yc_stock_detail.scan_state
+type ScanState string
+
+// A detail is received into a warehouse, picked for a transfer or sales,
+// loaded onto the truck and delivered, in that order
+const (
+	ScanReceived  ScanState = "received"
+	ScanPicked    ScanState = "picked"
+	ScanLoaded    ScanState = "loaded"
+	ScanDelivered ScanState = "delivered"
+)
+
+// StockScan is a yc_stock_scan row: one scan by the handheld and whether
+// it was accepted. Detail is 0 when the barcode matched no stock detail.
+type StockScan struct {
+	ID        int64     `db:"id"`
+	Detail    int64     `db:"detail"`
+	Barcode   string    `db:"barcode"`
+	Action    string    `db:"action"`
+	Ref       string    `db:"ref"`
+	StateFrom ScanState `db:"state_from"`
+	StateTo   ScanState `db:"state_to"`
+	Result    string    `db:"result"`
+	Message   string    `db:"message"`
+	Rgdt      string    `db:"rgdt"`
+	Upuser    string    `db:"upuser"`
+}
+
+// TransferCancel is a yc_transfer_cancel row: who cancelled a transfer,
+// why, and how many stock details it gave back
+type TransferCancel struct {
+	ID       int64  `db:"id"`
+	Stock    string `db:"stock"`
+	Released int    `db:"released"`
+	Reason   string `db:"reason"`
+	Rgdt     string `db:"rgdt"`
+	Upuser   string `db:"upuser"`
+}
+
+// MovementKind is yc_stock_ledger.kind
+type MovementKind string
+
+const (
+	// Receipt is goods arriving in a warehouse
+	Receipt MovementKind = "receipt"
+	// TransferOut takes goods off the hand of the sending warehouse
+	TransferOut MovementKind = "transfer_out"
+	// Transit puts the goods of a transfer in transit to the receiving
+	// warehouse
+	Transit MovementKind = "transit"
+	// TransferIn takes goods out of transit into the hand of the receiving
+	// warehouse
+	TransferIn MovementKind = "transfer_in"
+	// Sale reserves stock for a sales, or ships it
+	Sale MovementKind = "sale"
+	// Adjustment corrects a balance after a count
+	Adjustment MovementKind = "adjustment"
+	// Cancel reverses an earlier entry, named by CancelOf
+	Cancel MovementKind = "cancel"
+)
+
+// LedgerEntry is a yc_stock_ledger row: one movement of goods of one lot in
+// one warehouse. OnHand, Reserved and InTransit are the changes it makes to
+// the balance. Ref is what caused the movement, such as a stock number or
+// "sales:<id>".
+type LedgerEntry struct {
+	ID        int64        `db:"id"`
+	Kind      MovementKind `db:"kind"`
+	Ref       string       `db:"ref"`
+	Goods     string       `db:"goods"`
+	Warehouse string       `db:"warehouse"`
+	Lot       string       `db:"lot"`
+	OnHand    scan.Qty     `db:"on_hand"`
+	Reserved  scan.Qty     `db:"reserved"`
+	InTransit scan.Qty     `db:"in_transit"`
+	CancelOf  int64        `db:"cancel_of"`
+	Reason    string       `db:"reason"`
+	Rgdt      string       `db:"rgdt"`
+	Upuser    string       `db:"upuser"`
+}
+
+// StockBalance is a yc_stock_balance row: the sum of the ledger for one
+// goods, warehouse and lot
+type StockBalance struct {
+	Goods     string   `db:"goods"`
+	Warehouse string   `db:"warehouse"`
+	Lot       string   `db:"lot"`
+	OnHand    scan.Qty `db:"on_hand"`
+	Reserved  scan.Qty `db:"reserved"`
+	InTransit scan.Qty `db:"in_transit"`
+	Updt      string   `db:"updt"`
+}
+
+// Available is the stock on hand that is not reserved
+func (b *StockBalance) Available() scan.Qty {
+	return b.OnHand - b.Reserved
+}
+
+// Warehouse is a yc_warehouse row. SourceFg warehouses hold stock that
+// transfers take from; DestinationFg warehouses receive transfers; BulkFg
+// warehouses can handle bulk (tank lorry) goods.
+type Warehouse struct {
+	Warehouse     string `db:"warehouse"`
+	Name          string `db:"name"`
+	SourceFg      bool   `db:"source_fg"`
+	DestinationFg bool   `db:"destination_fg"`
+	BulkFg        bool   `db:"bulk_fg"`
+	Rgdt          string `db:"rgdt"`
+	Updt          string `db:"updt"`
+}
+
+// WarehouseRoute is a yc_warehouse_route row: transfers to To may take
+// stock from From. The active route with the lowest Priority wins.
+type WarehouseRoute struct {
+	From     string `db:"from_warehouse"`
+	To       string `db:"to_warehouse"`
+	Priority int    `db:"priority"`
+	ActiveFg bool   `db:"active_fg"`
+	Rgdt     string `db:"rgdt"`
+	Updt     string `db:"updt"`
+}
+
+// StockThreshold is a yc_stock_threshold row: the stock of goods in a
+// warehouse should not fall below MinQty, and a reorder or transfer should
+// bring it back to TargetQty
+type StockThreshold struct {
+	Goods     string   `db:"goods"`
+	Warehouse string   `db:"warehouse"`
+	MinQty    scan.Qty `db:"min_qty"`
+	TargetQty scan.Qty `db:"target_qty"`
+	Rgdt      string   `db:"rgdt"`
+	Updt      string   `db:"updt"`
+	Upuser    string   `db:"upuser"`
+}
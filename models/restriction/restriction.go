@@ -0,0 +1,132 @@
+// Package restriction keeps customers to the goods assigned to them in
+// yc_customer_goods.
+//
+// A sales for goods the customer is not assigned is refused when it is
+// created, when an update changes its customer or goods, and when a repeat
+// is materialized. What a customer with no goods assigned at all may
+// order is the Checker's Unassigned policy: by default any goods, as
+// customers registered before the assignment was kept have none.
+//
+// An administrator may let such a sales through by giving a reason. Every
+// override is recorded in yc_goods_override; the repeats of an overridden
+// sales inherit its override, and each materialized sales is recorded in
+// turn.
+package restriction
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+)
+
+// How a sales came to be, as recorded in yc_goods_override.action
+const (
+	ActionCreate      = "create"
+	ActionUpdate      = "update"
+	ActionMaterialize = "materialize"
+)
+
+var (
+	// ErrNotAssigned is wrapped when the goods is not assigned to the
+	// customer
+	ErrNotAssigned = errors.New("restriction: goods not assigned to the customer")
+	// ErrNotAdmin is returned when someone other than an administrator
+	// asks to override
+	ErrNotAdmin = errors.New("restriction: only administrators may order unassigned goods")
+)
+
+// Override is who asks to let a sales through and why. A blank Reason asks
+// for no override.
+type Override struct {
+	Admin  bool
+	Reason string
+	User   string
+}
+
+// UnassignedPolicy is what a customer with no goods assigned may order
+type UnassignedPolicy int
+
+const (
+	// AnyGoods lets the customer order any goods. It is the default, as
+	// customers registered before the assignment was kept have none.
+	AnyGoods UnassignedPolicy = iota
+	// NoGoods refuses every goods, as if none were assigned on purpose;
+	// an administrator can still override
+	NoGoods
+)
+
+// Checker checks the goods of sales against yc_customer_goods
+type Checker struct {
+	Store *repository.Store
+	// Unassigned is what a customer with no goods assigned may order
+	Unassigned UnassignedPolicy
+}
+
+// Allowed reports whether customer may order goods: one of the goods
+// assigned to it, or what the Unassigned policy allows when none are
+func (c *Checker) Allowed(customer, goods string) (bool, error) {
+	codes, err := c.Store.Customers.GoodsCodes(customer)
+	if err != nil {
+		return false, err
+	}
+	if len(codes) == 0 {
+		return c.Unassigned == AnyGoods, nil
+	}
+	for _, code := range codes {
+		if code == goods {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Check checks that s orders goods assigned to its customer. When it does
+// not and by overrides, it returns the override to record with Record once
+// the sales has its number.
+func (c *Checker) Check(s *repository.Sales, action string, by Override) (*repository.GoodsOverride, error) {
+	ok, err := c.Allowed(s.Customer, s.Goods)
+	if err != nil || ok {
+		return nil, err
+	}
+	reason := strings.TrimSpace(by.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("%w: %s for %s", ErrNotAssigned, s.Goods, s.Customer)
+	}
+	if !by.Admin {
+		return nil, ErrNotAdmin
+	}
+	return &repository.GoodsOverride{
+		Customer: s.Customer,
+		Goods:    s.Goods,
+		Sales:    s.Sales,
+		Action:   action,
+		Reason:   reason,
+		Upuser:   by.User,
+	}, nil
+}
+
+// Record writes override o of sales; a nil o records nothing
+func (c *Checker) Record(o *repository.GoodsOverride, sales int64) error {
+	if o == nil {
+		return nil
+	}
+	o.Sales = sales
+	return c.Store.Customers.AddOverride(o)
+}
+
+// Inherited returns the override that let base order its goods, or nil.
+// Occurrences of a repeat of base order the same goods under it.
+func (c *Checker) Inherited(base *repository.Sales) (*repository.GoodsOverride, error) {
+	overrides, err := c.Store.Customers.Overrides(base.Customer)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(overrides) - 1; i >= 0; i-- {
+		if o := overrides[i]; o.Sales == base.Sales && o.Goods == base.Goods {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,39 @@
+package restriction_test
+
+import (
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/restriction"
+)
+
+func TestAllowed(t *testing.T) {
+	store := repository.NewMemory()
+	if err := store.Customers.SetGoodsCodes("C1", []string{"101"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		unassigned restriction.UnassignedPolicy
+		customer   string
+		goods      string
+		want       bool
+	}{
+		{"assigned goods", restriction.AnyGoods, "C1", "101", true},
+		{"other goods", restriction.AnyGoods, "C1", "102", false},
+		{"no goods assigned, any goods", restriction.AnyGoods, "C2", "102", true},
+		{"assigned goods, no goods policy", restriction.NoGoods, "C1", "101", true},
+		{"no goods assigned, no goods policy", restriction.NoGoods, "C2", "102", false},
+	}
+	for _, tt := range tests {
+		c := &restriction.Checker{Store: store, Unassigned: tt.unassigned}
+		got, err := c.Allowed(tt.customer, tt.goods)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Allowed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package scan
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// dateLayouts are the formats MySQL returns for DATE and DATETIME columns
+// when the driver is not configured with parseTime. They are read in the
+// business timezone, as rgdt and updt are written in it.
+var dateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02",
+}
+
+// assign stores a normalized column value into a struct field.
+func assign(f reflect.Value, v interface{}) error {
+	if f.CanAddr() && f.Addr().Type().Implements(scannerType) {
+		return f.Addr().Interface().(sql.Scanner).Scan(v)
+	}
+
+	if f.Kind() == reflect.Ptr {
+		if v == nil {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		p := reflect.New(f.Type().Elem())
+		if err := assign(p.Elem(), v); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	if v == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+
+	if f.Type() == timeType {
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(toString(v))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt(v)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := toInt(v)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("negative value %d for unsigned field", n)
+		}
+		f.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Bool:
+		b, err := toBool(v)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Interface:
+		f.Set(reflect.ValueOf(v))
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case time.Time:
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(v)
+}
+
+func toInt(v interface{}) (int64, error) {
+	switch t := v.(type) {
+	case int64:
+		return t, nil
+	case float64:
+		return int64(t), nil
+	case bool:
+		if t {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		s := strings.TrimSpace(t)
+		if s == "" {
+			return 0, nil
+		}
+		// DECIMAL columns holding whole numbers arrive as "6.000".
+		if i := strings.IndexByte(s, '.'); i >= 0 && strings.Trim(s[i+1:], "0") == "" {
+			s = s[:i]
+		}
+		return strconv.ParseInt(s, 10, 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to int", v)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case int64:
+		return float64(t), nil
+	case string:
+		if strings.TrimSpace(t) == "" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(strings.TrimSpace(t), 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to float", v)
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch t := v.(type) {
+	case bool:
+		return t, nil
+	case int64:
+		return t != 0, nil
+	case string:
+		switch strings.TrimSpace(t) {
+		case "", "0", "false":
+			return false, nil
+		case "1", "true":
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("cannot convert %v to bool", v)
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		for _, layout := range dateLayouts {
+			if tm, err := time.ParseInLocation(layout, t, civil.Location()); err == nil {
+				return tm, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as date", t)
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to time", v)
+}
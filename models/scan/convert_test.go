@@ -0,0 +1,25 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+)
+
+func TestToTimeUsesBusinessZone(t *testing.T) {
+	defer civil.SetLocation(nil)
+	civil.SetLocation(time.FixedZone("JST", 9*60*60))
+
+	got, err := toTime("2026-10-19 00:30:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 10, 18, 15, 30, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("toTime = %v, want %v", got, want)
+	}
+	if _, off := got.Zone(); off != 9*60*60 {
+		t.Errorf("toTime zone offset = %d, want +09:00", off)
+	}
+}
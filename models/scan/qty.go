@@ -0,0 +1,125 @@
+package scan
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// QtyScale is the number of fractional digits kept by Qty. DECIMAL
+// quantities are stored in tons with kilogram precision.
+const QtyScale = 3
+
+const qtyUnit = 1000
+
+// Qty is a DECIMAL quantity held as an integer number of thousandths so it
+// can be summed and compared without floating point error.
+type Qty int64
+
+// NewQty returns a Qty for a whole number of units.
+func NewQty(units int64) Qty {
+	return Qty(units * qtyUnit)
+}
+
+// ParseQty parses a decimal string such as "6", "6.5" or "-0.250".
+func ParseQty(s string) (Qty, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	in := s
+	neg := strings.HasPrefix(s, "-")
+	if neg || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	// One optional sign, then digits: "--5", "6.-5" and "." are not
+	// quantities
+	if whole+frac == "" || !digits(whole) || !digits(frac) {
+		return 0, fmt.Errorf("scan: invalid quantity %q", in)
+	}
+	if len(frac) > QtyScale {
+		if strings.Trim(frac[QtyScale:], "0") != "" {
+			return 0, fmt.Errorf("scan: %q has more than %d decimal places", in, QtyScale)
+		}
+		frac = frac[:QtyScale]
+	}
+	frac += strings.Repeat("0", QtyScale-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("scan: invalid quantity %q", in)
+	}
+	f, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("scan: invalid quantity %q", in)
+	}
+	q := Qty(w*qtyUnit + f)
+	if neg {
+		q = -q
+	}
+	return q, nil
+}
+
+// digits reports whether s holds only ASCII digits; "" does
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Scan implements sql.Scanner.
+func (q *Qty) Scan(src interface{}) error {
+	switch t := src.(type) {
+	case nil:
+		*q = 0
+	case int64:
+		*q = NewQty(t)
+	case float64:
+		*q = Qty(math.Round(t * qtyUnit))
+	case []byte:
+		return q.Scan(string(t))
+	case string:
+		v, err := ParseQty(t)
+		if err != nil {
+			return err
+		}
+		*q = v
+	default:
+		return fmt.Errorf("scan: cannot convert %T to Qty", src)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer, writing the DECIMAL string form.
+func (q Qty) Value() (driver.Value, error) {
+	return q.String(), nil
+}
+
+// String formats q with QtyScale decimal places, e.g. "6.000".
+func (q Qty) String() string {
+	sign := ""
+	v := int64(q)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%03d", sign, v/qtyUnit, v%qtyUnit)
+}
+
+// Float64 returns q as a float for display.
+func (q Qty) Float64() float64 {
+	return float64(q) / qtyUnit
+}
@@ -0,0 +1,51 @@
+package scan
+
+import "testing"
+
+func TestParseQty(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Qty
+	}{
+		{"", 0},
+		{"6", 6000},
+		{"6.5", 6500},
+		{" 6.500 ", 6500},
+		{"-0.250", -250},
+		{"+1.2", 1200},
+		{".5", 500},
+		{"5.", 5000},
+		{"6.0000", 6000},
+	}
+	for _, tt := range tests {
+		got, err := ParseQty(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseQty(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseQtyMalformed(t *testing.T) {
+	for _, in := range []string{
+		"--5",
+		"+-5",
+		"-+5",
+		"6.-5",
+		"6.+5",
+		"6-5",
+		"-",
+		"+",
+		".",
+		"-.",
+		"1.2.3",
+		"1e3",
+		"0x10",
+		"6.0001",
+		"１",
+		"6 t",
+	} {
+		if got, err := ParseQty(in); err == nil {
+			t.Errorf("ParseQty(%q) = %d, want an error", in, got)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package scan
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// zeroDates are the MySQL "zero" date values. They are read as NULL.
+var zeroDates = map[string]bool{
+	"0000-00-00":          true,
+	"0000-00-00 00:00:00": true,
+}
+
+// Maps reads every remaining row into a map keyed by column name.
+// When a column name appears more than once (e.g. "c.*, cd.*") the last
+// one wins, matching the PHP associative arrays these queries came from.
+func Maps(rows *sql.Rows) ([]map[string]interface{}, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []map[string]interface{}
+	for rows.Next() {
+		vals, err := scanValues(rows, len(cols))
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			m[col] = vals[i]
+		}
+		ret = append(ret, m)
+	}
+
+	return ret, rows.Err()
+}
+
+// Map reads the next row into a map. It returns nil when there are no rows.
+func Map(rows *sql.Rows) (map[string]interface{}, error) {
+	list, err := Maps(rows)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+// Structs reads every remaining row into dest, which must be a pointer to a
+// slice of structs or struct pointers. Columns are matched to fields by the
+// `db` tag, falling back to the lower-cased field name. Columns without a
+// matching field are ignored.
+func Structs(rows *sql.Rows, dest interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.Elem().Kind() != reflect.Slice {
+		return errors.New("scan: dest must be a pointer to a slice")
+	}
+	slice := dv.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if isPtr {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return errors.New("scan: slice element must be a struct")
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	index := fieldIndex(structType)
+
+	for rows.Next() {
+		vals, err := scanValues(rows, len(cols))
+		if err != nil {
+			return err
+		}
+		item := reflect.New(structType)
+		if err := assignStruct(item.Elem(), index, cols, vals); err != nil {
+			return err
+		}
+		if isPtr {
+			slice.Set(reflect.Append(slice, item))
+		} else {
+			slice.Set(reflect.Append(slice, item.Elem()))
+		}
+	}
+
+	return rows.Err()
+}
+
+// Struct reads the next row into dest, which must be a pointer to a struct.
+// It returns sql.ErrNoRows when there are no rows.
+func Struct(rows *sql.Rows, dest interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.Elem().Kind() != reflect.Struct {
+		return errors.New("scan: dest must be a pointer to a struct")
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	vals, err := scanValues(rows, len(cols))
+	if err != nil {
+		return err
+	}
+
+	return assignStruct(dv.Elem(), fieldIndex(dv.Elem().Type()), cols, vals)
+}
+
+// scanValues scans the current row and normalizes driver values:
+// []byte becomes string, and zero dates become nil.
+func scanValues(rows *sql.Rows, n int) ([]interface{}, error) {
+	vals := make([]interface{}, n)
+	ptrs := make([]interface{}, n)
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		vals[i] = normalize(v)
+	}
+	return vals, nil
+}
+
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []byte:
+		s := string(t)
+		if zeroDates[s] {
+			return nil
+		}
+		return s
+	case string:
+		if zeroDates[t] {
+			return nil
+		}
+		return t
+	case time.Time:
+		if t.IsZero() {
+			return nil
+		}
+		return t
+	}
+	return v
+}
+
+// fieldIndex maps column names to struct field indexes.
+func fieldIndex(t reflect.Type) map[string][]int {
+	index := make(map[string][]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for col, sub := range fieldIndex(f.Type) {
+				if _, ok := index[col]; !ok {
+					index[col] = append([]int{i}, sub...)
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.ToLower(f.Name)
+		if tag, ok := f.Tag.Lookup("db"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = strings.Split(tag, ",")[0]
+		}
+		index[name] = []int{i}
+	}
+	return index
+}
+
+func assignStruct(sv reflect.Value, index map[string][]int, cols []string, vals []interface{}) error {
+	for i, col := range cols {
+		fi, ok := index[col]
+		if !ok {
+			continue
+		}
+		if err := assign(sv.FieldByIndex(fi), vals[i]); err != nil {
+			return fmt.Errorf("scan: column %q: %w", col, err)
+		}
+	}
+	return nil
+}
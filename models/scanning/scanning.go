@@ -0,0 +1,347 @@
+// Package scanning checks the stock detail barcodes the handheld scans on
+// the way from receipt to delivery.
+//
+// Every scan names an action: receive, pick, load or deliver. The action
+// moves the scanned detail from one scan state to the next, and is checked
+// against what is being worked on: the transfer the detail must belong to,
+// or the sales whose goods, outgoing warehouse, lots and delivery date it
+// must fit. Lot and expiry on a GS1-128 label must agree with the detail.
+// Everything that does not fit is reported at once in a *MismatchError so
+// the handheld can show it. Every scan, accepted or not, is logged in
+// yc_stock_scan; the receipt of a transferred detail and the delivery of
+// a sales are posted to the stock ledger with it.
+package scanning
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/geeknow112/srv-tools/models/barcode"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/transfer"
+)
+
+// Action is what the handheld scans a detail for
+type Action string
+
+const (
+	Receive Action = "receive"
+	Pick    Action = "pick"
+	Load    Action = "load"
+	Deliver Action = "deliver"
+)
+
+// Results logged in yc_stock_scan
+const (
+	ResultOK       = "ok"
+	ResultMismatch = "mismatch"
+	ResultRejected = "rejected"
+)
+
+var (
+	// ErrUnknownAction is returned for an action other than the four above
+	ErrUnknownAction = errors.New("scanning: unknown action")
+	// ErrUnknownBarcode is wrapped when no stock detail has the barcode
+	ErrUnknownBarcode = errors.New("scanning: no stock detail with the barcode")
+	// ErrNoContext is returned when a pick, load or delivery names neither
+	// a transfer nor a sales
+	ErrNoContext = errors.New("scanning: a transfer or a sales is required")
+	// ErrBothContexts is returned when a scan names a transfer and a sales
+	ErrBothContexts = errors.New("scanning: give either a transfer or a sales, not both")
+	// ErrState is wrapped when the detail is not in a state the action
+	// moves on from
+	ErrState = errors.New("scanning: detail cannot be scanned for this action now")
+)
+
+// transition lists the states an action takes a detail from, and the
+// state it leaves it in. A detail can be picked straight after its
+// receipt was booked without a scan, and a transferred detail is received
+// again at its destination.
+type transition struct {
+	from []repository.ScanState
+	to   repository.ScanState
+}
+
+var transitions = map[Action]transition{
+	Receive: {[]repository.ScanState{"", repository.ScanDelivered}, repository.ScanReceived},
+	Pick:    {[]repository.ScanState{"", repository.ScanReceived}, repository.ScanPicked},
+	Load:    {[]repository.ScanState{repository.ScanPicked}, repository.ScanLoaded},
+	Deliver: {[]repository.ScanState{repository.ScanLoaded}, repository.ScanDelivered},
+}
+
+// Mismatch is one value of a detail that is not what the scan expected
+type Mismatch struct {
+	Field    string
+	Expected string
+	Got      string
+}
+
+// MismatchError lists everything about a scanned detail that does not fit
+// the transfer or sales
+type MismatchError struct {
+	Barcode    string
+	Mismatches []Mismatch
+}
+
+func (e *MismatchError) Error() string {
+	parts := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		parts[i] = fmt.Sprintf("%s: expected %q, got %q", m.Field, m.Expected, m.Got)
+	}
+	return fmt.Sprintf("scanning: %s does not match: %s", e.Barcode, strings.Join(parts, "; "))
+}
+
+// Request is one scan
+type Request struct {
+	Action  Action
+	Barcode string
+	// Transfer is the stock number of the transfer being worked on
+	Transfer string
+	// Sales is the sales being worked on
+	Sales int64
+	// Warehouse is where the handheld is; when given, a picked detail must
+	// be in it
+	Warehouse string
+	User      string
+}
+
+// Result is an accepted scan
+type Result struct {
+	Detail *repository.StockDetail
+	Code   *barcode.Code
+	From   repository.ScanState
+	To     repository.ScanState
+	Scan   *repository.StockScan
+}
+
+// Scanner checks scans and moves details through their scan states
+type Scanner struct {
+	Store *repository.Store
+}
+
+// Scan checks req and moves the scanned detail on, posting what it
+// received or delivered to the ledger. A detail that does not fit returns
+// a *MismatchError, one in the wrong state wraps ErrState, and a detail
+// scanned by two handhelds at once wraps repository.ErrConflict for the
+// slower one.
+func (s *Scanner) Scan(req Request) (*Result, error) {
+	log := &repository.StockScan{Barcode: req.Barcode, Action: string(req.Action), Ref: ref(req), Upuser: req.User}
+
+	t, ok := transitions[req.Action]
+	if !ok {
+		return nil, s.reject(log, fmt.Errorf("%w: %q", ErrUnknownAction, req.Action))
+	}
+	if req.Transfer != "" && req.Sales != 0 {
+		return nil, s.reject(log, ErrBothContexts)
+	}
+	if req.Action != Receive && req.Transfer == "" && req.Sales == 0 {
+		return nil, s.reject(log, ErrNoContext)
+	}
+	code, err := barcode.Parse(req.Barcode)
+	if err != nil {
+		return nil, s.reject(log, err)
+	}
+	d, err := s.Store.Stock.ByBarcode(code.Keys()...)
+	if err == repository.ErrNotFound {
+		return nil, s.reject(log, fmt.Errorf("%w: %q", ErrUnknownBarcode, code.Value))
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Detail, log.StateFrom = d.ID, d.ScanState
+
+	if !allowed(t.from, d.ScanState) {
+		return nil, s.reject(log, fmt.Errorf("%w: cannot %s a detail that is %s", ErrState, req.Action, stateName(d.ScanState)))
+	}
+
+	var mismatches []Mismatch
+	mismatches = append(mismatches, label(code, d)...)
+	switch {
+	case req.Transfer != "":
+		m, err := s.checkTransfer(req, d)
+		if err != nil {
+			return nil, s.reject(log, err)
+		}
+		mismatches = append(mismatches, m...)
+	case req.Sales != 0:
+		m, err := s.checkSales(req, d, code)
+		if err != nil {
+			return nil, s.reject(log, err)
+		}
+		mismatches = append(mismatches, m...)
+	}
+	if req.Action == Pick && req.Warehouse != "" && d.Warehouse != req.Warehouse {
+		mismatches = append(mismatches, Mismatch{"warehouse", req.Warehouse, d.Warehouse})
+	}
+	if len(mismatches) > 0 {
+		err := &MismatchError{Barcode: code.Value, Mismatches: mismatches}
+		log.Result, log.Message = ResultMismatch, err.Error()
+		s.Store.Stock.AddScan(log)
+		return nil, err
+	}
+
+	err = s.Store.Tx(func(tx *repository.Store) error {
+		if err := tx.Stock.SetScanState(d.ID, d.ScanState, t.to); err != nil {
+			return err
+		}
+		if err := post(tx, req, d); err != nil {
+			return err
+		}
+		log.StateTo, log.Result = t.to, ResultOK
+		return tx.Stock.AddScan(log)
+	})
+	if err == repository.ErrConflict {
+		return nil, s.reject(log, fmt.Errorf("%w: %s was scanned meanwhile", err, code.Value))
+	}
+	if err != nil {
+		return nil, err
+	}
+	from := d.ScanState
+	d.ScanState = t.to
+	return &Result{Detail: d, Code: code, From: from, To: t.to, Scan: log}, nil
+}
+
+// post posts the movement of an accepted scan to the ledger: a receipt
+// at the destination of a transfer takes the detail out of transit, and
+// a delivery for a sales ships it. A receipt without a transfer only
+// confirms a detail whose receipt was posted when it was registered.
+func post(tx *repository.Store, req Request, d *repository.StockDetail) error {
+	l := &ledger.Ledger{Store: tx}
+	switch {
+	case req.Action == Receive && req.Transfer != "":
+		// Wait for a cancellation of the transfer running meanwhile
+		if _, err := tx.Stock.LockTransferred(req.Transfer); err != nil {
+			return err
+		}
+		header, err := tx.Stock.GetStock(req.Transfer)
+		if err != nil {
+			return err
+		}
+		_, err = l.ReceiveDetails(req.Transfer, header.Warehouse, []*repository.StockDetail{d}, req.User)
+		return err
+	case req.Action == Deliver && req.Sales != 0:
+		sales, err := tx.Sales.Get(req.Sales)
+		if err != nil {
+			return err
+		}
+		return l.Ship(sales, []*repository.StockDetail{d}, req.User)
+	}
+	return nil
+}
+
+// checkTransfer checks that d was taken by transfer req.Transfer. Only the
+// receipt at the destination may come after the details were given back
+// by a cancellation, so a cancelled transfer fails every other action.
+func (s *Scanner) checkTransfer(req Request, d *repository.StockDetail) ([]Mismatch, error) {
+	header, err := s.Store.Stock.GetStock(req.Transfer)
+	if err != nil {
+		return nil, err
+	}
+	if !header.TransferFg {
+		return nil, fmt.Errorf("%w: %s", transfer.ErrNotTransfer, req.Transfer)
+	}
+	var ret []Mismatch
+	if d.TransferRef != req.Transfer {
+		ret = append(ret, Mismatch{"transfer", req.Transfer, d.TransferRef})
+	}
+	if d.Goods != header.Goods {
+		ret = append(ret, Mismatch{"goods", header.Goods, d.Goods})
+	}
+	if req.Action == Receive && req.Warehouse != "" && req.Warehouse != header.Warehouse {
+		ret = append(ret, Mismatch{"warehouse", header.Warehouse, req.Warehouse})
+	}
+	return ret, nil
+}
+
+// checkSales checks d against the goods, outgoing warehouse, lots and
+// delivery date of sales req.Sales
+func (s *Scanner) checkSales(req Request, d *repository.StockDetail, code *barcode.Code) ([]Mismatch, error) {
+	sales, err := s.Store.Sales.Get(req.Sales)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Mismatch
+	if d.Goods != sales.Goods {
+		ret = append(ret, Mismatch{"goods", sales.Goods, d.Goods})
+	}
+	if sales.OutgoingWarehouse != "" && d.Warehouse != sales.OutgoingWarehouse {
+		ret = append(ret, Mismatch{"warehouse", sales.OutgoingWarehouse, d.Warehouse})
+	}
+	if sales.LotFg {
+		slots, err := s.Store.Lots.Slots(sales.Sales)
+		if err != nil {
+			return nil, err
+		}
+		var lots []string
+		for _, slot := range slots {
+			if slot.Lot != "" {
+				lots = append(lots, slot.Lot)
+			}
+		}
+		if len(lots) > 0 && !contains(lots, d.Lot) {
+			ret = append(ret, Mismatch{"lot", strings.Join(lots, ","), d.Lot})
+		}
+	}
+	useBy := d.ExpiryDt
+	if useBy.IsZero() {
+		useBy = code.UseBy()
+	}
+	if !useBy.IsZero() && !sales.DeliveryDt.IsZero() && useBy.Before(sales.DeliveryDt) {
+		ret = append(ret, Mismatch{"expiry", "on or after " + sales.DeliveryDt.String(), useBy.String()})
+	}
+	return ret, nil
+}
+
+// label checks the lot and expiry printed on a GS1-128 label against the
+// detail they were registered with
+func label(code *barcode.Code, d *repository.StockDetail) []Mismatch {
+	var ret []Mismatch
+	if code.Lot != "" && d.Lot != "" && code.Lot != d.Lot {
+		ret = append(ret, Mismatch{"lot", d.Lot, code.Lot})
+	}
+	if useBy := code.UseBy(); !useBy.IsZero() && !d.ExpiryDt.IsZero() && useBy.Compare(d.ExpiryDt) != 0 {
+		ret = append(ret, Mismatch{"expiry", d.ExpiryDt.String(), useBy.String()})
+	}
+	return ret
+}
+
+// reject logs a scan that was refused and returns err
+func (s *Scanner) reject(log *repository.StockScan, err error) error {
+	log.Result, log.Message = ResultRejected, err.Error()
+	s.Store.Stock.AddScan(log)
+	return err
+}
+
+func ref(req Request) string {
+	if req.Sales != 0 {
+		return ledger.SalesRef(req.Sales)
+	}
+	return req.Transfer
+}
+
+func allowed(from []repository.ScanState, state repository.ScanState) bool {
+	for _, f := range from {
+		if f == state {
+			return true
+		}
+	}
+	return false
+}
+
+func stateName(state repository.ScanState) string {
+	if state == "" {
+		return "not scanned yet"
+	}
+	return "already " + string(state)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package scanning_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/scanning"
+	"github.com/geeknow112/srv-tools/models/transfer"
+)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setup receives three details of goods 101 into warehouse 1, which
+// feeds warehouse 2
+func setup(t *testing.T) *repository.Store {
+	t.Helper()
+	st := repository.NewMemory()
+	must(t, st.Warehouses.Save(&repository.Warehouse{Warehouse: "1", SourceFg: true}))
+	must(t, st.Warehouses.Save(&repository.Warehouse{Warehouse: "2", DestinationFg: true}))
+	must(t, st.Warehouses.SaveRoute(&repository.WarehouseRoute{From: "1", To: "2", Priority: 1, ActiveFg: true}))
+
+	header := &repository.Stock{Stock: "S1", Goods: "101", Warehouse: "1", ArrivalDt: civil.MustParse("2026-10-01")}
+	var details []*repository.StockDetail
+	for i := 1; i <= 3; i++ {
+		details = append(details, &repository.StockDetail{Lot: "L1", Barcode: fmt.Sprint("S1-", i)})
+	}
+	must(t, st.Stock.Create(header, details))
+	must(t, (&ledger.Ledger{Store: st}).Receive(header, details, "test"))
+	return st
+}
+
+func position(t *testing.T, st *repository.Store, warehouse string) ledger.Position {
+	t.Helper()
+	p, err := (&ledger.Ledger{Store: st}).Position("101", warehouse)
+	must(t, err)
+	return p
+}
+
+func TestReceiveTransferPosts(t *testing.T) {
+	st := setup(t)
+	must(t, st.Stock.Create(&repository.Stock{Stock: "T1", Goods: "101", Warehouse: "2", TransferFg: true}, nil))
+	_, err := (&transfer.Service{Store: st}).Send("T1", "101", "1", "2", 2, "test")
+	must(t, err)
+
+	s := &scanning.Scanner{Store: st}
+	_, err = s.Scan(scanning.Request{Action: scanning.Receive, Barcode: "S1-1", Transfer: "T1", User: "test"})
+	must(t, err)
+	if p := position(t, st, "2"); p.OnHand != scan.NewQty(1) || p.InTransit != scan.NewQty(1) {
+		t.Errorf("after one receipt scan: %+v, want 1 on hand and 1 in transit", p)
+	}
+
+	entries, err := (&ledger.Ledger{Store: st}).ReceiveTransfer("T1", "test")
+	must(t, err)
+	if len(entries) != 1 || entries[0].OnHand != scan.NewQty(1) {
+		t.Errorf("ReceiveTransfer booked %+v, want the one detail left", entries)
+	}
+	_, err = s.Scan(scanning.Request{Action: scanning.Receive, Barcode: "S1-2", Transfer: "T1", User: "test"})
+	must(t, err)
+	if p := position(t, st, "2"); p.OnHand != scan.NewQty(2) || p.InTransit != 0 {
+		t.Errorf("scanning a booked detail posted again: %+v", p)
+	}
+}
+
+func TestDeliverShips(t *testing.T) {
+	st := setup(t)
+	sales := &repository.Sales{Customer: "C1", Goods: "101", Qty: scan.NewQty(2), OutgoingWarehouse: "1", DeliveryDt: civil.MustParse("2026-10-21")}
+	_, err := st.Sales.Create(sales)
+	must(t, err)
+	l := &ledger.Ledger{Store: st}
+	must(t, l.Reserve(sales, "test"))
+
+	s := &scanning.Scanner{Store: st}
+	for _, action := range []scanning.Action{scanning.Pick, scanning.Load} {
+		_, err := s.Scan(scanning.Request{Action: action, Barcode: "S1-1", Sales: sales.Sales, User: "test"})
+		must(t, err)
+	}
+	if p := position(t, st, "1"); p.OnHand != scan.NewQty(3) || p.Reserved != scan.NewQty(2) {
+		t.Errorf("picking and loading changed the stock: %+v", p)
+	}
+	_, err = s.Scan(scanning.Request{Action: scanning.Deliver, Barcode: "S1-1", Sales: sales.Sales, User: "test"})
+	must(t, err)
+	if p := position(t, st, "1"); p.OnHand != scan.NewQty(2) || p.Reserved != scan.NewQty(1) {
+		t.Errorf("after one delivery: %+v, want 2 on hand and 1 reserved", p)
+	}
+
+	// Saving the sales again keeps what is still to ship reserved
+	must(t, l.Reserve(sales, "test"))
+	if p := position(t, st, "1"); p.Reserved != scan.NewQty(1) {
+		t.Errorf("Reserve after a delivery: reserved %s, want 1", p.Reserved)
+	}
+}
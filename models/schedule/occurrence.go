@@ -0,0 +1,200 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+var (
+	// ErrNotOccurrence is returned for a date the repeat does not deliver on
+	ErrNotOccurrence = errors.New("schedule: not an occurrence of the repeat")
+	// ErrConfirmed is returned when the occurrence is already a sales
+	ErrConfirmed = errors.New("schedule: occurrence is already confirmed")
+	// ErrNotExcluded is returned by Restore when there is nothing to undo
+	ErrNotExcluded = errors.New("schedule: occurrence is not skipped or rescheduled")
+	// ErrDateTaken is returned when a reschedule targets a date the repeat
+	// already delivers on
+	ErrDateTaken = errors.New("schedule: the repeat already delivers on that date")
+)
+
+// OccurrenceStatus is the state of one occurrence, as listed by Occurrences
+type OccurrenceStatus struct {
+	DeliveryDt    civil.Date `json:"delivery_dt"`
+	PlannedDt     civil.Date `json:"planned_dt"`
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason,omitempty"`
+	NewDeliveryDt civil.Date `json:"new_delivery_dt"`
+	NewQty        string     `json:"new_qty,omitempty"`
+}
+
+// Occurrences skips, reschedules and restores single occurrences of a
+// repeat. The override is stored in yc_repeat_exclude under the repeated
+// sales and the occurrence's delivery date.
+type Occurrences struct {
+	Store    *repository.Store
+	Calendar *calendar.Calendar
+}
+
+// List returns every occurrence of repeat in w with its status
+func (o *Occurrences) List(repeat int64, w Window) ([]OccurrenceStatus, error) {
+	rep, err := o.Store.Repeats.Get(repeat)
+	if err != nil {
+		return nil, err
+	}
+	occs, err := ExpandRepeat(rep, w, o.Calendar)
+	if err != nil {
+		return nil, err
+	}
+	pauses, err := o.Store.Repeats.Pauses(repeat)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []OccurrenceStatus
+	for _, occ := range occs {
+		st := OccurrenceStatus{DeliveryDt: civil.DateOf(occ.Date), PlannedDt: civil.DateOf(occ.Planned), Status: "scheduled"}
+		if isPaused(pauses, st.DeliveryDt) {
+			st.Status = "paused"
+			ret = append(ret, st)
+			continue
+		}
+		e, err := o.Store.Exclusions.Get(rep.Sales, st.DeliveryDt)
+		switch {
+		case err == repository.ErrNotFound:
+		case err != nil:
+			return nil, err
+		default:
+			st.Status = e.Type.String()
+			st.Reason = e.Reason
+			st.NewDeliveryDt = e.NewDeliveryDt
+			if e.NewQty != 0 {
+				st.NewQty = e.NewQty.String()
+			}
+		}
+		ret = append(ret, st)
+	}
+	return ret, nil
+}
+
+// Skip cancels the occurrence of repeat on deliveryDt
+func (o *Occurrences) Skip(repeat int64, deliveryDt civil.Date, reason, user string) (*repository.Exclusion, error) {
+	rep, err := o.editable(repeat, deliveryDt)
+	if err != nil {
+		return nil, err
+	}
+	e := &repository.Exclusion{
+		Sales:      rep.Sales,
+		DeliveryDt: deliveryDt,
+		Type:       repository.Skipped,
+		Reason:     reason,
+		Upuser:     user,
+	}
+	if err := o.Store.Exclusions.Save(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reschedule moves the occurrence of repeat on deliveryDt to newDt. A zero
+// newDt keeps the date and a zero newQty keeps the quantity.
+func (o *Occurrences) Reschedule(repeat int64, deliveryDt, newDt civil.Date, newQty scan.Qty, reason, user string) (*repository.Exclusion, error) {
+	if newDt.IsZero() && newQty == 0 {
+		return nil, errors.New("schedule: reschedule needs a new date or quantity")
+	}
+	rep, err := o.editable(repeat, deliveryDt)
+	if err != nil {
+		return nil, err
+	}
+	if newDt.IsZero() {
+		newDt = deliveryDt
+	}
+	if newDt != deliveryDt {
+		taken, err := o.isOccurrence(rep, newDt)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, fmt.Errorf("%w: %s", ErrDateTaken, newDt)
+		}
+	}
+
+	e := &repository.Exclusion{
+		Sales:         rep.Sales,
+		DeliveryDt:    deliveryDt,
+		Type:          repository.Rescheduled,
+		Reason:        reason,
+		NewDeliveryDt: newDt,
+		NewQty:        newQty,
+		Upuser:        user,
+	}
+	if err := o.Store.Exclusions.Save(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Restore undoes a skip or a reschedule
+func (o *Occurrences) Restore(repeat int64, deliveryDt civil.Date) error {
+	rep, err := o.Store.Repeats.Get(repeat)
+	if err != nil {
+		return err
+	}
+	e, err := o.Store.Exclusions.Get(rep.Sales, deliveryDt)
+	if err == repository.ErrNotFound {
+		return ErrNotExcluded
+	}
+	if err != nil {
+		return err
+	}
+	if e.Type == repository.Confirmed {
+		return ErrConfirmed
+	}
+	return o.Store.Exclusions.Remove(rep.Sales, deliveryDt)
+}
+
+// editable loads repeat and checks that deliveryDt is one of its
+// occurrences and not yet confirmed
+func (o *Occurrences) editable(repeat int64, deliveryDt civil.Date) (*repository.Repeat, error) {
+	rep, err := o.Store.Repeats.Get(repeat)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := o.isOccurrence(rep, deliveryDt)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotOccurrence, deliveryDt)
+	}
+
+	e, err := o.Store.Exclusions.Get(rep.Sales, deliveryDt)
+	if err == repository.ErrNotFound {
+		return rep, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Type == repository.Confirmed {
+		return nil, ErrConfirmed
+	}
+	return rep, nil
+}
+
+// isOccurrence reports whether rep delivers on d; a paused date is not an
+// occurrence
+func (o *Occurrences) isOccurrence(rep *repository.Repeat, d civil.Date) (bool, error) {
+	occs, err := ExpandRepeat(rep, Window{From: d.Time(), To: d.Time()}, o.Calendar)
+	if err != nil || len(occs) == 0 {
+		return false, err
+	}
+	pauses, err := o.Store.Repeats.Pauses(rep.Repeat)
+	if err != nil {
+		return false, err
+	}
+	return !isPaused(pauses, d), nil
+}
@@ -0,0 +1,87 @@
+package schedule
+
+import (
+	"sort"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+// PendingOccurrence is an occurrence of a repeat that is neither paused,
+// skipped nor confirmed as a sales yet. Exclusion is set for a rescheduled
+// occurrence, whose override is confirmed in place.
+type PendingOccurrence struct {
+	Repeat     *repository.Repeat
+	DeliveryDt civil.Date
+	Qty        scan.Qty
+	Exclusion  *repository.Exclusion
+}
+
+// Pending lists the pending occurrences of every active repeat from from to
+// to, rescheduled ones on their new date and with their new quantity, by
+// delivery date then repeat. A nil cal means weekends and public holidays
+// only.
+func Pending(store *repository.Store, from, to civil.Date, cal *calendar.Calendar) ([]PendingOccurrence, error) {
+	w, err := NewWindow(from.Time(), to.Time(), to.DaysSince(from)+1)
+	if err != nil {
+		return nil, err
+	}
+	repeats, err := store.Repeats.List(repository.RepeatFilter{})
+	if err != nil {
+		return nil, err
+	}
+	pauses, err := store.Repeats.Pauses(0)
+	if err != nil {
+		return nil, err
+	}
+	byRepeat := PausesByRepeat(pauses)
+	exclusions, err := store.Exclusions.List(from, to)
+	if err != nil {
+		return nil, err
+	}
+	excluded := make(map[int64]map[civil.Date]*repository.Exclusion)
+	moved := make(map[int64][]*repository.Exclusion)
+	for _, e := range exclusions {
+		if excluded[e.Sales] == nil {
+			excluded[e.Sales] = make(map[civil.Date]*repository.Exclusion)
+		}
+		excluded[e.Sales][e.DeliveryDt] = e
+		if e.Type == repository.Rescheduled {
+			moved[e.Sales] = append(moved[e.Sales], e)
+		}
+	}
+
+	var ret []PendingOccurrence
+	for _, rep := range repeats {
+		occs, err := ExpandRepeat(rep, w, cal)
+		if err != nil {
+			return nil, err
+		}
+		for _, occ := range Paused(occs, byRepeat[rep.Repeat]) {
+			d := civil.DateOf(occ.Date)
+			if excluded[rep.Sales][d] != nil {
+				continue
+			}
+			ret = append(ret, PendingOccurrence{Repeat: rep, DeliveryDt: d, Qty: rep.DeliveryQty()})
+		}
+		for _, e := range moved[rep.Sales] {
+			if !MovedIn(w, rep.RepeatSDt, rep.RepeatEDt, e.DeliveryDt, e.NewDeliveryDt, byRepeat[rep.Repeat]) {
+				continue
+			}
+			p := PendingOccurrence{Repeat: rep, DeliveryDt: e.NewDeliveryDt, Qty: rep.DeliveryQty(), Exclusion: e}
+			if e.NewQty != 0 {
+				p.Qty = e.NewQty
+			}
+			ret = append(ret, p)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if c := ret[i].DeliveryDt.Compare(ret[j].DeliveryDt); c != 0 {
+			return c < 0
+		}
+		return ret[i].Repeat.Repeat < ret[j].Repeat.Repeat
+	})
+	return ret, nil
+}
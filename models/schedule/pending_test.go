@@ -0,0 +1,109 @@
+package schedule_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/schedule"
+)
+
+var d = civil.MustParse
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// weekly saves a weekly repeat of sales from sdt to edt
+func weekly(t *testing.T, store *repository.Store, sales int64, sdt, edt string, parent int64) int64 {
+	t.Helper()
+	id, err := store.Repeats.Save(&repository.Repeat{Sales: sales, Period: 1, RepeatSDt: d(sdt), RepeatEDt: d(edt), ParentRepeat: parent})
+	must(t, err)
+	return id
+}
+
+func TestPending(t *testing.T) {
+	store := repository.NewMemory()
+	for _, qty := range []int64{5, 3} {
+		_, err := store.Sales.Create(&repository.Sales{Customer: "C1", Goods: "101", Qty: scan.NewQty(qty), RepeatFg: true, DeliveryDt: d("2026-10-19")})
+		must(t, err)
+	}
+	// Sales 1 is delivered on Mondays, split on Nov 9; sales 2 on Wednesdays
+	a := weekly(t, store, 1, "2026-10-19", "2026-11-08", 0)
+	weekly(t, store, 2, "2026-10-21", "2026-12-31", 0)
+	weekly(t, store, 1, "2026-11-09", "2026-12-31", a)
+
+	must(t, store.Repeats.SavePause(&repository.RepeatPause{Repeat: a, PauseSDt: d("2026-11-04"), PauseEDt: d("2026-11-06")}))
+	for _, e := range []*repository.Exclusion{
+		{Sales: 1, DeliveryDt: d("2026-10-26"), Type: repository.Rescheduled, NewDeliveryDt: d("2026-10-28"), NewQty: scan.NewQty(7)},
+		// moved into the pause of its repeat
+		{Sales: 1, DeliveryDt: d("2026-11-02"), Type: repository.Rescheduled, NewDeliveryDt: d("2026-11-05")},
+		// on the series after the split only
+		{Sales: 1, DeliveryDt: d("2026-11-09"), Type: repository.Rescheduled, NewDeliveryDt: d("2026-11-10")},
+		{Sales: 2, DeliveryDt: d("2026-11-11"), Type: repository.Skipped},
+		// moved out of the window
+		{Sales: 2, DeliveryDt: d("2026-11-04"), Type: repository.Rescheduled, NewDeliveryDt: d("2026-11-18")},
+	} {
+		must(t, store.Exclusions.Save(e))
+	}
+
+	want := []string{
+		"2026-10-19 1 5.000",
+		"2026-10-21 2 3.000",
+		"2026-10-28 1 7.000 moved",
+		"2026-10-28 2 3.000",
+		"2026-11-10 3 5.000 moved",
+	}
+	// Map iteration made the order vary from run to run
+	for run := 0; run < 20; run++ {
+		list, err := schedule.Pending(store, d("2026-10-19"), d("2026-11-15"), nil)
+		must(t, err)
+		var got []string
+		for _, p := range list {
+			s := fmt.Sprintf("%s %d %s", p.DeliveryDt, p.Repeat.Repeat, p.Qty)
+			if p.Exclusion != nil {
+				s += " moved"
+			}
+			got = append(got, s)
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("Pending =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func TestMovedIn(t *testing.T) {
+	w, err := schedule.NewWindow(d("2026-11-01").Time(), d("2026-11-30").Time(), 0)
+	must(t, err)
+	pauses := []*repository.RepeatPause{{PauseSDt: d("2026-11-20")}}
+	tests := []struct {
+		name           string
+		planned, newDt string
+		want           bool
+	}{
+		{"in the window", "2026-11-02", "2026-11-03", true},
+		{"planned before the window", "2026-10-26", "2026-11-03", true},
+		{"out of the window", "2026-11-02", "2026-12-01", false},
+		{"into an open pause", "2026-11-02", "2026-11-24", false},
+		{"planned before the series", "2026-10-01", "2026-11-03", false},
+		{"planned after the series", "2026-12-01", "2026-11-03", false},
+		{"no new date", "2026-11-02", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var newDt civil.Date
+			if tt.newDt != "" {
+				newDt = d(tt.newDt)
+			}
+			if got := schedule.MovedIn(w, d("2026-10-05"), d("2026-11-30"), d(tt.planned), newDt, pauses); got != tt.want {
+				t.Errorf("MovedIn = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/recurrence"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+var (
+	// ErrPaused is returned when a pause overlaps an existing one
+	ErrPaused = errors.New("schedule: the repeat is already paused then")
+	// ErrNotPaused is returned by Resume when no pause covers the date
+	ErrNotPaused = errors.New("schedule: the repeat is not paused on that date")
+	// ErrNoOccurrence is returned by ChangeFrom when the repeat does not
+	// deliver on or after the date
+	ErrNoOccurrence = errors.New("schedule: the repeat has no occurrence from that date")
+)
+
+// yc_repeat_version.action values
+const (
+	ActionPause  = "pause"
+	ActionResume = "resume"
+	ActionEnd    = "end"
+	ActionEdit   = "edit"
+	ActionSplit  = "split"
+	ActionCreate = "create"
+)
+
+// Change is a "this and following" edit. Zero fields are left unchanged.
+type Change struct {
+	RepeatEDt civil.Date
+	Qty       scan.Qty
+}
+
+// Series pauses, resumes and edits whole repeats. Every change is
+// recorded in yc_repeat_version with its reason and user.
+type Series struct {
+	Store *repository.Store
+}
+
+// Pause stops the deliveries of repeat from from to to. A zero to pauses
+// until Resume.
+func (s *Series) Pause(repeat int64, from, to civil.Date, reason, user string) (*repository.RepeatPause, error) {
+	if from.IsZero() {
+		return nil, errors.New("schedule: pause needs a start date")
+	}
+	if !to.IsZero() && to.Before(from) {
+		return nil, fmt.Errorf("schedule: pause ends on %s, before it starts on %s", to, from)
+	}
+	if _, err := s.Store.Repeats.Get(repeat); err != nil {
+		return nil, err
+	}
+	pauses, err := s.Store.Repeats.Pauses(repeat)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pauses {
+		if (to.IsZero() || !p.PauseSDt.After(to)) && (p.PauseEDt.IsZero() || !p.PauseEDt.Before(from)) {
+			return nil, fmt.Errorf("%w: %s", ErrPaused, pauseRange(p))
+		}
+	}
+
+	p := &repository.RepeatPause{Repeat: repeat, PauseSDt: from, PauseEDt: to, Reason: reason, Upuser: user}
+	if err := s.Store.Repeats.SavePause(p); err != nil {
+		return nil, err
+	}
+	return p, s.record(repeat, ActionPause, from, "paused "+pauseRange(p), reason, user)
+}
+
+// Resume restarts the deliveries of repeat on on, ending the pause that
+// covers it. A pause that had not started yet is removed.
+func (s *Series) Resume(repeat int64, on civil.Date, reason, user string) error {
+	pauses, err := s.Store.Repeats.Pauses(repeat)
+	if err != nil {
+		return err
+	}
+	var p *repository.RepeatPause
+	for _, c := range pauses {
+		if c.Contains(on) {
+			p = c
+			break
+		}
+	}
+	if p == nil {
+		return fmt.Errorf("%w: %s", ErrNotPaused, on)
+	}
+
+	detail := "resumed, was paused " + pauseRange(p)
+	if on == p.PauseSDt {
+		err = s.Store.Repeats.RemovePause(repeat, p.PauseSDt)
+	} else {
+		p.PauseEDt = on.AddDays(-1)
+		err = s.Store.Repeats.SavePause(p)
+	}
+	if err != nil {
+		return err
+	}
+	return s.record(repeat, ActionResume, on, detail, reason, user)
+}
+
+// SetEndDt changes repeat_e_dt of repeat
+func (s *Series) SetEndDt(repeat int64, edt civil.Date, reason, user string) (*repository.Repeat, error) {
+	rep, err := s.Store.Repeats.Get(repeat)
+	if err != nil {
+		return nil, err
+	}
+	if edt.IsZero() || edt.Before(rep.RepeatSDt) {
+		return nil, fmt.Errorf("schedule: repeat_e_dt %s is before repeat_s_dt %s", edt, rep.RepeatSDt)
+	}
+	detail := fmt.Sprintf("repeat_e_dt %s -> %s", rep.RepeatEDt, edt)
+	rep.RepeatEDt = edt
+	if _, err := s.Store.Repeats.Save(rep); err != nil {
+		return nil, err
+	}
+	return rep, s.record(repeat, ActionEnd, edt, detail, reason, user)
+}
+
+// ChangeFrom applies c to the occurrences of repeat on and after from. The
+// repeat is edited in place when only repeat_e_dt changes or from is not
+// after its first occurrence. Otherwise it ends the day before from and a
+// new repeat, whose parent_repeat is the old one, continues from the first
+// occurrence on or after from with the change applied. The repeat
+// delivering from from is returned.
+func (s *Series) ChangeFrom(repeat int64, from civil.Date, c Change, reason, user string) (*repository.Repeat, error) {
+	if c.RepeatEDt.IsZero() && c.Qty == 0 {
+		return nil, errors.New("schedule: change needs a new repeat_e_dt or qty")
+	}
+	rep, err := s.Store.Repeats.Get(repeat)
+	if err != nil {
+		return nil, err
+	}
+	first, err := firstPlanned(rep, from)
+	if err != nil {
+		return nil, err
+	}
+	if !c.RepeatEDt.IsZero() && c.RepeatEDt.Before(first) {
+		return nil, fmt.Errorf("schedule: repeat_e_dt %s is before the change starts on %s", c.RepeatEDt, first)
+	}
+
+	if c.Qty == 0 || !first.After(rep.RepeatSDt) {
+		action := ActionEdit
+		if c.Qty == 0 {
+			action = ActionEnd
+		}
+		detail := applyChange(rep, c)
+		if _, err := s.Store.Repeats.Save(rep); err != nil {
+			return nil, err
+		}
+		return rep, s.record(rep.Repeat, action, first, detail, reason, user)
+	}
+
+	next := *rep
+	next.Repeat = 0
+	next.ParentRepeat = rep.Repeat
+	next.RepeatSDt = first
+	detail := applyChange(&next, c)
+	if _, err := s.Store.Repeats.Save(&next); err != nil {
+		return nil, err
+	}
+	rep.RepeatEDt = from.AddDays(-1)
+	if _, err := s.Store.Repeats.Save(rep); err != nil {
+		return nil, err
+	}
+	if err := s.movePauses(rep.Repeat, next.Repeat, first); err != nil {
+		return nil, err
+	}
+
+	if err := s.record(rep.Repeat, ActionSplit, from, fmt.Sprintf("continued as repeat %d: %s", next.Repeat, detail), reason, user); err != nil {
+		return nil, err
+	}
+	return &next, s.record(next.Repeat, ActionCreate, first, fmt.Sprintf("split from repeat %d: %s", rep.Repeat, detail), reason, user)
+}
+
+// History returns the versions of repeat and of the repeats it was split
+// from, oldest first
+func (s *Series) History(repeat int64) ([]*repository.RepeatVersion, error) {
+	var chain []int64
+	for id := repeat; id != 0; {
+		rep, err := s.Store.Repeats.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([]int64{id}, chain...)
+		id = rep.ParentRepeat
+	}
+
+	var ret []*repository.RepeatVersion
+	for _, id := range chain {
+		versions, err := s.Store.Repeats.Versions(id)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, versions...)
+	}
+	return ret, nil
+}
+
+// movePauses moves the part of the pauses of from on and after dt to to
+func (s *Series) movePauses(from, to int64, dt civil.Date) error {
+	pauses, err := s.Store.Repeats.Pauses(from)
+	if err != nil {
+		return err
+	}
+	for _, p := range pauses {
+		if !p.PauseEDt.IsZero() && p.PauseEDt.Before(dt) {
+			continue
+		}
+		moved := *p
+		moved.Repeat = to
+		if moved.PauseSDt.Before(dt) {
+			moved.PauseSDt = dt
+		}
+		if err := s.Store.Repeats.SavePause(&moved); err != nil {
+			return err
+		}
+		if p.PauseSDt.Before(dt) {
+			p.PauseEDt = dt.AddDays(-1)
+			err = s.Store.Repeats.SavePause(p)
+		} else {
+			err = s.Store.Repeats.RemovePause(from, p.PauseSDt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Series) record(repeat int64, action string, dt civil.Date, detail, reason, user string) error {
+	return s.Store.Repeats.AddVersion(&repository.RepeatVersion{
+		Repeat:      repeat,
+		Action:      action,
+		EffectiveDt: dt,
+		Detail:      detail,
+		Reason:      reason,
+		Upuser:      user,
+	})
+}
+
+// Paused removes the occurrences that fall in one of pauses
+func Paused(occs []calendar.Occurrence, pauses []*repository.RepeatPause) []calendar.Occurrence {
+	if len(pauses) == 0 {
+		return occs
+	}
+	ret := occs[:0:0]
+	for _, occ := range occs {
+		if !isPaused(pauses, civil.DateOf(occ.Date)) {
+			ret = append(ret, occ)
+		}
+	}
+	return ret
+}
+
+// MovedIn reports whether an occurrence of a series running from sdt to
+// edt, planned on planned and rescheduled to newDt, is delivered in w:
+// newDt is in w and outside pauses, and planned is within the series, as
+// a reschedule made on the old series of a split repeat belongs to the
+// repeat that covered the original date
+func MovedIn(w Window, sdt, edt, planned, newDt civil.Date, pauses []*repository.RepeatPause) bool {
+	if newDt.IsZero() || !w.Contains(newDt.Time()) || isPaused(pauses, newDt) {
+		return false
+	}
+	return !planned.Before(sdt) && !planned.After(edt)
+}
+
+func isPaused(pauses []*repository.RepeatPause, d civil.Date) bool {
+	for _, p := range pauses {
+		if p.Contains(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstPlanned returns the first date on or after from that the rule of
+// rep delivers on, before the calendar rolls it. Starting the continuation
+// there keeps biweekly and monthly repeats on their cadence.
+func firstPlanned(rep *repository.Repeat, from civil.Date) (civil.Date, error) {
+	rule, err := recurrence.ForRepeat(strconv.Itoa(rep.Period), strconv.Itoa(rep.Span), rep.DayOfWeek, rep.RRule, rep.RepeatSDt.String(), rep.RepeatEDt.String())
+	if err != nil {
+		return civil.Date{}, err
+	}
+	if from.Before(rep.RepeatSDt) {
+		from = rep.RepeatSDt
+	}
+	if from.After(rep.RepeatEDt) {
+		return civil.Date{}, fmt.Errorf("%w: %s", ErrNoOccurrence, from)
+	}
+	for d := from; !d.After(rep.RepeatEDt); d = d.AddDays(DefaultMaxDays) {
+		if planned := rule.Occurrences(d.Time(), d.AddDays(DefaultMaxDays-1).Time()); len(planned) > 0 {
+			return civil.DateOf(planned[0]), nil
+		}
+	}
+	return civil.Date{}, fmt.Errorf("%w: %s", ErrNoOccurrence, from)
+}
+
+// applyChange applies c to rep and describes it
+func applyChange(rep *repository.Repeat, c Change) string {
+	var detail []string
+	if !c.RepeatEDt.IsZero() {
+		detail = append(detail, fmt.Sprintf("repeat_e_dt %s -> %s", rep.RepeatEDt, c.RepeatEDt))
+		rep.RepeatEDt = c.RepeatEDt
+	}
+	if c.Qty != 0 {
+		detail = append(detail, fmt.Sprintf("qty %s -> %s", rep.DeliveryQty(), c.Qty))
+		rep.RepeatQty = c.Qty
+	}
+	return strings.Join(detail, ", ")
+}
+
+func pauseRange(p *repository.RepeatPause) string {
+	if p.PauseEDt.IsZero() {
+		return "from " + p.PauseSDt.String() + " until resumed"
+	}
+	return p.PauseSDt.String() + " - " + p.PauseEDt.String()
+}
+
+// PausesByRepeat groups the pauses read by Pauses(0) by repeat
+func PausesByRepeat(pauses []*repository.RepeatPause) map[int64][]*repository.RepeatPause {
+	ret := make(map[int64][]*repository.RepeatPause)
+	for _, p := range pauses {
+		ret[p.Repeat] = append(ret[p.Repeat], p)
+	}
+	return ret
+}
+
+// ApplyRepeatRow prepares a yc_schedule_repeat row read by scan.Maps for
+// the schedule screens: repeat_qty, when set, replaces the sales qty. It
+// returns the repeat id of the row.
+func ApplyRepeatRow(r map[string]interface{}) int64 {
+	if qty, err := scan.ParseQty(fmt.Sprint(r["repeat_qty"])); err == nil && qty != 0 {
+		r["qty"] = qty.String()
+	}
+	id, _ := strconv.ParseInt(fmt.Sprint(r["repeat"]), 10, 64)
+	return id
+}
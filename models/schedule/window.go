@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/recurrence"
+	"github.com/geeknow112/srv-tools/models/repository"
+)
+
+const dateLayout = "2006-01-02"
+
+// DefaultDays is the window length when no end date is given; it is the
+// old OUTPUT_LIMIT of the schedule screens
+const DefaultDays = 10
+
+// DefaultMaxDays caps a window unless the caller configures another limit.
+// It fits a quarter, so monthly planning views are always allowed.
+const DefaultMaxDays = 93
+
+// rollMargin is how far outside the window occurrences are expanded so
+// that those rolled into it by the calendar are not lost
+const rollMargin = 14
+
+// ErrWindow is wrapped by every window validation error
+var ErrWindow = errors.New("schedule: invalid window")
+
+// Window is an inclusive range of delivery dates. From and To are civil
+// dates held as midnight UTC, like every date in recurrence and calendar.
+type Window struct {
+	From time.Time
+	To   time.Time
+}
+
+// NewWindow validates from and to. maxDays limits the number of days in the
+// window; zero or less means DefaultMaxDays.
+func NewWindow(from, to time.Time, maxDays int) (Window, error) {
+	if maxDays <= 0 {
+		maxDays = DefaultMaxDays
+	}
+	w := Window{From: dateOf(from), To: dateOf(to)}
+	if w.To.Before(w.From) {
+		return Window{}, fmt.Errorf("%w: %s is after %s", ErrWindow, w.From.Format(dateLayout), w.To.Format(dateLayout))
+	}
+	if n := w.Days(); n > maxDays {
+		return Window{}, fmt.Errorf("%w: %d days exceeds the maximum of %d", ErrWindow, n, maxDays)
+	}
+	return w, nil
+}
+
+// ParseWindow reads the sdt/edt search parameters. An empty edt gives a
+// window of DefaultDays days after sdt.
+func ParseWindow(sdt, edt string, maxDays int) (Window, error) {
+	from, err := civil.Parse(strings.TrimSpace(sdt))
+	if err != nil {
+		return Window{}, fmt.Errorf("%w: sdt %q is not YYYY-MM-DD", ErrWindow, sdt)
+	}
+	to := from.AddDays(DefaultDays)
+	if strings.TrimSpace(edt) != "" {
+		if to, err = civil.Parse(strings.TrimSpace(edt)); err != nil {
+			return Window{}, fmt.Errorf("%w: edt %q is not YYYY-MM-DD", ErrWindow, edt)
+		}
+	}
+	return NewWindow(from.Time(), to.Time(), maxDays)
+}
+
+// Days returns the number of days in the window
+func (w Window) Days() int {
+	return int(w.To.Sub(w.From).Hours()/24) + 1
+}
+
+// Contains reports whether d is in the window
+func (w Window) Contains(d time.Time) bool {
+	d = dateOf(d)
+	return !d.Before(w.From) && !d.After(w.To)
+}
+
+// Expand returns the deliveries of one yc_schedule_repeat row (as read by
+// scan.Maps) in the window, after applying the row's roll_policy with cal.
+// A nil cal means weekends and public holidays only.
+func Expand(r map[string]interface{}, w Window, cal *calendar.Calendar) ([]calendar.Occurrence, error) {
+	// A driver with parseTime returns time.Time, which fmt.Sprint would
+	// print with a zone; civil reads either form as a plain date
+	sdt, err := civil.FromValue(r["repeat_s_dt"])
+	if err != nil {
+		return nil, err
+	}
+	edt, err := civil.FromValue(r["repeat_e_dt"])
+	if err != nil {
+		return nil, err
+	}
+	dayOfWeek, _ := r["day_of_week"].(string)
+	rrule, _ := r["rrule"].(string)
+	rule, err := recurrence.ForRepeat(fmt.Sprint(r["period"]), fmt.Sprint(r["span"]), dayOfWeek, rrule, sdt.String(), edt.String())
+	if err != nil {
+		return nil, err
+	}
+	policy, err := calendar.ParsePolicy(fmt.Sprint(r["roll_policy"]))
+	if err != nil {
+		return nil, err
+	}
+	return expand(rule, policy, fmt.Sprint(r["outgoing_warehouse"]), w, cal), nil
+}
+
+// ExpandRepeat is Expand for a repository.Repeat
+func ExpandRepeat(rep *repository.Repeat, w Window, cal *calendar.Calendar) ([]calendar.Occurrence, error) {
+	rule, err := recurrence.ForRepeat(strconv.Itoa(rep.Period), strconv.Itoa(rep.Span), rep.DayOfWeek, rep.RRule, rep.RepeatSDt.String(), rep.RepeatEDt.String())
+	if err != nil {
+		return nil, err
+	}
+	return expand(rule, calendar.Policy(rep.RollPolicy), rep.OutgoingWarehouse, w, cal), nil
+}
+
+func expand(rule *recurrence.RRule, policy calendar.Policy, warehouse string, w Window, cal *calendar.Calendar) []calendar.Occurrence {
+	if cal == nil {
+		cal = calendar.New()
+	}
+	planned := rule.Occurrences(w.From.AddDate(0, 0, -rollMargin), w.To.AddDate(0, 0, rollMargin))
+	var ret []calendar.Occurrence
+	for _, occ := range cal.Apply(warehouse, planned, policy) {
+		if w.Contains(occ.Date) {
+			ret = append(ret, occ)
+		}
+	}
+	return ret
+}
+
+func dateOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,117 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019001
+// Creates the yc_* tables read by the models
+
+func init() {
+	register(Migration{
+		Version: "migration20261019001",
+		Name:    "create yc tables",
+		Up: func(d dialect.Dialect) []string {
+			opt := d.TableOptions()
+			return []string{
+				`CREATE TABLE IF NOT EXISTS yc_customer (
+					customer VARCHAR(32) NOT NULL PRIMARY KEY,
+					name VARCHAR(100) NOT NULL DEFAULT '',
+					pref VARCHAR(100) NOT NULL DEFAULT '',
+					rgdt DATETIME NULL,
+					updt DATETIME NULL,
+					upuser VARCHAR(100) NULL
+				)` + opt,
+				`CREATE TABLE IF NOT EXISTS yc_customer_detail (
+					customer VARCHAR(32) NOT NULL,
+					detail INT NOT NULL,
+					tank VARCHAR(100) NOT NULL DEFAULT '',
+					PRIMARY KEY (customer, detail)
+				)` + opt,
+				`CREATE TABLE IF NOT EXISTS yc_goods (
+					goods VARCHAR(32) NOT NULL PRIMARY KEY,
+					name VARCHAR(100) NOT NULL DEFAULT '',
+					qty DECIMAL(10,3) NOT NULL DEFAULT 0,
+					separately_fg TINYINT NOT NULL DEFAULT 0,
+					rgdt DATETIME NULL,
+					updt DATETIME NULL
+				)` + opt,
+				`CREATE TABLE IF NOT EXISTS yc_customer_goods (
+					customer VARCHAR(32) NOT NULL,
+					goods VARCHAR(32) NOT NULL,
+					PRIMARY KEY (customer, goods)
+				)` + opt,
+				`CREATE TABLE IF NOT EXISTS yc_sales (
+					sales ` + d.AutoIncrement() + `,
+					class INT NOT NULL DEFAULT 0,
+					customer VARCHAR(32) NOT NULL DEFAULT '',
+					name VARCHAR(100) NOT NULL DEFAULT '',
+					goods VARCHAR(32) NOT NULL DEFAULT '',
+					qty DECIMAL(10,3) NOT NULL DEFAULT 0,
+					ship_addr VARCHAR(100) NOT NULL DEFAULT '',
+					cars_tank VARCHAR(100) NOT NULL DEFAULT '',
+					outgoing_warehouse VARCHAR(32) NOT NULL DEFAULT '',
+					use_stock INT NOT NULL DEFAULT 0,
+					delivery_dt DATE NULL,
+					arrival_dt DATE NULL,
+					repeat_fg TINYINT NOT NULL DEFAULT 0,
+					lot_fg TINYINT NOT NULL DEFAULT 0,
+					status INT NOT NULL DEFAULT 0,
+					remark TEXT NULL,
+					field1 VARCHAR(255) NULL,
+					field2 VARCHAR(255) NULL,
+					field3 VARCHAR(255) NULL,
+					rgdt DATETIME NULL,
+					updt DATETIME NULL,
+					upuser VARCHAR(100) NULL
+				)` + opt,
+				d.CreateIndex("idx_yc_sales_delivery", "yc_sales", "delivery_dt"),
+				`CREATE TABLE IF NOT EXISTS yc_goods_detail (
+					id ` + d.AutoIncrement() + `,
+					` + d.Quote("order") + ` BIGINT NOT NULL,
+					goods VARCHAR(32) NOT NULL DEFAULT '',
+					lot VARCHAR(100) NOT NULL DEFAULT '',
+					tank VARCHAR(100) NOT NULL DEFAULT '',
+					rgdt DATETIME NULL,
+					updt DATETIME NULL
+				)` + opt,
+				`CREATE TABLE IF NOT EXISTS yc_schedule_repeat (
+					` + d.Quote("repeat") + ` ` + d.AutoIncrement() + `,
+					sales BIGINT NOT NULL,
+					period INT NOT NULL DEFAULT 0,
+					span INT NOT NULL DEFAULT 0,
+					day_of_week VARCHAR(32) NOT NULL DEFAULT '',
+					repeat_s_dt DATE NULL,
+					repeat_e_dt DATE NULL,
+					rgdt DATETIME NULL,
+					updt DATETIME NULL,
+					upuser VARCHAR(100) NULL
+				)` + opt,
+				`CREATE TABLE IF NOT EXISTS yc_repeat_exclude (
+					sales BIGINT NOT NULL,
+					delivery_dt DATE NOT NULL,
+					rgdt DATETIME NULL,
+					PRIMARY KEY (sales, delivery_dt)
+				)` + opt,
+				`CREATE TABLE IF NOT EXISTS yc_stock (
+					stock VARCHAR(32) NOT NULL PRIMARY KEY,
+					goods VARCHAR(32) NOT NULL DEFAULT '',
+					warehouse VARCHAR(32) NOT NULL DEFAULT '',
+					qty DECIMAL(10,3) NOT NULL DEFAULT 0,
+					arrival_dt DATE NULL,
+					transfer_fg TINYINT NOT NULL DEFAULT 0,
+					rgdt DATETIME NULL,
+					updt DATETIME NULL
+				)` + opt,
+				`CREATE TABLE IF NOT EXISTS yc_stock_detail (
+					id ` + d.AutoIncrement() + `,
+					stock VARCHAR(32) NOT NULL,
+					lot VARCHAR(100) NOT NULL DEFAULT '',
+					barcode VARCHAR(100) NOT NULL DEFAULT '',
+					transfer_fg TINYINT NOT NULL DEFAULT 0,
+					rgdt DATETIME NULL,
+					updt DATETIME NULL
+				)` + opt,
+				d.CreateIndex("idx_yc_stock_detail_stock", "yc_stock_detail", "stock"),
+			}
+		},
+	})
+}
@@ -0,0 +1,18 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019002
+// Adds the RRULE subset to repeat series
+
+func init() {
+	register(Migration{
+		Version: "migration20261019002",
+		Name:    "add yc_schedule_repeat.rrule",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_schedule_repeat ADD COLUMN rrule VARCHAR(255) NOT NULL DEFAULT ''`,
+			}
+		},
+	})
+}
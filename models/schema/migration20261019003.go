@@ -0,0 +1,26 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019003
+// Adds warehouse closures / blackout dates and the repeat roll policy
+
+func init() {
+	register(Migration{
+		Version: "migration20261019003",
+		Name:    "add yc_calendar_closure and yc_schedule_repeat.roll_policy",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS yc_calendar_closure (
+					warehouse VARCHAR(32) NOT NULL DEFAULT '',
+					closed_dt DATE NOT NULL,
+					reason VARCHAR(255) NOT NULL DEFAULT '',
+					rgdt DATETIME NULL,
+					PRIMARY KEY (warehouse, closed_dt)
+				)` + d.TableOptions(),
+				d.CreateIndex("idx_yc_calendar_closure_dt", "yc_calendar_closure", "closed_dt"),
+				`ALTER TABLE yc_schedule_repeat ADD COLUMN roll_policy INT NOT NULL DEFAULT 0`,
+			}
+		},
+	})
+}
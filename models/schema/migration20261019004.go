@@ -0,0 +1,28 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019004
+// Adds lead-time rules by customer, goods, packing and warehouse
+
+func init() {
+	register(Migration{
+		Version: "migration20261019004",
+		Name:    "add yc_lead_time",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS yc_lead_time (
+					lead_time ` + d.AutoIncrement() + `,
+					customer VARCHAR(32) NOT NULL DEFAULT '',
+					goods VARCHAR(32) NOT NULL DEFAULT '',
+					warehouse VARCHAR(32) NOT NULL DEFAULT '',
+					packing INT NOT NULL DEFAULT 0,
+					days INT NOT NULL DEFAULT 3,
+					remark VARCHAR(255) NOT NULL DEFAULT '',
+					rgdt DATETIME NULL,
+					updt DATETIME NULL
+				)` + d.TableOptions(),
+			}
+		},
+	})
+}
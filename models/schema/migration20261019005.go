@@ -0,0 +1,25 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019005
+// Turns yc_repeat_exclude into per-occurrence overrides: confirmed, skipped
+// or rescheduled
+
+func init() {
+	register(Migration{
+		Version: "migration20261019005",
+		Name:    "add type and reschedule columns to yc_repeat_exclude",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_repeat_exclude ADD COLUMN ` + d.Quote("type") + ` INT NOT NULL DEFAULT 0`,
+				`ALTER TABLE yc_repeat_exclude ADD COLUMN reason VARCHAR(255) NOT NULL DEFAULT ''`,
+				`ALTER TABLE yc_repeat_exclude ADD COLUMN new_delivery_dt DATE NULL`,
+				`ALTER TABLE yc_repeat_exclude ADD COLUMN new_qty DECIMAL(10,3) NOT NULL DEFAULT 0`,
+				`ALTER TABLE yc_repeat_exclude ADD COLUMN updt DATETIME NULL`,
+				`ALTER TABLE yc_repeat_exclude ADD COLUMN upuser VARCHAR(100) NULL`,
+				d.CreateIndex("idx_yc_repeat_exclude_new_dt", "yc_repeat_exclude", "new_delivery_dt"),
+			}
+		},
+	})
+}
@@ -0,0 +1,40 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019006
+// Adds repeat pauses, the version history of a repeat and the lineage and
+// quantity of repeats split by a "this and following" change
+
+func init() {
+	register(Migration{
+		Version: "migration20261019006",
+		Name:    "add yc_repeat_pause, yc_repeat_version and repeat lineage",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_schedule_repeat ADD COLUMN parent_repeat INT NULL`,
+				`ALTER TABLE yc_schedule_repeat ADD COLUMN repeat_qty DECIMAL(10,3) NOT NULL DEFAULT 0`,
+				`CREATE TABLE IF NOT EXISTS yc_repeat_pause (
+					` + d.Quote("repeat") + ` INT NOT NULL,
+					pause_s_dt DATE NOT NULL,
+					pause_e_dt DATE NULL,
+					reason VARCHAR(255) NOT NULL DEFAULT '',
+					rgdt DATETIME NULL,
+					upuser VARCHAR(100) NULL,
+					PRIMARY KEY (` + d.Quote("repeat") + `, pause_s_dt)
+				)` + d.TableOptions(),
+				`CREATE TABLE IF NOT EXISTS yc_repeat_version (
+					` + d.Quote("repeat") + ` INT NOT NULL,
+					version INT NOT NULL,
+					action VARCHAR(16) NOT NULL,
+					effective_dt DATE NULL,
+					detail VARCHAR(255) NOT NULL DEFAULT '',
+					reason VARCHAR(255) NOT NULL DEFAULT '',
+					rgdt DATETIME NULL,
+					upuser VARCHAR(100) NULL,
+					PRIMARY KEY (` + d.Quote("repeat") + `, version)
+				)` + d.TableOptions(),
+			}
+		},
+	})
+}
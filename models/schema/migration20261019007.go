@@ -0,0 +1,32 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019007
+// Adds the link from a materialized sales to its repeated sales and the
+// log of the materialization job
+
+func init() {
+	register(Migration{
+		Version: "migration20261019007",
+		Name:    "add yc_sales.base_sales and yc_materialize_log",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_sales ADD COLUMN base_sales BIGINT NULL`,
+				d.CreateIndex("idx_yc_sales_base", "yc_sales", "base_sales, delivery_dt"),
+				`CREATE TABLE IF NOT EXISTS yc_materialize_log (
+					id ` + d.AutoIncrement() + `,
+					run_at DATETIME NOT NULL,
+					dry_run TINYINT NOT NULL DEFAULT 0,
+					base_sales BIGINT NOT NULL,
+					` + d.Quote("repeat") + ` BIGINT NOT NULL,
+					delivery_dt DATE NOT NULL,
+					sales BIGINT NULL,
+					status VARCHAR(16) NOT NULL,
+					message VARCHAR(255) NOT NULL DEFAULT ''
+				)` + d.TableOptions(),
+				d.CreateIndex("idx_yc_materialize_log_run", "yc_materialize_log", "run_at"),
+			}
+		},
+	})
+}
@@ -0,0 +1,22 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019008
+// Turns yc_goods_detail into lot slots: each row carries the quantity of
+// one lot delivered into one tank
+
+func init() {
+	register(Migration{
+		Version: "migration20261019008",
+		Name:    "add slot, qty and upuser to yc_goods_detail",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_goods_detail ADD COLUMN slot INT NOT NULL DEFAULT 0`,
+				`ALTER TABLE yc_goods_detail ADD COLUMN qty DECIMAL(10,3) NOT NULL DEFAULT 0`,
+				`ALTER TABLE yc_goods_detail ADD COLUMN upuser VARCHAR(100) NULL`,
+				d.CreateIndex("idx_yc_goods_detail_order", "yc_goods_detail", d.Quote("order")+", slot"),
+			}
+		},
+	})
+}
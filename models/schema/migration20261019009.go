@@ -0,0 +1,21 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019009
+// Adds the expiry date of a stock detail and the picking strategy that
+// took it for a transfer
+
+func init() {
+	register(Migration{
+		Version: "migration20261019009",
+		Name:    "add expiry_dt and pick_strategy to yc_stock_detail",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_stock_detail ADD COLUMN expiry_dt DATE NULL`,
+				`ALTER TABLE yc_stock_detail ADD COLUMN pick_strategy VARCHAR(64) NOT NULL DEFAULT ''`,
+				d.CreateIndex("idx_yc_stock_goods", "yc_stock", "goods, warehouse, arrival_dt"),
+			}
+		},
+	})
+}
@@ -0,0 +1,58 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019010
+// Adds the stock movement ledger and its balances per goods, warehouse and
+// lot. Every stock detail not yet transferred is posted as a receipt of
+// one goods unit so the balances start from the current stock.
+
+func init() {
+	register(Migration{
+		Version: "migration20261019010",
+		Name:    "add yc_stock_ledger and yc_stock_balance",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS yc_stock_ledger (
+					id ` + d.AutoIncrement() + `,
+					kind VARCHAR(16) NOT NULL,
+					ref VARCHAR(64) NOT NULL DEFAULT '',
+					goods VARCHAR(32) NOT NULL,
+					warehouse VARCHAR(32) NOT NULL,
+					lot VARCHAR(100) NOT NULL DEFAULT '',
+					on_hand DECIMAL(10,3) NOT NULL DEFAULT 0,
+					reserved DECIMAL(10,3) NOT NULL DEFAULT 0,
+					in_transit DECIMAL(10,3) NOT NULL DEFAULT 0,
+					cancel_of BIGINT NULL,
+					reason VARCHAR(255) NOT NULL DEFAULT '',
+					rgdt DATETIME NOT NULL,
+					upuser VARCHAR(64) NOT NULL DEFAULT ''
+				)` + d.TableOptions(),
+				d.CreateIndex("idx_yc_stock_ledger_goods", "yc_stock_ledger", "goods, warehouse, lot"),
+				d.CreateIndex("idx_yc_stock_ledger_ref", "yc_stock_ledger", "ref"),
+				`CREATE TABLE IF NOT EXISTS yc_stock_balance (
+					goods VARCHAR(32) NOT NULL,
+					warehouse VARCHAR(32) NOT NULL,
+					lot VARCHAR(100) NOT NULL DEFAULT '',
+					on_hand DECIMAL(10,3) NOT NULL DEFAULT 0,
+					reserved DECIMAL(10,3) NOT NULL DEFAULT 0,
+					in_transit DECIMAL(10,3) NOT NULL DEFAULT 0,
+					updt DATETIME NULL,
+					PRIMARY KEY (goods, warehouse, lot)
+				)` + d.TableOptions(),
+				`INSERT INTO yc_stock_ledger (kind, ref, goods, warehouse, lot, on_hand, reason, rgdt, upuser)
+					SELECT 'receipt', st.stock, st.goods, st.warehouse, std.lot,
+						SUM(CASE WHEN g.qty > 0 THEN g.qty ELSE 1 END), 'opening balance', CURRENT_TIMESTAMP, 'migration'
+					FROM yc_stock AS st
+					INNER JOIN yc_stock_detail AS std ON st.stock = std.stock
+					LEFT JOIN yc_goods AS g ON st.goods = g.goods
+					WHERE std.transfer_fg <> 1
+					GROUP BY st.stock, st.goods, st.warehouse, std.lot`,
+				`INSERT INTO yc_stock_balance (goods, warehouse, lot, on_hand, reserved, in_transit, updt)
+					SELECT goods, warehouse, lot, SUM(on_hand), SUM(reserved), SUM(in_transit), CURRENT_TIMESTAMP
+					FROM yc_stock_ledger
+					GROUP BY goods, warehouse, lot`,
+			}
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019011
+// Links a transferred stock detail to the transfer that took it, so a
+// cancelled transfer can give its details back, and records who cancelled
+// a transfer and why
+
+func init() {
+	register(Migration{
+		Version: "migration20261019011",
+		Name:    "add yc_stock_detail.transfer_ref and yc_transfer_cancel",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_stock_detail ADD COLUMN transfer_ref VARCHAR(32) NULL`,
+				d.CreateIndex("idx_yc_stock_detail_transfer", "yc_stock_detail", "transfer_ref"),
+				`CREATE TABLE IF NOT EXISTS yc_transfer_cancel (
+					id ` + d.AutoIncrement() + `,
+					stock VARCHAR(32) NOT NULL,
+					released INT NOT NULL DEFAULT 0,
+					reason VARCHAR(255) NOT NULL,
+					rgdt DATETIME NOT NULL,
+					upuser VARCHAR(64) NOT NULL DEFAULT ''
+				)` + d.TableOptions(),
+				d.CreateIndex("idx_yc_transfer_cancel_stock", "yc_transfer_cancel", "stock"),
+			}
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019012
+// Adds the warehouse master and the transfer routes between warehouses.
+// Warehouse 2 (丹波SP) is the stock point every other warehouse already
+// in use receives its transfers from, as RegDetail hardcoded before.
+
+func init() {
+	register(Migration{
+		Version: "migration20261019012",
+		Name:    "add yc_warehouse and yc_warehouse_route",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS yc_warehouse (
+					warehouse VARCHAR(32) NOT NULL PRIMARY KEY,
+					name VARCHAR(100) NOT NULL DEFAULT '',
+					source_fg TINYINT NOT NULL DEFAULT 0,
+					destination_fg TINYINT NOT NULL DEFAULT 1,
+					bulk_fg TINYINT NOT NULL DEFAULT 0,
+					rgdt DATETIME NULL,
+					updt DATETIME NULL
+				)` + d.TableOptions(),
+				`CREATE TABLE IF NOT EXISTS yc_warehouse_route (
+					from_warehouse VARCHAR(32) NOT NULL,
+					to_warehouse VARCHAR(32) NOT NULL,
+					priority INT NOT NULL DEFAULT 0,
+					active_fg TINYINT NOT NULL DEFAULT 1,
+					rgdt DATETIME NULL,
+					updt DATETIME NULL,
+					PRIMARY KEY (from_warehouse, to_warehouse)
+				)` + d.TableOptions(),
+				`INSERT INTO yc_warehouse (warehouse, name, source_fg, destination_fg, bulk_fg, rgdt, updt)
+					VALUES ('2', '丹波SP', 1, 0, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+				`INSERT INTO yc_warehouse (warehouse, name, source_fg, destination_fg, bulk_fg, rgdt, updt)
+					SELECT w.warehouse, w.warehouse, 0, 1, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+					FROM (
+						SELECT warehouse FROM yc_stock
+						UNION SELECT outgoing_warehouse FROM yc_sales
+					) AS w
+					WHERE w.warehouse <> '' AND w.warehouse <> '2'`,
+				`INSERT INTO yc_warehouse_route (from_warehouse, to_warehouse, priority, active_fg, rgdt, updt)
+					SELECT '2', w.warehouse, 0, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+					FROM yc_warehouse AS w
+					WHERE w.destination_fg = 1`,
+			}
+		},
+	})
+}
@@ -0,0 +1,36 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019013
+// Tracks where a stock detail is on its way from receipt to delivery, as
+// the handheld scans its barcode, and logs every scan with its result so a
+// rejected one can be looked into
+
+func init() {
+	register(Migration{
+		Version: "migration20261019013",
+		Name:    "add yc_stock_detail.scan_state and yc_stock_scan",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_stock_detail ADD COLUMN scan_state VARCHAR(16) NOT NULL DEFAULT ''`,
+				d.CreateIndex("idx_yc_stock_detail_barcode", "yc_stock_detail", "barcode"),
+				`CREATE TABLE IF NOT EXISTS yc_stock_scan (
+					id ` + d.AutoIncrement() + `,
+					detail BIGINT NULL,
+					barcode VARCHAR(255) NOT NULL,
+					action VARCHAR(16) NOT NULL,
+					ref VARCHAR(32) NOT NULL DEFAULT '',
+					state_from VARCHAR(16) NOT NULL DEFAULT '',
+					state_to VARCHAR(16) NOT NULL DEFAULT '',
+					result VARCHAR(16) NOT NULL,
+					message VARCHAR(1024) NOT NULL DEFAULT '',
+					rgdt DATETIME NOT NULL,
+					upuser VARCHAR(64) NOT NULL DEFAULT ''
+				)` + d.TableOptions(),
+				d.CreateIndex("idx_yc_stock_scan_detail", "yc_stock_scan", "detail"),
+				d.CreateIndex("idx_yc_stock_scan_ref", "yc_stock_scan", "ref"),
+			}
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019014
+// Adds the minimum stock of goods per warehouse that the stock projection
+// warns about, and the level a reorder or transfer should bring it back to
+
+func init() {
+	register(Migration{
+		Version: "migration20261019014",
+		Name:    "add yc_stock_threshold",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS yc_stock_threshold (
+					goods VARCHAR(32) NOT NULL,
+					warehouse VARCHAR(32) NOT NULL,
+					min_qty DECIMAL(10,3) NOT NULL DEFAULT 0,
+					target_qty DECIMAL(10,3) NOT NULL DEFAULT 0,
+					rgdt DATETIME NULL,
+					updt DATETIME NULL,
+					upuser VARCHAR(64) NOT NULL DEFAULT '',
+					PRIMARY KEY (goods, warehouse)
+				)` + d.TableOptions(),
+			}
+		},
+	})
+}
@@ -0,0 +1,31 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019015
+// Turns the free-text tanks in yc_customer_detail into tank records with a
+// capacity, the level last read and how much the customer uses per day,
+// and lists the goods each tank may hold. A capacity of 0 is unknown and
+// is not checked.
+
+func init() {
+	register(Migration{
+		Version: "migration20261019015",
+		Name:    "add tank capacity and level to yc_customer_detail, add yc_customer_tank_goods",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE yc_customer_detail ADD COLUMN capacity DECIMAL(10,3) NOT NULL DEFAULT 0`,
+				`ALTER TABLE yc_customer_detail ADD COLUMN daily_use DECIMAL(10,3) NOT NULL DEFAULT 0`,
+				`ALTER TABLE yc_customer_detail ADD COLUMN level DECIMAL(10,3) NOT NULL DEFAULT 0`,
+				`ALTER TABLE yc_customer_detail ADD COLUMN level_dt DATE NULL`,
+				`ALTER TABLE yc_customer_detail ADD COLUMN updt DATETIME NULL`,
+				`CREATE TABLE IF NOT EXISTS yc_customer_tank_goods (
+					customer VARCHAR(32) NOT NULL,
+					tank VARCHAR(100) NOT NULL,
+					goods VARCHAR(32) NOT NULL,
+					PRIMARY KEY (customer, tank, goods)
+				)` + d.TableOptions(),
+			}
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019016
+// Records every sales an administrator let through for goods not assigned
+// to the customer in yc_customer_goods, with the reason given
+
+func init() {
+	register(Migration{
+		Version: "migration20261019016",
+		Name:    "add yc_goods_override",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS yc_goods_override (
+					id ` + d.AutoIncrement() + `,
+					customer VARCHAR(32) NOT NULL,
+					goods VARCHAR(32) NOT NULL,
+					sales BIGINT NULL,
+					action VARCHAR(16) NOT NULL,
+					reason VARCHAR(255) NOT NULL,
+					rgdt DATETIME NOT NULL,
+					upuser VARCHAR(64) NOT NULL DEFAULT ''
+				)` + d.TableOptions(),
+				d.CreateIndex("idx_yc_goods_override_customer", "yc_goods_override", "customer, goods"),
+				d.CreateIndex("idx_yc_goods_override_sales", "yc_goods_override", "sales"),
+			}
+		},
+	})
+}
@@ -0,0 +1,25 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019017
+// Widens the repeat columns added by migration20261019006 to the BIGINT of
+// yc_schedule_repeat.repeat. SQLite only has the INTEGER affinity for
+// both types, so there is nothing to change there.
+
+func init() {
+	register(Migration{
+		Version: "migration20261019017",
+		Name:    "widen repeat references to BIGINT",
+		Up: func(d dialect.Dialect) []string {
+			if d.Name() != dialect.MySQL.Name() {
+				return nil
+			}
+			return []string{
+				`ALTER TABLE yc_schedule_repeat MODIFY parent_repeat BIGINT NULL`,
+				`ALTER TABLE yc_repeat_pause MODIFY ` + d.Quote("repeat") + ` BIGINT NOT NULL`,
+				`ALTER TABLE yc_repeat_version MODIFY ` + d.Quote("repeat") + ` BIGINT NOT NULL`,
+			}
+		},
+	})
+}
@@ -0,0 +1,22 @@
+package schema
+
+import "github.com/geeknow112/srv-tools/models/dialect"
+
+// Migration: migration20261019018
+// Relabels the in-transit side of the transfers posted so far. Ledger
+// entries are otherwise never changed, but these were posted as
+// transfer_out although they put goods in transit to the receiving
+// warehouse rather than take them off the hand of the sending one.
+
+func init() {
+	register(Migration{
+		Version: "migration20261019018",
+		Name:    "post the receiving side of transfers as transit",
+		Up: func(d dialect.Dialect) []string {
+			return []string{
+				`UPDATE yc_stock_ledger SET kind = 'transit'
+					WHERE kind = 'transfer_out' AND on_hand = 0 AND in_transit <> 0`,
+			}
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/dialect"
+)
+
+// Migration is one DDL step of the yc_* schema. Versions follow the
+// migrationYYYYMMDDNNN naming used in the migrations directory.
+type Migration struct {
+	Version string
+	Name    string
+	Up      func(d dialect.Dialect) []string
+}
+
+// migrations is the ordered list of schema migrations. Append new steps;
+// never edit one that has already been applied.
+var migrations []Migration
+
+func register(m Migration) {
+	migrations = append(migrations, m)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+}
+
+// Migrations returns every registered migration in version order
+func Migrations() []Migration {
+	return append([]Migration{}, migrations...)
+}
+
+// Migrate applies the migrations that are not yet recorded in
+// yc_schema_migrations and returns the versions it applied
+func Migrate(db *sql.DB, d dialect.Dialect) ([]string, error) {
+	d = dialect.Or(d)
+
+	create := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS yc_schema_migrations (
+		version VARCHAR(32) NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at DATETIME NOT NULL
+	)%s`, d.TableOptions())
+	if _, err := db.Exec(create); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version FROM yc_schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := apply(db, d, m); err != nil {
+			return done, fmt.Errorf("schema: %s %s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m.Version)
+	}
+
+	return done, nil
+}
+
+// apply runs one migration. MySQL commits DDL implicitly, so the
+// transaction only guarantees atomicity on engines with transactional DDL;
+// on MySQL, an index left by an earlier, interrupted run is skipped.
+func apply(db *sql.DB, d dialect.Dialect, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.Up(d) {
+		if _, err := tx.Exec(stmt); err != nil && !d.IndexExists(err) {
+			return err
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO yc_schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, civil.Timestamp()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,95 @@
+package schema_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/dialect"
+	"github.com/geeknow112/srv-tools/models/schema"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	db := testdb.New(t)
+	applied, err := schema.Migrate(db, testdb.Dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second Migrate applied %v", applied)
+	}
+}
+
+// TestCreateStatementsRerun runs every CREATE of every migration again on
+// a migrated database, as a migration interrupted after its DDL would
+func TestCreateStatementsRerun(t *testing.T) {
+	db := testdb.New(t)
+	for _, m := range schema.Migrations() {
+		for _, stmt := range m.Up(testdb.Dialect) {
+			if !strings.HasPrefix(strings.TrimSpace(stmt), "CREATE") {
+				continue
+			}
+			if _, err := db.Exec(stmt); err != nil {
+				t.Errorf("%s: %v\n%s", m.Version, err, stmt)
+			}
+		}
+	}
+}
+
+func TestCreateIndexIsGuarded(t *testing.T) {
+	for _, d := range []dialect.Dialect{dialect.MySQL, dialect.SQLite} {
+		for _, m := range schema.Migrations() {
+			for _, stmt := range m.Up(d) {
+				if strings.HasPrefix(stmt, "CREATE TABLE") && !strings.HasPrefix(stmt, "CREATE TABLE IF NOT EXISTS") {
+					t.Errorf("%s %s: unguarded %.60s", d.Name(), m.Version, stmt)
+				}
+				if strings.HasPrefix(stmt, "CREATE INDEX") && d == dialect.SQLite && !strings.HasPrefix(stmt, "CREATE INDEX IF NOT EXISTS") {
+					t.Errorf("%s %s: unguarded %.60s", d.Name(), m.Version, stmt)
+				}
+			}
+		}
+	}
+	if !dialect.MySQL.IndexExists(mysqlError("Error 1061 (42000): Duplicate key name 'idx_yc_sales_delivery'")) {
+		t.Error("MySQL IndexExists does not match error 1061")
+	}
+	if dialect.MySQL.IndexExists(mysqlError("Error 1146 (42S02): Table 'yc.yc_sales' doesn't exist")) {
+		t.Error("MySQL IndexExists matches another error")
+	}
+}
+
+type mysqlError string
+
+func (e mysqlError) Error() string { return string(e) }
+
+// refColumn matches the columns holding a sales or repeat number in a
+// CREATE TABLE body or an ALTER TABLE
+var refColumn = regexp.MustCompile("(?m)^\\s*(?:ALTER TABLE \\w+ (?:ADD COLUMN|MODIFY) )?`?(sales|base_sales|repeat|parent_repeat)`? (\\w+)")
+
+var tableName = regexp.MustCompile(`^(?:CREATE TABLE IF NOT EXISTS|ALTER TABLE) (\w+)`)
+
+// TestReferenceTypes checks that, once every migration ran, the columns
+// referring to a sales or repeat have the BIGINT type of yc_sales.sales
+// and yc_schedule_repeat.repeat
+func TestReferenceTypes(t *testing.T) {
+	types := make(map[string]string)
+	for _, m := range schema.Migrations() {
+		for _, stmt := range m.Up(dialect.MySQL) {
+			table := tableName.FindStringSubmatch(stmt)
+			if table == nil {
+				continue
+			}
+			for _, match := range refColumn.FindAllStringSubmatch(stmt, -1) {
+				types[table[1]+"."+match[1]] = match[2]
+			}
+		}
+	}
+	if len(types) == 0 {
+		t.Fatal("no sales or repeat column found")
+	}
+	for col, typ := range types {
+		if typ != "BIGINT" {
+			t.Errorf("%s is %s, want BIGINT", col, typ)
+		}
+	}
+}
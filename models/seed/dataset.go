@@ -0,0 +1,167 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dataset is a set of fixtures for a development database. Sales are
+// referenced from repeats by Ref, because their ids are assigned on insert.
+type Dataset struct {
+	Warehouses []Warehouse `json:"warehouses" yaml:"warehouses"`
+	Routes     []Route     `json:"routes" yaml:"routes"`
+	Goods      []Goods     `json:"goods" yaml:"goods"`
+	Customers  []Customer  `json:"customers" yaml:"customers"`
+	Sales      []Sales     `json:"sales" yaml:"sales"`
+	Repeats    []Repeat    `json:"repeats" yaml:"repeats"`
+	Stock      []Stock     `json:"stock" yaml:"stock"`
+}
+
+// Warehouse is a yc_warehouse fixture
+type Warehouse struct {
+	Warehouse     string `json:"warehouse" yaml:"warehouse"`
+	Name          string `json:"name" yaml:"name"`
+	SourceFg      bool   `json:"source_fg" yaml:"source_fg"`
+	DestinationFg bool   `json:"destination_fg" yaml:"destination_fg"`
+	BulkFg        bool   `json:"bulk_fg" yaml:"bulk_fg"`
+}
+
+// Route is a yc_warehouse_route fixture; routes are loaded active
+type Route struct {
+	From     string `json:"from" yaml:"from"`
+	To       string `json:"to" yaml:"to"`
+	Priority int    `json:"priority" yaml:"priority"`
+}
+
+// Goods is a yc_goods fixture
+type Goods struct {
+	Goods        string `json:"goods" yaml:"goods"`
+	Name         string `json:"name" yaml:"name"`
+	Qty          string `json:"qty" yaml:"qty"`
+	SeparatelyFg bool   `json:"separately_fg" yaml:"separately_fg"`
+}
+
+// Customer is a yc_customer fixture with its tanks (yc_customer_detail)
+// and the goods it may order (yc_customer_goods)
+type Customer struct {
+	Customer string   `json:"customer" yaml:"customer"`
+	Name     string   `json:"name" yaml:"name"`
+	Pref     string   `json:"pref" yaml:"pref"`
+	Tanks    []string `json:"tanks" yaml:"tanks"`
+	Goods    []string `json:"goods" yaml:"goods"`
+}
+
+// Sales is a yc_sales fixture
+type Sales struct {
+	Ref               string `json:"ref" yaml:"ref"`
+	Class             int    `json:"class" yaml:"class"`
+	Customer          string `json:"customer" yaml:"customer"`
+	Goods             string `json:"goods" yaml:"goods"`
+	Qty               string `json:"qty" yaml:"qty"`
+	ShipAddr          string `json:"ship_addr" yaml:"ship_addr"`
+	OutgoingWarehouse string `json:"outgoing_warehouse" yaml:"outgoing_warehouse"`
+	DeliveryDt        string `json:"delivery_dt" yaml:"delivery_dt"`
+	ArrivalDt         string `json:"arrival_dt" yaml:"arrival_dt"`
+	RepeatFg          bool   `json:"repeat_fg" yaml:"repeat_fg"`
+	Status            int    `json:"status" yaml:"status"`
+	Remark            string `json:"remark" yaml:"remark"`
+}
+
+// Repeat is a yc_schedule_repeat fixture
+type Repeat struct {
+	Sales     string `json:"sales" yaml:"sales"`
+	Period    int    `json:"period" yaml:"period"`
+	Span      int    `json:"span" yaml:"span"`
+	DayOfWeek string `json:"day_of_week" yaml:"day_of_week"`
+	RRule     string `json:"rrule" yaml:"rrule"`
+	// RollPolicy is a calendar.Policy: 0 next business day, 1 previous,
+	// 2 skip, 3 keep
+	RollPolicy int    `json:"roll_policy" yaml:"roll_policy"`
+	RepeatSDt  string `json:"repeat_s_dt" yaml:"repeat_s_dt"`
+	RepeatEDt  string `json:"repeat_e_dt" yaml:"repeat_e_dt"`
+}
+
+// Stock is a yc_stock fixture with its yc_stock_detail rows
+type Stock struct {
+	Stock     string        `json:"stock" yaml:"stock"`
+	Goods     string        `json:"goods" yaml:"goods"`
+	Warehouse string        `json:"warehouse" yaml:"warehouse"`
+	Qty       string        `json:"qty" yaml:"qty"`
+	ArrivalDt string        `json:"arrival_dt" yaml:"arrival_dt"`
+	Details   []StockDetail `json:"details" yaml:"details"`
+}
+
+// StockDetail is a yc_stock_detail fixture
+type StockDetail struct {
+	Lot     string `json:"lot" yaml:"lot"`
+	Barcode string `json:"barcode" yaml:"barcode"`
+}
+
+// ReadFile parses a fixture file. The format is chosen by extension:
+// .json, or .yaml/.yml.
+func ReadFile(path string) (*Dataset, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &Dataset{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, ds)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, ds)
+	default:
+		return nil, fmt.Errorf("seed: unknown fixture format %q", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("seed: %s: %w", path, err)
+	}
+
+	return ds, nil
+}
+
+// Merge appends the fixtures of other to ds. A warehouse or route equal
+// to one ds already has is skipped, so generated data can be merged with
+// fixtures that define the same warehouses; one that differs is kept for
+// Validate to report.
+func (ds *Dataset) Merge(other *Dataset) {
+	for _, w := range other.Warehouses {
+		if !containsWarehouse(ds.Warehouses, w) {
+			ds.Warehouses = append(ds.Warehouses, w)
+		}
+	}
+	for _, r := range other.Routes {
+		if !containsRoute(ds.Routes, r) {
+			ds.Routes = append(ds.Routes, r)
+		}
+	}
+	ds.Goods = append(ds.Goods, other.Goods...)
+	ds.Customers = append(ds.Customers, other.Customers...)
+	ds.Sales = append(ds.Sales, other.Sales...)
+	ds.Repeats = append(ds.Repeats, other.Repeats...)
+	ds.Stock = append(ds.Stock, other.Stock...)
+}
+
+func containsWarehouse(list []Warehouse, w Warehouse) bool {
+	for _, v := range list {
+		if v == w {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRoute(list []Route, r Route) bool {
+	for _, v := range list {
+		if v == r {
+			return true
+		}
+	}
+	return false
+}
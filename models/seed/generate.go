@@ -0,0 +1,155 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+)
+
+// GenerateOptions sizes a synthetic dataset
+type GenerateOptions struct {
+	Customers int
+	Months    int
+	// Start is the first delivery month; zero means the current month in
+	// the business timezone
+	Start time.Time
+	// Seed makes the output reproducible
+	Seed int64
+}
+
+var (
+	farmPrefixes = []string{"梅田", "北川", "山本", "丹波", "西村", "中島", "大野", "高橋", "森", "藤井"}
+	farmSuffixes = []string{"畜産", "牧場", "ファーム", "養鶏場"}
+	tankNames    = []string{"A棟", "B棟", "C棟", "D棟"}
+	warehouses   = []string{"1", "2"}
+)
+
+// genPrefix starts every goods, customer, stock and sales ref code that
+// Generate makes, so that generated data never collides with the fixture
+// files it is merged with
+const genPrefix = "G-"
+
+// genBarcode is the GS1 prefix of generated barcodes. Prefixes 20-29 are
+// kept for restricted distribution and never issued to products, unlike
+// the 49 and 45 of real Japanese barcodes used by fixtures.
+const genBarcode = "29"
+
+var catalog = []Goods{
+	{Goods: genPrefix + "101", Name: "ミルククイーン", Qty: "1", SeparatelyFg: true},
+	{Goods: genPrefix + "102", Name: "ミルククイーン", Qty: "0.02"},
+	{Goods: genPrefix + "201", Name: "肥育前期", Qty: "1", SeparatelyFg: true},
+	{Goods: genPrefix + "202", Name: "肥育後期", Qty: "1", SeparatelyFg: true},
+	{Goods: genPrefix + "301", Name: "育成用配合", Qty: "0.02"},
+	{Goods: genPrefix + "401", Name: "採卵鶏用", Qty: "1", SeparatelyFg: true},
+	{Goods: genPrefix + "402", Name: "ブロイラー仕上", Qty: "1", SeparatelyFg: true},
+	{Goods: genPrefix + "501", Name: "子牛用スターター", Qty: "0.02"},
+}
+
+// Generate builds a realistic dataset of o.Customers farms ordering over
+// o.Months months, with repeat orders for about a third of them and a
+// monthly stock receipt per goods. Its codes start with "G-" and its
+// barcodes with 29; the warehouses are the usual "1" and "2".
+func Generate(o GenerateOptions) *Dataset {
+	rng := rand.New(rand.NewSource(o.Seed))
+	start := o.Start
+	if start.IsZero() {
+		start = civil.Today().Time()
+	}
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, o.Months, -1)
+
+	ds := &Dataset{
+		Warehouses: []Warehouse{
+			{Warehouse: "1", Name: "本社倉庫", DestinationFg: true, BulkFg: true},
+			{Warehouse: "2", Name: "丹波SP", SourceFg: true},
+		},
+		Routes: []Route{{From: "2", To: "1"}},
+		Goods:  append([]Goods{}, catalog...),
+	}
+
+	for i := 0; i < o.Customers; i++ {
+		c := Customer{
+			Customer: fmt.Sprintf("%sC%05d", genPrefix, i+1),
+			Name:     farmPrefixes[rng.Intn(len(farmPrefixes))] + farmSuffixes[rng.Intn(len(farmSuffixes))],
+			Tanks:    append([]string{}, tankNames[:1+rng.Intn(len(tankNames))]...),
+		}
+		for _, j := range rng.Perm(len(catalog))[:1+rng.Intn(3)] {
+			c.Goods = append(c.Goods, catalog[j].Goods)
+		}
+		ds.Customers = append(ds.Customers, c)
+
+		warehouse := warehouses[rng.Intn(len(warehouses))]
+		for dt := start.AddDate(0, 0, rng.Intn(7)); !dt.After(end); dt = dt.AddDate(0, 0, 7+rng.Intn(8)) {
+			goods := c.Goods[rng.Intn(len(c.Goods))]
+			ds.Sales = append(ds.Sales, Sales{
+				Customer:          c.Customer,
+				Goods:             goods,
+				Qty:               randomQty(rng, goods),
+				ShipAddr:          c.Tanks[rng.Intn(len(c.Tanks))],
+				OutgoingWarehouse: warehouse,
+				DeliveryDt:        dt.Format("2006-01-02"),
+				ArrivalDt:         dt.AddDate(0, 0, -3).Format("2006-01-02"),
+			})
+		}
+
+		if rng.Intn(3) == 0 {
+			ref := c.Customer + "-repeat"
+			goods := c.Goods[0]
+			first := start.AddDate(0, 0, rng.Intn(7))
+			ds.Sales = append(ds.Sales, Sales{
+				Ref:               ref,
+				Customer:          c.Customer,
+				Goods:             goods,
+				Qty:               randomQty(rng, goods),
+				ShipAddr:          c.Tanks[0],
+				OutgoingWarehouse: warehouse,
+				DeliveryDt:        first.Format("2006-01-02"),
+				ArrivalDt:         first.AddDate(0, 0, -3).Format("2006-01-02"),
+				RepeatFg:          true,
+			})
+			r := Repeat{Sales: ref, Period: 1, RepeatSDt: first.Format("2006-01-02"), RepeatEDt: end.Format("2006-01-02")}
+			if rng.Intn(2) == 0 {
+				r.Period, r.Span = 9, 10+rng.Intn(5)
+			}
+			ds.Repeats = append(ds.Repeats, r)
+		}
+	}
+
+	barcode := 0
+	for m := 0; m < o.Months; m++ {
+		month := start.AddDate(0, m, 0)
+		for _, g := range catalog {
+			st := Stock{
+				Stock:     fmt.Sprintf("%s-%s", g.Goods, month.Format("200601")),
+				Goods:     g.Goods,
+				Warehouse: "2",
+				ArrivalDt: month.AddDate(0, 0, rng.Intn(5)).Format("2006-01-02"),
+			}
+			n := 10 + rng.Intn(21)
+			for k := 0; k < n; k++ {
+				barcode++
+				st.Details = append(st.Details, StockDetail{
+					Lot:     fmt.Sprintf("L%s%s-%02d", month.Format("0601"), g.Goods[len(genPrefix):], k/10+1),
+					Barcode: fmt.Sprintf("%s%011d", genBarcode, barcode),
+				})
+			}
+			st.Qty = fmt.Sprintf("%d", n)
+			ds.Stock = append(ds.Stock, st)
+		}
+	}
+
+	return ds
+}
+
+// randomQty returns a delivery quantity in tons: whole tons for bulk goods,
+// part of a ton for bagged goods
+func randomQty(rng *rand.Rand, goods string) string {
+	for _, g := range catalog {
+		if g.Goods == goods && !g.SeparatelyFg {
+			return fmt.Sprintf("%d.%03d", rng.Intn(2), 200+rng.Intn(800))
+		}
+	}
+	return fmt.Sprintf("%d", 2+rng.Intn(9))
+}
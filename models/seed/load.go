@@ -0,0 +1,343 @@
+package seed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/geeknow112/srv-tools/models/calendar"
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/recurrence"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+// ValidationError lists every referential problem found in a dataset
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("seed: %d problem(s):\n  %s", len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+// Summary counts the records written by Load
+type Summary struct {
+	Warehouses int
+	Routes     int
+	Goods      int
+	Customers  int
+	Tanks      int
+	Sales      int
+	Repeats    int
+	Stock      int
+	Details    int
+}
+
+// Validate checks the dataset before anything is written. A reference is
+// satisfied by a record in the dataset or, when store is not nil, by one
+// already in the database.
+func Validate(ds *Dataset, store *repository.Store) error {
+	var problems []string
+	bad := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	warehouses := make(map[string]bool)
+	for i, w := range ds.Warehouses {
+		if w.Warehouse == "" {
+			bad("warehouses[%d]: empty code", i)
+			continue
+		}
+		if warehouses[w.Warehouse] {
+			bad("warehouses[%d]: duplicate code %q", i, w.Warehouse)
+		}
+		warehouses[w.Warehouse] = true
+	}
+	hasWarehouse := func(code string) bool {
+		if warehouses[code] {
+			return true
+		}
+		if store == nil {
+			return false
+		}
+		_, err := store.Warehouses.Get(code)
+		return err == nil
+	}
+	for i, r := range ds.Routes {
+		if !hasWarehouse(r.From) {
+			bad("routes[%d]: unknown warehouse %q", i, r.From)
+		}
+		if !hasWarehouse(r.To) {
+			bad("routes[%d]: unknown warehouse %q", i, r.To)
+		}
+		if r.From == r.To {
+			bad("routes[%d]: route from %q to itself", i, r.From)
+		}
+	}
+
+	goods := make(map[string]bool)
+	for i, g := range ds.Goods {
+		if g.Goods == "" {
+			bad("goods[%d]: empty code", i)
+			continue
+		}
+		if goods[g.Goods] {
+			bad("goods[%d]: duplicate code %q", i, g.Goods)
+		}
+		goods[g.Goods] = true
+		if _, err := scan.ParseQty(g.Qty); err != nil {
+			bad("goods %q: %v", g.Goods, err)
+		}
+	}
+	hasGoods := func(code string) bool {
+		if goods[code] {
+			return true
+		}
+		if store == nil {
+			return false
+		}
+		_, err := store.Goods.Get(code)
+		return err == nil
+	}
+
+	customers := make(map[string]bool)
+	for i, c := range ds.Customers {
+		if c.Customer == "" {
+			bad("customers[%d]: empty code", i)
+			continue
+		}
+		if customers[c.Customer] {
+			bad("customers[%d]: duplicate code %q", i, c.Customer)
+		}
+		customers[c.Customer] = true
+		for _, g := range c.Goods {
+			if !hasGoods(g) {
+				bad("customer %q: unknown goods %q", c.Customer, g)
+			}
+		}
+	}
+	hasCustomer := func(code string) bool {
+		if customers[code] {
+			return true
+		}
+		if store == nil {
+			return false
+		}
+		_, err := store.Customers.Get(code)
+		return err == nil
+	}
+
+	refs := make(map[string]bool)
+	for i, s := range ds.Sales {
+		if s.Ref != "" {
+			if refs[s.Ref] {
+				bad("sales[%d]: duplicate ref %q", i, s.Ref)
+			}
+			refs[s.Ref] = true
+		}
+		if !hasCustomer(s.Customer) {
+			bad("sales[%d]: unknown customer %q", i, s.Customer)
+		}
+		if !hasGoods(s.Goods) {
+			bad("sales[%d]: unknown goods %q", i, s.Goods)
+		}
+		if _, err := scan.ParseQty(s.Qty); err != nil {
+			bad("sales[%d]: %v", i, err)
+		}
+		if !validDate(s.DeliveryDt) {
+			bad("sales[%d]: invalid delivery_dt %q", i, s.DeliveryDt)
+		}
+		if s.ArrivalDt != "" && !validDate(s.ArrivalDt) {
+			bad("sales[%d]: invalid arrival_dt %q", i, s.ArrivalDt)
+		}
+	}
+
+	for i, r := range ds.Repeats {
+		if !refs[r.Sales] {
+			bad("repeats[%d]: unknown sales ref %q", i, r.Sales)
+		}
+		if _, err := recurrence.ForRepeat(strconv.Itoa(r.Period), strconv.Itoa(r.Span), r.DayOfWeek, r.RRule, r.RepeatSDt, r.RepeatEDt); err != nil {
+			bad("repeats[%d]: %v", i, err)
+		}
+		if _, err := calendar.ParsePolicy(strconv.Itoa(r.RollPolicy)); err != nil {
+			bad("repeats[%d]: %v", i, err)
+		}
+	}
+
+	stocks := make(map[string]bool)
+	barcodes := make(map[string]bool)
+	for i, st := range ds.Stock {
+		if st.Stock == "" {
+			bad("stock[%d]: empty code", i)
+		} else if stocks[st.Stock] {
+			bad("stock[%d]: duplicate code %q", i, st.Stock)
+		}
+		stocks[st.Stock] = true
+		if !hasGoods(st.Goods) {
+			bad("stock %q: unknown goods %q", st.Stock, st.Goods)
+		}
+		if st.Warehouse == "" {
+			bad("stock %q: empty warehouse", st.Stock)
+		} else if !hasWarehouse(st.Warehouse) {
+			bad("stock %q: unknown warehouse %q", st.Stock, st.Warehouse)
+		}
+		if st.ArrivalDt != "" && !validDate(st.ArrivalDt) {
+			bad("stock %q: invalid arrival_dt %q", st.Stock, st.ArrivalDt)
+		}
+		for _, d := range st.Details {
+			if d.Barcode == "" {
+				continue
+			}
+			if barcodes[d.Barcode] {
+				bad("stock %q: duplicate barcode %q", st.Stock, d.Barcode)
+			}
+			barcodes[d.Barcode] = true
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Load validates ds and writes it in dependency order: warehouses and
+// routes, goods, customers (with tanks and goods), sales, repeats, then
+// stock with its ledger receipt. Everything is written in one transaction,
+// so nothing is left behind when Load fails.
+func Load(store *repository.Store, ds *Dataset) (*Summary, error) {
+	if err := Validate(ds, store); err != nil {
+		return nil, err
+	}
+	sum := &Summary{}
+	if err := store.Tx(func(tx *repository.Store) error { return load(tx, ds, sum) }); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+func load(store *repository.Store, ds *Dataset, sum *Summary) error {
+	for _, w := range ds.Warehouses {
+		row := &repository.Warehouse{Warehouse: w.Warehouse, Name: w.Name, SourceFg: w.SourceFg, DestinationFg: w.DestinationFg, BulkFg: w.BulkFg}
+		if err := store.Warehouses.Save(row); err != nil {
+			return fmt.Errorf("seed: warehouse %q: %w", w.Warehouse, err)
+		}
+		sum.Warehouses++
+	}
+	for i, r := range ds.Routes {
+		if err := store.Warehouses.SaveRoute(&repository.WarehouseRoute{From: r.From, To: r.To, Priority: r.Priority, ActiveFg: true}); err != nil {
+			return fmt.Errorf("seed: routes[%d]: %w", i, err)
+		}
+		sum.Routes++
+	}
+
+	for _, g := range ds.Goods {
+		qty, _ := scan.ParseQty(g.Qty)
+		if err := store.Goods.Save(&repository.Goods{Goods: g.Goods, Name: g.Name, Qty: qty, SeparatelyFg: g.SeparatelyFg}); err != nil {
+			return fmt.Errorf("seed: goods %q: %w", g.Goods, err)
+		}
+		sum.Goods++
+	}
+
+	for _, c := range ds.Customers {
+		if err := store.Customers.Save(&repository.Customer{Customer: c.Customer, Name: c.Name, Pref: c.Pref}); err != nil {
+			return fmt.Errorf("seed: customer %q: %w", c.Customer, err)
+		}
+		details := make([]*repository.CustomerDetail, len(c.Tanks))
+		for i, tank := range c.Tanks {
+			details[i] = &repository.CustomerDetail{Customer: c.Customer, Tank: tank}
+		}
+		if err := store.Customers.SaveDetails(c.Customer, details); err != nil {
+			return fmt.Errorf("seed: customer %q tanks: %w", c.Customer, err)
+		}
+		if err := store.Customers.SetGoodsCodes(c.Customer, c.Goods); err != nil {
+			return fmt.Errorf("seed: customer %q goods: %w", c.Customer, err)
+		}
+		sum.Customers++
+		sum.Tanks += len(details)
+	}
+
+	names := make(map[string]string)
+	for _, c := range ds.Customers {
+		names[c.Customer] = c.Name
+	}
+	l := &ledger.Ledger{Store: store}
+	salesIDs := make(map[string]int64)
+	for i, s := range ds.Sales {
+		qty, _ := scan.ParseQty(s.Qty)
+		row := &repository.Sales{
+			Class:             s.Class,
+			Customer:          s.Customer,
+			Name:              names[s.Customer],
+			Goods:             s.Goods,
+			Qty:               qty,
+			ShipAddr:          s.ShipAddr,
+			OutgoingWarehouse: s.OutgoingWarehouse,
+			DeliveryDt:        date(s.DeliveryDt),
+			ArrivalDt:         date(s.ArrivalDt),
+			RepeatFg:          s.RepeatFg,
+			Status:            s.Status,
+			Remark:            s.Remark,
+		}
+		id, err := store.Sales.Create(row)
+		if err != nil {
+			return fmt.Errorf("seed: sales[%d]: %w", i, err)
+		}
+		if err := l.Reserve(row, "seed"); err != nil {
+			return fmt.Errorf("seed: sales[%d] reservation: %w", i, err)
+		}
+		if s.Ref != "" {
+			salesIDs[s.Ref] = id
+		}
+		sum.Sales++
+	}
+
+	for i, r := range ds.Repeats {
+		row := &repository.Repeat{
+			Sales:      salesIDs[r.Sales],
+			Period:     r.Period,
+			Span:       r.Span,
+			DayOfWeek:  r.DayOfWeek,
+			RRule:      r.RRule,
+			RollPolicy: r.RollPolicy,
+			RepeatSDt:  date(r.RepeatSDt),
+			RepeatEDt:  date(r.RepeatEDt),
+		}
+		if _, err := store.Repeats.Save(row); err != nil {
+			return fmt.Errorf("seed: repeats[%d]: %w", i, err)
+		}
+		sum.Repeats++
+	}
+
+	for _, st := range ds.Stock {
+		qty, _ := scan.ParseQty(st.Qty)
+		details := make([]*repository.StockDetail, len(st.Details))
+		for i, d := range st.Details {
+			details[i] = &repository.StockDetail{Lot: d.Lot, Barcode: d.Barcode}
+		}
+		row := &repository.Stock{Stock: st.Stock, Goods: st.Goods, Warehouse: st.Warehouse, Qty: qty, ArrivalDt: date(st.ArrivalDt)}
+		if err := store.Stock.Create(row, details); err != nil {
+			return fmt.Errorf("seed: stock %q: %w", st.Stock, err)
+		}
+		if err := l.Receive(row, details, "seed"); err != nil {
+			return fmt.Errorf("seed: stock %q receipt: %w", st.Stock, err)
+		}
+		sum.Stock++
+		sum.Details += len(details)
+	}
+
+	return nil
+}
+
+func validDate(s string) bool {
+	_, err := civil.Parse(s)
+	return err == nil
+}
+
+// date converts a validated fixture date; "" is the zero (NULL) date
+func date(s string) civil.Date {
+	d, _ := civil.Parse(s)
+	return d
+}
@@ -0,0 +1,109 @@
+package seed_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/seed"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+const devFixtures = "../../config/fixtures/dev.yaml"
+
+func readDev(t *testing.T) *seed.Dataset {
+	t.Helper()
+	ds, err := seed.ReadFile(devFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+// TestGenerateMergesWithFixtures is "seed -dry-run -customers 5" over the
+// development fixtures
+func TestGenerateMergesWithFixtures(t *testing.T) {
+	ds := readDev(t)
+	ds.Merge(seed.Generate(seed.GenerateOptions{Customers: 5, Months: 2, Start: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC), Seed: 1}))
+	if err := seed.Validate(ds, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeWarehouses(t *testing.T) {
+	ds := &seed.Dataset{}
+	ds.Merge(seed.Generate(seed.GenerateOptions{Customers: 1, Months: 1, Seed: 1}))
+	if len(ds.Warehouses) != 2 || len(ds.Routes) != 1 {
+		t.Fatalf("merged %d warehouses and %d routes, want 2 and 1", len(ds.Warehouses), len(ds.Routes))
+	}
+	if err := seed.Validate(ds, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ds.Merge(&seed.Dataset{Warehouses: []seed.Warehouse{{Warehouse: "1", Name: "other"}}})
+	if len(ds.Warehouses) != 3 {
+		t.Fatalf("a different warehouse 1 was dropped: %+v", ds.Warehouses)
+	}
+	if err := seed.Validate(ds, nil); err == nil {
+		t.Error("Validate accepted two different warehouses 1")
+	}
+}
+
+func TestValidateStockWarehouse(t *testing.T) {
+	ds := &seed.Dataset{
+		Goods: []seed.Goods{{Goods: "101", Name: "feed"}},
+		Stock: []seed.Stock{{Stock: "S1", Goods: "101", Warehouse: "9"}},
+	}
+	err := seed.Validate(ds, nil)
+	if err == nil || !strings.Contains(err.Error(), `unknown warehouse "9"`) {
+		t.Errorf("Validate err = %v, want the unknown warehouse", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	store := repository.NewMemory()
+	sum, err := seed.Load(store, readDev(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Goods != 2 || sum.Customers != 1 || sum.Tanks != 2 || sum.Sales != 1 || sum.Repeats != 1 || sum.Stock != 1 || sum.Details != 3 {
+		t.Errorf("Summary = %+v", sum)
+	}
+
+	balances, err := store.Ledger.Balances(repository.LedgerFilter{Goods: "101", Warehouse: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Lot != "L2212101-01" || balances[0].OnHand != scan.NewQty(3) {
+		t.Errorf("Balances = %+v", balances)
+	}
+}
+
+// TestLoadIsAtomic loads the fixtures twice: the second run fails on the
+// stock already there and must not leave its sales behind
+func TestLoadIsAtomic(t *testing.T) {
+	store := repository.NewSQL(testdb.New(t), testdb.Dialect)
+	if _, err := seed.Load(store, readDev(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seed.Load(store, readDev(t)); err == nil {
+		t.Fatal("loading the same stock twice succeeded")
+	}
+
+	sales, err := store.Sales.List(repository.SalesFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sales) != 1 {
+		t.Errorf("%d sales after the failed load, want 1", len(sales))
+	}
+	entries, err := store.Ledger.Entries(repository.LedgerFilter{Ref: "S202212101"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d ledger entries after the failed load, want 1", len(entries))
+	}
+}
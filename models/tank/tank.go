@@ -0,0 +1,261 @@
+// Package tank estimates the level of customer tanks and keeps deliveries
+// from overfilling them.
+//
+// A tank is a yc_customer_detail row. Its level is read on the farm now
+// and then; in between, the level is estimated from the last reading: the
+// deliveries booked into the tank since, as split by the lot slots of the
+// sales, less DailyUse for every day. A customer with a single tank gets
+// every delivery in it, slots or not. A reading also corrects DailyUse to
+// what the customer actually used since the previous one.
+//
+// Check refuses lot slots that would put goods into a tank not allowed to
+// hold them, or more into a tank than the estimated free space on the
+// delivery date. A tank without capacity is not checked; one never read
+// is assumed empty on the delivery date.
+package tank
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+)
+
+var (
+	// ErrOverfill is wrapped when a delivery does not fit in a tank
+	ErrOverfill = errors.New("tank: delivery would overfill the tank")
+	// ErrGoodsNotAllowed is wrapped when a tank may not hold the goods
+	ErrGoodsNotAllowed = errors.New("tank: goods not allowed in the tank")
+	// ErrReading is wrapped for a level reading that cannot be right
+	ErrReading = errors.New("tank: invalid level reading")
+)
+
+// Status is a tank with its estimated level on a day
+type Status struct {
+	*repository.CustomerDetail
+	// Goods the tank may hold; empty allows any
+	Goods []string
+	On    civil.Date
+	// Estimated is the level on On, after its deliveries
+	Estimated scan.Qty
+}
+
+// Free is the room left in the tank on On; it is meaningless when the
+// capacity is unknown
+func (s *Status) Free() scan.Qty {
+	if s.Estimated >= s.Capacity {
+		return 0
+	}
+	return s.Capacity - s.Estimated
+}
+
+// Tanks estimates tank levels
+type Tanks struct {
+	Store *repository.Store
+}
+
+// delivery is a quantity delivered into a tank on a day
+type delivery struct {
+	dt  civil.Date
+	qty scan.Qty
+}
+
+// List returns the tanks of customer with their level estimated on on
+func (t *Tanks) List(customer string, on civil.Date) ([]*Status, error) {
+	details, err := t.Store.Customers.Details(customer)
+	if err != nil {
+		return nil, err
+	}
+	goods, err := t.Store.Customers.TankGoods(customer)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Status, 0, len(details))
+	for _, d := range details {
+		level, err := t.estimate(d, len(details) == 1, on, 0)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &Status{CustomerDetail: d, Goods: goods[d.Tank], On: on, Estimated: level})
+	}
+	return ret, nil
+}
+
+// Get returns tank of customer with its level estimated on on
+func (t *Tanks) Get(customer, tank string, on civil.Date) (*Status, error) {
+	list, err := t.List(customer, on)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range list {
+		if s.Tank == tank {
+			return s, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+// Check checks that the slots of sales s fit the customer's tanks on its
+// delivery date, next to everything else delivered into them by then
+func (t *Tanks) Check(s *repository.Sales, slots []*repository.LotSlot) error {
+	details, err := t.Store.Customers.Details(s.Customer)
+	if err != nil {
+		return err
+	}
+	goods, err := t.Store.Customers.TankGoods(s.Customer)
+	if err != nil {
+		return err
+	}
+
+	into := make(map[string]scan.Qty)
+	for _, slot := range slots {
+		tank := slot.Tank
+		if tank == "" && len(details) == 1 {
+			tank = details[0].Tank
+		}
+		into[tank] += slot.Qty
+	}
+	for _, d := range details {
+		qty, ok := into[d.Tank]
+		if !ok {
+			continue
+		}
+		if allowed := goods[d.Tank]; len(allowed) > 0 && !contains(allowed, s.Goods) {
+			return fmt.Errorf("%w: %s in tank %s", ErrGoodsNotAllowed, s.Goods, d.Tank)
+		}
+		if d.Capacity <= 0 {
+			continue
+		}
+		level, err := t.estimate(d, len(details) == 1, s.DeliveryDt, s.Sales)
+		if err != nil {
+			return err
+		}
+		if level+qty > d.Capacity {
+			return fmt.Errorf("%w: tank %s holds %s of %s on %s, %s more does not fit", ErrOverfill, d.Tank, level, d.Capacity, s.DeliveryDt, qty)
+		}
+	}
+	return nil
+}
+
+// Reading records level as read in tank of customer on on. When the tank
+// was read before, DailyUse becomes what was used per day since.
+func (t *Tanks) Reading(customer, tank string, level scan.Qty, on civil.Date) (*Status, error) {
+	details, err := t.Store.Customers.Details(customer)
+	if err != nil {
+		return nil, err
+	}
+	var d *repository.CustomerDetail
+	for _, cd := range details {
+		if cd.Tank == tank {
+			d = cd
+		}
+	}
+	switch {
+	case d == nil:
+		return nil, repository.ErrNotFound
+	case level < 0:
+		return nil, fmt.Errorf("%w: level %s is negative", ErrReading, level)
+	case d.Capacity > 0 && level > d.Capacity:
+		return nil, fmt.Errorf("%w: level %s exceeds the capacity of %s", ErrReading, level, d.Capacity)
+	case !d.LevelDt.IsZero() && on.Before(d.LevelDt):
+		return nil, fmt.Errorf("%w: %s is before the last reading on %s", ErrReading, on, d.LevelDt)
+	}
+
+	if days := on.DaysSince(d.LevelDt); !d.LevelDt.IsZero() && days > 0 {
+		in, err := t.deliveries(d, len(details) == 1, d.LevelDt, on, 0)
+		if err != nil {
+			return nil, err
+		}
+		used := d.Level - level
+		for _, dl := range in {
+			used += dl.qty
+		}
+		// Less than nothing used means a delivery was not booked; keep
+		// the old estimate rather than learn from it
+		if used >= 0 {
+			d.DailyUse = used / scan.Qty(days)
+		}
+	}
+	d.Level, d.LevelDt = level, on
+	if err := t.Store.Customers.SaveTank(d); err != nil {
+		return nil, err
+	}
+	return t.Get(customer, tank, on)
+}
+
+// estimate is the level of d on on after that day's deliveries, leaving
+// out sales exclude
+func (t *Tanks) estimate(d *repository.CustomerDetail, only bool, on civil.Date, exclude int64) (scan.Qty, error) {
+	if !d.LevelDt.IsZero() && on.Before(d.LevelDt) {
+		return d.Level, nil
+	}
+	from := d.LevelDt
+	if from.IsZero() {
+		// Never read: empty until the deliveries of the day
+		from = on.AddDays(-1)
+	}
+	in, err := t.deliveries(d, only, from, on, exclude)
+	if err != nil {
+		return 0, err
+	}
+	level, last := d.Level, from
+	use := func(to civil.Date) {
+		level -= d.DailyUse * scan.Qty(to.DaysSince(last))
+		if level < 0 {
+			level = 0
+		}
+		last = to
+	}
+	for _, dl := range in {
+		use(dl.dt)
+		level += dl.qty
+	}
+	use(on)
+	return level, nil
+}
+
+// deliveries lists what the sales of the customer of d deliver into it
+// after from up to and including to, by date. only is set when it is the
+// customer's only tank.
+func (t *Tanks) deliveries(d *repository.CustomerDetail, only bool, from, to civil.Date, exclude int64) ([]delivery, error) {
+	sales, err := t.Store.Sales.List(repository.SalesFilter{Customer: d.Customer, DeliveryFrom: from.AddDays(1), DeliveryTo: to})
+	if err != nil {
+		return nil, err
+	}
+	var ret []delivery
+	for _, s := range sales {
+		if s.Sales == exclude || s.Status == 9 {
+			continue
+		}
+		slots, err := t.Store.Lots.Slots(s.Sales)
+		if err != nil {
+			return nil, err
+		}
+		var qty scan.Qty
+		for _, slot := range slots {
+			if slot.Tank == d.Tank || (only && slot.Tank == "") {
+				qty += slot.Qty
+			}
+		}
+		if len(slots) == 0 && only {
+			qty = s.Qty
+		}
+		if qty > 0 {
+			ret = append(ret, delivery{dt: s.DeliveryDt, qty: qty})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].dt.Before(ret[j].dt) })
+	return ret, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
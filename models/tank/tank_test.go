@@ -0,0 +1,160 @@
+package tank_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/tank"
+	"github.com/geeknow112/srv-tools/models/testdb"
+)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func q(s string) scan.Qty {
+	qty, err := scan.ParseQty(s)
+	if err != nil {
+		panic(err)
+	}
+	return qty
+}
+
+var d = civil.MustParse
+
+// forEachStore runs f against the in-memory store and a SQLite database
+func forEachStore(t *testing.T, f func(t *testing.T, st *repository.Store)) {
+	t.Helper()
+	t.Run("memory", func(t *testing.T) {
+		f(t, repository.NewMemory())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		f(t, repository.NewSQL(testdb.New(t), testdb.Dialect))
+	})
+}
+
+// order creates a sales of qty of goods for customer C1 delivered on dt
+func order(t *testing.T, st *repository.Store, goods, qty, dt string) *repository.Sales {
+	t.Helper()
+	s := &repository.Sales{Customer: "C1", Goods: goods, Qty: q(qty), DeliveryDt: d(dt)}
+	_, err := st.Sales.Create(s)
+	must(t, err)
+	return s
+}
+
+func into(tank, qty string) []*repository.LotSlot {
+	return []*repository.LotSlot{{Tank: tank, Qty: q(qty)}}
+}
+
+// TestCheckCapacity fills the only tank of C1, 10t and full when read on
+// 2026-10-19, using 2t a day. A 2t delivery on 2026-10-21 leaves it at 8t,
+// so on 2026-10-22 it holds 6t and takes exactly 4t more.
+func TestCheckCapacity(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		must(t, st.Customers.SaveDetails("C1", []*repository.CustomerDetail{
+			{Tank: "T1", Capacity: q("10"), DailyUse: q("2"), Level: q("10"), LevelDt: d("2026-10-19")},
+		}))
+		order(t, st, "101", "2", "2026-10-21")
+		s := order(t, st, "101", "4", "2026-10-22")
+		tanks := &tank.Tanks{Store: st}
+
+		must(t, tanks.Check(s, into("T1", "4")))
+		// A slot without a tank goes into the only one
+		must(t, tanks.Check(s, into("", "4")))
+		for _, qty := range []string{"4.001", "6"} {
+			if err := tanks.Check(s, into("T1", qty)); !errors.Is(err, tank.ErrOverfill) {
+				t.Errorf("Check of %st: err = %v, want ErrOverfill", qty, err)
+			}
+		}
+
+		// A day earlier the tank still holds 8t
+		s.DeliveryDt = d("2026-10-21")
+		if err := tanks.Check(s, into("T1", "4")); !errors.Is(err, tank.ErrOverfill) {
+			t.Errorf("Check of 4t on 2026-10-21: err = %v, want ErrOverfill", err)
+		}
+		must(t, tanks.Check(s, into("T1", "2")))
+
+		// A tank without capacity takes anything
+		must(t, st.Customers.SaveTank(&repository.CustomerDetail{Customer: "C1", Tank: "T1"}))
+		must(t, tanks.Check(s, into("T1", "100")))
+	})
+}
+
+// TestCheckGoods lets tank T1 of C1 hold goods 101 only; tank T2 holds any
+func TestCheckGoods(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		must(t, st.Customers.SaveDetails("C1", []*repository.CustomerDetail{{Tank: "T1"}, {Tank: "T2"}}))
+		must(t, st.Customers.SetTankGoods("C1", "T1", []string{"101"}))
+		tanks := &tank.Tanks{Store: st}
+
+		allowed := order(t, st, "101", "1", "2026-10-21")
+		other := order(t, st, "102", "1", "2026-10-21")
+		must(t, tanks.Check(allowed, into("T1", "1")))
+		must(t, tanks.Check(other, into("T2", "1")))
+		if err := tanks.Check(other, into("T1", "1")); !errors.Is(err, tank.ErrGoodsNotAllowed) {
+			t.Errorf("Check of goods 102 into T1: err = %v, want ErrGoodsNotAllowed", err)
+		}
+	})
+}
+
+// TestLevel reads 10t in the only tank of C1 on 2026-10-19, using 2t a
+// day, with 5t delivered on 2026-10-21. The reading of 6t on 2026-10-23
+// shows 9t used in 4 days.
+func TestLevel(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st *repository.Store) {
+		must(t, st.Customers.SaveDetails("C1", []*repository.CustomerDetail{
+			{Tank: "T1", Capacity: q("20"), DailyUse: q("2"), Level: q("10"), LevelDt: d("2026-10-19")},
+		}))
+		order(t, st, "101", "5", "2026-10-21")
+		tanks := &tank.Tanks{Store: st}
+
+		tests := []struct {
+			on   string
+			want string
+		}{
+			{"2026-10-18", "10"},
+			{"2026-10-19", "10"},
+			{"2026-10-20", "8"},
+			{"2026-10-21", "11"},
+			{"2026-10-23", "7"},
+			{"2026-10-30", "0"},
+		}
+		for _, tt := range tests {
+			s, err := tanks.Get("C1", "T1", d(tt.on))
+			must(t, err)
+			if s.Estimated != q(tt.want) {
+				t.Errorf("level on %s = %s, want %s", tt.on, s.Estimated, tt.want)
+			}
+		}
+
+		s, err := tanks.Reading("C1", "T1", q("6"), d("2026-10-23"))
+		must(t, err)
+		if s.DailyUse != q("2.25") || s.Estimated != q("6") {
+			t.Errorf("after the reading: daily use %s, level %s; want 2.25 and 6", s.DailyUse, s.Estimated)
+		}
+		s, err = tanks.Get("C1", "T1", d("2026-10-25"))
+		must(t, err)
+		if s.Estimated != q("1.5") {
+			t.Errorf("level on 2026-10-25 = %s, want 1.5", s.Estimated)
+		}
+
+		bad := []struct {
+			level, on string
+		}{
+			{"-1", "2026-10-24"},
+			{"21", "2026-10-24"},
+			{"5", "2026-10-22"},
+		}
+		for _, tt := range bad {
+			if _, err := tanks.Reading("C1", "T1", q(tt.level), d(tt.on)); !errors.Is(err, tank.ErrReading) {
+				t.Errorf("Reading of %s on %s: err = %v, want ErrReading", tt.level, tt.on, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package testdb
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/dialect"
+	"github.com/geeknow112/srv-tools/models/schema"
+
+	_ "modernc.org/sqlite"
+)
+
+// Dialect is the dialect of databases returned by New
+var Dialect = dialect.SQLite
+
+var seq int64
+
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Fixture is a set of rows inserted into one table
+type Fixture struct {
+	Table string
+	Rows  []map[string]interface{}
+}
+
+// New opens a private in-memory database, applies the schema and loads
+// the fixtures in order. The database is closed when the test ends.
+func New(tb testing.TB, fixtures ...Fixture) *sql.DB {
+	tb.Helper()
+
+	name := fmt.Sprintf("file:testdb%d?mode=memory&cache=shared&_pragma=foreign_keys(1)", atomic.AddInt64(&seq, 1))
+	db, err := sql.Open(Dialect.Name(), name)
+	if err != nil {
+		tb.Fatalf("testdb: open: %v", err)
+	}
+	// A shared-cache memory database lives as long as one connection does.
+	db.SetMaxOpenConns(1)
+	tb.Cleanup(func() { db.Close() })
+
+	if _, err := schema.Migrate(db, Dialect); err != nil {
+		tb.Fatalf("testdb: migrate: %v", err)
+	}
+	if err := Load(db, fixtures...); err != nil {
+		tb.Fatalf("testdb: %v", err)
+	}
+
+	return db
+}
+
+// Load inserts fixture rows. Each row may list different columns.
+func Load(db *sql.DB, fixtures ...Fixture) error {
+	for _, f := range fixtures {
+		if !identPattern.MatchString(f.Table) {
+			return fmt.Errorf("invalid table %q", f.Table)
+		}
+		for i, row := range f.Rows {
+			cols := make([]string, 0, len(row))
+			for c := range row {
+				if !identPattern.MatchString(c) {
+					return fmt.Errorf("%s row %d: invalid column %q", f.Table, i, c)
+				}
+				cols = append(cols, c)
+			}
+			sort.Strings(cols)
+
+			args := make([]interface{}, len(cols))
+			for j, c := range cols {
+				args[j] = row[c]
+			}
+			if _, err := db.Exec(dialect.Insert(Dialect, f.Table, cols), args...); err != nil {
+				return fmt.Errorf("%s row %d: %w", f.Table, i, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+// Package transfer moves stock details between warehouses. A transfer is
+// identified by the stock number of the yc_stock record (transfer_fg 1)
+// it creates in the receiving warehouse; the details it takes from the
+// sending warehouse carry that number in transfer_ref.
+//
+// Which warehouse a transfer takes its stock from is configured in
+// yc_warehouse and yc_warehouse_route; Source resolves it. Send reserves
+// the details with a picking strategy and posts them to the ledger as in
+// transit; SendAll sends every line of a transfer slip at once. Receive
+// books them into the receiving warehouse.
+// Cancel gives the details back to the sending warehouse, reverses the
+// ledger and records who cancelled and why; a received transfer cannot be
+// cancelled.
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/picking"
+	"github.com/geeknow112/srv-tools/models/repository"
+)
+
+var (
+	// ErrReceived is returned when cancelling a transfer that has arrived
+	ErrReceived = errors.New("transfer: already received at the destination")
+	// ErrNoReason is returned when a cancellation gives no reason
+	ErrNoReason = errors.New("transfer: a reason is required to cancel")
+	// ErrNotTransfer is returned for a stock number that is a receipt, not
+	// a transfer
+	ErrNotTransfer = errors.New("transfer: stock is not a transfer")
+	// ErrUnknownWarehouse is wrapped for a warehouse not in yc_warehouse
+	ErrUnknownWarehouse = errors.New("transfer: unknown warehouse")
+	// ErrNoRoute is wrapped when no active route connects two warehouses
+	ErrNoRoute = errors.New("transfer: no route between the warehouses")
+	// ErrQty is wrapped when a transfer is asked for no or a negative
+	// quantity
+	ErrQty = errors.New("transfer: quantity must be positive")
+)
+
+// Service sends, receives and cancels transfers
+type Service struct {
+	Store *repository.Store
+	// Strategy picks the details to send; nil means picking.FIFO
+	Strategy picking.Strategy
+}
+
+func (s *Service) ledger() *ledger.Ledger {
+	return &ledger.Ledger{Store: s.Store}
+}
+
+// Source returns the warehouse transfers to warehouse to take their stock
+// from: the source of the active route into to with the lowest priority.
+// It returns "" for a source warehouse no route leads to, as a transfer
+// into a stock point reduces no stock.
+func (s *Service) Source(to string) (string, error) {
+	dest, err := s.warehouse(to)
+	if err != nil {
+		return "", err
+	}
+	routes, err := s.Store.Warehouses.Routes(to)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range routes {
+		if !r.ActiveFg || r.From == to {
+			continue
+		}
+		from, err := s.warehouse(r.From)
+		if err != nil {
+			return "", err
+		}
+		if from.SourceFg && dest.DestinationFg {
+			return from.Warehouse, nil
+		}
+	}
+	if dest.SourceFg {
+		return "", nil
+	}
+	return "", fmt.Errorf("%w: none into %s", ErrNoRoute, to)
+}
+
+// Route checks that transfers may go from warehouse from to warehouse to
+func (s *Service) Route(from, to string) error {
+	src, err := s.warehouse(from)
+	if err != nil {
+		return err
+	}
+	dest, err := s.warehouse(to)
+	if err != nil {
+		return err
+	}
+	if src.SourceFg && dest.DestinationFg {
+		routes, err := s.Store.Warehouses.Routes(to)
+		if err != nil {
+			return err
+		}
+		for _, r := range routes {
+			if r.From == from && r.ActiveFg {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrNoRoute, from, to)
+}
+
+func (s *Service) warehouse(code string) (*repository.Warehouse, error) {
+	w, err := s.Store.Warehouses.Get(code)
+	if err == repository.ErrNotFound {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownWarehouse, code)
+	}
+	return w, err
+}
+
+// Send takes n details of goods from warehouse from for transfer ref to
+// warehouse to. A route must lead from from to to. The details are
+// reserved and posted to the ledger in one transaction, so a failed post
+// leaves them free to be picked again.
+func (s *Service) Send(ref, goods, from, to string, n int, user string) ([]*repository.StockDetail, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d of %s", ErrQty, n, goods)
+	}
+	if err := s.Route(from, to); err != nil {
+		return nil, err
+	}
+	var picked []*repository.StockDetail
+	err := s.Store.Tx(func(tx *repository.Store) error {
+		var err error
+		if picked, err = picking.Transfer(tx.Stock, ref, goods, from, n, s.Strategy); err != nil {
+			return err
+		}
+		return (&ledger.Ledger{Store: tx}).Transfer(ref, to, picked, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return picked, nil
+}
+
+// Line is one goods row of a transfer slip: Qty details of Goods for
+// warehouse To
+type Line struct {
+	Goods string
+	To    string
+	Qty   int
+}
+
+// SendAll sends every line of transfer ref from the warehouse that
+// supplies its receiving warehouse, in one transaction: when one line
+// cannot be sent, none is. Lines without goods, receiving warehouse or
+// quantity are skipped, as are lines into a warehouse that takes no stock
+// from another.
+func (s *Service) SendAll(ref string, lines []Line, user string) error {
+	for _, l := range lines {
+		if l.Goods != "" && l.To != "" && l.Qty < 0 {
+			return fmt.Errorf("%w: %d of %s to warehouse %s", ErrQty, l.Qty, l.Goods, l.To)
+		}
+	}
+	return s.Store.Tx(func(tx *repository.Store) error {
+		svc := &Service{Store: tx, Strategy: s.Strategy}
+		for _, l := range lines {
+			if l.Goods == "" || l.To == "" || l.Qty == 0 {
+				continue
+			}
+			from, err := svc.Source(l.To)
+			if err != nil {
+				return err
+			}
+			if from == "" {
+				continue
+			}
+			if _, err := svc.Send(ref, l.Goods, from, l.To, l.Qty, user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Receive books what transfer ref has in transit into the receiving
+// warehouse. It holds the details of the transfer meanwhile, so a
+// cancellation waits for it and then finds the transfer received.
+func (s *Service) Receive(ref, user string) ([]*repository.LedgerEntry, error) {
+	var entries []*repository.LedgerEntry
+	err := s.Store.Tx(func(tx *repository.Store) error {
+		if _, err := tx.Stock.LockTransferred(ref); err != nil {
+			return err
+		}
+		var err error
+		entries, err = (&ledger.Ledger{Store: tx}).ReceiveTransfer(ref, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Cancel cancels transfer ref: its details become available again in the
+// sending warehouse, its ledger entries are reversed, its stock record is
+// deleted and the cancellation is recorded, all in one transaction. The
+// details stay locked until it ends, so a receipt running meanwhile is
+// either seen as received or waits and finds nothing left in transit.
+func (s *Service) Cancel(ref, reason, user string) (*repository.TransferCancel, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrNoReason
+	}
+
+	var c *repository.TransferCancel
+	err := s.Store.Tx(func(tx *repository.Store) error {
+		if _, err := tx.Stock.LockTransferred(ref); err != nil {
+			return err
+		}
+		header, err := tx.Stock.GetStock(ref)
+		if err != nil {
+			return err
+		}
+		if !header.TransferFg {
+			return fmt.Errorf("%w: %s", ErrNotTransfer, ref)
+		}
+
+		l := &ledger.Ledger{Store: tx}
+		received, err := l.Received(ref)
+		if err != nil {
+			return err
+		}
+		if received {
+			return fmt.Errorf("%w: %s", ErrReceived, ref)
+		}
+
+		released, err := tx.Stock.Release(ref)
+		if err != nil {
+			return err
+		}
+		if _, err := l.Cancel(ref, reason, user); err != nil && !errors.Is(err, ledger.ErrNothingToCancel) {
+			return err
+		}
+		if err := tx.Stock.DeleteTransfer(ref); err != nil {
+			return err
+		}
+		c = &repository.TransferCancel{Stock: ref, Released: released, Reason: reason, Upuser: user}
+		return tx.Stock.AddCancel(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
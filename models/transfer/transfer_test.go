@@ -0,0 +1,315 @@
+package transfer_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/geeknow112/srv-tools/models/civil"
+	"github.com/geeknow112/srv-tools/models/ledger"
+	"github.com/geeknow112/srv-tools/models/picking"
+	"github.com/geeknow112/srv-tools/models/repository"
+	"github.com/geeknow112/srv-tools/models/scan"
+	"github.com/geeknow112/srv-tools/models/testdb"
+	"github.com/geeknow112/srv-tools/models/transfer"
+)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stores opens the in-memory store and a SQLite database
+var stores = map[string]func(t *testing.T) *repository.Store{
+	"memory": func(*testing.T) *repository.Store { return repository.NewMemory() },
+	"sqlite": func(t *testing.T) *repository.Store { return repository.NewSQL(testdb.New(t), testdb.Dialect) },
+}
+
+// setup routes warehouse 1 into warehouse 2 and receives n details of
+// goods 101 into warehouse 1
+func setup(t *testing.T, st *repository.Store, n int) {
+	t.Helper()
+	must(t, st.Warehouses.Save(&repository.Warehouse{Warehouse: "1", SourceFg: true}))
+	must(t, st.Warehouses.Save(&repository.Warehouse{Warehouse: "2", DestinationFg: true}))
+	must(t, st.Warehouses.SaveRoute(&repository.WarehouseRoute{From: "1", To: "2", Priority: 1, ActiveFg: true}))
+
+	header := &repository.Stock{Stock: "S1", Goods: "101", Warehouse: "1", ArrivalDt: civil.MustParse("2026-10-01")}
+	var details []*repository.StockDetail
+	for i := 0; i < n; i++ {
+		details = append(details, &repository.StockDetail{Lot: "L1", Barcode: fmt.Sprintf("S1-%d", i+1)})
+	}
+	must(t, st.Stock.Create(header, details))
+	must(t, (&ledger.Ledger{Store: st}).Receive(header, details, "test"))
+}
+
+// TestSendConcurrent races more transfers than there is stock for:
+// every detail must go to exactly one transfer and the ledger must post
+// exactly what was taken
+func TestSendConcurrent(t *testing.T) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			st := open(t)
+			setup(t, st, 8)
+			svc := &transfer.Service{Store: st}
+
+			var (
+				wg    sync.WaitGroup
+				mu    sync.Mutex
+				owner = make(map[int64]string)
+				short int
+			)
+			for i := 0; i < 24; i++ {
+				wg.Add(1)
+				go func(ref string) {
+					defer wg.Done()
+					picked, err := svc.Send(ref, "101", "1", "2", 1, "test")
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case errors.Is(err, picking.ErrShort):
+						short++
+					case err != nil:
+						t.Errorf("%s: %v", ref, err)
+					}
+					for _, d := range picked {
+						if prev, ok := owner[d.ID]; ok {
+							t.Errorf("detail %d taken by %s and %s", d.ID, prev, ref)
+						}
+						owner[d.ID] = ref
+					}
+				}(fmt.Sprint("T", i))
+			}
+			wg.Wait()
+
+			if len(owner) != 8 || short != 16 {
+				t.Errorf("%d details taken and %d transfers short, want 8 and 16", len(owner), short)
+			}
+			l := &ledger.Ledger{Store: st}
+			from, err := l.Position("101", "1")
+			must(t, err)
+			to, err := l.Position("101", "2")
+			must(t, err)
+			if from.OnHand != 0 || to.InTransit != scan.NewQty(8) {
+				t.Errorf("on hand in 1 = %s, in transit to 2 = %s; want 0 and 8", from.OnHand, to.InTransit)
+			}
+		})
+	}
+}
+
+// TestSendIsAtomic breaks the ledger: the details a failed Send reserved
+// must stay available
+func TestSendIsAtomic(t *testing.T) {
+	db := testdb.New(t)
+	st := repository.NewSQL(db, testdb.Dialect)
+	setup(t, st, 2)
+	_, err := db.Exec("DROP TABLE yc_stock_ledger")
+	must(t, err)
+
+	svc := &transfer.Service{Store: st}
+	if _, err := svc.Send("T1", "101", "1", "2", 2, "test"); err == nil {
+		t.Fatal("Send succeeded without a ledger")
+	}
+	avail, err := st.Stock.Available("101", "1", -1)
+	must(t, err)
+	if len(avail) != 2 {
+		t.Fatalf("%d details available after a failed Send, want 2", len(avail))
+	}
+	for _, d := range avail {
+		if d.TransferRef != "" || d.PickStrategy != "" {
+			t.Errorf("detail %d kept transfer_ref %q and pick_strategy %q", d.ID, d.TransferRef, d.PickStrategy)
+		}
+	}
+}
+
+func TestSendRejectsQty(t *testing.T) {
+	st := repository.NewMemory()
+	setup(t, st, 1)
+	svc := &transfer.Service{Store: st}
+	for _, n := range []int{0, -1} {
+		if _, err := svc.Send("T1", "101", "1", "2", n, "test"); !errors.Is(err, transfer.ErrQty) {
+			t.Errorf("Send of %d err = %v, want ErrQty", n, err)
+		}
+	}
+}
+
+// TestSendAll sends a transfer slip whose last line cannot be sent: the
+// lines before it must not stay reserved or in transit
+func TestSendAll(t *testing.T) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			st := open(t)
+			setup(t, st, 4)
+			svc := &transfer.Service{Store: st}
+			unchanged := func(when string) {
+				t.Helper()
+				avail, err := st.Stock.Available("101", "1", -1)
+				must(t, err)
+				entries, err := st.Ledger.Entries(repository.LedgerFilter{Ref: "T1"})
+				must(t, err)
+				if len(avail) != 4 || len(entries) != 0 {
+					t.Errorf("%s: %d details available and %d ledger entries, want 4 and none", when, len(avail), len(entries))
+				}
+			}
+
+			err := svc.SendAll("T1", []transfer.Line{{Goods: "101", To: "2", Qty: 2}, {Goods: "101", To: "2", Qty: 3}}, "test")
+			if !errors.Is(err, picking.ErrShort) {
+				t.Errorf("SendAll of 5 out of 4: err = %v, want ErrShort", err)
+			}
+			unchanged("after a short line")
+
+			err = svc.SendAll("T1", []transfer.Line{{Goods: "101", To: "2", Qty: 2}, {Goods: "101", To: "2", Qty: -1}}, "test")
+			if !errors.Is(err, transfer.ErrQty) {
+				t.Errorf("SendAll with a negative line: err = %v, want ErrQty", err)
+			}
+			unchanged("after a negative line")
+
+			lines := []transfer.Line{
+				{Goods: "101", To: "2", Qty: 3},
+				{Goods: "101", To: "2", Qty: 0},
+				{Goods: "", To: "2", Qty: 5},
+				{Goods: "101", To: "", Qty: 5},
+				// a source warehouse takes no stock from another
+				{Goods: "101", To: "1", Qty: 5},
+			}
+			must(t, svc.SendAll("T1", lines, "test"))
+			taken, err := st.Stock.Transferred("T1")
+			must(t, err)
+			if len(taken) != 3 {
+				t.Errorf("SendAll took %d details, want 3", len(taken))
+			}
+		})
+	}
+}
+
+// send transfers n details of goods 101 from warehouse 1 to warehouse 2
+// as transfer ref, with its stock record in warehouse 2
+func send(t *testing.T, st *repository.Store, ref string, n int) {
+	t.Helper()
+	must(t, st.Stock.Create(&repository.Stock{Stock: ref, Goods: "101", Warehouse: "2", ArrivalDt: civil.MustParse("2026-10-20"), TransferFg: true}, nil))
+	_, err := (&transfer.Service{Store: st}).Send(ref, "101", "1", "2", n, "test")
+	must(t, err)
+}
+
+// TestCancel cancels a transfer twice: the first gives the details back,
+// reverses the ledger and records one cancellation, the second finds no
+// transfer and records nothing
+func TestCancel(t *testing.T) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			st := open(t)
+			setup(t, st, 4)
+			send(t, st, "T1", 3)
+			svc := &transfer.Service{Store: st}
+
+			if _, err := svc.Cancel("T1", "  ", "clerk"); err != transfer.ErrNoReason {
+				t.Errorf("Cancel without a reason: err = %v, want ErrNoReason", err)
+			}
+			if _, err := svc.Cancel("S1", "wrong", "clerk"); !errors.Is(err, transfer.ErrNotTransfer) {
+				t.Errorf("Cancel of a receipt: err = %v, want ErrNotTransfer", err)
+			}
+
+			c, err := svc.Cancel("T1", " sent to the wrong site ", "clerk")
+			must(t, err)
+			want := repository.TransferCancel{Stock: "T1", Released: 3, Reason: "sent to the wrong site", Upuser: "clerk"}
+			if got := *c; got.Stock != want.Stock || got.Released != want.Released || got.Reason != want.Reason || got.Upuser != want.Upuser {
+				t.Errorf("Cancel = %+v, want %+v", got, want)
+			}
+			cancels, err := st.Stock.Cancels("T1")
+			must(t, err)
+			if len(cancels) != 1 {
+				t.Fatalf("%d cancellations recorded, want 1", len(cancels))
+			}
+			if got := cancels[0]; got.Stock != want.Stock || got.Released != want.Released || got.Reason != want.Reason || got.Upuser != want.Upuser || got.Rgdt == "" {
+				t.Errorf("recorded %+v, want %+v with rgdt", got, want)
+			}
+
+			avail, err := st.Stock.Available("101", "1", -1)
+			must(t, err)
+			if len(avail) != 4 {
+				t.Errorf("%d details available after Cancel, want 4", len(avail))
+			}
+			l := &ledger.Ledger{Store: st}
+			from, err := l.Position("101", "1")
+			must(t, err)
+			to, err := l.Position("101", "2")
+			must(t, err)
+			if from.OnHand != scan.NewQty(4) || to.InTransit != 0 {
+				t.Errorf("on hand in 1 = %s, in transit to 2 = %s; want 4 and 0", from.OnHand, to.InTransit)
+			}
+			if _, err := st.Stock.GetStock("T1"); err != repository.ErrNotFound {
+				t.Errorf("stock record of the cancelled transfer: err = %v, want ErrNotFound", err)
+			}
+
+			if _, err := svc.Cancel("T1", "again", "clerk"); err != repository.ErrNotFound {
+				t.Errorf("second Cancel: err = %v, want ErrNotFound", err)
+			}
+			cancels, err = st.Stock.Cancels("T1")
+			must(t, err)
+			if len(cancels) != 1 {
+				t.Errorf("%d cancellations recorded after the second Cancel, want 1", len(cancels))
+			}
+		})
+	}
+}
+
+// TestCancelReceived receives a transfer and then cancels it: the
+// cancellation is refused and changes nothing
+func TestCancelReceived(t *testing.T) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			st := open(t)
+			setup(t, st, 4)
+			send(t, st, "T1", 2)
+			svc := &transfer.Service{Store: st}
+			_, err := svc.Receive("T1", "test")
+			must(t, err)
+
+			if _, err := svc.Cancel("T1", "too late", "clerk"); !errors.Is(err, transfer.ErrReceived) {
+				t.Fatalf("Cancel after Receive: err = %v, want ErrReceived", err)
+			}
+			taken, err := st.Stock.Transferred("T1")
+			must(t, err)
+			cancels, err := st.Stock.Cancels("T1")
+			must(t, err)
+			if len(taken) != 2 || len(cancels) != 0 {
+				t.Errorf("%d details still transferred and %d cancellations, want 2 and none", len(taken), len(cancels))
+			}
+			if _, err := st.Stock.GetStock("T1"); err != nil {
+				t.Errorf("stock record of the received transfer: %v", err)
+			}
+			to, err := (&ledger.Ledger{Store: st}).Position("101", "2")
+			must(t, err)
+			if to.OnHand != scan.NewQty(2) || to.InTransit != 0 {
+				t.Errorf("on hand in 2 = %s, in transit = %s; want 2 and 0", to.OnHand, to.InTransit)
+			}
+		})
+	}
+}
+
+// TestCancelIsAtomic breaks yc_transfer_cancel: a cancellation that
+// cannot be recorded must not give the details back or touch the ledger
+func TestCancelIsAtomic(t *testing.T) {
+	db := testdb.New(t)
+	st := repository.NewSQL(db, testdb.Dialect)
+	setup(t, st, 2)
+	send(t, st, "T1", 2)
+	_, err := db.Exec("DROP TABLE yc_transfer_cancel")
+	must(t, err)
+
+	if _, err := (&transfer.Service{Store: st}).Cancel("T1", "wrong site", "clerk"); err == nil {
+		t.Fatal("Cancel succeeded without yc_transfer_cancel")
+	}
+	taken, err := st.Stock.Transferred("T1")
+	must(t, err)
+	entries, err := st.Ledger.Entries(repository.LedgerFilter{Ref: "T1", Kind: repository.Cancel})
+	must(t, err)
+	if len(taken) != 2 || len(entries) != 0 {
+		t.Errorf("%d details still transferred and %d cancel entries, want 2 and none", len(taken), len(entries))
+	}
+	if _, err := st.Stock.GetStock("T1"); err != nil {
+		t.Errorf("stock record after a failed Cancel: %v", err)
+	}
+}